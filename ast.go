@@ -9,8 +9,9 @@ type AstPackage struct {
 	uninferredGlobals []*ExprVariable
 	uninferredLocals  []Inferrer // VarDecl, StmtShortVarDecl or RangeClause
 	stringLiterals    []*ExprStringLiteral
-	vars              []*DeclVar
+	vars              []*DeclVar // in the order of initialization
 	funcs             []*DeclFunc
+	inits             []*DeclFunc // the init functions in the order of declaration
 	methods           map[identifier]methods
 }
 
@@ -24,9 +25,12 @@ type AstFile struct {
 	uninferredGlobals []*ExprVariable
 	uninferredLocals  []Inferrer // VarDecl, StmtShortVarDecl or RangeClause
 	stringLiterals    []*ExprStringLiteral
+	formatCalls       []*ExprFuncallOrConversion
+	selectors         []Expr
 	dynamicTypes      []*Gtype
 	namedTypes        []*DeclType
 	methods           map[identifier]methods
+	errors            []string
 }
 
 type Expr interface {
@@ -69,16 +73,20 @@ type ExprStringLiteral struct {
 	tok    *Token
 	val    string
 	slabel string
+	used   bool // referred by the emitted code
 }
 
 // local or global variable
 type ExprVariable struct {
-	tok        *Token
-	varname    identifier
-	gtype      *Gtype
-	offset     int // for local variable
-	isGlobal   bool
-	isVariadic bool
+	tok          *Token
+	varname      identifier
+	gtype        *Gtype
+	offset       int // for local variable
+	isGlobal     bool
+	isVariadic   bool
+	heapAddr     *ExprVariable   // holds the address of the variable when it is moved to heap
+	escloc       *escapeLocation // used by escape analysis
+	isInlineCopy bool            // a copy of a param of an inlined callee
 }
 
 type ExprConstVariable struct {
@@ -91,10 +99,12 @@ type ExprConstVariable struct {
 
 // ident( ___ )
 type ExprFuncallOrConversion struct {
-	tok   *Token
-	rel   *Relation
-	fname string
-	args  []Expr
+	tok          *Token
+	rel          *Relation
+	fname        string
+	args         []Expr
+	invisiblevar *ExprVariable // the backing array of makeSlice() which does not escape
+	inlined      *InlinedCall
 }
 
 type ExprMethodcall struct {
@@ -102,6 +112,7 @@ type ExprMethodcall struct {
 	receiver Expr
 	fname    identifier
 	args     []Expr
+	inlined  *InlinedCall
 }
 
 type ExprBinop struct {
@@ -136,6 +147,9 @@ type DeclVar struct {
 	varname  *Relation
 	variable *ExprVariable
 	initval  Expr
+	// the storage of the composite literals in the initializer of a package variable,
+	// which belongs to the init function of the package
+	invisibles []*ExprVariable
 }
 
 type DeclConst struct {
@@ -239,10 +253,17 @@ type DeclFunc struct {
 	rettypes  []*Gtype
 	params    []*ExprVariable
 	localvars []*ExprVariable
-	body      *StmtSatementList
-	stmtDefer *StmtDefer
+	// whether each param escapes, with the receiver first
+	paramEscapes []bool
+	body         *StmtSatementList
+	stmtDefer    *StmtDefer
 	// every function has a defer handler
 	labelDeferHandler string
+	ir                *IrFunc // set if the function is emitted from the IR
+	noinline          bool    // marked by //go:noinline
+	inlineCost        int     // the size of the body for the inliner, or -1 if it can not be inlined. 0 until it is checked
+	dead              bool    // not reachable from main.main nor from any init
+	initIndex         int     // the order of an init function in its package
 }
 
 type TopLevelDecl struct {
@@ -290,6 +311,7 @@ type ExprSliceLiteral struct {
 	gtype        *Gtype
 	values       []Expr
 	invisiblevar *ExprVariable // the underlying array
+	onStack      bool          // the underlying array does not escape
 }
 
 func (e *ExprSliceLiteral) getGtype() *Gtype {
@@ -370,6 +392,15 @@ type ExprStructLiteral struct {
 	strctname    *Relation
 	fields       []*KeyedElement
 	invisiblevar *ExprVariable // to have offfset for &T{}
+	onStack      bool          // &T{} does not escape
+}
+
+// new(T)
+type ExprNew struct {
+	tok          *Token
+	gtype        *Gtype // T
+	invisiblevar *ExprVariable
+	onStack      bool
 }
 
 type ExprStructField struct {
@@ -395,6 +426,11 @@ type ExprTypeSwitchGuard struct {
 	expr Expr
 }
 
+// placeholder for an expression which could not be parsed
+type ExprBad struct {
+	tok *Token
+}
+
 func (node *Relation) token() *Token                  { return node.tok }
 func (node *ExprNilLiteral) token() *Token            { return node.tok }
 func (node *ExprNumberLiteral) token() *Token         { return node.tok }
@@ -441,8 +477,10 @@ func (node *StmtSwitch) token() *Token                { return node.tok }
 func (node *KeyedElement) token() *Token              { return node.tok }
 func (node *ExprStructLiteral) token() *Token         { return node.tok }
 func (node *ExprStructField) token() *Token           { return node.tok }
+func (node *ExprNew) token() *Token                   { return node.tok }
 func (node *ExprTypeSwitchGuard) token() *Token       { return node.tok }
 func (node *ExprMapLiteral) token() *Token            { return node.tok }
 func (node *ExprLen) token() *Token                   { return node.tok }
 func (node *ExprCap) token() *Token                   { return node.tok }
 func (node *ExprConversionToInterface) token() *Token { return node.tok }
+func (node *ExprBad) token() *Token                   { return node.tok }
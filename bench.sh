@@ -0,0 +1,20 @@
+#!/bin/bash
+# Benchmark: the CPU time for the 2nd gen compiler to compile itself.
+# It prints the best of several runs in seconds.
+set -e
+runs=${1:-5}
+
+make minigo2 > /dev/null
+
+TIMEFORMAT=%3U
+best=""
+for i in $(seq $runs)
+do
+    t=$( { time ./minigo2 -S *.go > /dev/null; } 2>&1 )
+    ms=$((10#${t/./}))
+    if [[ -z $best || $ms -lt $best ]]; then
+        best=$ms
+    fi
+done
+
+printf "self-compile: %d.%03ds user (best of %d)\n" $((best / 1000)) $((best % 1000)) $runs
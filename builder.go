@@ -1,60 +1,62 @@
 // builder builds packages
 package main
 
-// analyze imports of given go files
-func parseImports(sourceFiles []string) []string {
-
-	// "fmt" depends on "os. So inject it in advance.
-	// Actually, dependency graph should be analyzed.
-	var imported []string = []string{"os"}
-	for _, sourceFile := range sourceFiles {
-		p := &parser{}
-		astFile := p.parseFile(sourceFile, nil, true)
-		for _, importDecl := range astFile.importDecls {
-			for _, spec := range importDecl.specs {
-				baseName := getBaseNameFromImport(spec.path)
-				if !in_array(baseName, imported) {
-					imported = append(imported, baseName)
-				}
-			}
-		}
-	}
+import (
+	"fmt"
+	"os"
+)
 
-	return imported
+// inject builtin functions into the universe scope
+// They are implemented with internal ones.
+func compileUniverse(universe *Scope, internal *Scope) *AstPackage {
+	return parseInternalPackage("", "universe", internalUniverseCode, universe, internal)
 }
 
-// inject builtin functions into the universe scope
-func compileUniverse(universe *Scope) *AstPackage {
-	p := &parser{
-		packageName: "",
-	}
-	f := p.parseString("internal_universe.go", internalUniverseCode, universe, false)
+// inject runtime things into the internal scope
+func compileRuntime(internal *Scope) *AstPackage {
+	return parseInternalPackage("iruntime", "runtime", internalRuntimeCode, internal, internal)
+}
 
-	//debugf("len p.methods = %d", len(p.methods))
-	resolveMethods(f.methods, p.packageBlockScope)
-	inferTypes(f.uninferredGlobals, f.uninferredLocals)
-	return &AstPackage{
-		name:           "",
-		files:          []*AstFile{f},
-		stringLiterals: f.stringLiterals,
-		dynamicTypes:   f.dynamicTypes,
+// parseInternalPackage parses the files of internal/name in the root into a scope,
+// or the embedded copy if no root is set.
+// The names which it does not declare are resolved in the internal scope.
+func parseInternalPackage(pkgname identifier, name string, embedded string, scope *Scope, internal *Scope) *AstPackage {
+	var files []*AstFile
+	var sources []string = rootFiles("internal/" + name)
+	if len(sources) == 0 {
+		p := &parser{
+			packageName: pkgname,
+		}
+		files = append(files, p.parseString("internal_"+name+".go", embedded, scope, false))
+	}
+	for _, source := range sources {
+		p := &parser{
+			packageName: pkgname,
+		}
+		files = append(files, p.parseFile(source, scope, false))
 	}
-}
 
-// inject runtime things into the universe scope
-func compileRuntime(universe *Scope) *AstPackage {
-	p := &parser{
-		packageName: "iruntime",
+	pkg := &AstPackage{
+		name:  pkgname,
+		files: files,
+	}
+	if len(sources) > 0 {
+		reportErrors(pkg)
 	}
-	f := p.parseString("internal_runtime.go", internalRuntimeCode, universe, false)
-	resolveMethods(f.methods, p.packageBlockScope)
-	inferTypes(f.uninferredGlobals, f.uninferredLocals)
-	return &AstPackage{
-		name:           "",
-		files:          []*AstFile{f},
-		stringLiterals: f.stringLiterals,
-		dynamicTypes:   f.dynamicTypes,
+	for _, f := range files {
+		for _, rel := range f.unresolved {
+			resolve(internal, rel)
+		}
+		resolveMethods(f.methods, scope)
+		inferTypes(f.uninferredGlobals, f.uninferredLocals)
+		for _, sl := range f.stringLiterals {
+			pkg.stringLiterals = append(pkg.stringLiterals, sl)
+		}
+		for _, dt := range f.dynamicTypes {
+			pkg.dynamicTypes = append(pkg.dynamicTypes, dt)
+		}
 	}
+	return pkg
 }
 
 func compileMainPackage(universe *Scope, sourceFiles []string) *AstPackage {
@@ -64,12 +66,16 @@ func compileMainPackage(universe *Scope, sourceFiles []string) *AstPackage {
 		if debugAst {
 			mainPkg.dump()
 		}
+		reportErrors(mainPkg)
 		return nil
 	}
+	reportErrors(mainPkg)
 	resolveInPackage(mainPkg, universe)
 	resolveMethods(mainPkg.methods, mainPkg.scope)
 	allScopes[mainPkg.name] = mainPkg.scope
 	inferTypes(mainPkg.uninferredGlobals, mainPkg.uninferredLocals)
+	reportErrorList(mainPkg, checkFormatCalls(mainPkg))
+	reportErrorList(mainPkg, checkExports(mainPkg))
 	if debugAst {
 		mainPkg.dump()
 	}
@@ -81,31 +87,217 @@ func compileMainPackage(universe *Scope, sourceFiles []string) *AstPackage {
 }
 
 // parse standard libraries
-func compileStdLibs(universe *Scope, imported []string) *compiledStdlib {
+// They can use the internal scope.
+func compileStdLibs(internal *Scope, imported []*sourcePackage) *compiledStdlib {
 	var libs *compiledStdlib = &compiledStdlib{
 		compiledPackages:         map[identifier]*AstPackage{},
 		uniqImportedPackageNames: nil,
 	}
-	stdPkgs := makeStdLib()
 
-	for _, spkgName := range imported {
-		pkgName := identifier(spkgName)
-		pkgCode, ok := stdPkgs[pkgName]
-		if !ok {
-			errorf("package '" + spkgName + "' is not a standard library.")
-		}
-		var codes []string = []string{pkgCode}
-		pkg := ParseSources(pkgName, codes, true)
-		resolveInPackage(pkg, universe)
-		resolveMethods(pkg.methods, pkg.scope)
-		allScopes[pkgName] = pkg.scope
-		inferTypes(pkg.uninferredGlobals, pkg.uninferredLocals)
+	for _, spkg := range imported {
+		pkg := parseSourcePackage(spkg)
+		analyzePackage(pkg, internal)
 		libs.AddPackage(pkg)
 	}
 
 	return libs
 }
 
+// parseSourcePackage parses the files of a package, or its embedded code
+func parseSourcePackage(spkg *sourcePackage) *AstPackage {
+	if spkg.code != "" {
+		var codes []string = []string{spkg.code}
+		return ParseSources(spkg.name, codes, true)
+	}
+	return ParseSources(spkg.name, spkg.files, false)
+}
+
+// parse the packages of the module in the order of dependencies
+// Like the main package, they can use only the universe scope.
+func compileModulePackages(universe *Scope, libs *compiledStdlib, pkgs []*sourcePackage) {
+	for _, spkg := range pkgs {
+		checkPackageName(spkg)
+		pkg := ParseSources(spkg.name, spkg.files, false)
+		analyzePackage(pkg, universe)
+		libs.AddPackage(pkg)
+	}
+}
+
+func checkPackageName(spkg *sourcePackage) {
+	if _, ok := allScopes[spkg.name]; ok {
+		errorft(spkg.tok, "package %s (%s) conflicts with another package of the same name", string(spkg.name), spkg.path)
+	}
+}
+
+// analyzePackage resolves the names of a parsed package and checks it
+func analyzePackage(pkg *AstPackage, outer *Scope) {
+	reportErrors(pkg)
+	resolveInPackage(pkg, outer)
+	resolveMethods(pkg.methods, pkg.scope)
+	allScopes[pkg.name] = pkg.scope
+	inferTypes(pkg.uninferredGlobals, pkg.uninferredLocals)
+	reportErrorList(pkg, checkFormatCalls(pkg))
+	reportErrorList(pkg, checkExports(pkg))
+}
+
+// loadExportData loads the declarations of a package compiled before
+func loadExportData(spkg *sourcePackage, file string, outer *Scope) *AstPackage {
+	pkg := ParseExportData(spkg.name, file)
+	reportErrors(pkg)
+	resolveInPackage(pkg, outer)
+	resolveMethods(pkg.methods, pkg.scope)
+	allScopes[pkg.name] = pkg.scope
+	inferTypes(pkg.uninferredGlobals, pkg.uninferredLocals)
+	return pkg
+}
+
+// compileObject writes the assembly of the object of a package,
+// or of the runtime if spkg is nil.
+// The packages it imports are loaded from their export data in the cache.
+func compileObject(c *buildCache, ld *packageLoader, spkg *sourcePackage, asmFile string) *AstPackage {
+	universe := newUniverse()
+	internal := newInternalScope(universe)
+	u := compileUniverse(universe, internal)
+	r := compileRuntime(internal)
+	allScopes = map[identifier]*Scope{}
+
+	var pkg *AstPackage
+	var root *IrRoot
+	if spkg == nil {
+		pkg = r
+		var noInits []*AstPackage
+		root = newIrRoot([]*AstPackage{u, r}, noInits)
+		root.withRuntime = true
+	} else {
+		// the runtime first, and then every package after the packages it imports
+		var initOrder []*AstPackage = []*AstPackage{r}
+		var deps []*sourcePackage = ld.dependencyOrder([]*sourcePackage{spkg})
+		for _, dep := range deps {
+			if dep == spkg {
+				continue
+			}
+			checkPackageName(dep)
+			outer := universe
+			if dep.std {
+				outer = internal
+			}
+			initOrder = append(initOrder, loadExportData(dep, c.exportFile(dep), outer))
+		}
+		checkPackageName(spkg)
+		if spkg.name == "main" {
+			pkg = compileMainPackage(universe, spkg.files)
+		} else if spkg.std {
+			pkg = parseSourcePackage(spkg)
+			analyzePackage(pkg, internal)
+		} else {
+			pkg = parseSourcePackage(spkg)
+			analyzePackage(pkg, universe)
+		}
+		initOrder = append(initOrder, pkg)
+		root = newIrRoot([]*AstPackage{pkg}, initOrder)
+		root.withMain = pkg.name == "main"
+	}
+	root.separate = true
+	analyzeEscapes(root, pkg)
+	inlineCalls(root, pkg)
+	eliminateDeadCode(root, pkg)
+	lowerFuncs(root, pkg)
+
+	f, err := os.Create(asmFile)
+	if err != nil {
+		errorf("%s", err.Error())
+	}
+	asmOut = f
+	root.emit()
+	f.Close()
+	return pkg
+}
+
+// buildPackages compiles the runtime, the roots and the packages they import
+// into the build cache, except the ones compiled before.
+func buildPackages(ld *packageLoader, roots []*sourcePackage) *buildCache {
+	c := openBuildCache()
+	c.build(ld, nil, c.runtimeKey(), false)
+	var pkgs []*sourcePackage = ld.dependencyOrder(roots)
+	for _, spkg := range pkgs {
+		key := c.packageKey(spkg)
+		c.keys[spkg.path] = key
+		var isRoot bool
+		for _, root := range roots {
+			if root == spkg {
+				isRoot = true
+			}
+		}
+		// -m prints the decisions of the packages on the command line.
+		// They are not kept in the cache, so the packages are compiled again.
+		c.build(ld, spkg, key, printEscapes && isRoot)
+	}
+	return c
+}
+
+// build compiles a package into the cache unless it is there,
+// or always if its decisions are printed.
+// The object is stored last, which tells the package is complete.
+func (c *buildCache) build(ld *packageLoader, spkg *sourcePackage, key string, printDecisions bool) {
+	objFile := c.objFile(key)
+	c.objFiles = append(c.objFiles, objFile)
+	if fileExists(objFile) && !printDecisions {
+		return
+	}
+	name := "runtime"
+	if spkg != nil {
+		name = spkg.path
+	}
+	if verboseBuild {
+		var b []byte = []byte(name + "\n")
+		os.Stderr.Write(b)
+	}
+	// builds running at the same time write their own files
+	tmp := fmt.Sprintf("%s/%s.tmp%d", c.dir, key, os.Getpid())
+	flagM := printEscapes
+	printEscapes = printDecisions
+	pkg := compileObject(c, ld, spkg, tmp+".s")
+	printEscapes = flagM
+	if spkg != nil && pkg.name != "main" {
+		writeExportData(pkg, ld.packagePaths(), tmp+".x")
+		err := os.Rename(tmp+".x", c.dir+"/"+key+".x")
+		if err != nil {
+			errorf("cannot write the export data of %s", name)
+		}
+	}
+	var args []string = []string{"-o", tmp + ".o", tmp + ".s"}
+	if runTool("as", args) != 0 {
+		os.Exit(1)
+	}
+	os.Remove(tmp + ".s")
+	err := os.Rename(tmp+".o", objFile)
+	if err != nil {
+		errorf("cannot write the object of %s", name)
+	}
+}
+
+// report all the errors found while parsing a package at once
+func reportErrors(pkg *AstPackage) {
+	var errors []string
+	for _, f := range pkg.files {
+		for _, s := range f.errors {
+			errors = append(errors, s)
+		}
+	}
+	reportErrorList(pkg, errors)
+}
+
+func reportErrorList(pkg *AstPackage, errors []string) {
+	for _, s := range errors {
+		line := s + "\n"
+		var b []byte = []byte(line)
+		os.Stderr.Write(b)
+	}
+	if len(errors) > 0 {
+		errorf("%d errors in package %s", len(errors), pkg.name)
+	}
+}
+
 type compiledStdlib struct {
 	compiledPackages         map[identifier]*AstPackage
 	uniqImportedPackageNames []string
@@ -54,10 +54,11 @@ func (bs *ByteStream) get() (byte, error) {
 	r := bs.source[bs.nextIndex]
 	if r == '\n' {
 		bs.line++
-		bs.column = 1
+		bs.column = 0
+	} else {
+		bs.column++
 	}
 	bs.nextIndex++
-	bs.column++
 	return r, nil
 }
 
@@ -66,5 +67,7 @@ func (bs *ByteStream) unget() {
 	r := bs.source[bs.nextIndex]
 	if r == '\n' {
 		bs.line--
+	} else {
+		bs.column--
 	}
 }
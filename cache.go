@@ -0,0 +1,132 @@
+// the build cache keeps the object and the export data of each compiled package
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var verboseBuild bool // -v: print the packages as they are compiled
+
+// buildCache finds compiled packages by the SHA-256 of their contents.
+// A package is stored as <key>.o and <key>.x, which is its export data.
+type buildCache struct {
+	dir      string
+	toolKey  string            // the hash of the compiler and the flags
+	keys     map[string]string // the keys of the packages by import path
+	objFiles []string          // the objects to link, the runtime first
+}
+
+func openBuildCache() *buildCache {
+	dir := os.Getenv("MINIGOCACHE")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			errorf("neither $MINIGOCACHE nor $HOME is set")
+		}
+		dir = home + "/.cache/minigo"
+	}
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		errorf("cannot make the build cache: %s", err.Error())
+	}
+	return &buildCache{
+		dir:     dir,
+		toolKey: compilerKey(),
+		keys:    map[string]string{},
+	}
+}
+
+// compilerKey identifies the executable of the compiler and the flags which change the code
+func compilerKey() string {
+	h := newHasher()
+	exe, _ := ioutil.ReadFile("/proc/self/exe")
+	h.writeBytes(exe)
+	h.write(fmt.Sprintf("peephole=%s inline=%s dwarf=%s",
+		bool2string(peepholeEnabled), bool2string(inlineEnabled), bool2string(dwarfEnabled)))
+	h.write(fmt.Sprintf("budget=%d growth=%d", inlineBudget, inlineGrowth))
+	return h.sum()
+}
+
+// packageKey is the key of a package, which depends on its sources and
+// the keys of the packages it imports
+func (c *buildCache) packageKey(spkg *sourcePackage) string {
+	h := newHasher()
+	h.write(c.toolKey)
+	h.write(spkg.path)
+	if spkg.code != "" {
+		h.write(spkg.code)
+	}
+	for _, file := range spkg.files {
+		h.write(file)
+		src, _ := ioutil.ReadFile(file)
+		h.writeBytes(src)
+	}
+	for _, imported := range spkg.imports {
+		h.write(c.keys[imported.path])
+	}
+	return h.sum()
+}
+
+// runtimeKey is the key of the object of the universe and the runtime
+func (c *buildCache) runtimeKey() string {
+	h := newHasher()
+	h.write(c.toolKey)
+	h.write("runtime")
+	var files []string = rootFiles("internal/universe")
+	var runtimeFiles []string = rootFiles("internal/runtime")
+	for _, file := range runtimeFiles {
+		files = append(files, file)
+	}
+	for _, file := range files {
+		h.write(file)
+		src, _ := ioutil.ReadFile(file)
+		h.writeBytes(src)
+	}
+	return h.sum()
+}
+
+func (c *buildCache) objFile(key string) string {
+	return c.dir + "/" + key + ".o"
+}
+
+func (c *buildCache) exportFile(spkg *sourcePackage) string {
+	return c.dir + "/" + c.keys[spkg.path] + ".x"
+}
+
+// hasher makes the SHA-256 of a sequence of strings
+type hasher struct {
+	digest *sha256Digest
+}
+
+func newHasher() *hasher {
+	return &hasher{
+		digest: newSha256(),
+	}
+}
+
+// write hashes the length of a string before it, so that "ab","c" differs from "a","bc"
+func (h *hasher) write(s string) {
+	h.writeLength(len(s))
+	for i := 0; i < len(s); i++ {
+		h.digest.writeByte(s[i])
+	}
+}
+
+func (h *hasher) writeBytes(b []byte) {
+	h.writeLength(len(b))
+	for i := 0; i < len(b); i++ {
+		h.digest.writeByte(b[i])
+	}
+}
+
+func (h *hasher) writeLength(n int) {
+	for i := 7; i >= 0; i-- {
+		h.digest.writeByte(byte(n >> (8 * i) & 0xff))
+	}
+}
+
+func (h *hasher) sum() string {
+	return h.digest.sum()
+}
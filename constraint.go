@@ -0,0 +1,241 @@
+// build constraints select the files of a package like the go command
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// the tags which are satisfied in a build by minigo.
+// Go release tags from go1.1 up to go1.10 are satisfied too.
+var buildTags []string = []string{"linux", "amd64", "unix", "minigo"}
+
+// the last Go 1 release whose language minigo compiles
+const goReleaseMinor int = 10
+
+var knownOS []string = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "js",
+	"linux", "nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows", "zos",
+}
+
+var knownArch []string = []string{
+	"386", "amd64", "amd64p32", "arm", "armbe", "arm64", "arm64be", "loong64",
+	"mips", "mipsle", "mips64", "mips64le", "mips64p32", "mips64p32le",
+	"ppc", "ppc64", "ppc64le", "riscv", "riscv64", "s390", "s390x", "sparc", "sparc64", "wasm",
+}
+
+// shouldBuild reports whether a .go file belongs to its package in this build.
+// Hidden and test files, files for other systems by their names and
+// files whose //go:build line is not satisfied are left out.
+func shouldBuild(path string) bool {
+	if path == "/dev/stdin" {
+		return true
+	}
+	if !matchFileName(baseName(path)) {
+		return false
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		// the parser reports it
+		return true
+	}
+	p := findBuildLine(path, string(src))
+	if p == nil {
+		return true
+	}
+	return p.eval()
+}
+
+// matchFileName skips names beginning with . or _, and checks
+// the suffixes _test, _GOOS, _GOARCH and _GOOS_GOARCH of a file name.
+func matchFileName(name string) bool {
+	if name[0] == '.' || name[0] == '_' {
+		return false
+	}
+	name = name[0 : len(name)-len(".go")]
+	if strings.HasSuffix(name, "_test") {
+		return false
+	}
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return true
+	}
+	var elems []string = strings.Split(name[i:len(name)], "_")
+	n := len(elems)
+	if n >= 2 && in_array(elems[n-2], knownOS) && in_array(elems[n-1], knownArch) {
+		return elems[n-2] == "linux" && elems[n-1] == "amd64"
+	}
+	if in_array(elems[n-1], knownOS) {
+		return elems[n-1] == "linux"
+	}
+	if in_array(elems[n-1], knownArch) {
+		return elems[n-1] == "amd64"
+	}
+	return true
+}
+
+// findBuildLine finds the //go:build line in the header of a file,
+// which is the comments before the package clause up to the last blank line.
+// It returns nil if there is none.
+func findBuildLine(path string, src string) *constraintParser {
+	var found *constraintParser
+	var pending *constraintParser
+	var lines []string = strings.Split(src, "\n")
+	inComment := false
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if inComment {
+			if strings.Contains(line, "*/") {
+				inComment = false
+			}
+			continue
+		}
+		if line == "" {
+			if pending != nil {
+				found = pending
+				pending = nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "/*") {
+			inComment = !strings.Contains(line[2:len(line)], "*/")
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		if !isBuildLine(line) {
+			continue
+		}
+		if found != nil || pending != nil {
+			buildLineError(path, i+1, "multiple //go:build comments")
+		}
+		pending = &constraintParser{
+			path:   path,
+			lineno: i + 1,
+			s:      line[len("//go:build"):len(line)],
+		}
+	}
+	return found
+}
+
+func isBuildLine(line string) bool {
+	if !strings.HasPrefix(line, "//go:build") {
+		return false
+	}
+	if len(line) == len("//go:build") {
+		return true
+	}
+	c := line[len("//go:build")]
+	return c == ' ' || c == '\t'
+}
+
+func buildLineError(path string, lineno int, msg string) {
+	var errors []string = []string{fmt.Sprintf("%s:%d: %s", path, lineno, msg)}
+	reportLoadErrors(errors)
+}
+
+// constraintParser evaluates the expression of a //go:build line.
+//
+//	expr = and { "||" and }
+//	and  = not { "&&" not }
+//	not  = "!" not | "(" expr ")" | tag
+type constraintParser struct {
+	path   string
+	lineno int
+	s      string
+	pos    int
+}
+
+func (p *constraintParser) eval() bool {
+	r := p.or()
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		p.error()
+	}
+	return r
+}
+
+func (p *constraintParser) or() bool {
+	r := p.and()
+	for p.accept("||") {
+		right := p.and()
+		r = r || right
+	}
+	return r
+}
+
+func (p *constraintParser) and() bool {
+	r := p.not()
+	for p.accept("&&") {
+		right := p.not()
+		r = r && right
+	}
+	return r
+}
+
+func (p *constraintParser) not() bool {
+	if p.accept("!") {
+		r := p.not()
+		return !r
+	}
+	if p.accept("(") {
+		r := p.or()
+		if !p.accept(")") {
+			p.error()
+		}
+		return r
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isTagChar(p.s[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		p.error()
+	}
+	return matchTag(p.s[start:p.pos])
+}
+
+func (p *constraintParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *constraintParser) accept(op string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:len(p.s)], op) {
+		p.pos = p.pos + len(op)
+		return true
+	}
+	return false
+}
+
+func (p *constraintParser) error() {
+	buildLineError(p.path, p.lineno, "invalid //go:build expression: "+strings.TrimSpace(p.s))
+}
+
+func isTagChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '_' || c == '.'
+}
+
+func matchTag(tag string) bool {
+	if in_array(tag, buildTags) {
+		return true
+	}
+	if !strings.HasPrefix(tag, "go1.") || len(tag) == len("go1.") {
+		return false
+	}
+	var minor int
+	for i := len("go1."); i < len(tag); i++ {
+		if tag[i] < '0' || '9' < tag[i] {
+			return false
+		}
+		minor = minor*10 + int(tag[i]) - '0'
+		if minor > goReleaseMinor {
+			return false
+		}
+	}
+	return minor >= 1
+}
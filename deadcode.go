@@ -0,0 +1,336 @@
+// Dead code elimination.
+// Only the functions reachable from main.main, the package inits and the
+// runtime are emitted. A method is reachable either by a static call, or by
+// an interface method call of its name when its receiver type may be
+// converted to an interface in reachable code.
+// String literals and dynamic types are marked as used when they are emitted,
+// so those only referred by dead functions are dropped as well.
+package main
+
+// functions which the code generator calls without a call in the source
+var runtimeRoots = []string{
+	"iruntime.append1",
+	"iruntime.append8",
+	"iruntime.append16",
+	"iruntime.append24",
+	"iruntime.makeSlice",
+	"iruntime.cmpstrings",
+	"iruntime.copybytes",
+	"iruntime.cstring",
+	"iruntime.eqstrings",
+	"iruntime.gcCollect",
+	"iruntime.malloc",
+	"iruntime.mallocNoscan",
+	"iruntime.mallocTyped",
+	".panic",
+}
+
+type deadcodeMarker struct {
+	queue            []*DeclFunc
+	methods          []*DeclFunc // all the methods
+	convertedTypeIds []int       // receiverTypeIds of the types which may be converted to interfaces
+	calledNames      []string    // names of interface method calls
+}
+
+func eliminateDeadCode(root *IrRoot, mainPkg *AstPackage) {
+	m := &deadcodeMarker{}
+	var funcs []*DeclFunc
+	for _, pkg := range root.packages {
+		for _, fn := range pkg.funcs {
+			fn.dead = true
+			funcs = append(funcs, fn)
+			if fn.receiver != nil {
+				m.methods = append(m.methods, fn)
+			}
+		}
+	}
+
+	mainSymbol := getFuncSymbol(mainPkg.name, "main")
+	for _, fn := range funcs {
+		if fn.receiver != nil {
+			continue
+		}
+		symbol := fn.getSymbol()
+		if fn.fname == "init" || symbol == mainSymbol || in_array(symbol, runtimeRoots) {
+			m.mark(fn)
+		}
+	}
+	if root.separate {
+		// the objects of other packages may refer to any of them
+		for _, fn := range funcs {
+			m.mark(fn)
+		}
+	}
+	for _, pkg := range root.packages {
+		for _, vardecl := range pkg.vars {
+			m.value(vardecl.initval)
+		}
+	}
+
+	// the queue grows while it is walked
+	for i := 0; i < len(m.queue); i++ {
+		fn := m.queue[i]
+		m.stmt(fn.body)
+	}
+}
+
+// getReceiverTypeId returns the receiverTypeId of a named type or a pointer to it, or 0
+func getReceiverTypeId(gtype *Gtype) int {
+	if gtype == nil {
+		return 0
+	}
+	if gtype.kind == G_POINTER {
+		gtype = gtype.origType
+	}
+	if gtype == nil || gtype.kind != G_NAMED || gtype.relation == nil || gtype.relation.gtype == nil {
+		return 0
+	}
+	return gtype.relation.gtype.receiverTypeId
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *deadcodeMarker) mark(fn *DeclFunc) {
+	if !fn.dead {
+		return
+	}
+	fn.dead = false
+	m.queue = append(m.queue, fn)
+}
+
+// A value is converted to an interface implicitly when it is assigned,
+// passed or returned, or put in a composite literal.
+// Every such value is taken as converted, whatever the type of its destination is.
+func (m *deadcodeMarker) value(e Expr) {
+	if e == nil {
+		return
+	}
+	m.markConvertedType(e.getGtype())
+	m.expr(e)
+}
+
+func (m *deadcodeMarker) values(list []Expr) {
+	for _, e := range list {
+		m.value(e)
+	}
+}
+
+// the methods of a converted type can be called by the interface method calls so far
+func (m *deadcodeMarker) markConvertedType(gtype *Gtype) {
+	typeId := getReceiverTypeId(gtype)
+	if typeId == 0 || containsInt(m.convertedTypeIds, typeId) {
+		return
+	}
+	m.convertedTypeIds = append(m.convertedTypeIds, typeId)
+	for _, method := range m.methods {
+		if getReceiverTypeId(method.receiver.getGtype()) != typeId {
+			continue
+		}
+		if in_array(string(method.fname), m.calledNames) {
+			m.mark(method)
+		}
+	}
+}
+
+// an interface method call can reach the method of every converted type
+func (m *deadcodeMarker) markMethodName(name identifier) {
+	if in_array(string(name), m.calledNames) {
+		return
+	}
+	m.calledNames = append(m.calledNames, string(name))
+	for _, method := range m.methods {
+		if method.fname != name {
+			continue
+		}
+		if containsInt(m.convertedTypeIds, getReceiverTypeId(method.receiver.getGtype())) {
+			m.mark(method)
+		}
+	}
+}
+
+func (m *deadcodeMarker) stmt(s Stmt) {
+	if s == nil {
+		return
+	}
+	switch s.(type) {
+	case *StmtSatementList:
+		list := s.(*StmtSatementList)
+		if list == nil {
+			return
+		}
+		for _, stmt := range list.stmts {
+			m.stmt(stmt)
+		}
+	case *DeclVar:
+		m.value(s.(*DeclVar).initval)
+	case *StmtShortVarDecl:
+		decl := s.(*StmtShortVarDecl)
+		m.exprs(decl.lefts)
+		// the new variables have the types of the values
+		m.exprs(decl.rights)
+	case *StmtAssignment:
+		assignment := s.(*StmtAssignment)
+		m.exprs(assignment.lefts)
+		m.values(assignment.rights)
+	case *StmtExpr:
+		m.expr(s.(*StmtExpr).expr)
+	case *StmtInc:
+		m.expr(s.(*StmtInc).operand)
+	case *StmtDec:
+		m.expr(s.(*StmtDec).operand)
+	case *StmtReturn:
+		m.values(s.(*StmtReturn).exprs)
+	case *StmtDefer:
+		m.expr(s.(*StmtDefer).expr)
+	case *StmtIf:
+		stmtIf := s.(*StmtIf)
+		m.stmt(stmtIf.simplestmt)
+		m.expr(stmtIf.cond)
+		m.stmt(stmtIf.then)
+		m.stmt(stmtIf.els)
+	case *StmtFor:
+		stmtFor := s.(*StmtFor)
+		if stmtFor.rng != nil {
+			m.expr(stmtFor.rng.rangeexpr)
+		}
+		if stmtFor.cls != nil {
+			m.stmt(stmtFor.cls.init)
+			m.stmt(stmtFor.cls.cond)
+			m.stmt(stmtFor.cls.post)
+		}
+		m.stmt(stmtFor.block)
+	case *StmtSwitch:
+		stmtSwitch := s.(*StmtSwitch)
+		m.expr(stmtSwitch.cond)
+		for _, cse := range stmtSwitch.cases {
+			m.exprs(cse.exprs)
+			m.stmt(cse.compound)
+		}
+		m.stmt(stmtSwitch.dflt)
+	case *ExprBinop:
+		// the condition of a for statement
+		m.expr(s.(*ExprBinop))
+	case *ExprUop:
+		m.expr(s.(*ExprUop))
+	case *ExprFuncallOrConversion:
+		m.expr(s.(*ExprFuncallOrConversion))
+	case *ExprMethodcall:
+		m.expr(s.(*ExprMethodcall))
+	}
+}
+
+func (m *deadcodeMarker) exprs(list []Expr) {
+	for _, e := range list {
+		m.expr(e)
+	}
+}
+
+func (m *deadcodeMarker) expr(x Expr) {
+	if x == nil {
+		return
+	}
+	switch x.(type) {
+	case *Relation:
+		// a function used as a value
+		rel := x.(*Relation)
+		if rel.expr == nil {
+			return
+		}
+		funcref, ok := rel.expr.(*ExprFuncRef)
+		if ok {
+			m.mark(funcref.funcdef)
+		}
+	case *ExprFuncRef:
+		m.mark(x.(*ExprFuncRef).funcdef)
+	case *ExprUop:
+		m.expr(x.(*ExprUop).operand)
+	case *ExprBinop:
+		binop := x.(*ExprBinop)
+		m.expr(binop.left)
+		m.expr(binop.right)
+	case *ExprStructLiteral:
+		for _, field := range x.(*ExprStructLiteral).fields {
+			m.value(field.value)
+		}
+	case *ExprSliceLiteral:
+		m.values(x.(*ExprSliceLiteral).values)
+	case *ExprArrayLiteral:
+		m.values(x.(*ExprArrayLiteral).values)
+	case *ExprMapLiteral:
+		for _, element := range x.(*ExprMapLiteral).elements {
+			m.value(element.key)
+			m.value(element.value)
+		}
+	case *ExprStructField:
+		m.expr(x.(*ExprStructField).strct)
+	case *ExprIndex:
+		index := x.(*ExprIndex)
+		m.expr(index.collection)
+		m.expr(index.index)
+	case *ExprSlice:
+		slice := x.(*ExprSlice)
+		m.expr(slice.collection)
+		m.expr(slice.low)
+		m.expr(slice.high)
+		m.expr(slice.max)
+	case *ExprLen:
+		m.expr(x.(*ExprLen).arg)
+	case *ExprCap:
+		m.expr(x.(*ExprCap).arg)
+	case *ExprConversion:
+		m.value(x.(*ExprConversion).expr)
+	case *ExprConversionToInterface:
+		m.value(x.(*ExprConversionToInterface).expr)
+	case *ExprTypeAssertion:
+		m.expr(x.(*ExprTypeAssertion).expr)
+	case *ExprTypeSwitchGuard:
+		m.expr(x.(*ExprTypeSwitchGuard).expr)
+	case *ExprVaArg:
+		m.value(x.(*ExprVaArg).expr)
+	case *ExprFuncallOrConversion:
+		funcall := x.(*ExprFuncallOrConversion)
+		if funcall.inlined != nil {
+			m.inlined(funcall.inlined)
+			return
+		}
+		m.values(funcall.args)
+		if funcall.rel.expr == nil {
+			// conversion
+			return
+		}
+		funcref, ok := funcall.rel.expr.(*ExprFuncRef)
+		if ok {
+			m.mark(funcref.funcdef)
+		}
+	case *ExprMethodcall:
+		call := x.(*ExprMethodcall)
+		if call.inlined != nil {
+			m.inlined(call.inlined)
+			return
+		}
+		m.expr(call.receiver)
+		m.values(call.args)
+		origType := call.getOrigType()
+		if origType.kind == G_INTERFACE {
+			m.markMethodName(call.fname)
+			return
+		}
+		funcref, ok := origType.methods[call.fname]
+		if ok {
+			m.mark(funcref.funcdef)
+		}
+	}
+}
+
+// the callee of an inlined call is not called
+func (m *deadcodeMarker) inlined(call *InlinedCall) {
+	m.values(call.args)
+	m.expr(call.body)
+}
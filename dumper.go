@@ -194,6 +194,10 @@ func (a *ExprStructField) dump() {
 	debugf("  .%s", a.fieldname)
 }
 
+func (e *ExprNew) dump() {
+	debugf("new(%s)", e.gtype.String())
+}
+
 func (stmt *ExprCaseClause) dump() {
 	debugf("case")
 	debugNest++
@@ -288,6 +292,10 @@ func (e *ExprTypeSwitchGuard) dump() {
 	e.expr.dump()
 }
 
+func (e *ExprBad) dump() {
+	debugf("bad expr")
+}
+
 func (f *StmtFor) dump() {
 	if f.rng != nil {
 		debugf("for range")
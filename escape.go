@@ -0,0 +1,751 @@
+// Escape analysis decides which values can live in the stack frame
+package main
+
+import "os"
+
+var printEscapes = false // -m: print escape analysis and inlining decisions
+
+// values larger than this are allocated in heap anyway
+const maxStackAllocSize = 65536
+
+// A node of the data flow graph of a function.
+// It is either a local variable or an allocation site,
+// that is &T{}, new(T), a slice literal, makeSlice() or &x.
+type escapeLocation struct {
+	tok     *Token
+	depth   int               // loop depth where it is declared or allocated
+	escapes bool              // flows to somewhere outliving the function
+	flows   []*escapeLocation // locations the value is assigned to
+	visited int
+
+	addr *escapeLocation // &x of a variable
+
+	isSite        bool
+	addrOf        *ExprVariable
+	structLiteral *ExprStructLiteral
+	sliceLiteral  *ExprSliceLiteral
+	newExpr       *ExprNew
+	makeSlice     *ExprFuncallOrConversion
+}
+
+type escapeState struct {
+	fn      *DeclFunc
+	depth   int
+	sites   []*escapeLocation
+	params  []*ExprVariable // receiver first
+	visitId int
+	unknown bool // met something we can not follow
+}
+
+// params of a function with its receiver first
+func escapeParams(fn *DeclFunc) []*ExprVariable {
+	if fn.receiver == nil {
+		return fn.params
+	}
+	params := []*ExprVariable{fn.receiver}
+	for _, param := range fn.params {
+		params = append(params, param)
+	}
+	return params
+}
+
+func analyzeEscapes(root *IrRoot, mainPkg *AstPackage) {
+	var funcs []*DeclFunc
+	for _, pkg := range root.packages {
+		for _, fn := range pkg.funcs {
+			if fn.body != nil {
+				funcs = append(funcs, fn)
+			}
+		}
+	}
+
+	// Param summaries start as "does not escape" and grow until nothing changes.
+	for _, fn := range funcs {
+		var params []*ExprVariable = escapeParams(fn)
+		fn.paramEscapes = nil
+		for i := 0; i < len(params); i++ {
+			fn.paramEscapes = append(fn.paramEscapes, false)
+		}
+	}
+
+	var states []*escapeState
+	for {
+		changed := false
+		states = nil
+		for _, fn := range funcs {
+			e := &escapeState{
+				fn: fn,
+			}
+			e.analyze()
+			var paramEscapes []bool = e.paramEscapes()
+			if !equalBools(paramEscapes, fn.paramEscapes) {
+				fn.paramEscapes = paramEscapes
+				changed = true
+			}
+			states = append(states, e)
+		}
+		if !changed {
+			break
+		}
+	}
+
+	for _, e := range states {
+		e.decide()
+		if printEscapes && e.fn.pkg == mainPkg.name {
+			e.printDecisions()
+		}
+	}
+}
+
+func equalBools(a []bool, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if v != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *escapeState) analyze() {
+	e.params = escapeParams(e.fn)
+	for _, lvar := range e.fn.localvars {
+		lvar.escloc = nil
+	}
+	for _, param := range e.params {
+		e.declare(param)
+	}
+	e.stmt(e.fn.body)
+	for _, site := range e.sites {
+		e.visitId++
+		if e.unknown || e.reaches(site, site.depth) {
+			site.escapes = true
+		}
+	}
+}
+
+func (e *escapeState) paramEscapes() []bool {
+	var r []bool
+	for _, param := range e.params {
+		e.visitId++
+		r = append(r, e.unknown || e.reaches(param.escloc, 0))
+	}
+	return r
+}
+
+// whether a value flows to somewhere outliving the function or the loop iteration
+func (e *escapeState) reaches(loc *escapeLocation, depth int) bool {
+	if loc.visited == e.visitId {
+		return false
+	}
+	loc.visited = e.visitId
+	if loc.escapes || loc.depth < depth {
+		return true
+	}
+	for _, next := range loc.flows {
+		if e.reaches(next, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *escapeState) decide() {
+	for _, site := range e.sites {
+		if site.addrOf != nil {
+			// the runtime allocates memory by itself
+			if site.escapes && e.fn.pkg != "iruntime" {
+				moveToHeap(e.fn, site.addrOf)
+			}
+		} else if site.structLiteral != nil {
+			site.structLiteral.onStack = !site.escapes
+		} else if site.sliceLiteral != nil {
+			site.sliceLiteral.onStack = !site.escapes
+		} else if site.newExpr != nil {
+			site.newExpr.onStack = !site.escapes
+		} else if site.makeSlice != nil && !site.escapes {
+			call := site.makeSlice
+			size := call.args[1].(*ExprNumberLiteral).val * call.args[2].(*ExprNumberLiteral).val
+			call.invisiblevar = &ExprVariable{
+				tok: call.tok,
+				gtype: &Gtype{
+					kind:        G_ARRAY,
+					elementType: gByte,
+					length:      size,
+				},
+			}
+			e.fn.localvars = append(e.fn.localvars, call.invisiblevar)
+		}
+	}
+}
+
+// A variable moved to heap is accessed through a hidden local pointer.
+func moveToHeap(fn *DeclFunc, variable *ExprVariable) {
+	if variable.heapAddr != nil {
+		return
+	}
+	variable.heapAddr = &ExprVariable{
+		tok:     variable.tok,
+		varname: "&" + variable.varname,
+		gtype: &Gtype{
+			kind:     G_POINTER,
+			origType: variable.gtype,
+		},
+	}
+	fn.localvars = append(fn.localvars, variable.heapAddr)
+}
+
+func (e *escapeState) printDecisions() {
+	for _, site := range e.sites {
+		var what string
+		if site.addrOf != nil {
+			if site.escapes {
+				printEscapeDecision(site.addrOf.tok, "moved to heap: "+string(site.addrOf.varname))
+			}
+			continue
+		} else if site.structLiteral != nil {
+			what = "&" + string(site.structLiteral.strctname.name) + "{}"
+			if len(site.structLiteral.fields) > 0 {
+				what = "&" + string(site.structLiteral.strctname.name) + "{...}"
+			}
+		} else if site.sliceLiteral != nil {
+			what = typeName(site.sliceLiteral.gtype) + "{...}"
+		} else if site.newExpr != nil {
+			what = "new(" + typeName(site.newExpr.gtype) + ")"
+		} else {
+			what = "makeSlice(...)"
+		}
+		if site.escapes {
+			printEscapeDecision(site.tok, what+" escapes to heap")
+		} else {
+			printEscapeDecision(site.tok, what+" does not escape")
+		}
+	}
+}
+
+func printEscapeDecision(tok *Token, msg string) {
+	var b []byte = []byte(errorAt(tok, msg) + "\n")
+	os.Stderr.Write(b)
+}
+
+func (e *escapeState) newSite(tok *Token) *escapeLocation {
+	site := &escapeLocation{
+		tok:    tok,
+		depth:  e.depth,
+		isSite: true,
+	}
+	e.sites = append(e.sites, site)
+	return site
+}
+
+func (e *escapeState) declare(variable *ExprVariable) {
+	variable.escloc = &escapeLocation{
+		tok:   variable.tok,
+		depth: e.depth,
+	}
+}
+
+// variables are declared before use,
+// but be conservative about the ones we did not see
+func (e *escapeState) location(variable *ExprVariable) *escapeLocation {
+	if variable.escloc == nil {
+		variable.escloc = &escapeLocation{
+			tok: variable.tok,
+		}
+	}
+	return variable.escloc
+}
+
+func (e *escapeState) addrOfVariable(variable *ExprVariable) []*escapeLocation {
+	if variable.isGlobal {
+		return nil
+	}
+	loc := e.location(variable)
+	if loc.addr == nil {
+		site := e.newSite(variable.tok)
+		site.depth = loc.depth
+		site.addrOf = variable
+		loc.addr = site
+	}
+	return []*escapeLocation{loc.addr}
+}
+
+func (e *escapeState) escape(srcs []*escapeLocation) {
+	for _, src := range srcs {
+		src.escapes = true
+	}
+}
+
+func (e *escapeState) flow(dst *escapeLocation, srcs []*escapeLocation) {
+	for _, src := range srcs {
+		src.flows = append(src.flows, dst)
+	}
+}
+
+func (e *escapeState) stmt(s Stmt) {
+	if s == nil {
+		return
+	}
+	switch s.(type) {
+	case *StmtSatementList:
+		list := s.(*StmtSatementList)
+		if list == nil {
+			return
+		}
+		for _, stmt := range list.stmts {
+			e.stmt(stmt)
+		}
+	case *DeclVar:
+		decl := s.(*DeclVar)
+		e.declare(decl.variable)
+		if decl.initval != nil {
+			e.assignToVariable(decl.variable, e.expr(decl.initval))
+		}
+	case *DeclConst, *DeclType, *StmtContinue, *StmtBreak:
+		// nothing to do
+	case *StmtShortVarDecl:
+		decl := s.(*StmtShortVarDecl)
+		for _, left := range decl.lefts {
+			e.declareLeft(left)
+		}
+		e.assign(decl.lefts, decl.rights)
+	case *StmtAssignment:
+		assignment := s.(*StmtAssignment)
+		e.assign(assignment.lefts, assignment.rights)
+	case *StmtExpr:
+		e.expr(s.(*StmtExpr).expr)
+	case *StmtInc:
+		e.expr(s.(*StmtInc).operand)
+	case *StmtDec:
+		e.expr(s.(*StmtDec).operand)
+	case *StmtReturn:
+		for _, expr := range s.(*StmtReturn).exprs {
+			e.escape(e.expr(expr))
+		}
+	case *StmtDefer:
+		// deferred calls run before the frame goes away
+		e.expr(s.(*StmtDefer).expr)
+	case *StmtIf:
+		stmtIf := s.(*StmtIf)
+		e.stmt(stmtIf.simplestmt)
+		e.expr(stmtIf.cond)
+		e.stmt(stmtIf.then)
+		e.stmt(stmtIf.els)
+	case *StmtFor:
+		e.stmtFor(s.(*StmtFor))
+	case *StmtSwitch:
+		stmtSwitch := s.(*StmtSwitch)
+		e.expr(stmtSwitch.cond)
+		for _, cse := range stmtSwitch.cases {
+			for _, expr := range cse.exprs {
+				e.expr(expr)
+			}
+			e.stmt(cse.compound)
+		}
+		e.stmt(stmtSwitch.dflt)
+	default:
+		e.exprStmt(s)
+	}
+}
+
+// the condition of a for statement can be an expression
+func (e *escapeState) exprStmt(s Stmt) {
+	switch s.(type) {
+	case *ExprBinop:
+		e.expr(s.(*ExprBinop))
+	case *ExprUop:
+		e.expr(s.(*ExprUop))
+	case *Relation:
+		e.expr(s.(*Relation))
+	case *ExprFuncallOrConversion:
+		e.expr(s.(*ExprFuncallOrConversion))
+	case *ExprMethodcall:
+		e.expr(s.(*ExprMethodcall))
+	default:
+		e.unknown = true
+	}
+}
+
+func (e *escapeState) stmtFor(f *StmtFor) {
+	if f.rng != nil {
+		// elements are copied out of the collection
+		e.expr(f.rng.rangeexpr)
+		e.depth++
+		if f.rng.indexvar != nil {
+			e.declareLeft(f.rng.indexvar)
+		}
+		if f.rng.valuevar != nil {
+			e.declareLeft(f.rng.valuevar)
+		}
+		e.stmt(f.block)
+		e.depth--
+		return
+	}
+	if f.cls != nil {
+		e.stmt(f.cls.init)
+	}
+	e.depth++
+	if f.cls != nil {
+		e.stmt(f.cls.cond)
+		e.stmt(f.cls.post)
+	}
+	e.stmt(f.block)
+	e.depth--
+}
+
+func (e *escapeState) declareLeft(left Expr) {
+	rel, ok := left.(*Relation)
+	if !ok || rel.expr == nil {
+		return
+	}
+	variable, ok := rel.expr.(*ExprVariable)
+	if ok && !variable.isGlobal {
+		e.declare(variable)
+	}
+}
+
+func (e *escapeState) assign(lefts []Expr, rights []Expr) {
+	if len(lefts) == len(rights) {
+		for i, right := range rights {
+			e.assignTo(lefts[i], e.expr(right))
+		}
+		return
+	}
+	// multiple values of a call, a map index or a type assertion
+	for _, right := range rights {
+		e.escape(e.expr(right))
+	}
+	for _, left := range lefts {
+		e.lvalue(left)
+	}
+}
+
+func (e *escapeState) assignTo(left Expr, srcs []*escapeLocation) {
+	switch left.(type) {
+	case *Relation:
+		rel := left.(*Relation)
+		if rel.expr == nil {
+			// _
+			return
+		}
+		variable, ok := rel.expr.(*ExprVariable)
+		if !ok {
+			e.escape(srcs)
+			return
+		}
+		e.assignToVariable(variable, srcs)
+	default:
+		// storing through a pointer or into a struct loses track of the value
+		e.lvalue(left)
+		e.escape(srcs)
+	}
+}
+
+func (e *escapeState) lvalue(left Expr) {
+	switch left.(type) {
+	case *ExprStructField:
+		e.expr(left.(*ExprStructField).strct)
+	case *ExprIndex:
+		index := left.(*ExprIndex)
+		e.expr(index.collection)
+		e.expr(index.index)
+	case *ExprUop:
+		e.expr(left.(*ExprUop).operand)
+	default:
+		e.expr(left)
+	}
+}
+
+func (e *escapeState) assignToVariable(variable *ExprVariable, srcs []*escapeLocation) {
+	if variable.isGlobal {
+		e.escape(srcs)
+		return
+	}
+	switch variable.getGtype().getKind() {
+	case G_INTERFACE:
+		// the value is copied into heap
+		e.escape(srcs)
+	case G_ARRAY:
+		// elements are copied
+	default:
+		e.flow(e.location(variable), srcs)
+	}
+}
+
+// the address of an addressable expression
+func (e *escapeState) addressOf(x Expr) []*escapeLocation {
+	switch x.(type) {
+	case *Relation:
+		rel := x.(*Relation)
+		variable, ok := rel.expr.(*ExprVariable)
+		if !ok {
+			e.unknown = true
+			return nil
+		}
+		return e.addrOfVariable(variable)
+	case *ExprStructField:
+		field := x.(*ExprStructField)
+		if field.strct.getGtype().kind == G_POINTER {
+			return e.expr(field.strct)
+		}
+		return e.addressOf(field.strct)
+	case *ExprIndex:
+		index := x.(*ExprIndex)
+		e.expr(index.index)
+		if index.collection.getGtype().getKind() == G_ARRAY {
+			return e.addressOf(index.collection)
+		}
+		return e.expr(index.collection)
+	case *ExprUop:
+		return e.expr(x.(*ExprUop).operand)
+	}
+	e.unknown = true
+	return nil
+}
+
+// walk an expression and return the locations whose values it may be
+func (e *escapeState) expr(x Expr) []*escapeLocation {
+	if x == nil {
+		return nil
+	}
+	switch x.(type) {
+	case *Relation:
+		rel := x.(*Relation)
+		if rel.expr == nil {
+			return nil
+		}
+		return e.expr(rel.expr)
+	case *ExprVariable:
+		variable := x.(*ExprVariable)
+		if variable.isGlobal {
+			return nil
+		}
+		if variable.getGtype().getKind() == G_ARRAY {
+			// an array is loaded as its address
+			return e.addrOfVariable(variable)
+		}
+		return []*escapeLocation{e.location(variable)}
+	case *ExprNumberLiteral, *ExprStringLiteral, *ExprNilLiteral, *ExprConstVariable, *ExprFuncRef:
+		return nil
+	case *ExprUop:
+		uop := x.(*ExprUop)
+		if uop.op == "&" {
+			return e.addrOf(uop)
+		}
+		e.expr(uop.operand)
+		return nil
+	case *ExprBinop:
+		binop := x.(*ExprBinop)
+		e.expr(binop.left)
+		e.expr(binop.right)
+		return nil
+	case *ExprStructLiteral:
+		e.structLiteralFields(x.(*ExprStructLiteral))
+		return nil
+	case *ExprSliceLiteral:
+		lit := x.(*ExprSliceLiteral)
+		for _, value := range lit.values {
+			e.escape(e.expr(value))
+		}
+		if len(lit.values) == 0 || lit.gtype.elementType.getSize()*len(lit.values) > maxStackAllocSize {
+			return nil
+		}
+		site := e.newSite(lit.tok)
+		site.sliceLiteral = lit
+		return []*escapeLocation{site}
+	case *ExprArrayLiteral:
+		for _, value := range x.(*ExprArrayLiteral).values {
+			e.escape(e.expr(value))
+		}
+		return nil
+	case *ExprMapLiteral:
+		for _, element := range x.(*ExprMapLiteral).elements {
+			e.escape(e.expr(element.key))
+			e.escape(e.expr(element.value))
+		}
+		return nil
+	case *ExprNew:
+		newExpr := x.(*ExprNew)
+		if newExpr.gtype.getSize() > maxStackAllocSize {
+			return nil
+		}
+		site := e.newSite(newExpr.tok)
+		site.newExpr = newExpr
+		return []*escapeLocation{site}
+	case *ExprStructField:
+		field := x.(*ExprStructField)
+		if field.getGtype().getKind() == G_ARRAY {
+			// an array field is loaded as its address
+			return e.addressOf(field)
+		}
+		e.expr(field.strct)
+		return nil
+	case *ExprIndex:
+		index := x.(*ExprIndex)
+		if index.getGtype().getKind() == G_ARRAY {
+			return e.addressOf(index)
+		}
+		e.expr(index.collection)
+		e.expr(index.index)
+		return nil
+	case *ExprSlice:
+		slice := x.(*ExprSlice)
+		e.expr(slice.low)
+		e.expr(slice.high)
+		e.expr(slice.max)
+		return e.expr(slice.collection)
+	case *ExprFuncallOrConversion:
+		return e.funcall(x.(*ExprFuncallOrConversion))
+	case *ExprMethodcall:
+		return e.methodcall(x.(*ExprMethodcall))
+	case *ExprLen:
+		e.expr(x.(*ExprLen).arg)
+		return nil
+	case *ExprCap:
+		e.expr(x.(*ExprCap).arg)
+		return nil
+	case *ExprConversion:
+		return e.expr(x.(*ExprConversion).expr)
+	case *ExprConversionToInterface:
+		e.escape(e.expr(x.(*ExprConversionToInterface).expr))
+		return nil
+	case *ExprTypeAssertion:
+		e.expr(x.(*ExprTypeAssertion).expr)
+		return nil
+	case *ExprTypeSwitchGuard:
+		e.expr(x.(*ExprTypeSwitchGuard).expr)
+		return nil
+	case *ExprVaArg:
+		return e.expr(x.(*ExprVaArg).expr)
+	}
+	e.unknown = true
+	return nil
+}
+
+// &x, &T{} and &p.field
+func (e *escapeState) addrOf(uop *ExprUop) []*escapeLocation {
+	switch uop.operand.(type) {
+	case *ExprStructLiteral:
+		lit := uop.operand.(*ExprStructLiteral)
+		e.structLiteralFields(lit)
+		if lit.getGtype().getSize() > maxStackAllocSize {
+			return nil
+		}
+		site := e.newSite(uop.tok)
+		site.structLiteral = lit
+		return []*escapeLocation{site}
+	}
+	return e.addressOf(uop.operand)
+}
+
+func (e *escapeState) structLiteralFields(lit *ExprStructLiteral) {
+	for _, field := range lit.fields {
+		e.escape(e.expr(field.value))
+	}
+}
+
+func (e *escapeState) funcall(funcall *ExprFuncallOrConversion) []*escapeLocation {
+	if funcall.rel.expr == nil {
+		// conversion
+		if len(funcall.args) == 0 {
+			return nil
+		}
+		return e.expr(funcall.args[0])
+	}
+	funcref, ok := funcall.rel.expr.(*ExprFuncRef)
+	if !ok {
+		e.unknown = true
+		return nil
+	}
+	decl := funcref.funcdef
+	switch decl {
+	case builtinLen, builtinCap:
+		for _, arg := range funcall.args {
+			e.expr(arg)
+		}
+		return nil
+	case builtinAppend:
+		// the result may share the underlying array
+		srcs := e.expr(funcall.args[0])
+		e.escape(e.expr(funcall.args[1]))
+		return srcs
+	case builtinMakeSlice:
+		for _, arg := range funcall.args {
+			e.expr(arg)
+		}
+		return e.makeSlice(funcall)
+	}
+	if decl.pkg == "libc" {
+		for _, arg := range funcall.args {
+			e.expr(arg)
+		}
+		return nil
+	}
+	e.callArgs(decl, funcall.args)
+	return nil
+}
+
+// makeSlice() of constant size
+func (e *escapeState) makeSlice(funcall *ExprFuncallOrConversion) []*escapeLocation {
+	var sizes []int
+	for _, arg := range funcall.args {
+		lit, ok := arg.(*ExprNumberLiteral)
+		if !ok {
+			return nil
+		}
+		sizes = append(sizes, lit.val)
+	}
+	if sizes[0] > sizes[1] || sizes[1]*sizes[2] == 0 || sizes[1]*sizes[2] > maxStackAllocSize {
+		return nil
+	}
+	site := e.newSite(funcall.tok)
+	site.makeSlice = funcall
+	return []*escapeLocation{site}
+}
+
+func (e *escapeState) methodcall(call *ExprMethodcall) []*escapeLocation {
+	args := []Expr{call.receiver}
+	for _, arg := range call.args {
+		args = append(args, arg)
+	}
+	gtype := call.receiver.getGtype()
+	if gtype.kind == G_POINTER {
+		gtype = gtype.origType
+	}
+	if gtype.kind != G_NAMED || gtype.relation.gtype.kind == G_INTERFACE {
+		// dynamic dispatch
+		for _, arg := range args {
+			e.escape(e.expr(arg))
+		}
+		return nil
+	}
+	funcref, ok := gtype.relation.gtype.methods[call.fname]
+	if !ok {
+		e.unknown = true
+		return nil
+	}
+	e.callArgs(funcref.funcdef, args)
+	return nil
+}
+
+// args escape unless the callee says they don't
+func (e *escapeState) callArgs(callee *DeclFunc, args []Expr) {
+	var params []*ExprVariable = escapeParams(callee)
+	known := callee.body != nil && len(params) == len(args) && len(callee.paramEscapes) == len(args)
+	for _, param := range params {
+		if param.isVariadic {
+			known = false
+		}
+	}
+	for i, arg := range args {
+		srcs := e.expr(arg)
+		if !known || callee.paramEscapes[i] {
+			e.escape(srcs)
+		} else if params[i].getGtype().getKind() == G_INTERFACE && arg.getGtype().getKind() != G_INTERFACE {
+			// converted into interface
+			e.escape(srcs)
+		}
+	}
+}
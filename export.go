@@ -0,0 +1,261 @@
+// export data describes the declarations of a compiled package in Go syntax.
+// The importers of the package parse it instead of the source.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type exportWriter struct {
+	pkg     *AstPackage
+	paths   map[identifier]string // the import paths of the packages by name
+	imports []string              // the packages which the declarations refer to
+}
+
+// writeExportData writes the export data of a compiled package.
+// It has all the named types and methods, which the method tables and
+// the types of the exported names need, and the exported functions without bodies.
+func writeExportData(pkg *AstPackage, paths map[identifier]string, file string) {
+	w := &exportWriter{
+		pkg:   pkg,
+		paths: paths,
+	}
+	body := w.decls()
+	var s string
+	var unexported []string = unexportedNames(pkg)
+	if len(unexported) > 0 {
+		// the importers report the use of them as not exported rather than not found
+		s = "//go:unexported " + joinStrings(unexported, " ") + "\n"
+	}
+	s = s + fmt.Sprintf("package %s\n", string(pkg.name))
+	sortStrings(w.imports)
+	for _, name := range w.imports {
+		s = s + fmt.Sprintf("\nimport \"%s\"\n", w.paths[identifier(name)])
+	}
+	s = s + body
+
+	f, err := os.Create(file)
+	if err != nil {
+		errorf("%s", err.Error())
+	}
+	var b []byte = []byte(s)
+	f.Write(b)
+	f.Close()
+}
+
+func (w *exportWriter) decls() string {
+	var s string
+	for _, f := range w.pkg.files {
+		for _, decl := range f.topLevelDecls {
+			if decl.typedecl != nil {
+				s = s + w.typeDecl(decl.typedecl)
+			} else if decl.constdecl != nil {
+				for _, cnst := range decl.constdecl.consts {
+					if isExported(cnst.name) {
+						s = s + w.constDecl(cnst)
+					}
+				}
+			}
+		}
+	}
+	for _, decl := range w.pkg.vars {
+		// the symbol is qualified by the package name
+		symbol := string(decl.variable.varname)
+		name := identifier(symbol[len(w.pkg.name)+1 : len(symbol)])
+		if isExported(name) {
+			s = s + fmt.Sprintf("\nvar %s %s\n", string(name), w.typeString(decl.variable.gtype))
+		}
+	}
+	for _, fn := range w.pkg.funcs {
+		if fn.receiver != nil || (isExported(fn.fname) && fn.fname != "init") {
+			s = s + "\n" + w.funcDecl(fn) + "\n"
+		}
+	}
+	// the importers call the init functions, which keep their numbers
+	for i := 0; i < len(w.pkg.inits); i++ {
+		s = s + "\nfunc init()\n"
+	}
+	return s
+}
+
+// unexportedNames returns the sorted names of the functions, variables and constants
+// which are left out of the export data
+func unexportedNames(pkg *AstPackage) []string {
+	var names []string
+	for _, f := range pkg.files {
+		for _, decl := range f.topLevelDecls {
+			if decl.constdecl == nil {
+				continue
+			}
+			for _, cnst := range decl.constdecl.consts {
+				if !isExported(cnst.name) && cnst.name != "_" {
+					names = append(names, string(cnst.name))
+				}
+			}
+		}
+	}
+	for _, decl := range pkg.vars {
+		symbol := string(decl.variable.varname)
+		name := identifier(symbol[len(pkg.name)+1 : len(symbol)])
+		if !isExported(name) && name != "_" {
+			names = append(names, string(name))
+		}
+	}
+	for _, fn := range pkg.funcs {
+		if fn.receiver == nil && !isExported(fn.fname) && fn.fname != "init" {
+			names = append(names, string(fn.fname))
+		}
+	}
+	sortStrings(names)
+	return names
+}
+
+func (w *exportWriter) typeDecl(decl *DeclType) string {
+	gtype := decl.gtype
+	if gtype.kind == G_INTERFACE {
+		var names []string
+		for name, _ := range gtype.imethods {
+			names = append(names, string(name))
+		}
+		sortStrings(names)
+		s := fmt.Sprintf("\ntype %s interface {\n", string(decl.name))
+		for _, name := range names {
+			method := gtype.imethods[identifier(name)]
+			var params []string
+			for i, ptype := range method.paramTypes {
+				params = append(params, fmt.Sprintf("p%d %s", i, w.typeString(ptype)))
+			}
+			s = s + "\t" + name + w.signature(params, method.rettypes) + "\n"
+		}
+		return s + "}\n"
+	}
+	return fmt.Sprintf("\ntype %s %s\n", string(decl.name), w.typeString(gtype))
+}
+
+func (w *exportWriter) constDecl(cnst *ExprConstVariable) string {
+	gtype := cnst.gtype
+	var typ string
+	if gtype == nil {
+		gtype = cnst.val.getGtype()
+	} else {
+		typ = " " + w.typeString(gtype)
+	}
+	var val string
+	switch gtype.getKind() {
+	case G_STRING:
+		val = "\"" + escapeString(evalStringExpr(cnst.val)) + "\""
+	case G_BOOL:
+		if evalIntExpr(cnst) == 0 {
+			val = "false"
+		} else {
+			val = "true"
+		}
+	default:
+		val = fmt.Sprintf("%d", evalIntExpr(cnst))
+	}
+	return fmt.Sprintf("\nconst %s%s = %s\n", string(cnst.name), typ, val)
+}
+
+func (w *exportWriter) funcDecl(fn *DeclFunc) string {
+	var s string = "func "
+	if fn.receiver != nil {
+		s = s + fmt.Sprintf("(%s %s) ", string(fn.receiver.varname), w.typeString(fn.receiver.gtype))
+	}
+	var params []string
+	for _, param := range fn.params {
+		if param.isVariadic {
+			params = append(params, fmt.Sprintf("%s ...%s", string(param.varname), w.typeString(param.gtype.elementType)))
+		} else {
+			params = append(params, fmt.Sprintf("%s %s", string(param.varname), w.typeString(param.gtype)))
+		}
+	}
+	return s + string(fn.fname) + w.signature(params, fn.rettypes)
+}
+
+// signature prints "(params) results"
+func (w *exportWriter) signature(params []string, rettypes []*Gtype) string {
+	s := "(" + joinStrings(params, ", ") + ")"
+	if len(rettypes) == 1 {
+		return s + " " + w.typeString(rettypes[0])
+	}
+	if len(rettypes) > 1 {
+		var results []string
+		for _, rettype := range rettypes {
+			results = append(results, w.typeString(rettype))
+		}
+		s = s + " (" + joinStrings(results, ", ") + ")"
+	}
+	return s
+}
+
+// typeString prints a type as it is written in the package
+func (w *exportWriter) typeString(gtype *Gtype) string {
+	switch gtype.kind {
+	case G_NAMED:
+		return w.typeName(gtype.relation)
+	case G_INT:
+		return "int"
+	case G_BOOL:
+		return "bool"
+	case G_BYTE:
+		return "byte"
+	case G_STRING:
+		return "string"
+	case G_POINTER:
+		return "*" + w.typeString(gtype.origType)
+	case G_SLICE:
+		return "[]" + w.typeString(gtype.elementType)
+	case G_ARRAY:
+		return fmt.Sprintf("[%d]%s", gtype.length, w.typeString(gtype.elementType))
+	case G_MAP:
+		return "map[" + w.typeString(gtype.mapKey) + "]" + w.typeString(gtype.mapValue)
+	case G_STRUCT:
+		s := "struct {\n"
+		for _, field := range gtype.fields {
+			s = s + "\t" + string(field.fieldname) + " " + w.typeString(field) + "\n"
+		}
+		return s + "}"
+	case G_INTERFACE:
+		if len(gtype.imethods) == 0 {
+			return "interface{}"
+		}
+	}
+	errorf("type %s can not be exported", gtype.String())
+	return ""
+}
+
+// typeName qualifies the names of other packages
+func (w *exportWriter) typeName(rel *Relation) string {
+	if rel.pkg == w.pkg.name {
+		return string(rel.name)
+	}
+	scope, ok := allScopes[rel.pkg]
+	if !ok || scope.getDeclared(rel.name) == nil {
+		// a predeclared type
+		return string(rel.name)
+	}
+	if !in_array(string(rel.pkg), w.imports) {
+		w.imports = append(w.imports, string(rel.pkg))
+	}
+	return string(rel.pkg) + "." + string(rel.name)
+}
+
+// evalStringExpr returns the value of a constant string expression
+func evalStringExpr(e Expr) string {
+	switch e.(type) {
+	case *ExprStringLiteral:
+		return e.(*ExprStringLiteral).val
+	case *Relation:
+		return evalStringExpr(e.(*Relation).expr)
+	case *ExprConstVariable:
+		return evalStringExpr(e.(*ExprConstVariable).val)
+	case *ExprBinop:
+		binop := e.(*ExprBinop)
+		if binop.op == "+" {
+			return evalStringExpr(binop.left) + evalStringExpr(binop.right)
+		}
+	}
+	errorft(e.token(), "not a constant string")
+	return ""
+}
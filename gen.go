@@ -16,17 +16,28 @@ const ptrSize int = 8
 const sliceWidth int = 3
 const interfaceWidth int = 3
 const mapWidth int = 3
+const stringWidth int = 2
 const sliceSize int = IntSize + ptrSize + ptrSize
 
+var asmOut *os.File // where the assembly is written
+
 func emitNewline() {
+	if peepholeEnabled {
+		bufferAsm("\n")
+		return
+	}
 	var b []byte = []byte{'\n'}
-	os.Stdout.Write(b)
+	asmOut.Write(b)
 }
 
 func emitOut(format string, v ...interface{}) {
 	s := fmt.Sprintf(format, v...)
+	if peepholeEnabled {
+		bufferAsm(s)
+		return
+	}
 	var b []byte = []byte(s)
-	os.Stdout.Write(b)
+	asmOut.Write(b)
 }
 
 var gasIndentLevel int = 1
@@ -59,6 +70,19 @@ func getMethodUniqueName(gtype *Gtype, fname identifier) string {
 	return string(typename) + "$" + string(fname)
 }
 
+// the method table of a pointer to a named type which has methods, or ""
+// The table is emitted with the package which declares the type.
+func getMethodTableSymbol(gtype *Gtype) string {
+	if gtype.kind != G_POINTER || gtype.origType.kind != G_NAMED {
+		return ""
+	}
+	named := gtype.origType
+	if named.relation.gtype == nil || len(named.relation.gtype.methods) == 0 {
+		return ""
+	}
+	return getFuncSymbol(named.relation.pkg, string(named.relation.name)+"..methods")
+}
+
 // "main","f1" -> "main.f1"
 func getFuncSymbol(pkg identifier, fname string) string {
 	if pkg == "libc" {
@@ -76,6 +100,10 @@ func (f *DeclFunc) getSymbol() string {
 		return getFuncSymbol(f.pkg, getMethodUniqueName(f.receiver.gtype, f.fname))
 	}
 
+	if f.fname == "init" {
+		return getFuncSymbol(f.pkg, fmt.Sprintf("init.%d", f.initIndex))
+	}
+
 	// other functions
 	return getFuncSymbol(f.pkg, string(f.fname))
 }
@@ -103,6 +131,33 @@ func emitFuncEpilogue(labelDeferHandler string, stmtDefer *StmtDefer) {
 	emit("LEAVE_AND_RET")
 }
 
+// isGlobalSymbol tells if the objects of other packages may refer to the function
+func (f *DeclFunc) isGlobalSymbol() bool {
+	if f.receiver == nil && f.fname == "init" {
+		return true
+	}
+	return isExported(f.fname) || isRuntimePackage(f.pkg)
+}
+
+// emitFuncStart starts a function symbol.
+// It is bound globally if other objects may refer to it.
+func emitFuncStart(symbol string, global bool) {
+	if global {
+		emit(".global %s", symbol)
+	}
+	emit(".type %s, @function", symbol)
+	emitWithoutIndent("%s:", symbol)
+	emit(".cfi_startproc")
+}
+
+func emitFuncEnd(symbol string) {
+	emit(".cfi_endproc")
+	emit(".size %s, .-%s", symbol, symbol)
+	if dwarfEnabled {
+		emitWithoutIndent(".Lfunc_end.%s:", symbol)
+	}
+}
+
 func (structfield *ExprStructField) calcOffset() {
 	fieldType := structfield.getGtype()
 	if fieldType.offset != undefinedSize {
@@ -180,7 +235,11 @@ func (uop *ExprUop) emitSave() {
 	emit("PUSH_8")
 	uop.operand.emit()
 	emit("PUSH_8")
-	emit("STORE_8_INDIRECT_FROM_STACK")
+	if uop.getGtype().getSize() == 1 {
+		emit("STORE_1_INDIRECT_FROM_STACK")
+	} else {
+		emit("STORE_8_INDIRECT_FROM_STACK")
+	}
 }
 
 // e.g. x = 1
@@ -204,6 +263,11 @@ func (variable *ExprVariable) emitOffsetSave(size int, offset int, forceIndirect
 	}
 	if variable.isGlobal {
 		emit("STORE_%d_TO_GLOBAL %s %d", size, variable.varname, offset)
+	} else if variable.heapAddr != nil {
+		emit("PUSH_8")
+		variable.emitAddress(offset)
+		emit("PUSH_8")
+		emit("STORE_%d_INDIRECT_FROM_STACK", size)
 	} else {
 		emit("STORE_%d_TO_LOCAL %d+%d", size, variable.offset, offset)
 	}
@@ -211,42 +275,52 @@ func (variable *ExprVariable) emitOffsetSave(size int, offset int, forceIndirect
 
 func (binop *ExprBinop) emitCompareStrings() {
 	emit("# emitCompareStrings")
-	var equal bool
+	var instruction string
 	switch binop.op {
 	case "<":
-		TBI(binop.token(), "")
+		instruction = "setl"
 	case ">":
-		TBI(binop.token(), "")
+		instruction = "setg"
 	case "<=":
-		TBI(binop.token(), "")
+		instruction = "setle"
 	case ">=":
-		TBI(binop.token(), "")
-	case "!=":
-		equal = false
-	case "==":
-		equal = true
+		instruction = "setge"
 	}
 
-	labelElse := makeLabel()
-	labelEnd := makeLabel()
-
 	binop.left.emit()
+	emit("PUSH_STRING # left")
+	binop.right.emit()
+	emit("PUSH_STRING # right")
+	if instruction == "" {
+		emitStringsEqualFromStack(binop.op == "==")
+		return
+	}
+	emitStringsOrderFromStack(instruction)
+}
 
-	// convert nil to the empty string
-	emit("CMP_EQ_ZERO")
-	emit("TEST_IT")
-	emit("LOAD_NUMBER 0")
-	emit("je %s", labelElse)
-	emitEmptyString()
-	emit("jmp %s", labelEnd)
-	emit("%s:", labelElse)
-	binop.left.emit()
-	emit("%s:", labelEnd)
-	emit("PUSH_8")
+// call iruntime.eqstrings
+func emitStringsEqualFromStack(equal bool) {
+	emit("POP_TO_ARG_3 # right.len")
+	emit("POP_TO_ARG_2 # right.ptr")
+	emit("POP_TO_ARG_1 # left.len")
+	emit("POP_TO_ARG_0 # left.ptr")
+	emit("FUNCALL iruntime.eqstrings")
+	if !equal {
+		emit("CMP_EQ_ZERO")
+	}
+}
 
-	binop.right.emit()
+// call iruntime.cmpstrings and compare its result with 0
+func emitStringsOrderFromStack(instruction string) {
+	emit("POP_TO_ARG_3 # right.len")
+	emit("POP_TO_ARG_2 # right.ptr")
+	emit("POP_TO_ARG_1 # left.len")
+	emit("POP_TO_ARG_0 # left.ptr")
+	emit("FUNCALL iruntime.cmpstrings")
+	emit("PUSH_8")
+	emit("LOAD_NUMBER 0")
 	emit("PUSH_8")
-	emitStringsEqualFromStack(equal)
+	emit("CMP_FROM_STACK %s", instruction)
 }
 
 func emitConvertNilToEmptyString() {
@@ -263,8 +337,8 @@ func emitConvertNilToEmptyString() {
 	emit("%s:", labelEnd)
 }
 
-// call strcmp
-func emitStringsEqualFromStack(equal bool) {
+// compare C strings like type labels by calling strcmp
+func emitCStringsEqualFromStack(equal bool) {
 	emit("pop %%rax") // left
 
 	emitConvertNilToEmptyString()
@@ -276,7 +350,7 @@ func emitStringsEqualFromStack(equal bool) {
 	emit("PUSH_8")
 	emit("POP_TO_ARG_0")
 	emit("POP_TO_ARG_1")
-	emit("FUNCALL strcmp")
+	emit("FUNCALL strcmp@PLT")
 	if equal {
 		emit("CMP_EQ_ZERO") // retval == 0
 	} else {
@@ -310,48 +384,31 @@ func (binop *ExprBinop) emitComp() {
 	emit_comp_primitive(instruction, binop)
 }
 
+// allocate len(left) + len(right) bytes and copy both strings into it
 func emitStringConcate(left Expr, right Expr) {
 	emit("# emitStringConcate")
 	left.emit()
-	emit("PUSH_8 # left string")
-
-	emit("PUSH_8")
-	emit("POP_TO_ARG_0")
-	emit("FUNCALL strlen # get left len")
-
-	emit("PUSH_8 # left len")
+	emit("PUSH_STRING # left string")
 	right.emit()
-	emit("PUSH_8 # right string")
-	emit("PUSH_8")
-	emit("POP_TO_ARG_0")
-	emit("FUNCALL strlen # get right len")
-	emit("PUSH_8 # right len")
-
-	emit("pop %%rax # right len")
-	emit("pop %%rcx # right string")
-	emit("pop %%rbx # left len")
-	emit("pop %%rdx # left string")
+	emit("PUSH_STRING # right string")
 
-	emit("push %%rcx # right string")
-	emit("push %%rdx # left  string")
-
-	// newSize = strlen(left) + strlen(right) + 1
-	emit("add %%rax, %%rbx # len + len")
-	emit("add $1, %%rbx # + 1 (null byte)")
-	emit("mov %%rbx, %%rax")
+	emit("mov 16(%%rsp), %%rax # left len")
+	emit("add (%%rsp), %%rax # + right len")
 	emit("PUSH_8")
 	emit("POP_TO_ARG_0")
-	emit("FUNCALL iruntime.malloc")
+	emit("FUNCALL iruntime.mallocNoscan")
 
-	emit("PUSH_8")
-	emit("POP_TO_ARG_0")
-	emit("POP_TO_ARG_1")
-	emit("FUNCALL strcat")
+	emit("mov %%rax, %%rdi # dest")
+	emit("mov 24(%%rsp), %%rsi # left ptr")
+	emit("mov 16(%%rsp), %%rcx # left len")
+	emit("rep movsb")
+	emit("mov 8(%%rsp), %%rsi # right ptr")
+	emit("mov (%%rsp), %%rcx # right len")
+	emit("rep movsb")
 
-	emit("PUSH_8")
-	emit("POP_TO_ARG_0")
-	emit("POP_TO_ARG_1")
-	emit("FUNCALL strcat")
+	emit("mov 16(%%rsp), %%rbx # left len")
+	emit("add (%%rsp), %%rbx # + right len")
+	emit("add $32, %%rsp # drop both strings")
 }
 
 func (ast *ExprBinop) emit() {
@@ -401,6 +458,18 @@ func (ast *ExprBinop) emit() {
 		emit("SUB_FROM_STACK")
 	} else if ast.op == "*" {
 		emit("IMUL_FROM_STACK")
+	} else if ast.op == "&" {
+		emit("AND_FROM_STACK")
+	} else if ast.op == "|" {
+		emit("OR_FROM_STACK")
+	} else if ast.op == "^" {
+		emit("XOR_FROM_STACK")
+	} else if ast.op == "&^" {
+		emit("ANDNOT_FROM_STACK")
+	} else if ast.op == "<<" {
+		emit("SHL_FROM_STACK")
+	} else if ast.op == ">>" {
+		emit("SAR_FROM_STACK")
 	} else if ast.op == "%" {
 		emit("pop %%rcx")
 		emit("pop %%rax")
@@ -474,6 +543,8 @@ func (ast *StmtAssignment) emit() {
 				assignToStruct(left, right)
 			case gtype.getKind() == G_INTERFACE:
 				assignToInterface(left, right)
+			case gtype.getKind() == G_STRING:
+				assignToString(left, right)
 			default:
 				// suppose primitive
 				emitAssignPrimitive(left, right)
@@ -551,6 +622,8 @@ func (ast *StmtAssignment) emit() {
 					} else if left.getGtype().getKind() == G_INTERFACE {
 						// @TODO: Does this work ?
 						emitSave24(left, 0)
+					} else if left.getGtype().isString() {
+						emitSave16(left, 0)
 					} else {
 						emit("pop %%rax")
 						emitSave(left)
@@ -579,13 +652,15 @@ func (ast *StmtAssignment) emit() {
 			assignToInterface(left, right)
 		case gtype.getKind() == G_MAP:
 			assignToMap(left, right)
+		case gtype.getKind() == G_STRING:
+			assignToString(left, right)
 		default:
 			// suppose primitive
 			emitAssignPrimitive(left, right)
 		}
 		if leftsMayBeTwo && len(ast.lefts) == 2 {
 			okVariable := ast.lefts[1]
-			okRegister := mapOkRegister(right.getGtype().is24Width())
+			okRegister := mapOkRegister(right.getGtype())
 			emit("mov %%%s, %%rax # emit okValue", okRegister)
 			emitSave(okVariable)
 		}
@@ -595,8 +670,8 @@ func (ast *StmtAssignment) emit() {
 }
 
 func emitAssignPrimitive(left Expr, right Expr) {
-	assert(left.getGtype().getSize() <= 8, left.token(), fmt.Sprintf("invalid type for lhs: %s", left.getGtype()))
-	assert(right != nil || right.getGtype().getSize() <= 8, right.token(), fmt.Sprintf("invalid type for rhs: %s", right.getGtype()))
+	assert(left.getGtype().getSize() <= 8, left.token(), fmt.Sprintf("invalid type for lhs: %s", left.getGtype().String()))
+	assert(right != nil || right.getGtype().getSize() <= 8, right.token(), fmt.Sprintf("invalid type for rhs: %s", right.getGtype().String()))
 	right.emit()   //   expr => %rax
 	emitSave(left) //   %rax => memory
 }
@@ -634,7 +709,7 @@ func (e *ExprIndex) emitSave24() {
 	case collectionType.getKind() == G_ARRAY, collectionType.getKind() == G_SLICE, collectionType.getKind() == G_STRING:
 		e.collection.emit() // head address
 	case collectionType.getKind() == G_MAP:
-		e.emitMapSet(true)
+		e.emitMapSet(3)
 		return
 	default:
 		TBI(e.token(), "unable to handle %s", collectionType)
@@ -659,6 +734,27 @@ func (e *ExprIndex) emitSave24() {
 	emit("STORE_24_INDIRECT_FROM_STACK")
 }
 
+// save a string from stack
+func (e *ExprIndex) emitSave16() {
+	collectionType := e.collection.getGtype()
+	switch {
+	case collectionType.getKind() == G_ARRAY, collectionType.getKind() == G_SLICE:
+		e.collection.emit() // head address
+	case collectionType.getKind() == G_MAP:
+		e.emitMapSet(2)
+		return
+	default:
+		TBI(e.token(), "unable to handle %s", collectionType)
+	}
+	emit("PUSH_8 # head address of collection")
+	e.index.emit()
+	emit("IMUL_NUMBER %d # index * elementSize", collectionType.elementType.getSize())
+	emit("PUSH_8 # index * elementSize")
+	emit("SUM_FROM_STACK # (index * size) + address")
+	emit("PUSH_8")
+	emit("STORE_16_INDIRECT_FROM_STACK")
+}
+
 func (e *ExprIndex) emitSave() {
 	collectionType := e.collection.getGtype()
 	switch {
@@ -666,7 +762,7 @@ func (e *ExprIndex) emitSave() {
 		emitCollectIndexSave(e.collection, e.index, 0)
 	case collectionType.getKind() == G_MAP:
 		emit("PUSH_8") // push RHS value
-		e.emitMapSet(false)
+		e.emitMapSet(1)
 		return
 	default:
 		TBI(e.token(), "unable to handle %s", collectionType)
@@ -700,6 +796,7 @@ func (e *ExprStructField) emitOffsetLoad(size int, offset int) {
 
 func (stmt *StmtIf) emit() {
 	emit("# if")
+	emitLoc(stmt.tok)
 	if stmt.simplestmt != nil {
 		stmt.simplestmt.emit()
 	}
@@ -739,7 +836,11 @@ func (stmt *StmtSwitch) emit() {
 	if stmt.cond != nil {
 		emit("# the subject expression")
 		stmt.cond.emit()
-		emit("PUSH_8 # the subject value")
+		if !stmt.isTypeSwitch && stmt.cond.getGtype().isString() {
+			emit("PUSH_STRING # the subject value")
+		} else {
+			emit("PUSH_8 # the subject value")
+		}
 		emit("#")
 	} else {
 		// switch {
@@ -750,53 +851,70 @@ func (stmt *StmtSwitch) emit() {
 	//     stmt1;
 	//     stmt2;
 	//     ...
-	for i, caseClause := range stmt.cases {
-		emit("# case %d", i)
-		myCaseLabel := makeLabel()
-		labels = append(labels, myCaseLabel)
-		if stmt.cond == nil {
-			for _, e := range caseClause.exprs {
-				e.emit()
-				emit("TEST_IT")
-				emit("jne %s # jump if matches", myCaseLabel)
-			}
-		} else if stmt.isTypeSwitch {
-			// compare type
-			for _, gtype := range caseClause.gtypes {
-				emit("# Duplicate the subject value in stack")
-				emit("POP_8")
-				emit("PUSH_8")
-				emit("PUSH_8")
-
-				if gtype.isNil() {
-					emit("mov $0, %%rax # nil")
-				} else {
-					typeLabel := groot.getTypeLabel(gtype)
-					emit("LOAD_STRING_LITERAL .%s # type: %s", typeLabel, gtype.String())
+	if stmt.cond != nil && !stmt.isTypeSwitch && stmt.cond.getGtype().isString() && stmt.hasOnlyStringLiterals() {
+		for i := 0; i < len(stmt.cases); i++ {
+			labels = append(labels, makeLabel())
+		}
+		stmt.emitStringLiteralDispatch(labels)
+	} else {
+		for i, caseClause := range stmt.cases {
+			emit("# case %d", i)
+			myCaseLabel := makeLabel()
+			labels = append(labels, myCaseLabel)
+			if stmt.cond == nil {
+				for _, e := range caseClause.exprs {
+					e.emit()
+					emit("TEST_IT")
+					emit("jne %s # jump if matches", myCaseLabel)
 				}
-				emit("PUSH_8")
-				emitStringsEqualFromStack(true)
+			} else if stmt.isTypeSwitch {
+				// compare type
+				for _, gtype := range caseClause.gtypes {
+					emit("# Duplicate the subject value in stack")
+					emit("POP_8")
+					emit("PUSH_8")
+					emit("PUSH_8")
+
+					if gtype.isNil() {
+						emit("mov $0, %%rax # nil")
+					} else {
+						typeLabel := groot.getTypeLabel(gtype)
+						emit("lea .%s(%%rip), %%rax # type: %s", typeLabel, gtype.String())
+					}
+					emit("PUSH_8")
+					emitCStringsEqualFromStack(true)
 
-				emit("TEST_IT")
-				emit("jne %s # jump if matches", myCaseLabel)
-			}
-		} else {
-			for _, e := range caseClause.exprs {
-				emit("# Duplicate the subject value in stack")
-				emit("POP_8")
-				emit("PUSH_8")
-				emit("PUSH_8")
-
-				e.emit()
-				emit("PUSH_8")
-				if e.getGtype().isString() {
+					emit("TEST_IT")
+					emit("jne %s # jump if matches", myCaseLabel)
+				}
+			} else if stmt.cond.getGtype().isString() {
+				for _, e := range caseClause.exprs {
+					emit("# Duplicate the subject value in stack")
+					emit("mov 8(%%rsp), %%rax")
+					emit("mov (%%rsp), %%rbx")
+					emit("PUSH_STRING")
+
+					e.emit()
+					emit("PUSH_STRING")
 					emitStringsEqualFromStack(true)
-				} else {
-					emit("CMP_FROM_STACK sete")
+
+					emit("TEST_IT")
+					emit("jne %s # jump if matches", myCaseLabel)
 				}
+			} else {
+				for _, e := range caseClause.exprs {
+					emit("# Duplicate the subject value in stack")
+					emit("POP_8")
+					emit("PUSH_8")
+					emit("PUSH_8")
+
+					e.emit()
+					emit("PUSH_8")
+					emit("CMP_FROM_STACK sete")
 
-				emit("TEST_IT")
-				emit("jne %s # jump if matches", myCaseLabel)
+					emit("TEST_IT")
+					emit("jne %s # jump if matches", myCaseLabel)
+				}
 			}
 		}
 	}
@@ -827,6 +945,85 @@ func (stmt *StmtSwitch) emit() {
 	emit("%s: # end of switch", labelEnd)
 }
 
+// stringLiteralOf returns the string literal that a case expression denotes, or nil
+func stringLiteralOf(e Expr) *ExprStringLiteral {
+	for e != nil {
+		lit, ok := e.(*ExprStringLiteral)
+		if ok {
+			return lit
+		}
+		rel, ok := e.(*Relation)
+		if ok {
+			e = rel.expr
+			continue
+		}
+		cnst, ok := e.(*ExprConstVariable)
+		if ok {
+			e = cnst.val
+			continue
+		}
+		return nil
+	}
+	return nil
+}
+
+func (stmt *StmtSwitch) hasOnlyStringLiterals() bool {
+	for _, caseClause := range stmt.cases {
+		for _, e := range caseClause.exprs {
+			if stringLiteralOf(e) == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// dispatch on the length of the subject string first,
+// and then compare its bytes only with the literals of the same length.
+// The subject value is on the stack (ptr at 8(%rsp), len at (%rsp)).
+func (stmt *StmtSwitch) emitStringLiteralDispatch(labels []string) {
+	emit("# dispatch by string length")
+	var lengths []int
+	for _, caseClause := range stmt.cases {
+		for _, e := range caseClause.exprs {
+			length := len(stringLiteralOf(e).val)
+			var seen bool
+			for _, l := range lengths {
+				if l == length {
+					seen = true
+				}
+			}
+			if !seen {
+				lengths = append(lengths, length)
+			}
+		}
+	}
+
+	for _, length := range lengths {
+		labelNextLength := makeLabel()
+		emit("cmpq $%d, (%%rsp) # subject len", length)
+		emit("jne %s", labelNextLength)
+		for i, caseClause := range stmt.cases {
+			for _, e := range caseClause.exprs {
+				lit := stringLiteralOf(e)
+				if len(lit.val) != length {
+					continue
+				}
+				if length == 0 {
+					emit("jmp %s # matches \"\"", labels[i])
+					continue
+				}
+				emit("mov 8(%%rsp), %%rsi # subject ptr")
+				emit("lea .%s(%%rip), %%rdi", lit.getLabel())
+				emit("mov $%d, %%rcx", length)
+				emit("repe cmpsb")
+				emit("je %s # jump if matches", labels[i])
+			}
+		}
+		emit("%s:", labelNextLength)
+	}
+}
+
 func (f *StmtFor) emitRangeForList() {
 	emitNewline()
 	emit("# for range %s", f.rng.rangeexpr.getGtype().String())
@@ -886,6 +1083,7 @@ func (f *StmtFor) emitRangeForList() {
 
 	f.block.emit()
 	emit("%s: # end block", f.labelEndBlock)
+	emitLoc(f.tok)
 
 	// break if i == len(list) - 1
 	condition2 := &ExprBinop{
@@ -934,6 +1132,7 @@ func (f *StmtFor) emitForClause() {
 	}
 	f.block.emit()
 	emit("%s: # end block", f.labelEndBlock)
+	emitLoc(f.tok)
 	if f.cls.post != nil {
 		f.cls.post.emit()
 	}
@@ -997,7 +1196,7 @@ func assignToStruct(lhs Expr, rhs Expr) {
 			elementType := arrayType.elementType
 			elmSize := arrayType.elementType.getSize()
 			switch {
-			case elementType.kind == G_NAMED && elementType.relation.gtype.kind == G_STRUCT:
+			case elementType.kind == G_NAMED && elementType.relation.gtype.kind == G_STRUCT, elementType.getKind() == G_STRING:
 				left := &ExprStructField{
 					strct:     lhs,
 					fieldname: fieldtype.fieldname,
@@ -1029,6 +1228,10 @@ func assignToStruct(lhs Expr, rhs Expr) {
 			emit("LOAD_EMPTY_INTERFACE")
 			emit("PUSH_INTERFACE")
 			emitSave24(lhs, fieldtype.offset)
+		case fieldtype.getKind() == G_STRING:
+			emit("LOAD_EMPTY_STRING")
+			emit("PUSH_STRING")
+			emitSave16(lhs, fieldtype.offset)
 		default:
 			emit("mov $0, %%rax")
 			regSize := fieldtype.getSize()
@@ -1081,7 +1284,7 @@ func assignToStruct(lhs Expr, rhs Expr) {
 				elementType := arrayType.elementType
 				elmSize := elementType.getSize()
 				switch {
-				case elementType.kind == G_NAMED && elementType.relation.gtype.kind == G_STRUCT:
+				case elementType.kind == G_NAMED && elementType.relation.gtype.kind == G_STRUCT, elementType.getKind() == G_STRING:
 					left := &ExprStructField{
 						strct:     lhs,
 						fieldname: fieldtype.fieldname,
@@ -1114,6 +1317,13 @@ func assignToStruct(lhs Expr, rhs Expr) {
 					fieldname: field.key,
 				}
 				assignToInterface(left, field.value)
+			case fieldtype.getKind() == G_STRING:
+				left := &ExprStructField{
+					tok:       lhs.token(),
+					strct:     lhs,
+					fieldname: field.key,
+				}
+				assignToString(left, field.value)
 			case fieldtype.kind == G_NAMED && fieldtype.relation.gtype.kind == G_STRUCT:
 				left := &ExprStructField{
 					tok:       variable.token(),
@@ -1186,6 +1396,28 @@ func emitSave24(lhs Expr, offset int) {
 	}
 }
 
+// take string values from stack
+func emitSave16(lhs Expr, offset int) {
+	emit("# emitSave16(?, offset %d)", offset)
+	switch lhs.(type) {
+	case *Relation:
+		rel := lhs.(*Relation)
+		emitSave16(rel.expr, offset)
+	case *ExprVariable:
+		variable := lhs.(*ExprVariable)
+		variable.emitSave16(offset)
+	case *ExprStructField:
+		structfield := lhs.(*ExprStructField)
+		fieldType := structfield.getGtype()
+		emitSave16(structfield.strct, fieldType.offset+offset)
+	case *ExprIndex:
+		indexExpr := lhs.(*ExprIndex)
+		indexExpr.emitSave16()
+	default:
+		errorft(lhs.token(), "unkonwn type %T", lhs)
+	}
+}
+
 func emitCallMallocDinamicSize(eSize Expr) {
 	eSize.emit()
 	emit("PUSH_8")
@@ -1200,6 +1432,52 @@ func emitCallMalloc(size int) {
 	emitCallMallocDinamicSize(eNumber)
 }
 
+// emitCallMallocOfType allocates size bytes for values of gtype.
+// The collector scans only the words which may hold pointers.
+func emitCallMallocOfType(size int, gtype *Gtype) {
+	var offsets []int = gtype.pointerOffsets()
+	emit("mov $%d, %%rax", size)
+	emit("PUSH_8")
+	if len(offsets) == 0 {
+		emit("POP_TO_ARG_0")
+		emit("FUNCALL iruntime.mallocNoscan")
+		return
+	}
+	emit("lea .%s(%%rip), %%rax", groot.getPointerMapLabel(gtype.getSize(), offsets))
+	emit("PUSH_8")
+	emit("POP_TO_ARG_1")
+	emit("POP_TO_ARG_0")
+	emit("FUNCALL iruntime.mallocTyped")
+}
+
+// new(T)
+func (e *ExprNew) emit() {
+	if e.onStack {
+		e.invisiblevar.emitZero()
+		e.invisiblevar.emitAddress(0)
+		return
+	}
+	emitCallMallocOfType(e.gtype.getSize(), e.gtype)
+}
+
+// fill a local variable with zeros
+func (variable *ExprVariable) emitZero() {
+	words := align(variable.getGtype().getSize(), 8) / 8
+	emit("LOAD_LOCAL_ADDR %d+0", variable.offset)
+	emit("mov %%rax, %%rdi")
+	emit("mov $%d, %%rcx", words)
+	emit("mov $0, %%rax")
+	emit("rep stosq")
+}
+
+// allocate a fresh heap copy of a variable which is moved to heap
+func (variable *ExprVariable) emitNewHeapBox() {
+	gtype := variable.getGtype()
+	emit("# new heap box for \"%s\"", variable.varname)
+	emitCallMallocOfType(gtype.getSize(), gtype)
+	emit("STORE_8_TO_LOCAL %d+0", variable.heapAddr.offset)
+}
+
 func assignToMap(lhs Expr, rhs Expr) {
 	emit("# assignToMap")
 	if rhs == nil {
@@ -1240,22 +1518,42 @@ func emitConversionToInterface(dynamicValue Expr) {
 
 	emit("# emitConversionToInterface from %s", dynamicValue.getGtype().String())
 	dynamicValue.emit()
-	emit("PUSH_8")
-	emitCallMalloc(8)
-	emit("PUSH_8")
-	emit("STORE_8_INDIRECT_FROM_STACK")
+	if receiverType.isString() {
+		emit("PUSH_STRING")
+		emitCallMallocOfType(16, receiverType)
+		emit("PUSH_8")
+		emit("STORE_16_INDIRECT_FROM_STACK")
+	} else if receiverType.getKind() == G_SLICE {
+		emit("PUSH_SLICE")
+		emitCallMallocOfType(24, receiverType)
+		emit("PUSH_8")
+		emit("STORE_24_INDIRECT_FROM_STACK")
+	} else {
+		emit("PUSH_8")
+		// the box holds a scalar value or an address
+		var boxType *Gtype = gInt
+		switch receiverType.getKind() {
+		case G_INT, G_BOOL, G_BYTE:
+		default:
+			boxType = &Gtype{kind: G_POINTER, origType: receiverType}
+		}
+		emitCallMallocOfType(8, boxType)
+		emit("PUSH_8")
+		emit("STORE_8_INDIRECT_FROM_STACK")
+	}
 	emit("PUSH_8 # addr of dynamicValue") // address
 
-	if receiverType.kind == G_POINTER {
-		receiverType = receiverType.origType.relation.gtype
+	methodTable := getMethodTableSymbol(receiverType)
+	if methodTable == "" {
+		emit("mov $0, %%rax # no methods")
+	} else {
+		emit("lea %s(%%rip), %%rax # methods", methodTable)
 	}
-	//assert(receiverType.receiverTypeId > 0,  dynamicValue.token(), "no receiverTypeId")
-	emit("LOAD_NUMBER %d # receiverTypeId", receiverType.receiverTypeId)
-	emit("PUSH_8 # receiverTypeId")
+	emit("PUSH_8 # methods")
 
 	gtype := dynamicValue.getGtype()
 	label := groot.getTypeLabel(gtype)
-	emit("lea .%s, %%rax# dynamicType %s", label, gtype.String())
+	emit("lea .%s(%%rip), %%rax # dynamicType %s", label, gtype.String())
 	emit("PUSH_8 # dynamicType")
 
 	emit("POP_INTERFACE")
@@ -1294,6 +1592,17 @@ func assignToInterface(lhs Expr, rhs Expr) {
 	emitSave24(lhs, 0)
 }
 
+func assignToString(lhs Expr, rhs Expr) {
+	emit("# assignToString")
+	if rhs == nil {
+		emit("LOAD_EMPTY_STRING")
+	} else {
+		rhs.emit()
+	}
+	emit("PUSH_STRING")
+	emitSave16(lhs, 0)
+}
+
 func assignToSlice(lhs Expr, rhs Expr) {
 	emit("# assignToSlice")
 	assertInterface(lhs)
@@ -1328,27 +1637,6 @@ func assignToSlice(lhs Expr, rhs Expr) {
 		e := rhs.(*ExprSlice)
 		e.emit()
 		emit("PUSH_SLICE")
-	case *ExprConversion:
-		// https://golang.org/ref/spec#Conversions
-		// Converting a value of a string type to a slice of bytes type
-		// yields a slice whose successive elements are the bytes of the string.
-		//
-		// see also https://blog.golang.org/strings
-		conversion := rhs.(*ExprConversion)
-		assert(conversion.gtype.kind == G_SLICE, rhs.token(), "must be a slice of bytes")
-		assert(conversion.expr.getGtype().kind == G_STRING || conversion.expr.getGtype().relation.gtype.kind == G_STRING, rhs.token(), "must be a string type, but got "+conversion.expr.getGtype().String())
-		stringVarname, ok := conversion.expr.(*Relation)
-		assert(ok, rhs.token(), "ok")
-		stringVariable := stringVarname.expr.(*ExprVariable)
-		stringVariable.emit()
-		emit("PUSH_8 # ptr")
-		strlen := &ExprLen{
-			arg: stringVariable,
-		}
-		strlen.emit()
-		emit("PUSH_8 # len")
-		emit("PUSH_8 # cap")
-
 	default:
 		//emit("# emit rhs of type %T %s", rhs, rhs.getGtype().String())
 		rhs.emit() // it should put values to rax,rbx,rcx
@@ -1368,6 +1656,14 @@ func (variable *ExprVariable) emitSave24(offset int) {
 	variable.emitOffsetSave(8, offset+0, true)
 }
 
+func (variable *ExprVariable) emitSave16(offset int) {
+	emit("# *ExprVariable.emitSave16()")
+	emit("pop %%rax # 2nd")
+	variable.emitOffsetSave(8, offset+8, false)
+	emit("pop %%rax # 1st")
+	variable.emitOffsetSave(8, offset+0, true)
+}
+
 // copy each element
 func assignToArray(lhs Expr, rhs Expr) {
 	emit("# assignToArray")
@@ -1396,6 +1692,30 @@ func assignToArray(lhs Expr, rhs Expr) {
 			assignToStruct(left, arrayLiteral.values[i])
 		}
 		return
+	case elementType.getKind() == G_STRING:
+		for i := 0; i < arrayType.length; i++ {
+			left := &ExprIndex{
+				collection: lhs,
+				index:      &ExprNumberLiteral{val: i},
+			}
+			var value Expr
+			switch rhs.(type) {
+			case nil:
+				// zero value
+			case *ExprArrayLiteral:
+				arrayLiteral := rhs.(*ExprArrayLiteral)
+				if i < len(arrayLiteral.values) {
+					value = arrayLiteral.values[i]
+				}
+			default:
+				value = &ExprIndex{
+					collection: rhs,
+					index:      &ExprNumberLiteral{val: i},
+				}
+			}
+			assignToString(left, value)
+		}
+		return
 	default: // prrimitive type or interface
 		for i := 0; i < arrayType.length; i++ {
 			offsetByIndex := i * elmSize
@@ -1468,6 +1788,9 @@ func (decl *DeclVar) emit() {
 
 func (decl *DeclVar) emitLocal() {
 	emit("# DeclVar \"%s\"", decl.variable.varname)
+	if decl.variable.heapAddr != nil {
+		decl.variable.emitNewHeapBox()
+	}
 	gtype := decl.variable.gtype
 	varname := decl.varname
 	switch {
@@ -1481,17 +1804,15 @@ func (decl *DeclVar) emitLocal() {
 		assignToMap(varname, decl.initval)
 	case gtype.getKind() == G_INTERFACE:
 		assignToInterface(varname, decl.initval)
+	case gtype.getKind() == G_STRING:
+		assignToString(varname, decl.initval)
 	default:
 		assert(decl.variable.getGtype().getSize() <= 8, decl.token(), "invalid type:"+gtype.String())
 		// primitive types like int,bool,byte
 		rhs := decl.initval
 		if rhs == nil {
-			if gtype.isString() {
-				rhs = &eEmptyString
-			} else {
-				// assign zero value
-				rhs = &ExprNumberLiteral{}
-			}
+			// assign zero value
+			rhs = &ExprNumberLiteral{}
 		}
 		emit("# LOAD RHS")
 		gasIndentLevel++
@@ -1500,8 +1821,12 @@ func (decl *DeclVar) emitLocal() {
 		comment := "initialize " + string(decl.variable.varname)
 		emit("# Assign to LHS")
 		gasIndentLevel++
-		emit("STORE_%d_TO_LOCAL %d # %s",
-			decl.variable.getGtype().getSize(), decl.variable.offset, comment)
+		if decl.variable.heapAddr != nil {
+			decl.variable.emitOffsetSave(decl.variable.getGtype().getSize(), 0, false)
+		} else {
+			emit("STORE_%d_TO_LOCAL %d # %s",
+				decl.variable.getGtype().getSize(), decl.variable.offset, comment)
+		}
 		gasIndentLevel--
 	}
 }
@@ -1521,6 +1846,7 @@ func (decl *DeclConst) emit() {
 func (ast *StmtSatementList) emit() {
 	for _, stmt := range ast.stmts {
 		emit("# Statement")
+		emitLoc(stmt.token())
 		gasIndentLevel++
 		stmt.emit()
 		gasIndentLevel--
@@ -1576,6 +1902,16 @@ func (e *ExprNilLiteral) emit() {
 }
 
 func (ast *StmtShortVarDecl) emit() {
+	for _, left := range ast.lefts {
+		rel, ok := left.(*Relation)
+		if !ok {
+			continue
+		}
+		variable, ok := rel.expr.(*ExprVariable)
+		if ok && variable.heapAddr != nil {
+			variable.emitNewHeapBox()
+		}
+	}
 	a := &StmtAssignment{
 		tok:    ast.tok,
 		lefts:  ast.lefts,
@@ -1602,7 +1938,7 @@ func (e *ExprTypeAssertion) emit() {
 		// x.(T) asserts that the dynamic type of x is identical to the type T.
 
 		e.expr.emit() // emit interface
-		// rax(ptr), rbx(receiverTypeId of method table), rcx(hashed receiverTypeId)
+		// rax(ptr), rbx(method table), rcx(dtype)
 		emit("PUSH_8")
 		// @TODO DRY with type switch statement
 		typeLabel := groot.getTypeLabel(e.gtype)
@@ -1610,15 +1946,31 @@ func (e *ExprTypeAssertion) emit() {
 
 		emit("push %%rcx") // @TODO ????
 		emit("PUSH_8")
-		emitStringsEqualFromStack(true)
+		emitCStringsEqualFromStack(true)
 
-		emit("mov %%rax, %%rbx") // move flag @TODO: this is BUG in slice,map cases
+		emit("mov %%rax, %%%s # move flag", mapOkRegister(e.gtype)) // @TODO: this is BUG in slice,map cases
 		// @TODO consider big data like slice, struct, etd
 		emit("pop %%rax # load ptr")
 		emit("TEST_IT")
 		labelEnd := makeLabel()
-		emit("je %s # jmp if nil", labelEnd)
-		emit("LOAD_8_BY_DEREF")
+		if e.gtype.isString() {
+			labelNil := makeLabel()
+			emit("je %s # jmp if nil", labelNil)
+			emit("LOAD_16_BY_DEREF")
+			emit("jmp %s", labelEnd)
+			emitWithoutIndent("%s:", labelNil)
+			emit("LOAD_EMPTY_STRING")
+		} else if e.gtype.getKind() == G_SLICE {
+			labelNil := makeLabel()
+			emit("je %s # jmp if nil", labelNil)
+			emit("LOAD_24_BY_DEREF")
+			emit("jmp %s", labelEnd)
+			emitWithoutIndent("%s:", labelNil)
+			emit("LOAD_EMPTY_SLICE")
+		} else {
+			emit("je %s # jmp if nil", labelEnd)
+			emit("LOAD_8_BY_DEREF")
+		}
 		emitWithoutIndent("%s:", labelEnd)
 	}
 }
@@ -1670,8 +2022,7 @@ func (ast *StmtDefer) emit() {
 		emit("pop %%%s", retRegi[i])
 	}
 
-	emit("leave")
-	emit("ret")
+	emit("LEAVE_AND_RET")
 	emit("%s: # defer end", labelEnd)
 
 }
@@ -1680,16 +2031,18 @@ func (e *ExprVaArg) emit() {
 	e.expr.emit()
 }
 
+// string(bytes) and []byte(s) copy the bytes
 func (e *ExprConversion) emit() {
 	emit("# ExprConversion.emit()")
-	if e.gtype.isString() {
-		// s = string(bytes)
-		labelEnd := makeLabel()
+	fromKind := e.expr.getGtype().getKind()
+	toKind := e.gtype.getKind()
+	if (toKind == G_STRING && fromKind == G_SLICE) || (toKind == G_SLICE && fromKind == G_STRING) {
 		e.expr.emit()
-		emit("TEST_IT")
-		emit("jne %s", labelEnd)
-		emitEmptyString()
-		emit("%s:", labelEnd)
+		emit("push %%rax # ptr")
+		emit("push %%rbx # len")
+		emit("POP_TO_ARG_1")
+		emit("POP_TO_ARG_0")
+		emit("FUNCALL iruntime.copybytes")
 	} else {
 		e.expr.emit()
 	}
@@ -1704,6 +2057,10 @@ func (e *ExprTypeSwitchGuard) emit() {
 	emit("mov %%rcx, %%rax # copy type id")
 }
 
+func (e *ExprBad) emit() {
+	errorft(e.token(), "bad expression cannot be emitted")
+}
+
 func (ast *ExprMethodcall) getUniqueName() string {
 	gtype := ast.receiver.getGtype()
 	return getMethodUniqueName(gtype, ast.fname)
@@ -1723,7 +2080,7 @@ func (methodCall *ExprMethodcall) getOrigType() *Gtype {
 	}
 	assert(typeToBeloing.kind == G_NAMED, methodCall.tok, "method must belong to a named type")
 	origType := typeToBeloing.relation.gtype
-	assert(typeToBeloing.relation.gtype != nil, methodCall.token(), fmt.Sprintf("origType should not be nil:%#v", typeToBeloing.relation))
+	assert(typeToBeloing.relation.gtype != nil, methodCall.token(), fmt.Sprintf("origType should not be nil:%s", string(typeToBeloing.relation.name)))
 	return origType
 }
 
@@ -1781,6 +2138,10 @@ func (methodCall *ExprMethodcall) emitInterfaceMethodCall() {
 }
 
 func (methodCall *ExprMethodcall) emit() {
+	if methodCall.inlined != nil {
+		methodCall.inlined.emit()
+		return
+	}
 	origType := methodCall.getOrigType()
 	if origType.kind == G_INTERFACE {
 		methodCall.emitInterfaceMethodCall()
@@ -1869,9 +2230,7 @@ func (e *ExprLen) emit() {
 		}
 	case gtype.getKind() == G_STRING:
 		arg.emit()
-		emit("PUSH_8")
-		emit("POP_TO_ARG_0")
-		emit("FUNCALL strlen")
+		emit("mov %%rbx, %%rax # len")
 	default:
 		TBI(arg.token(), "unable to handle %s", gtype)
 	}
@@ -1941,6 +2300,10 @@ func (funcall *ExprFuncallOrConversion) emit() {
 
 	assert(funcall.rel.expr != nil && funcall.rel.gtype == nil, funcall.token(), "this is conversion")
 	assert(funcall.getFuncDef() != nil, funcall.token(), "funcdef is nil")
+	if funcall.inlined != nil {
+		funcall.inlined.emit()
+		return
+	}
 	decl := funcall.getFuncDef()
 
 	// check if it's a builtin function
@@ -1975,6 +2338,9 @@ func (funcall *ExprFuncallOrConversion) emit() {
 		case 8:
 			staticCall.symbol = getFuncSymbol("iruntime", "append8")
 			staticCall.emit(funcall.args)
+		case 16:
+			staticCall.symbol = getFuncSymbol("iruntime", "append16")
+			staticCall.emit(funcall.args)
 		case 24:
 			if slice.getGtype().elementType.getKind() == G_INTERFACE && valueToAppend.getGtype().getKind() != G_INTERFACE {
 				eConvertion := &ExprConversionToInterface{
@@ -1993,12 +2359,20 @@ func (funcall *ExprFuncallOrConversion) emit() {
 		var staticCall *IrStaticCall = &IrStaticCall{
 			callee: decl,
 		}
-		staticCall.symbol = getFuncSymbol("iruntime", "makeSlice")
-		staticCall.emit(funcall.args)
+		if funcall.invisiblevar != nil {
+			// the backing array lives in the stack frame
+			funcall.invisiblevar.emitZero()
+			funcall.invisiblevar.emitAddress(0)
+			emit("mov $%d, %%rbx # len", funcall.args[0].(*ExprNumberLiteral).val)
+			emit("mov $%d, %%rcx # cap", funcall.args[1].(*ExprNumberLiteral).val)
+		} else {
+			staticCall.symbol = getFuncSymbol("iruntime", "makeSlice")
+			staticCall.emit(funcall.args)
+		}
 	case builtinDumpSlice:
 		arg := funcall.args[0]
 
-		emit("lea .%s, %%rax", builtinStringKey2)
+		emit("lea .%s(%%rip), %%rax", builtinStringKey2)
 		emit("PUSH_8")
 
 		arg.emit()
@@ -2009,12 +2383,12 @@ func (funcall *ExprFuncallOrConversion) emit() {
 			emit("POP_TO_ARG_%d", i)
 		}
 
-		emit("FUNCALL %s", "printf")
+		emit("FUNCALL %s", "printf@PLT")
 		emitNewline()
 	case builtinDumpInterface:
 		arg := funcall.args[0]
 
-		emit("lea .%s, %%rax", builtinStringKey1)
+		emit("lea .%s(%%rip), %%rax", builtinStringKey1)
 		emit("PUSH_8")
 
 		arg.emit()
@@ -2025,7 +2399,7 @@ func (funcall *ExprFuncallOrConversion) emit() {
 			emit("POP_TO_ARG_%d", i)
 		}
 
-		emit("FUNCALL %s", "printf")
+		emit("FUNCALL %s", "printf@PLT")
 		emitNewline()
 	case builtinAssertInterface:
 		emit("# builtinAssertInterface")
@@ -2046,12 +2420,15 @@ func (funcall *ExprFuncallOrConversion) emit() {
 		emit("je %s", labelEnd)
 
 		slabel := makeLabel()
+		msg := "assertInterface failed"
 		emit(".data 0")
 		emitWithoutIndent("%s:", slabel)
-		emit(".string \"%s\"", "assertInterface failed")
+		emit(".string \"%s\"", msg)
 		emit(".text")
-		emit("lea %s, %%rax", slabel)
-		emit("PUSH_8")
+		emit("lea %s(%%rip), %%rax", slabel)
+		emit("mov $%d, %%rbx", len(msg))
+		emit("PUSH_STRING")
+		emit("POP_TO_ARG_1")
 		emit("POP_TO_ARG_0")
 		emit("FUNCALL %s", ".panic")
 
@@ -2061,7 +2438,7 @@ func (funcall *ExprFuncallOrConversion) emit() {
 	case builtinAsComment:
 		arg := funcall.args[0]
 		if stringLiteral, ok := arg.(*ExprStringLiteral); ok {
-			emitWithoutIndent("# %s", stringLiteral.val)
+			emitWithoutIndent("# %s", escapeString(stringLiteral.val))
 		}
 	default:
 		var staticCall *IrStaticCall = &IrStaticCall{
@@ -2090,7 +2467,7 @@ func bool2string(bol bool) string {
 
 func emitMakeSliceFunc() {
 	// makeSlice
-	emitWithoutIndent("%s:", "iruntime.makeSlice")
+	emitFuncStart("iruntime.makeSlice", true)
 	emit("FUNC_PROLOGUE")
 	emitNewline()
 
@@ -2105,20 +2482,112 @@ func emitMakeSliceFunc() {
 
 	emit("PUSH_8")
 	emit("POP_TO_ARG_0")
+	emit("cmpq $1, -8(%%rbp) # []byte has no pointers")
+	emit("je .makeSlice_noscan")
 	emit("FUNCALL iruntime.malloc")
+	emit("jmp .makeSlice_allocated")
+	emitWithoutIndent(".makeSlice_noscan:")
+	emit("FUNCALL iruntime.mallocNoscan")
+	emitWithoutIndent(".makeSlice_allocated:")
 
 	emit("mov -24(%%rbp), %%rbx # newlen")
 	emit("mov -16(%%rbp), %%rcx # newcap")
 
 	emit("LEAVE_AND_RET")
+	emitFuncEnd("iruntime.makeSlice")
+	emitNewline()
+}
+
+// copybytes(ptr, len) returns a copy of len bytes at ptr
+// in rax (ptr), rbx (len) and rcx (cap)
+func emitCopyBytesFunc() {
+	emitFuncStart("iruntime.copybytes", true)
+	emit("FUNC_PROLOGUE")
+	emitNewline()
+
+	emit("PUSH_ARG_0") // -8
+	emit("PUSH_ARG_1") // -16
+
+	emit("mov -16(%%rbp), %%rax # len")
+	emit("PUSH_8")
+	emit("POP_TO_ARG_0")
+	emit("FUNCALL iruntime.mallocNoscan")
+
+	emit("mov %%rax, %%rdi # dest")
+	emit("mov -8(%%rbp), %%rsi # src")
+	emit("mov -16(%%rbp), %%rcx # len")
+	emit("rep movsb")
+
+	emit("mov -16(%%rbp), %%rbx # len")
+	emit("mov -16(%%rbp), %%rcx # cap")
+
+	emit("LEAVE_AND_RET")
+	emitFuncEnd("iruntime.copybytes")
+	emitNewline()
+}
+
+// cstring(ptr, len) returns a NUL-terminated copy of a string
+// to pass it to libc functions
+func emitCStringFunc() {
+	emitFuncStart("iruntime.cstring", true)
+	emit("FUNC_PROLOGUE")
+	emitNewline()
+
+	emit("PUSH_ARG_0") // -8
+	emit("PUSH_ARG_1") // -16
+
+	emit("mov -16(%%rbp), %%rax # len")
+	emit("ADD_NUMBER 1 # NUL")
+	emit("PUSH_8")
+	emit("POP_TO_ARG_0")
+	emit("FUNCALL iruntime.mallocNoscan")
+
+	emit("mov %%rax, %%rdi # dest")
+	emit("mov -8(%%rbp), %%rsi # src")
+	emit("mov -16(%%rbp), %%rcx # len")
+	emit("rep movsb")
+	emit("movb $0, (%%rdi)")
+
+	emit("LEAVE_AND_RET")
+	emitFuncEnd("iruntime.cstring")
+	emitNewline()
+}
+
+var gcSavedRegs []string = []string{"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15"}
+
+// gc() saves all the registers on the stack so that the collector can see them,
+// and calls iruntime.gcCollect(sp, dataStart, dataEnd)
+func emitGCFunc() {
+	emitFuncStart("iruntime.gc", true)
+	emit("FUNC_PROLOGUE")
+	emitNewline()
+
+	for _, regi := range gcSavedRegs {
+		emit("push %%%s", regi)
+	}
+	emit("mov %%rsp, %%rdi # sp")
+	emit("lea __data_start(%%rip), %%rsi")
+	emit("lea _end(%%rip), %%rdx")
+	emit("FUNCALL iruntime.gcCollect")
+	for i := len(gcSavedRegs) - 1; i >= 0; i-- {
+		emit("pop %%%s", gcSavedRegs[i])
+	}
+
+	emit("LEAVE_AND_RET")
+	emitFuncEnd("iruntime.gc")
 	emitNewline()
 }
 
 func (f *DeclFunc) emit() {
-	f.emitPrologue()
-	f.body.emit()
-	emit("mov $0, %%rax")
-	emitFuncEpilogue(f.labelDeferHandler, f.stmtDefer)
+	if f.ir != nil {
+		f.ir.emit()
+	} else {
+		f.emitPrologue()
+		f.body.emit()
+		emit("mov $0, %%rax")
+		emitFuncEpilogue(f.labelDeferHandler, f.stmtDefer)
+	}
+	emitFuncEnd(f.getSymbol())
 }
 
 func evalIntExpr(e Expr) int {
@@ -2140,6 +2609,18 @@ func evalIntExpr(e Expr) int {
 			return evalIntExpr(binop.left) - evalIntExpr(binop.right)
 		case "*":
 			return evalIntExpr(binop.left) * evalIntExpr(binop.right)
+		case "&":
+			return evalIntExpr(binop.left) & evalIntExpr(binop.right)
+		case "|":
+			return evalIntExpr(binop.left) | evalIntExpr(binop.right)
+		case "^":
+			return evalIntExpr(binop.left) ^ evalIntExpr(binop.right)
+		case "&^":
+			return evalIntExpr(binop.left) &^ evalIntExpr(binop.right)
+		case "<<":
+			return evalIntExpr(binop.left) << evalIntExpr(binop.right)
+		case ">>":
+			return evalIntExpr(binop.left) >> evalIntExpr(binop.right)
 
 		}
 	case *ExprConstVariable:
@@ -22,7 +22,9 @@ var retRegi [14]string = [14]string{
 var RegsForArguments [12]string = [12]string{"rdi", "rsi", "rdx", "rcx", "r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15"}
 
 func (f *DeclFunc) emitPrologue() {
-	emitWithoutIndent("%s:", f.getSymbol())
+	emitFuncStart(f.getSymbol(), f.isGlobalSymbol())
+	resetLoc()
+	emitLoc(f.tok)
 	emit("FUNC_PROLOGUE")
 
 	var params []*ExprVariable
@@ -54,6 +56,12 @@ func (f *DeclFunc) emitPrologue() {
 			emit("PUSH_ARG_%d # second", regIndex+1)
 			emit("PUSH_ARG_%d # fist \"%s\" %s", regIndex, param.varname, param.getGtype().String())
 			regIndex += sliceWidth
+		case G_STRING:
+			offset -= IntSize * 2
+			param.offset = offset
+			emit("PUSH_ARG_%d # second", regIndex+1)
+			emit("PUSH_ARG_%d # fist \"%s\" %s", regIndex, param.varname, param.getGtype().String())
+			regIndex += stringWidth
 		default:
 			offset -= IntSize
 			param.offset = offset
@@ -89,15 +97,59 @@ func (f *DeclFunc) emitPrologue() {
 		emit("sub $%d, %%rsp # total stack size", -localarea)
 	}
 
+	// variables moved to heap get their boxes here,
+	// and params are copied into them
+	for _, param := range params {
+		if param.heapAddr == nil {
+			continue
+		}
+		param.emitNewHeapBox()
+		size := param.getGtype().getSize()
+		if size == 1 {
+			emit("LOAD_8_FROM_LOCAL %d+0", param.offset)
+			emit("PUSH_8")
+			emit("LOAD_8_FROM_LOCAL %d+0", param.heapAddr.offset)
+			emit("PUSH_8")
+			emit("STORE_1_INDIRECT_FROM_STACK")
+			continue
+		}
+		for w := 0; w < size; w = w + 8 {
+			emit("LOAD_8_FROM_LOCAL %d+%d", param.offset, w)
+			emit("PUSH_8")
+			emit("LOAD_8_FROM_LOCAL %d+0", param.heapAddr.offset)
+			emit("ADD_NUMBER %d", w)
+			emit("PUSH_8")
+			emit("STORE_8_INDIRECT_FROM_STACK")
+		}
+	}
+	for _, lvar := range f.localvars {
+		if lvar.heapAddr != nil {
+			lvar.emitNewHeapBox()
+		}
+	}
+
 	emitNewline()
 }
 
 func (ircall *IrStaticCall) emit(args []Expr) {
-	// nothing to do
+	// The callee may clobber any register (see regalloc.go),
+	// but the code from the AST keeps no value in registers across a call.
 	emit("# emitCall %s", ircall.symbol)
 
 	var numRegs int
 	var param *ExprVariable
+	var params []*ExprVariable
+
+	// args of a method call include its receiver
+	if ircall.callee.receiver != nil {
+		params = []*ExprVariable{ircall.callee.receiver}
+		for _, prm := range ircall.callee.params {
+			params = append(params, prm)
+		}
+	} else {
+		params = ircall.callee.params
+	}
+
 	var collectVariadicArgs bool // gather variadic args into a slice
 	var variadicArgs []Expr
 	var arg Expr
@@ -109,8 +161,14 @@ func (ircall *IrStaticCall) emit(args []Expr) {
 			fromGtype = arg.getGtype().String()
 		}
 		emit("# from %s", fromGtype)
-		if argIndex < len(ircall.callee.params) {
-			param = ircall.callee.params[argIndex]
+		if ircall.callee.pkg == "libc" {
+			emitLibcArg(arg)
+			emit("PUSH_8")
+			numRegs++
+			continue
+		}
+		if argIndex < len(params) {
+			param = params[argIndex]
 			if param.isVariadic {
 				if _, ok := arg.(*ExprVaArg); !ok {
 					collectVariadicArgs = true
@@ -127,7 +185,7 @@ func (ircall *IrStaticCall) emit(args []Expr) {
 
 		// do not convert receiver
 		if !ircall.isMethodCall || argIndex != 0 {
-			if param != nil && ircall.symbol != "printf" {
+			if param != nil {
 				emit("# has a corresponding param")
 
 				var fromGtype *Gtype
@@ -142,16 +200,13 @@ func (ircall *IrStaticCall) emit(args []Expr) {
 					emit("# toGtype:%s", toGtype.String())
 				}
 
-				if toGtype != nil && toGtype.getKind() == G_INTERFACE && fromGtype != nil && fromGtype.getKind() != G_INTERFACE {
+				// nil is converted to an empty interface
+				if toGtype != nil && toGtype.getKind() == G_INTERFACE && (fromGtype == nil || fromGtype.getKind() != G_INTERFACE) {
 					doConvertToInterface = true
 				}
 			}
 		}
 
-		if ircall.symbol == ".println" {
-			doConvertToInterface = false
-		}
-
 		emit("# arg %d, doConvertToInterface=%s, collectVariadicArgs=%s",
 			argIndex, bool2string(doConvertToInterface), bool2string(collectVariadicArgs))
 
@@ -176,6 +231,9 @@ func (ircall *IrStaticCall) emit(args []Expr) {
 		} else if primType == G_MAP {
 			emit("PUSH_MAP")
 			width = mapWidth
+		} else if primType == G_STRING {
+			emit("PUSH_STRING")
+			width = stringWidth
 		} else {
 			emit("PUSH_8")
 			width = 1
@@ -187,8 +245,8 @@ func (ircall *IrStaticCall) emit(args []Expr) {
 	// https://golang.org/ref/spec#Passing_arguments_to_..._parameters
 	// If f is invoked with no actual arguments for p, the value passed to p is nil.
 	if !collectVariadicArgs {
-		if argIndex+1 < len(ircall.callee.params) {
-			param = ircall.callee.params[argIndex+1]
+		if argIndex+1 < len(params) {
+			param = params[argIndex+1]
 			if param.isVariadic {
 				collectVariadicArgs = true
 			}
@@ -231,6 +289,10 @@ func (ircall *IrStaticCall) emit(args []Expr) {
 		numRegs += 3
 	}
 
+	// libc takes the rest of the arguments on the stack, which is not supported
+	if ircall.callee.pkg == "libc" && numRegs > 6 {
+		errorft(args[0].token(), "too many arguments for %s", ircall.symbol)
+	}
 	for i := numRegs - 1; i >= 0; i-- {
 		if i >= len(RegsForArguments) {
 			errorft(args[0].token(), "too many arguments")
@@ -238,10 +300,55 @@ func (ircall *IrStaticCall) emit(args []Expr) {
 		emit("POP_TO_ARG_%d", i)
 	}
 
-	emit("FUNCALL %s", ircall.symbol)
+	if ircall.callee.pkg == "libc" {
+		emit("FUNCALL_LIBC %s", ircall.symbol)
+	} else {
+		emit("FUNCALL %s", ircall.symbol)
+	}
 	emitNewline()
 }
 
+// emitLibcArg loads an argument of a libc function into %rax.
+// C takes a NUL-terminated copy of a string, and the pointer of a slice.
+func emitLibcArg(arg Expr) {
+	if uop, ok := arg.(*ExprUop); ok && uop.op == "*" && uop.operand.getGtype().getKind() == G_INTERFACE {
+		emitDynamicValueForLibc(uop.operand)
+		return
+	}
+	arg.emit()
+	if _, ok := arg.(*ExprStringLiteral); ok {
+		// string literals are NUL-terminated in the data section
+		return
+	}
+	if arg.getGtype().isString() {
+		emit("PUSH_STRING")
+		emit("POP_TO_ARG_1")
+		emit("POP_TO_ARG_0")
+		emit("FUNCALL iruntime.cstring")
+	}
+}
+
+// *ifc passes the dynamic value of ifc to a variadic libc function like sprintf.
+// A string is identified by the kind stored just before its type label.
+func emitDynamicValueForLibc(ifc Expr) {
+	labelNotString := makeLabel()
+	labelEnd := makeLabel()
+	ifc.emit() // rax=ptr, rbx=receverTypeId, rcx=dynamicTypeId
+	emit("test %%rcx, %%rcx")
+	emit("je %s # nil", labelNotString)
+	emit("cmpq $%d, -8(%%rcx) # kind of the dynamic type", G_STRING)
+	emit("jne %s", labelNotString)
+	emit("LOAD_16_BY_DEREF")
+	emit("PUSH_STRING")
+	emit("POP_TO_ARG_1")
+	emit("POP_TO_ARG_0")
+	emit("FUNCALL iruntime.cstring")
+	emit("jmp %s", labelEnd)
+	emitWithoutIndent("%s:", labelNotString)
+	emit("LOAD_8_BY_DEREF")
+	emitWithoutIndent("%s:", labelEnd)
+}
+
 func (stmt *StmtReturn) emit() {
 	if len(stmt.exprs) == 0 {
 		// return void
@@ -0,0 +1,457 @@
+// DWARF debug information.
+// The line table is made by the assembler from the .loc directives
+// emitted before statements. The functions, their params and local variables,
+// the global variables and their types are described in .debug_info.
+package main
+
+import "fmt"
+
+var dwarfEnabled = true // -w disables it
+
+// abbreviation codes
+const (
+	DW_ABBREV_COMPILE_UNIT int = 1
+	DW_ABBREV_SUBPROGRAM   int = 2
+	DW_ABBREV_PARAM        int = 3
+	DW_ABBREV_VARIABLE     int = 4
+	DW_ABBREV_BASE_TYPE    int = 5
+	DW_ABBREV_POINTER_TYPE int = 6
+	DW_ABBREV_VOID_POINTER int = 7
+	DW_ABBREV_STRUCT_TYPE  int = 8
+	DW_ABBREV_MEMBER       int = 9
+	DW_ABBREV_TYPEDEF      int = 10
+	DW_ABBREV_ARRAY_TYPE   int = 11
+	DW_ABBREV_SUBRANGE     int = 12
+)
+
+const (
+	DW_OP_addr   int = 0x03
+	DW_OP_deref  int = 0x06
+	DW_OP_fbreg  int = 0x91
+	DW_OP_breg6  int = 0x76 // rbp
+	DW_LANG_Go   int = 0x16
+	DW_ATE_bool  int = 0x02
+	DW_ATE_int   int = 0x05
+	DW_ATE_uchar int = 0x08
+)
+
+var dwarfFiles []string // the file number is the index + 1
+var dwarfLocFile int
+var dwarfLocLine int
+
+// type DIEs are emitted after the functions, one for each name
+var dwarfTypeNames []string
+var dwarfTypes []*Gtype
+
+// resetDebugInfo forgets the files and the types of the object emitted before
+func resetDebugInfo() {
+	dwarfFiles = nil
+	dwarfLocFile = 0
+	dwarfLocLine = 0
+	dwarfTypeNames = nil
+	dwarfTypes = nil
+}
+
+// emitLoc tells the assembler the source position of the code which follows
+func emitLoc(tok *Token) {
+	if !dwarfEnabled || tok == nil || tok.filename == "" || tok.line == 0 {
+		return
+	}
+	file := get_index(tok.filename, dwarfFiles) + 1
+	if file == 0 {
+		dwarfFiles = append(dwarfFiles, tok.filename)
+		file = len(dwarfFiles)
+		emit(".file %d \"%s\"", file, tok.filename)
+	}
+	if file == dwarfLocFile && tok.line == dwarfLocLine {
+		return
+	}
+	dwarfLocFile = file
+	dwarfLocLine = tok.line
+	emit(".loc %d %d %d", file, tok.line, tok.column)
+}
+
+// every function starts a new row in the line table
+func resetLoc() {
+	dwarfLocFile = 0
+	dwarfLocLine = 0
+}
+
+// the number of bytes of a signed LEB128 number
+func sleb128Size(n int) int {
+	// a negative number takes as many bytes as its complement
+	if n < 0 {
+		n = -n - 1
+	}
+	size := 1
+	for n >= 64 {
+		n = n / 128
+		size++
+	}
+	return size
+}
+
+// a Go like name of a type, by which type DIEs are shared
+func dwarfTypeName(gtype *Gtype) string {
+	if gtype == nil {
+		return "unsafe.Pointer"
+	}
+	switch gtype.kind {
+	case G_NAMED:
+		if gtype.relation == nil || gtype.relation.gtype == nil {
+			return "unsafe.Pointer"
+		}
+		switch gtype.relation.gtype {
+		case gBool, gByte, gInt, gString:
+			return gtype.relation.gtype.String()
+		}
+		if gtype.relation.pkg == "" {
+			return string(gtype.relation.name)
+		}
+		return fmt.Sprintf("%s.%s", gtype.relation.pkg, gtype.relation.name)
+	case G_INT:
+		return "int"
+	case G_BOOL:
+		return "bool"
+	case G_BYTE:
+		return "byte"
+	case G_STRING:
+		return "string"
+	case G_POINTER:
+		return "*" + dwarfTypeName(gtype.origType)
+	case G_SLICE:
+		return "[]" + dwarfTypeName(gtype.elementType)
+	case G_ARRAY:
+		return fmt.Sprintf("[%d]%s", gtype.length, dwarfTypeName(gtype.elementType))
+	case G_MAP:
+		return fmt.Sprintf("map[%s]%s", dwarfTypeName(gtype.mapKey), dwarfTypeName(gtype.mapValue))
+	case G_INTERFACE:
+		return "interface {}"
+	case G_STRUCT:
+		r := "struct {"
+		for i, field := range gtype.fields {
+			if i > 0 {
+				r += ";"
+			}
+			r += fmt.Sprintf(" %s %s", field.fieldname, dwarfTypeName(field))
+		}
+		return r + " }"
+	}
+	// functions and unknown types
+	return "unsafe.Pointer"
+}
+
+// the reference to the DIE of the type, which is emitted later
+func dwarfTypeRef(gtype *Gtype) string {
+	name := dwarfTypeName(gtype)
+	index := get_index(name, dwarfTypeNames)
+	if index < 0 {
+		index = len(dwarfTypeNames)
+		dwarfTypeNames = append(dwarfTypeNames, name)
+		dwarfTypes = append(dwarfTypes, gtype)
+	}
+	return fmt.Sprintf(".Ldwarf_type%d-.Ldebug_info0", index)
+}
+
+func emitAbbrev(code int, tag string, children bool, attrs []string) {
+	emit(".uleb128 %d", code)
+	emit(".uleb128 %s", tag)
+	if children {
+		emit(".byte 1 # DW_CHILDREN_yes")
+	} else {
+		emit(".byte 0 # DW_CHILDREN_no")
+	}
+	for i := 0; i < len(attrs); i += 2 {
+		emit(".uleb128 %s", attrs[i])
+		emit(".uleb128 %s", attrs[i+1])
+	}
+	emit(".byte 0")
+	emit(".byte 0")
+}
+
+func emitDebugAbbrev() {
+	emit(".section .debug_abbrev,\"\",@progbits")
+	emitWithoutIndent(".Ldebug_abbrev0:")
+	emitAbbrev(DW_ABBREV_COMPILE_UNIT, "0x11 # DW_TAG_compile_unit", true, []string{
+		"0x25", "0x08 # DW_AT_producer, DW_FORM_string",
+		"0x13", "0x0b # DW_AT_language, DW_FORM_data1",
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x1b", "0x08 # DW_AT_comp_dir, DW_FORM_string",
+		"0x11", "0x01 # DW_AT_low_pc, DW_FORM_addr",
+		"0x12", "0x07 # DW_AT_high_pc, DW_FORM_data8",
+		"0x10", "0x17 # DW_AT_stmt_list, DW_FORM_sec_offset",
+	})
+	emitAbbrev(DW_ABBREV_SUBPROGRAM, "0x2e # DW_TAG_subprogram", true, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x3a", "0x0f # DW_AT_decl_file, DW_FORM_udata",
+		"0x3b", "0x0f # DW_AT_decl_line, DW_FORM_udata",
+		"0x11", "0x01 # DW_AT_low_pc, DW_FORM_addr",
+		"0x12", "0x07 # DW_AT_high_pc, DW_FORM_data8",
+		"0x40", "0x18 # DW_AT_frame_base, DW_FORM_exprloc",
+	})
+	emitAbbrev(DW_ABBREV_PARAM, "0x05 # DW_TAG_formal_parameter", false, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x49", "0x13 # DW_AT_type, DW_FORM_ref4",
+		"0x02", "0x18 # DW_AT_location, DW_FORM_exprloc",
+	})
+	emitAbbrev(DW_ABBREV_VARIABLE, "0x34 # DW_TAG_variable", false, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x49", "0x13 # DW_AT_type, DW_FORM_ref4",
+		"0x02", "0x18 # DW_AT_location, DW_FORM_exprloc",
+	})
+	emitAbbrev(DW_ABBREV_BASE_TYPE, "0x24 # DW_TAG_base_type", false, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x0b", "0x0b # DW_AT_byte_size, DW_FORM_data1",
+		"0x3e", "0x0b # DW_AT_encoding, DW_FORM_data1",
+	})
+	emitAbbrev(DW_ABBREV_POINTER_TYPE, "0x0f # DW_TAG_pointer_type", false, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x0b", "0x0b # DW_AT_byte_size, DW_FORM_data1",
+		"0x49", "0x13 # DW_AT_type, DW_FORM_ref4",
+	})
+	emitAbbrev(DW_ABBREV_VOID_POINTER, "0x0f # DW_TAG_pointer_type", false, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x0b", "0x0b # DW_AT_byte_size, DW_FORM_data1",
+	})
+	emitAbbrev(DW_ABBREV_STRUCT_TYPE, "0x13 # DW_TAG_structure_type", true, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x0b", "0x0f # DW_AT_byte_size, DW_FORM_udata",
+	})
+	emitAbbrev(DW_ABBREV_MEMBER, "0x0d # DW_TAG_member", false, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x49", "0x13 # DW_AT_type, DW_FORM_ref4",
+		"0x38", "0x0f # DW_AT_data_member_location, DW_FORM_udata",
+	})
+	emitAbbrev(DW_ABBREV_TYPEDEF, "0x16 # DW_TAG_typedef", false, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x49", "0x13 # DW_AT_type, DW_FORM_ref4",
+	})
+	emitAbbrev(DW_ABBREV_ARRAY_TYPE, "0x01 # DW_TAG_array_type", true, []string{
+		"0x03", "0x08 # DW_AT_name, DW_FORM_string",
+		"0x49", "0x13 # DW_AT_type, DW_FORM_ref4",
+	})
+	emitAbbrev(DW_ABBREV_SUBRANGE, "0x21 # DW_TAG_subrange_type", false, []string{
+		"0x37", "0x0f # DW_AT_count, DW_FORM_udata",
+	})
+	emit(".byte 0")
+}
+
+// the name of a function as Go tools show it, like main.(*T).m
+func dwarfFuncName(f *DeclFunc) string {
+	if f.receiver == nil {
+		return f.getSymbol()
+	}
+	gtype := f.receiver.getGtype()
+	if gtype.kind == G_POINTER {
+		return fmt.Sprintf("%s.(*%s).%s", f.pkg, gtype.origType.relation.name, f.fname)
+	}
+	return fmt.Sprintf("%s.%s.%s", f.pkg, gtype.relation.name, f.fname)
+}
+
+func emitDebugVariable(code int, variable *ExprVariable) {
+	if variable.varname == "" || variable.varname == "_" {
+		return
+	}
+	emit(".uleb128 %d # %s", code, variable.varname)
+	emit(".string \"%s\"", variable.varname)
+	emit(".long %s", dwarfTypeRef(variable.getGtype()))
+	if variable.isGlobal {
+		emit(".uleb128 9")
+		emit(".byte %d # DW_OP_addr", DW_OP_addr)
+		emit(".quad %s", variable.varname)
+		return
+	}
+	if variable.heapAddr != nil {
+		// the box in the heap is pointed by a local
+		offset := variable.heapAddr.offset
+		emit(".uleb128 %d", 2+sleb128Size(offset))
+		emit(".byte %d # DW_OP_fbreg", DW_OP_fbreg)
+		emit(".sleb128 %d", offset)
+		emit(".byte %d # DW_OP_deref", DW_OP_deref)
+		return
+	}
+	emit(".uleb128 %d", 1+sleb128Size(variable.offset))
+	emit(".byte %d # DW_OP_fbreg", DW_OP_fbreg)
+	emit(".sleb128 %d", variable.offset)
+}
+
+func emitDebugFunc(f *DeclFunc) {
+	symbol := f.getSymbol()
+	emit(".uleb128 %d # %s", DW_ABBREV_SUBPROGRAM, symbol)
+	emit(".string \"%s\"", dwarfFuncName(f))
+	emit(".uleb128 %d", get_index(f.tok.filename, dwarfFiles)+1)
+	emit(".uleb128 %d", f.tok.line)
+	emit(".quad %s", symbol)
+	emit(".quad .Lfunc_end.%s-%s", symbol, symbol)
+	// the frame base is rbp, where the offsets of variables are from
+	emit(".uleb128 2")
+	emit(".byte %d # DW_OP_breg6", DW_OP_breg6)
+	emit(".sleb128 0")
+
+	// the values of a function from the IR live in registers
+	// which the register allocator chose, so they are not described.
+	if f.ir == nil {
+		if f.receiver != nil {
+			emitDebugVariable(DW_ABBREV_PARAM, f.receiver)
+		}
+		for _, param := range f.params {
+			emitDebugVariable(DW_ABBREV_PARAM, param)
+		}
+		for _, variable := range f.localvars {
+			if variable.isInlineCopy {
+				continue
+			}
+			// the box of a variable moved to the heap is found by the variable
+			if len(variable.varname) > 0 && variable.varname[0] == '&' {
+				continue
+			}
+			emitDebugVariable(DW_ABBREV_VARIABLE, variable)
+		}
+	}
+	emit(".byte 0 # end of %s", symbol)
+}
+
+func emitDebugMember(name string, gtype *Gtype, offset int) {
+	emit(".uleb128 %d", DW_ABBREV_MEMBER)
+	emit(".string \"%s\"", name)
+	emit(".long %s", dwarfTypeRef(gtype))
+	emit(".uleb128 %d", offset)
+}
+
+func emitDebugStruct(name string, size int) {
+	emit(".uleb128 %d", DW_ABBREV_STRUCT_TYPE)
+	emit(".string \"%s\"", name)
+	emit(".uleb128 %d", size)
+}
+
+func emitDebugType(name string, gtype *Gtype) {
+	if name == "unsafe.Pointer" {
+		emit(".uleb128 %d", DW_ABBREV_VOID_POINTER)
+		emit(".string \"%s\"", name)
+		emit(".byte %d", ptrSize)
+		return
+	}
+	// the predeclared types are named by themselves
+	if gtype.kind == G_NAMED && gtype.relation.gtype.kind != G_STRUCT && dwarfTypeName(gtype.relation.gtype) != name {
+		emit(".uleb128 %d", DW_ABBREV_TYPEDEF)
+		emit(".string \"%s\"", name)
+		emit(".long %s", dwarfTypeRef(gtype.relation.gtype))
+		return
+	}
+	bytePointer := &Gtype{
+		kind:     G_POINTER,
+		origType: gByte,
+	}
+	underlying := gtype.Underlying()
+	switch underlying.kind {
+	case G_INT, G_BOOL, G_BYTE:
+		encoding := DW_ATE_int
+		if underlying.kind == G_BOOL {
+			encoding = DW_ATE_bool
+		} else if underlying.kind == G_BYTE {
+			encoding = DW_ATE_uchar
+		}
+		emit(".uleb128 %d", DW_ABBREV_BASE_TYPE)
+		emit(".string \"%s\"", name)
+		emit(".byte %d", underlying.getSize())
+		emit(".byte %d", encoding)
+	case G_POINTER:
+		emit(".uleb128 %d", DW_ABBREV_POINTER_TYPE)
+		emit(".string \"%s\"", name)
+		emit(".byte %d", ptrSize)
+		emit(".long %s", dwarfTypeRef(underlying.origType))
+	case G_ARRAY:
+		emit(".uleb128 %d", DW_ABBREV_ARRAY_TYPE)
+		emit(".string \"%s\"", name)
+		emit(".long %s", dwarfTypeRef(underlying.elementType))
+		emit(".uleb128 %d", DW_ABBREV_SUBRANGE)
+		emit(".uleb128 %d", underlying.length)
+		emit(".byte 0")
+	case G_STRING:
+		emitDebugStruct(name, underlying.getSize())
+		emitDebugMember("str", bytePointer, 0)
+		emitDebugMember("len", gInt, ptrSize)
+		emit(".byte 0")
+	case G_SLICE:
+		elementPointer := &Gtype{
+			kind:     G_POINTER,
+			origType: underlying.elementType,
+		}
+		emitDebugStruct(name, underlying.getSize())
+		emitDebugMember("array", elementPointer, 0)
+		emitDebugMember("len", gInt, ptrSize)
+		emitDebugMember("cap", gInt, ptrSize+IntSize)
+		emit(".byte 0")
+	case G_MAP:
+		emitDebugStruct(name, underlying.getSize())
+		emitDebugMember("ptr", nil, 0)
+		emitDebugMember("len", gInt, ptrSize)
+		emitDebugMember("cap", gInt, ptrSize+IntSize)
+		emit(".byte 0")
+	case G_INTERFACE:
+		emitDebugStruct(name, underlying.getSize())
+		emitDebugMember("data", nil, 0)
+		emitDebugMember("methods", nil, ptrSize)
+		emitDebugMember("dtype", bytePointer, ptrSize+IntSize)
+		emit(".byte 0")
+	case G_STRUCT:
+		emitDebugStruct(name, underlying.getSize())
+		for _, field := range underlying.fields {
+			emitDebugMember(string(field.fieldname), field, field.offset)
+		}
+		emit(".byte 0")
+	}
+}
+
+func (root *IrRoot) emitDebugInfo() {
+	emitDebugAbbrev()
+
+	var name string
+	mainPkg := root.packages[len(root.packages)-1]
+	if len(mainPkg.files) > 0 {
+		name = mainPkg.files[0].name
+	}
+
+	emitNewline()
+	emit(".section .debug_info,\"\",@progbits")
+	emitWithoutIndent(".Ldebug_info0:")
+	emit(".long .Ldebug_info_end-.Ldebug_info_start # unit length")
+	emitWithoutIndent(".Ldebug_info_start:")
+	emit(".value 4 # DWARF version")
+	emit(".long .Ldebug_abbrev0")
+	emit(".byte %d # address size", ptrSize)
+
+	emit(".uleb128 %d", DW_ABBREV_COMPILE_UNIT)
+	emit(".string \"minigo\"")
+	emit(".byte %d", DW_LANG_Go)
+	emit(".string \"%s\"", name)
+	emit(".string \".\"")
+	emit(".quad .Ltext0")
+	emit(".quad .Letext0-.Ltext0")
+	emit(".long .Ldebug_line0")
+
+	for _, pkg := range root.packages {
+		for _, vardecl := range pkg.vars {
+			emitDebugVariable(DW_ABBREV_VARIABLE, vardecl.variable)
+		}
+	}
+	for _, pkg := range root.packages {
+		for _, funcdecl := range pkg.funcs {
+			if funcdecl.dead {
+				continue
+			}
+			emitDebugFunc(funcdecl)
+		}
+	}
+	// the list grows while types refer to other types
+	for i := 0; i < len(dwarfTypes); i++ {
+		emitWithoutIndent(".Ldwarf_type%d:", i)
+		emitDebugType(dwarfTypeNames[i], dwarfTypes[i])
+	}
+	emit(".byte 0 # end of compile unit")
+	emitWithoutIndent(".Ldebug_info_end:")
+
+	// the assembler puts the line table made from .loc here
+	emit(".section .debug_line,\"\",@progbits")
+	emitWithoutIndent(".Ldebug_line0:")
+}
@@ -1,11 +1,15 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // gloabal var which should be initialized with zeros
 // https://en.wikipedia.org/wiki/.bss
 func (decl *DeclVar) emitBss() {
 	emit(".data")
+	decl.emitSymbolInfo()
 	// https://sourceware.org/binutils/docs-2.30/as/Lcomm.html#Lcomm
 	emit(".lcomm %s, %d", decl.variable.varname, decl.variable.getGtype().getSize())
 }
@@ -17,6 +21,9 @@ func (decl *DeclVar) emitData() {
 
 	emit("# emitData()")
 	emit(".data 0")
+	// align so that the collector can find pointers in it
+	emit(".p2align 3")
+	decl.emitSymbolInfo()
 	emitWithoutIndent("%s: # gtype=%s", decl.variable.varname, gtype.String())
 	emit("# right.gtype = %s", right.getGtype().String())
 	doEmitData(ptok, right.getGtype(), right, "", 0)
@@ -54,22 +61,18 @@ func doEmitData(ptok *Token /* left type */, gtype *Gtype, value /* nullable */
 				assertNotNil(value != nil, nil)
 				size := elmType.getSize()
 				if size == 8 {
-					if value.getGtype().kind == G_STRING {
-						stringLiteral, ok := value.(*ExprStringLiteral)
-						assert(ok, nil, "ok")
-						emit(".quad .%s", stringLiteral.slabel)
-					} else {
-						switch value.(type) {
-						case *ExprUop:
-							uop := value.(*ExprUop)
-							rel, ok := uop.operand.(*Relation)
-							assert(ok, uop.token(), "only variable is allowed")
-							emit(".quad %s # %s %s", rel.name, value.getGtype().String(), selector)
-						case *Relation:
-							assert(false, value.token(), "variable here is not allowed")
-						default:
-							emit(".quad %d # %s %s", evalIntExpr(value), value.getGtype().String(), selector)
-						}
+					switch value.(type) {
+					case *ExprUop:
+						uop := value.(*ExprUop)
+						rel, ok := uop.operand.(*Relation)
+						assert(ok, uop.token(), "only variable is allowed")
+						emit(".quad %s # %s %s", rel.name, value.getGtype().String(), selector)
+					case *Relation:
+						_, isConst := value.(*Relation).expr.(*ExprConstVariable)
+						assert(isConst, value.token(), "variable here is not allowed")
+						emit(".quad %d # %s %s", evalIntExpr(value), value.getGtype().String(), selector)
+					default:
+						emit(".quad %d # %s %s", evalIntExpr(value), value.getGtype().String(), selector)
 					}
 				} else if size == 1 {
 					emit(".byte %d", evalIntExpr(value))
@@ -83,7 +86,9 @@ func doEmitData(ptok *Token /* left type */, gtype *Gtype, value /* nullable */
 	} else if primType == G_SLICE {
 		switch value.(type) {
 		case nil:
-			return
+			emit(".quad 0 # ptr %s zero value", containerName)
+			emit(".quad 0 # len")
+			emit(".quad 0 # cap")
 		case *ExprSliceLiteral:
 			// initialize a hidden array
 			lit := value.(*ExprSliceLiteral)
@@ -98,6 +103,24 @@ func doEmitData(ptok *Token /* left type */, gtype *Gtype, value /* nullable */
 		default:
 			TBI(ptok, "unable to handle gtype %s", gtype.String())
 		}
+	} else if primType == G_STRING {
+		switch value.(type) {
+		case nil:
+			emit(".quad 0 # ptr %s zero value", containerName)
+			emit(".quad 0 # len")
+		case *ExprStringLiteral:
+			stringLiteral := value.(*ExprStringLiteral)
+			emit(".quad .%s # ptr %s", stringLiteral.getLabel(), containerName)
+			emit(".quad %d # len", len(stringLiteral.val))
+		case *Relation:
+			rel := value.(*Relation)
+			doEmitData(ptok, gtype, rel.expr, containerName, depth)
+		case *ExprConstVariable:
+			cnst := value.(*ExprConstVariable)
+			doEmitData(ptok, gtype, cnst.val, containerName, depth)
+		default:
+			TBI(ptok, "unable to handle %T", value)
+		}
 	} else if primType == G_MAP || primType == G_INTERFACE {
 		// @TODO
 		emit(".quad 0")
@@ -159,9 +182,6 @@ func doEmitData(ptok *Token /* left type */, gtype *Gtype, value /* nullable */
 		case *ExprBinop:
 			val = evalIntExpr(value)
 			emit(".quad %d # %s ", val, gtype.String())
-		case *ExprStringLiteral:
-			stringLiteral := value.(*ExprStringLiteral)
-			emit(".quad .%s", stringLiteral.slabel)
 		case *Relation:
 			rel := value.(*Relation)
 			doEmitData(ptok, gtype, rel.expr, "rel", depth)
@@ -189,6 +209,7 @@ func doEmitData(ptok *Token /* left type */, gtype *Gtype, value /* nullable */
 // this logic is stolen from 8cc.
 func emitDataAddr(operand Expr, depth int) {
 	emit(".data %d", depth+1)
+	emit(".p2align 3")
 	label := makeLabel()
 	emit("%s:", label)
 	doEmitData(nil, operand.getGtype(), operand, "", depth+1)
@@ -196,11 +217,146 @@ func emitDataAddr(operand Expr, depth int) {
 	emit(".quad %s", label)
 }
 
+// the binding, the type and the size of the symbol of a global variable
+func (decl *DeclVar) emitSymbolInfo() {
+	name := decl.variable.varname
+	// the symbol is qualified by the package except in main
+	declared := string(name)
+	dot := strings.Index(declared, ".")
+	if dot >= 0 {
+		declared = declared[dot+1 : len(declared)]
+	}
+	if isExported(identifier(declared)) || isRuntimePackage(decl.pkg) {
+		emit(".global %s", name)
+	}
+	emit(".type %s, @object", name)
+	emit(".size %s, %d", name, decl.variable.getGtype().getSize())
+}
+
+// isStatic tells if the initial value of a package variable is known at compile time.
+// Otherwise the variable is assigned by the init function of the package.
+func (decl *DeclVar) isStatic() bool {
+	if decl.initval == nil || isNil(decl.initval) {
+		return true
+	}
+	return isStaticData(decl.variable.getGtype(), decl.initval)
+}
+
+// isStaticData tells if doEmitData can emit the value
+func isStaticData(gtype *Gtype, value Expr) bool {
+	if value == nil {
+		return true
+	}
+	switch gtype.getKind() {
+	case G_ARRAY:
+		arrayLiteral, ok := value.(*ExprArrayLiteral)
+		if !ok {
+			return false
+		}
+		return isStaticElements(gtype.elementType, arrayLiteral.values)
+	case G_SLICE:
+		sliceLiteral, ok := value.(*ExprSliceLiteral)
+		if !ok {
+			return false
+		}
+		return isStaticElements(gtype.elementType, sliceLiteral.values)
+	case G_STRING:
+		return isStaticString(value)
+	case G_MAP, G_INTERFACE:
+		return false
+	case G_BOOL:
+		return isStaticInt(value)
+	case G_STRUCT:
+		structLiteral, ok := value.(*ExprStructLiteral)
+		if !ok {
+			return false
+		}
+		for _, field := range gtype.relation.gtype.fields {
+			if !isStaticData(field, structLiteral.lookup(field.fieldname)) {
+				return false
+			}
+		}
+		return true
+	}
+	uop, ok := value.(*ExprUop)
+	if ok && uop.op == "&" {
+		if isGlobalVariable(uop.operand) {
+			return true
+		}
+		_, ok = uop.operand.(*ExprStructLiteral)
+		return ok && isStaticData(uop.operand.getGtype(), uop.operand)
+	}
+	return isStaticInt(value)
+}
+
+func isStaticElements(elementType *Gtype, values []Expr) bool {
+	for _, value := range values {
+		switch elementType.getSize() {
+		case 8:
+			uop, ok := value.(*ExprUop)
+			if ok && uop.op == "&" && isGlobalVariable(uop.operand) {
+				continue
+			}
+			if !isStaticInt(value) {
+				return false
+			}
+		case 1:
+			if !isStaticInt(value) {
+				return false
+			}
+		default:
+			if !isStaticData(elementType, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isGlobalVariable(e Expr) bool {
+	rel, ok := e.(*Relation)
+	if !ok {
+		return false
+	}
+	vr, ok := rel.expr.(*ExprVariable)
+	return ok && vr.isGlobal
+}
+
+// whether evalIntExpr can evaluate it
+func isStaticInt(e Expr) bool {
+	switch e.(type) {
+	case *ExprNumberLiteral, *ExprConstVariable:
+		return true
+	case *Relation:
+		return isStaticInt(e.(*Relation).expr)
+	case *ExprBinop:
+		binop := e.(*ExprBinop)
+		switch binop.op {
+		case "+", "-", "*", "&", "|", "^", "&^", "<<", ">>":
+			return isStaticInt(binop.left) && isStaticInt(binop.right)
+		}
+	}
+	return false
+}
+
+func isStaticString(e Expr) bool {
+	switch e.(type) {
+	case *ExprStringLiteral:
+		return true
+	case *Relation:
+		return isStaticString(e.(*Relation).expr)
+	case *ExprConstVariable:
+		return isStaticString(e.(*ExprConstVariable).val)
+	}
+	return false
+}
+
 func (decl *DeclVar) emitGlobal() {
 	emitWithoutIndent("# emitGlobal for %s", decl.variable.varname)
 	assertNotNil(decl.variable.gtype != nil, nil)
 
-	if decl.initval == nil {
+	if decl.initval == nil || isNil(decl.initval) || !decl.isStatic() {
+		// zeros until the init function of the package assigns it
 		decl.emitBss()
 	} else {
 		decl.emitData()
@@ -0,0 +1,324 @@
+// Code generation from the IR.
+// Values live in the registers given by the register allocator or in stack slots,
+// and phis are resolved by copies on the edges.
+package main
+
+import "fmt"
+
+var irSetInstructions []string = []string{
+	"sete", "setne", "setl", "setle", "setg", "setge",
+}
+
+var irArithInstructions []string = []string{
+	"add", "sub", "imul",
+}
+
+func (f *IrFunc) emit() {
+	f.allocateRegisters()
+
+	emitFuncStart(f.symbol, f.decl.isGlobalSymbol())
+	resetLoc()
+	emitLoc(f.decl.tok)
+	emit("FUNC_PROLOGUE")
+
+	var offset int
+	if len(f.params) > 0 {
+		emit("# set params")
+	}
+	for i, param := range f.params {
+		offset -= IntSize
+		param.offset = offset
+		emit("PUSH_ARG_%d # param \"%s\" %s", i, param.variable.varname, param.variable.getGtype().String())
+	}
+
+	var localarea int
+	for _, blk := range f.blocks {
+		for _, v := range blk.values {
+			if v.op == IR_PARAM || !v.needsLocation() || v.reg != "" {
+				continue
+			}
+			localarea -= IntSize
+			offset -= IntSize
+			v.offset = offset
+		}
+	}
+	if localarea != 0 {
+		emit("sub $%d, %%rsp # total stack size", -localarea)
+	}
+	for _, param := range f.params {
+		if param.reg != "" {
+			emit("mov %d(%%rbp), %%%s # %s", param.offset, param.reg, param.name())
+		}
+	}
+	emitNewline()
+
+	for _, blk := range f.blocks {
+		blk.label = makeLabel()
+	}
+	for i, blk := range f.blocks {
+		var next *IrBlock
+		if i+1 < len(f.blocks) {
+			next = f.blocks[i+1]
+		}
+		emit("%s: # b%d", blk.label, blk.id)
+		for _, v := range blk.values {
+			emitLoc(v.tok)
+			f.emitValue(v)
+		}
+		f.emitTerminator(blk, next)
+	}
+	emitNewline()
+}
+
+func fitsInImm32(n int) bool {
+	return n >= -2147483648 && n <= 2147483647
+}
+
+// the location of the value: an immediate, a register or a stack slot
+func (v *IrValue) operand() string {
+	if v.op == IR_CONST {
+		return fmt.Sprintf("$%d", v.aux)
+	}
+	if v.reg != "" {
+		return "%" + v.reg
+	}
+	return fmt.Sprintf("%d(%%rbp)", v.offset)
+}
+
+// the operand as a source of an instruction other than mov,
+// which takes no 64 bit immediate
+func (v *IrValue) source(scratch string) string {
+	if v.op == IR_CONST && !fitsInImm32(v.aux) {
+		v.loadTo(scratch)
+		return "%" + scratch
+	}
+	return v.operand()
+}
+
+func (v *IrValue) loadTo(reg string) {
+	if v.reg == reg {
+		return
+	}
+	emit("mov %s, %%%s", v.operand(), reg)
+}
+
+func (v *IrValue) storeFrom(reg string) {
+	if v.reg == reg {
+		return
+	}
+	emit("mov %%%s, %s", reg, v.operand())
+}
+
+// the register which holds the address of a load or store
+func (v *IrValue) baseRegister() string {
+	if v.reg != "" {
+		return v.reg
+	}
+	v.loadTo("rax")
+	return "rax"
+}
+
+func (f *IrFunc) emitValue(v *IrValue) {
+	switch v.op {
+	case IR_CONST, IR_PARAM, IR_PHI, IR_RESULT:
+		// nothing to do
+		return
+	}
+	emit("# %s", v.String())
+	switch v.op {
+	case IR_COPY:
+		v.args[0].loadTo("rax")
+	case IR_ADD, IR_SUB, IR_MUL:
+		inst := irArithInstructions[int(v.op-IR_ADD)]
+		a := v.args[0]
+		b := v.args[1]
+		if v.reg != "" && b.reg != v.reg {
+			// compute in place
+			a.loadTo(v.reg)
+			emit("%s %s, %%%s", inst, b.source("rcx"), v.reg)
+			return
+		}
+		a.loadTo("rax")
+		emit("%s %s, %%rax", inst, b.source("rcx"))
+	case IR_DIV, IR_MOD:
+		v.args[0].loadTo("rax")
+		emit("mov $0, %%rdx # init %%rdx")
+		b := v.args[1]
+		if b.op == IR_CONST {
+			b.loadTo("rcx")
+			emit("div %%rcx")
+		} else if b.reg != "" {
+			emit("div %%%s", b.reg)
+		} else {
+			emit("divq %s", b.operand())
+		}
+		if v.op == IR_MOD {
+			emit("mov %%rdx, %%rax")
+		}
+	case IR_EQ, IR_NE, IR_LT, IR_LE, IR_GT, IR_GE:
+		v.args[0].loadTo("rax")
+		emit("cmp %s, %%rax", v.args[1].source("rcx"))
+		emit("%s %%al", irSetInstructions[int(v.op-IR_EQ)])
+		emit("movzb %%al, %%eax")
+	case IR_NOT:
+		v.args[0].loadTo("rax")
+		emit("CMP_EQ_ZERO")
+	case IR_NEG:
+		if v.reg != "" {
+			v.args[0].loadTo(v.reg)
+			emit("neg %%%s", v.reg)
+			return
+		}
+		v.args[0].loadTo("rax")
+		emit("neg %%rax")
+	case IR_LOAD:
+		base := v.args[0].baseRegister()
+		if v.reg != "" {
+			emit("mov %d(%%%s), %%%s", v.aux, base, v.reg)
+			return
+		}
+		emit("mov %d(%%%s), %%rax", v.aux, base)
+	case IR_STORE:
+		base := v.args[0].baseRegister()
+		val := v.args[1]
+		if val.reg != "" {
+			emit("mov %s, %d(%%%s)", val.operand(), v.aux, base)
+		} else if val.op == IR_CONST && fitsInImm32(val.aux) {
+			emit("movq %s, %d(%%%s)", val.operand(), v.aux, base)
+		} else {
+			val.loadTo("rcx")
+			emit("mov %%rcx, %d(%%%s)", v.aux, base)
+		}
+		return
+	case IR_LOAD_GLOBAL:
+		emit("LOAD_8_FROM_GLOBAL %s", v.sym)
+	case IR_STORE_GLOBAL:
+		v.args[0].loadTo("rax")
+		emit("STORE_8_TO_GLOBAL %s, 0", v.sym)
+		return
+	case IR_CALL:
+		f.emitCall(v)
+		if v.aux != 1 {
+			return
+		}
+	default:
+		errorf("unknown op %d", int(v.op))
+	}
+	v.storeFrom("rax")
+}
+
+// No register is preserved by the callee,
+// so the values which live across the call are saved on the stack.
+func (f *IrFunc) emitCall(v *IrValue) {
+	saved := f.liveAcross(v.pos)
+	for _, s := range saved {
+		emit("pushq %%%s # save %s", s.reg, s.name())
+	}
+	// the argument registers may hold the operands
+	for _, arg := range v.args {
+		emit("pushq %s", arg.source("rax"))
+	}
+	for i := len(v.args) - 1; i >= 0; i-- {
+		emit("POP_TO_ARG_%d", i)
+	}
+	emit("FUNCALL %s", v.sym)
+	if v.aux > 1 {
+		emitResults(v)
+	}
+	for i := len(saved) - 1; i >= 0; i-- {
+		emit("popq %%%s # restore %s", saved[i].reg, saved[i].name())
+	}
+}
+
+// The results are in the return registers, which the register allocator also uses.
+// They are moved to the result values at the same time like the operands of phis.
+func emitResults(call *IrValue) {
+	var results []*IrValue
+	for _, v := range call.block.values {
+		if v.op == IR_RESULT && v.args[0] == call {
+			results = append(results, v)
+		}
+	}
+	for _, v := range results {
+		emit("pushq %%%s # %s", retRegi[v.aux], v.name())
+	}
+	for i := len(results) - 1; i >= 0; i-- {
+		emit("popq %s", results[i].operand())
+	}
+}
+
+func (f *IrFunc) emitTerminator(blk *IrBlock, next *IrBlock) {
+	switch blk.kind {
+	case IR_BLOCK_PLAIN:
+		emitEdge(blk, blk.succs[0], next)
+	case IR_BLOCK_IF:
+		if blk.control.reg != "" {
+			emit("test %%%s, %%%s", blk.control.reg, blk.control.reg)
+		} else {
+			blk.control.loadTo("rax")
+			emit("TEST_IT")
+		}
+		els := blk.succs[1]
+		if els.hasPhis() {
+			// the copies for phis are done only on the edge
+			labelElse := makeLabel()
+			emit("je %s", labelElse)
+			emitEdge(blk, blk.succs[0], nil)
+			emit("%s:", labelElse)
+			emitEdge(blk, els, next)
+		} else {
+			emit("je %s", els.label)
+			emitEdge(blk, blk.succs[0], next)
+		}
+	case IR_BLOCK_RETURN:
+		if len(blk.results) == 0 {
+			emit("mov $0, %%rax")
+		} else if len(blk.results) == 1 {
+			blk.results[0].loadTo("rax")
+		} else {
+			// the operands may be in the return registers
+			for _, v := range blk.results {
+				emit("pushq %s", v.source("rax"))
+			}
+			for i := len(blk.results) - 1; i >= 0; i-- {
+				emit("popq %%%s", retRegi[i])
+			}
+		}
+		emit("LEAVE_AND_RET")
+	}
+}
+
+func (blk *IrBlock) hasPhis() bool {
+	return len(blk.values) > 0 && blk.values[0].op == IR_PHI
+}
+
+// copy the operands of the phis of to, and jump there unless it is next
+func emitEdge(from *IrBlock, to *IrBlock, next *IrBlock) {
+	index := predIndex(to, from)
+	var phis []*IrValue
+	for _, v := range to.values {
+		if v.op == IR_PHI && v.args[index].operand() != v.operand() {
+			phis = append(phis, v)
+		}
+	}
+	if len(phis) == 1 {
+		phi := phis[0]
+		if phi.reg != "" {
+			phi.args[index].loadTo(phi.reg)
+		} else {
+			phi.args[index].loadTo("rax")
+			phi.storeFrom("rax")
+		}
+	} else if len(phis) > 1 {
+		// phis take their operands at the same time
+		for _, phi := range phis {
+			emit("pushq %s # %s", phi.args[index].source("rax"), phi.name())
+		}
+		for i := len(phis) - 1; i >= 0; i-- {
+			emit("popq %s", phis[i].operand())
+		}
+	}
+	if to != next {
+		emit("jmp %s", to.label)
+	}
+}
@@ -5,8 +5,14 @@ func (ast *ExprNumberLiteral) emit() {
 	emit("LOAD_NUMBER %d", ast.val)
 }
 
+// getLabel returns the label of the string, which is emitted only if it is referred
+func (ast *ExprStringLiteral) getLabel() string {
+	ast.used = true
+	return ast.slabel
+}
+
 func (ast *ExprStringLiteral) emit() {
-	emit("LOAD_STRING_LITERAL .%s", ast.slabel)
+	emit("LOAD_STRING_LITERAL .%s, %d", ast.getLabel(), len(ast.val))
 }
 
 func loadStructField(strct Expr, field *Gtype, offset int) {
@@ -22,6 +28,19 @@ func loadStructField(strct Expr, field *Gtype, offset int) {
 		variable := strct.(*ExprVariable)
 		if field.kind == G_ARRAY {
 			variable.emitAddress(field.offset)
+		} else if variable.heapAddr != nil {
+			variable.emitAddress(field.offset + offset)
+			if field.getKind() == G_STRING {
+				emit("LOAD_16_BY_DEREF")
+			} else {
+				emit("LOAD_8_BY_DEREF")
+			}
+		} else if field.getKind() == G_STRING {
+			if variable.isGlobal {
+				emit("LOAD_STRING_FROM_GLOBAL %s, %d+%d", variable.varname, field.offset, offset)
+			} else {
+				emit("LOAD_STRING_FROM_LOCAL %d+%d+%d", variable.offset, field.offset, offset)
+			}
 		} else {
 			if variable.isGlobal {
 				emit("LOAD_8_FROM_GLOBAL %s, %d+%d", variable.varname, field.offset,offset)
@@ -68,6 +87,8 @@ func (a *ExprStructField) emit() {
 		switch field.getKind() {
 		case G_SLICE, G_INTERFACE, G_MAP:
 			emit("LOAD_24_BY_DEREF")
+		case G_STRING:
+			emit("LOAD_16_BY_DEREF")
 		default:
 			emit("LOAD_8_BY_DEREF")
 		}
@@ -88,6 +109,8 @@ func (ast *ExprVariable) emit() {
 		switch ast.gtype.getKind() {
 		case G_INTERFACE:
 			emit("LOAD_INTERFACE_FROM_GLOBAL %s", ast.varname)
+		case G_STRING:
+			emit("LOAD_STRING_FROM_GLOBAL %s", ast.varname)
 		case G_SLICE:
 			emit("LOAD_SLICE_FROM_GLOBAL %s", ast.varname)
 		case G_MAP:
@@ -101,6 +124,22 @@ func (ast *ExprVariable) emit() {
 				emit("LOAD_8_FROM_GLOBAL %s", ast.varname)
 			}
 		}
+	} else if ast.heapAddr != nil {
+		ast.emitAddress(0)
+		switch ast.gtype.getKind() {
+		case G_INTERFACE, G_SLICE, G_MAP:
+			emit("LOAD_24_BY_DEREF")
+		case G_STRING:
+			emit("LOAD_16_BY_DEREF")
+		case G_ARRAY:
+			// the address is the value
+		default:
+			if ast.getGtype().getSize() == 1 {
+				emit("LOAD_1_BY_DEREF")
+			} else {
+				emit("LOAD_8_BY_DEREF")
+			}
+		}
 	} else {
 		if ast.offset == 0 {
 			errorft(ast.token(), "offset should not be zero for localvar %s", ast.varname)
@@ -108,6 +147,8 @@ func (ast *ExprVariable) emit() {
 		switch ast.gtype.getKind() {
 		case G_INTERFACE:
 			emit("LOAD_INTERFACE_FROM_LOCAL %d", ast.offset)
+		case G_STRING:
+			emit("LOAD_STRING_FROM_LOCAL %d", ast.offset)
 		case G_SLICE:
 			emit("LOAD_SLICE_FROM_LOCAL %d", ast.offset)
 		case G_MAP:
@@ -127,6 +168,9 @@ func (ast *ExprVariable) emit() {
 func (variable *ExprVariable) emitAddress(offset int) {
 	if variable.isGlobal {
 		emit("LOAD_GLOBAL_ADDR %s, %d", variable.varname, offset)
+	} else if variable.heapAddr != nil {
+		emit("LOAD_8_FROM_LOCAL %d # &%s", variable.heapAddr.offset, variable.varname)
+		emit("ADD_NUMBER %d", offset)
 	} else {
 		if variable.offset == 0 {
 			errorft(variable.token(), "offset should not be zero for localvar %s", variable.varname)
@@ -183,8 +227,12 @@ func (ast *ExprUop) emit() {
 			assert(e.invisiblevar.offset != 0, nil, "ExprStructLiteral's invisible var has offset")
 			ivv := e.invisiblevar
 			assignToStruct(ivv, e)
+			if e.onStack {
+				ivv.emitAddress(0)
+				return
+			}
 
-			emitCallMalloc(e.getGtype().getSize())
+			emitCallMallocOfType(e.getGtype().getSize(), e.getGtype())
 			emit("PUSH_8")                     // to:ptr addr
 			e.invisiblevar.emitAddress(0)
 			emit("PUSH_8") // from:address of invisible var
@@ -204,7 +252,13 @@ func (ast *ExprUop) emit() {
 		//vr, ok := rel.expr.(*ExprVariable)
 		//assert(ok, nil, "operand is a rel")
 		ast.operand.emit()
-		emit("LOAD_8_BY_DEREF")
+		if ast.getGtype().isString() {
+			emit("LOAD_16_BY_DEREF")
+		} else if ast.getGtype().getKind() == G_SLICE {
+			emit("LOAD_24_BY_DEREF")
+		} else {
+			emit("LOAD_8_BY_DEREF")
+		}
 	} else if ast.op == "!" {
 		ast.operand.emit()
 		emit("CMP_EQ_ZERO")
@@ -229,6 +283,9 @@ func (variable *ExprVariable) emitOffsetLoad(size int, offset int) {
 	assert(0 <= size && size <= 8, variable.token(), "invalid size")
 	if variable.isGlobal {
 		emit("LOAD_%d_FROM_GLOBAL %s %d", size, variable.varname, offset)
+	} else if variable.heapAddr != nil {
+		variable.emitAddress(offset)
+		emit("LOAD_%d_BY_DEREF", size)
 	} else {
 		emit("LOAD_%d_FROM_LOCAL %d+%d", size,  variable.offset, offset)
 	}
@@ -241,7 +298,11 @@ func (e *ExprSliceLiteral) emit() {
 	emit("# (*ExprSliceLiteral).emit()")
 	length := len(e.values)
 	//debugf("slice literal %s: underlyingarray size = %d (should be %d)", e.getGtype(), e.gtype.getSize(),  e.gtype.elementType.getSize() * length)
-	emitCallMalloc(e.gtype.getSize() * length)
+	if e.onStack {
+		e.invisiblevar.emitAddress(0)
+	} else {
+		emitCallMallocOfType(e.gtype.elementType.getSize()*length, e.gtype.elementType)
+	}
 	emit("PUSH_8 # ptr")
 	for i, value := range e.values {
 		if e.gtype.elementType.getKind() == G_INTERFACE && value.getGtype().getKind() != G_INTERFACE {
@@ -253,8 +314,13 @@ func (e *ExprSliceLiteral) emit() {
 		emit("pop %%r10 # ptr")
 
 		switch e.gtype.elementType.getKind() {
-		case G_BYTE, G_INT, G_POINTER, G_STRING:
+		case G_BYTE:
+			emit("mov %%al, %d(%%r10)", i)
+		case G_INT, G_POINTER:
 			emit("mov %%rax, %d(%%r10)", IntSize*i)
+		case G_STRING:
+			emit("mov %%rax, %d(%%r10)", IntSize*2*i)
+			emit("mov %%rbx, %d(%%r10)", IntSize*2*i+ptrSize)
 		case G_INTERFACE, G_SLICE, G_MAP:
 			emit("mov %%rax, %d(%%r10)", IntSize*3*i)
 			emit("mov %%rbx, %d(%%r10)", IntSize*3*i+ptrSize)
@@ -341,6 +407,8 @@ func loadArrayOrSliceIndex(collection Expr, index Expr, offset int) {
 	primType := collection.getGtype().elementType.getKind()
 	if primType == G_INTERFACE || primType == G_MAP || primType == G_SLICE {
 		emit("LOAD_24_BY_DEREF")
+	} else if primType == G_STRING {
+		emit("LOAD_16_BY_DEREF")
 	} else {
 		// dereference the content of an emelment
 		if elmSize == 1 {
@@ -367,21 +435,21 @@ func loadCollectIndex(collection Expr, index Expr, offset int) {
 		// a[x] is the non-constant byte value at index x and the type of a[x] is byte
 		// a[x] may not be assigned to
 		emit("# load head address of the string")
-		collection.emit()  // emit address
+		collection.emit() // emit ptr
 		emit("PUSH_8")
 		index.emit()
 		emit("PUSH_8")
 		emit("SUM_FROM_STACK")
 		emit("ADD_NUMBER %d", offset)
-		emit("LOAD_8_BY_DEREF")
+		emit("LOAD_1_BY_DEREF")
 	} else {
 		TBI(collection.token(), "unable to handle %s", collection.getGtype())
 	}
 }
 
+// s[n:m] shares the bytes of s.
+// The new header is (ptr + n, m - n).
 func (e *ExprSlice) emitSubString() {
-	// s[n:m]
-	// new strlen: m - n
 	var high Expr
 	if e.high == nil {
 		high = &ExprLen{
@@ -391,41 +459,20 @@ func (e *ExprSlice) emitSubString() {
 	} else {
 		high = e.high
 	}
-	eNewStrlen := &ExprBinop{
-		tok:   e.token(),
-		op:    "-",
-		left:  high,
-		right: e.low,
-	}
-	// mem size = strlen + 1
-	eMemSize := &ExprBinop{
-		tok:  e.token(),
-		op:   "+",
-		left: eNewStrlen,
-		right: &ExprNumberLiteral{
-			val: 1,
-		},
-	}
 
-	// src address + low
 	e.collection.emit()
-	emit("PUSH_8")
+	emit("PUSH_STRING")
 	e.low.emit()
-	emit("PUSH_8")
-	emit("SUM_FROM_STACK")
-	emit("PUSH_8")
-
-	emitCallMallocDinamicSize(eMemSize)
-	emit("PUSH_8")
-
-	eNewStrlen.emit()
-	emit("PUSH_8")
-
-	emit("POP_TO_ARG_2")
-	emit("POP_TO_ARG_1")
-	emit("POP_TO_ARG_0")
-
-	emit("FUNCALL iruntime.strcopy")
+	emit("PUSH_8 # low")
+	high.emit()
+	emit("PUSH_8 # high")
+
+	emit("pop %%rbx # high")
+	emit("pop %%rcx # low")
+	emit("sub %%rcx, %%rbx # len = high - low")
+	emit("pop %%rax # old len")
+	emit("pop %%rax # old ptr")
+	emit("add %%rcx, %%rax # ptr = ptr + low")
 }
 
 func (e *ExprSlice) emit() {
@@ -436,6 +483,23 @@ func (e *ExprSlice) emit() {
 	}
 }
 
+// highBound returns the high index of the slice expression.
+// s[lo:] ends at len(s), which is known only at runtime for a slice.
+func (e *ExprSlice) highBound() Expr {
+	if e.high != nil {
+		return e.high
+	}
+	if e.collection.getGtype().getKind() == G_SLICE {
+		return &ExprLen{
+			tok: e.token(),
+			arg: e.collection,
+		}
+	}
+	return &ExprNumberLiteral{
+		val: e.collection.getGtype().length,
+	}
+}
+
 func (e *ExprSlice) emitSlice() {
 	elmType := e.collection.getGtype().elementType
 	size := elmType.getSize()
@@ -456,14 +520,9 @@ func (e *ExprSlice) emitSlice() {
 
 	emit("#   calc and set len")
 
-	if e.high == nil {
-		e.high = &ExprNumberLiteral{
-			val: e.collection.getGtype().length,
-		}
-	}
 	calcLen := &ExprBinop{
 		op:    "-",
-		left:  e.high,
+		left:  e.highBound(),
 		right: e.low,
 	}
 	calcLen.emit()
@@ -5,9 +5,13 @@ import "fmt"
 func emitMacroDefinitions() {
 	emitWithoutIndent("// MACROS")
 
+	// the call frame information follows the frame pointer
 	macroStart("FUNC_PROLOGUE","")
 	emit("push %%rbp")
+	emit(".cfi_def_cfa_offset 16")
+	emit(".cfi_offset rbp, -16")
 	emit("mov %%rsp, %%rbp")
+	emit(".cfi_def_cfa_register rbp")
 	macroEnd()
 
 	for i, regi := range RegsForArguments {
@@ -32,6 +36,11 @@ func emitMacroDefinitions() {
 	emit("push %%rcx # 3rd")
 	macroEnd()
 
+	macroStart("PUSH_STRING", "")
+	emit("push %%rax # string.ptr")
+	emit("push %%rbx # string.len")
+	macroEnd()
+
 	macroStart("PUSH_SLICE", "")
 	emit("push %%rax # slice.ptr")
 	emit("push %%rbx # slice.len")
@@ -54,6 +63,11 @@ func emitMacroDefinitions() {
 	emit("pop %%rax # primitive")
 	macroEnd()
 
+	macroStart("POP_STRING", "")
+	emit("pop %%rbx # string.len")
+	emit("pop %%rax # string.ptr")
+	macroEnd()
+
 	macroStart("POP_SLICE", "")
 	emit("pop %%rcx # slice.cap")
 	emit("pop %%rbx # slice.len")
@@ -72,6 +86,11 @@ func emitMacroDefinitions() {
 	emit("pop %%rax # ifc.1st")
 	macroEnd()
 
+	macroStart("LOAD_EMPTY_STRING", "")
+	emit("mov $0, %%rax")
+	emit("mov $0, %%rbx")
+	macroEnd()
+
 	macroStart("LOAD_EMPTY_SLICE", "")
 	emit("mov $0, %%rax")
 	emit("mov $0, %%rbx")
@@ -90,8 +109,9 @@ func emitMacroDefinitions() {
 	emit("mov $0, %%rcx")
 	macroEnd()
 
-	macroStart("LOAD_STRING_LITERAL", "slabel")
+	macroStart("LOAD_STRING_LITERAL", "slabel, len")
 	emit("lea \\slabel(%%rip), %%rax")
+	emit("mov $\\len, %%rbx")
 	macroEnd()
 
 	macroStart("LOAD_NUMBER",  "n")
@@ -115,7 +135,7 @@ func emitMacroDefinitions() {
 	macroEnd()
 
 	macroStart("LOAD_1_FROM_LOCAL_CAST", "offset")
-	emit("movsbq \\offset(%%rbp), %%rax")
+	emit("movzbq \\offset(%%rbp), %%rax")
 	macroEnd()
 
 	macroStart("LOAD_1_FROM_LOCAL", "offset")
@@ -136,7 +156,7 @@ func emitMacroDefinitions() {
 
 
 	macroStart("LOAD_1_FROM_GLOBAL_CAST", "varname, offset=0")
-	emit("movsbq \\varname+\\offset(%%rip), %%rax")
+	emit("movzbq \\varname+\\offset(%%rip), %%rax")
 	macroEnd()
 
 	macroStart("LOAD_1_FROM_GLOBAL", "varname, offset=0")
@@ -153,12 +173,17 @@ func emitMacroDefinitions() {
 	emit("mov %d(%%rax), %%rax", 0)
 	macroEnd()
 
+	macroStart("LOAD_16_BY_DEREF", "")
+	emit("mov %d(%%rax), %%rbx", 8)
+	emit("mov %d(%%rax), %%rax", 0)
+	macroEnd()
+
 	macroStart("LOAD_8_BY_DEREF","")
 	emit("mov (%%rax), %%rax")
 	macroEnd()
 
 	macroStart("LOAD_1_BY_DEREF","")
-	emit("movsbq (%%rax), %%rax")
+	emit("movzbq (%%rax), %%rax")
 	macroEnd()
 
 
@@ -168,6 +193,11 @@ func emitMacroDefinitions() {
 	emit("mov \\varname+%2d(%%rip), %%rcx", ptrSize+ptrSize)
 	macroEnd()
 
+	macroStart("LOAD_STRING_FROM_GLOBAL", "varname, offset=0")
+	emit("mov \\varname+\\offset+%2d(%%rip), %%rax # ptr", 0)
+	emit("mov \\varname+\\offset+%2d(%%rip), %%rbx # len", ptrSize)
+	macroEnd()
+
 	macroStart("LOAD_SLICE_FROM_GLOBAL", "varname")
 	emit("mov \\varname+%2d(%%rip), %%rax # ptr", 0)
 	emit("mov \\varname+%2d(%%rip), %%rbx # len", ptrSize)
@@ -180,6 +210,11 @@ func emitMacroDefinitions() {
 	emit("mov \\varname+%2d(%%rip), %%rcx # cap", ptrSize+IntSize)
 	macroEnd()
 
+	macroStart("LOAD_STRING_FROM_LOCAL", "offset")
+	emit("mov \\offset+%2d(%%rbp), %%rax # ptr", 0)
+	emit("mov \\offset+%2d(%%rbp), %%rbx # len", ptrSize)
+	macroEnd()
+
 	macroStart("LOAD_SLICE_FROM_LOCAL", "offset")
 	emit("mov \\offset+%2d(%%rbp), %%rax # ptr", 0)
 	emit("mov \\offset+%2d(%%rbp), %%rbx # len", ptrSize)
@@ -239,6 +274,50 @@ func emitMacroDefinitions() {
 	emit("imul %%rcx , %%rax")
 	macroEnd()
 
+	macroStart("AND_FROM_STACK", "")
+	emit("pop %%rcx")
+	emit("pop %%rax")
+	emit("and %%rcx , %%rax")
+	macroEnd()
+
+	macroStart("OR_FROM_STACK", "")
+	emit("pop %%rcx")
+	emit("pop %%rax")
+	emit("or %%rcx , %%rax")
+	macroEnd()
+
+	macroStart("XOR_FROM_STACK", "")
+	emit("pop %%rcx")
+	emit("pop %%rax")
+	emit("xor %%rcx , %%rax")
+	macroEnd()
+
+	macroStart("ANDNOT_FROM_STACK", "")
+	emit("pop %%rcx")
+	emit("pop %%rax")
+	emit("not %%rcx")
+	emit("and %%rcx , %%rax")
+	macroEnd()
+
+	// a count of 64 or more shifts out all the bits
+	macroStart("SHL_FROM_STACK", "")
+	emit("pop %%rcx")
+	emit("pop %%rax")
+	emit("mov $0, %%rdx")
+	emit("cmp $64, %%rcx")
+	emit("cmovae %%rdx, %%rax")
+	emit("shl %%cl, %%rax")
+	macroEnd()
+
+	macroStart("SAR_FROM_STACK", "")
+	emit("pop %%rcx")
+	emit("pop %%rax")
+	emit("mov $63, %%rdx")
+	emit("cmp $64, %%rcx")
+	emit("cmovae %%rdx, %%rcx")
+	emit("sar %%cl, %%rax")
+	macroEnd()
+
 	macroStart("IMUL_NUMBER", "n")
 	emit("imul $\\n , %%rax")
 	macroEnd()
@@ -255,6 +334,14 @@ func emitMacroDefinitions() {
 	emit("mov %%rcx, (%%rax)")
 	macroEnd()
 
+	macroStart("STORE_16_INDIRECT_FROM_STACK", "")
+	emit("pop %%rax # target addr")
+	emit("pop %%rcx # load RHS value(b)")
+	emit("mov %%rcx, 8(%%rax)")
+	emit("pop %%rcx # load RHS value(a)")
+	emit("mov %%rcx, 0(%%rax)")
+	macroEnd()
+
 	macroStart("STORE_24_INDIRECT_FROM_STACK", "")
 	emit("pop %%rax # target addr")
 	emit("pop %%rcx # load RHS value(c)")
@@ -279,21 +366,43 @@ func emitMacroDefinitions() {
 	emit("call \\fname")
 	macroEnd()
 
+	// C requires the stack to be aligned to 16 bytes at a call,
+	// while the stack machine may leave it at any multiple of 8.
+	// %rbx is callee-saved, so it keeps the original stack pointer.
+	// libc is a shared library, so its functions are called through the PLT.
+	macroStart("FUNCALL_LIBC", "fname")
+	emit("push %%rbx")
+	emit("mov %%rsp, %%rbx")
+	emit("and $-16, %%rsp")
+	emit("mov $0, %%rax")
+	emit("call \\fname@PLT")
+	emit("mov %%rbx, %%rsp")
+	emit("pop %%rbx")
+	macroEnd()
+
 	macroStart("TEST_IT", "")
 	emit("test %%rax, %%rax")
 	macroEnd()
 
+	// the code after ret is still in the frame
 	macroStart("LEAVE_AND_RET", "")
+	emit(".cfi_remember_state")
 	emit("leave")
+	emit(".cfi_def_cfa rsp, 8")
 	emit("ret")
+	emit(".cfi_restore_state")
 	macroEnd()
 }
 
 func macroStart(name string, args string) {
 	emitWithoutIndent(".macro %s %s", name, args)
+	// the peephole optimizer expands it by itself
+	curMacro = newAsmMacro(name, args)
 }
 
 func macroEnd() {
+	addAsmMacro(curMacro)
+	curMacro = nil
 	emitWithoutIndent(".endm")
 	emitNewline()
 }
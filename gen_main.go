@@ -1,25 +1,52 @@
 package main
 
-import (
-	"fmt"
-	"strings"
-)
+import "fmt"
 
 func makeDynamicTypeLabel(id int) string {
 	return fmt.Sprintf("DynamicTypeId%d", id)
 }
 
 func (root *IrRoot) getTypeLabel(gtype *Gtype) string {
-	dynamicTypeId := get_index(gtype.String(), root.uniquedDTypes)
-	if dynamicTypeId == -1 {
-		errorft(nil, "type %s not found in uniquedDTypes", gtype.String())
-	}
+	// a type of another object may be converted without being named
+	dynamicTypeId := root.addDynamicType(gtype)
+	root.usedDTypes[dynamicTypeId] = true
 	return makeDynamicTypeLabel(dynamicTypeId)
 }
 
+func makePointerMapLabel(id int) string {
+	return fmt.Sprintf("PointerMap%d", id)
+}
+
+// getPointerMapLabel returns the label of a pointer map for elements of elementSize bytes.
+// A pointer map is {elementSize, the number of offsets, offsets...}.
+func (root *IrRoot) getPointerMapLabel(elementSize int, offsets []int) string {
+	contents := fmt.Sprintf("%d,%d", elementSize, len(offsets))
+	for _, offset := range offsets {
+		contents = contents + fmt.Sprintf(",%d", offset)
+	}
+	id := get_index(contents, root.pointerMaps)
+	if id == -1 {
+		root.pointerMaps = append(root.pointerMaps, contents)
+		id = len(root.pointerMaps) - 1
+	}
+	return makePointerMapLabel(id)
+}
+
+func (root *IrRoot) emitPointerMaps() {
+	emitNewline()
+	emit("# Pointer maps")
+	emit(".data 0")
+	for id, contents := range root.pointerMaps {
+		// the collector keeps the state of a chunk in the low 4 bits of the address
+		emit(".p2align 4")
+		emitWithoutIndent(".%s:", makePointerMapLabel(id))
+		emit(".quad %s", contents)
+	}
+}
+
 // builtin string
 var builtinStringKey1 string = "SfmtDumpInterface"
-var builtinStringValue1 string = "# interface = {ptr:%p,receiverTypeId:%d,dtype:'%s'}\\n"
+var builtinStringValue1 string = "# interface = {ptr:%p,methods:%p,dtype:'%s'}\\n"
 var builtinStringKey2 string = "SfmtDumpSlice"
 var builtinStringValue2 string = "# slice = {underlying:%p,len:%d,cap:%d}\\n"
 
@@ -40,83 +67,138 @@ func (root *IrRoot) emitSpecialStrings() {
 	emit(".string \"%s\"", eEmptyString.val)
 }
 
+func (root *IrRoot) emitStringLiterals() {
+	var packages []*AstPackage = root.packages
+	for _, pkg := range root.imported {
+		packages = append(packages, pkg)
+	}
+	for _, pkg := range packages {
+		emitNewline()
+		emitWithoutIndent("# string literals of package %s", pkg.name)
+		emit(".data 0")
+		for _, ast := range pkg.stringLiterals {
+			if !ast.used {
+				continue
+			}
+			emitWithoutIndent(".%s:", ast.slabel)
+			// https://sourceware.org/binutils/docs-2.30/as/String.html#String
+			// the assembler marks the end of each string with a 0 byte.
+			emit(".string \"%s\"", escapeString(ast.val))
+		}
+	}
+}
+
 func (root *IrRoot) emitDynamicTypes() {
 	emitNewline()
 	emit("# Dynamic Types")
+	emit(".data 0")
 	for dynamicTypeId, gs := range root.uniquedDTypes {
+		if !root.usedDTypes[dynamicTypeId] {
+			continue
+		}
 		label := makeDynamicTypeLabel(dynamicTypeId)
+		// the kind is put just before the label to be looked up at runtime
+		emit(".quad %d # kind", root.uniquedDKinds[dynamicTypeId])
 		emitWithoutIndent(".%s:", label)
 		emit(".string \"%s\"", gs)
 	}
 }
 
-func (root *IrRoot) emitMethodTable() {
-	emit("# Method table")
-
-	emitWithoutIndent("%s:", "receiverTypes")
-	emit(".quad 0 # receiverTypeId:0")
-	for i := 1; i <= len(root.methodTable); i++ {
-		emit(".quad receiverType%d # receiverTypeId:%d", i, i)
-	}
-
-	var shortMethodNames []string
-
-	for i := 1; i <= len(root.methodTable); i++ {
-		emitWithoutIndent("receiverType%d:", i)
-		mt := root.methodTable
-		methods, ok := mt[i]
-		if !ok {
-			debugf("methods not found in methodTable %d", i)
-			continue
-		}
-		for _, methodNameFull := range methods {
-			splitted := strings.Split(methodNameFull, "$")
-			shortMethodName := splitted[1]
-			emit(".quad .M%s # key", shortMethodName)
-			emit(".quad %s # method", methodNameFull)
-			if !in_array(shortMethodName, shortMethodNames) {
-				shortMethodNames = append(shortMethodNames, shortMethodName)
+// emitMethodTables emits the table of the methods of each named type which has methods.
+// A table is a list of {name, method} which is searched by the name of a method.
+// An interface value of a pointer to the type points to the table.
+func (root *IrRoot) emitMethodTables() {
+	emit("# Method tables")
+	emit(".data 0")
+	for _, pkg := range root.packages {
+		for _, typeDecl := range pkg.namedTypes {
+			methods := typeDecl.gtype.methods
+			if len(methods) == 0 {
+				continue
+			}
+			var names []string
+			for name, _ := range methods {
+				names = append(names, string(name))
 			}
+			sortStrings(names)
+			gtype := &Gtype{
+				kind: G_POINTER,
+				origType: &Gtype{
+					kind: G_NAMED,
+					relation: &Relation{
+						pkg:   pkg.name,
+						name:  typeDecl.name,
+						gtype: typeDecl.gtype,
+					},
+				},
+			}
+			symbol := getMethodTableSymbol(gtype)
+			emit(".p2align 3")
+			emit(".global %s", symbol)
+			emit(".type %s, @object", symbol)
+			emitWithoutIndent("%s:", symbol)
+			for _, name := range names {
+				funcdef := methods[identifier(name)].funcdef
+				if funcdef.dead {
+					continue
+				}
+				root.useMethodName(name)
+				emit(".quad .M%s # key", name)
+				emit(".quad %s # method", funcdef.getSymbol())
+			}
+			emit(".size %s, .-%s", symbol, symbol)
 		}
 	}
+}
 
-	emit("# METHOD NAMES")
-	for _, shortMethodName := range shortMethodNames {
-		emitWithoutIndent(".M%s:", shortMethodName)
-		emit(".string \"%s\"", shortMethodName)
+// useMethodName tells that the name of a method is referred by the emitted code
+func (root *IrRoot) useMethodName(name string) {
+	if !in_array(name, root.methodNames) {
+		root.methodNames = append(root.methodNames, name)
 	}
+}
 
+func (root *IrRoot) emitMethodNames() {
+	emitNewline()
+	emit("# Method names")
+	emit(".data 0")
+	for _, name := range root.methodNames {
+		emitWithoutIndent(".M%s:", name)
+		emit(".quad .S.M%s # ptr", name)
+		emit(".quad %d # len", len(name))
+		emitWithoutIndent(".S.M%s:", name)
+		emit(".string \"%s\"", name)
+	}
 }
 
 // generate code
 func (root *IrRoot) emit() {
 	groot = root
+	resetDebugInfo()
 
 	emitMacroDefinitions()
 
 	emit(".data 0")
 	root.emitSpecialStrings()
-	root.emitDynamicTypes()
-	root.emitMethodTable()
+	root.emitMethodTables()
 
 	emitWithoutIndent(".text")
-	emitRuntimeArgs()
-	emitMainFunc(root.importOS)
-	emitMakeSliceFunc()
+	emitWithoutIndent(".Ltext0:")
+	if root.withMain {
+		emitMainFunc(root.inits)
+	}
+	if root.withRuntime {
+		emitRuntimeArgs()
+		emitMakeSliceFunc()
+		emitCopyBytesFunc()
+		emitCStringFunc()
+		emitGCFunc()
+	}
 
 	// emit packages
 	for _, pkg := range root.packages {
 		emitWithoutIndent("#--------------------------------------------------------")
 		emitWithoutIndent("# package %s", pkg.name)
-		emitWithoutIndent("# string literals")
-		emitWithoutIndent(".data 0")
-		for _, ast := range pkg.stringLiterals {
-			emitWithoutIndent(".%s:", ast.slabel)
-			// https://sourceware.org/binutils/docs-2.30/as/String.html#String
-			// the assembler marks the end of each string with a 0 byte.
-			emit(".string \"%s\"", ast.val)
-		}
-
 		for _, vardecl := range pkg.vars {
 			emitNewline()
 			vardecl.emit()
@@ -125,51 +207,93 @@ func (root *IrRoot) emit() {
 
 		emitWithoutIndent(".text")
 		for _, funcdecl := range pkg.funcs {
+			if funcdecl.dead {
+				continue
+			}
 			funcdecl.emit()
 			emitNewline()
 		}
 
 	}
 
+	// emitted after the code to know which of them are referred
+	root.emitMethodNames()
+	root.emitStringLiterals()
+	root.emitDynamicTypes()
+	root.emitPointerMaps()
+	if dwarfEnabled {
+		emitWithoutIndent(".text")
+		emitWithoutIndent(".Letext0:")
+		root.emitDebugInfo()
+	}
+	// the stack is not executable
+	emit(".section .note.GNU-stack,\"\",@progbits")
+	finishAsm()
 }
 
+// build a []string of argv
 func emitRuntimeArgs() {
-	emitWithoutIndent(".runtime_args:")
-	emit("push %%rbp")
-	emit("mov %%rsp, %%rbp")
+	emitFuncStart(".runtime_args", true)
+	emit("FUNC_PROLOGUE")
+
+	emit("mov runtimeArgc(%%rip), %%rax")
+	emit("IMUL_NUMBER 16")
+	emit("PUSH_8")
+	emit("POP_TO_ARG_0")
+	emit("FUNCALL iruntime.malloc")
+	emit("push %%rax # -8(%%rbp): ptr")
+	emit("push $0 # -16(%%rbp): index")
+
+	labelBegin := ".runtime_args_begin"
+	labelEnd := ".runtime_args_end"
+	emitWithoutIndent("%s:", labelBegin)
+	emit("mov -16(%%rbp), %%rcx")
+	emit("cmp runtimeArgc(%%rip), %%rcx")
+	emit("jge %s", labelEnd)
+	emit("mov runtimeArgv(%%rip), %%rax")
+	emit("mov (%%rax,%%rcx,8), %%rax # argv[i]")
+	emit("push %%rax")
+	emit("mov %%rax, %%rdi")
+	emit("FUNCALL strlen@PLT")
+	emit("pop %%rdx # argv[i]")
+	emit("mov -16(%%rbp), %%rcx")
+	emit("imul $16, %%rcx")
+	emit("add -8(%%rbp), %%rcx")
+	emit("mov %%rdx, (%%rcx) # ptr")
+	emit("mov %%rax, 8(%%rcx) # len")
+	emit("addq $1, -16(%%rbp)")
+	emit("jmp %s", labelBegin)
+	emitWithoutIndent("%s:", labelEnd)
 
 	emit("# set argv, argc, argc")
-	emit("mov runtimeArgv(%%rip), %%rax # ptr")
+	emit("mov -8(%%rbp), %%rax # ptr")
 	emit("mov runtimeArgc(%%rip), %%rbx # len")
 	emit("mov runtimeArgc(%%rip), %%rcx # cap")
 
 	emitFuncEpilogue(".runtime_args_noop_handler", nil)
+	emitFuncEnd(".runtime_args")
 }
 
-func emitMainFunc(importOS bool) {
+func emitMainFunc(inits []*DeclFunc) {
 	fname := "main"
-	emit(".global	%s", fname)
-	emitWithoutIndent("%s:", fname)
-	emit("push %%rbp")
-	emit("mov %%rsp, %%rbp")
+	emitFuncStart(fname, true)
+	emit("FUNC_PROLOGUE")
 
 	emit("mov %%rsi, runtimeArgv(%%rip)")
 	emit("mov %%rdi, runtimeArgc(%%rip)")
 	emit("mov $0, %%rsi")
 	emit("mov $0, %%rdi")
 
-	// init runtime
-	emit("# init runtime")
-	emit("FUNCALL iruntime.init")
+	emit("mov %%rbp, runtimeStackBottom(%%rip)")
 
-	// init imported packages
-	if importOS {
-		emit("# init os")
-		emit("FUNCALL os.init")
+	// init the runtime and the packages
+	for _, fn := range inits {
+		emit("FUNCALL %s", fn.getSymbol())
 	}
 
 	emitNewline()
 	emit("FUNCALL main.main")
 	emitFuncEpilogue("noop_handler", nil)
+	emitFuncEnd(fname)
 }
 
@@ -1,6 +1,7 @@
 package main
 
 func (call *IrInterfaceMethodCall) emit(args []Expr) {
+	// like IrStaticCall, no register has to be saved around the call
 	emit("# emit interface method call \"%s\"", call.methodName)
 	mapType := &Gtype{
 		kind: G_MAP,
@@ -11,22 +12,17 @@ func (call *IrInterfaceMethodCall) emit(args []Expr) {
 			kind: G_STRING,
 		},
 	}
-	emit("# emit receiverTypeId of %s", call.receiver.getGtype().String())
+	emit("# emit the method table of %s", call.receiver.getGtype().String())
 	emitOffsetLoad(call.receiver, ptrSize, ptrSize)
-	emit("IMUL_NUMBER 8")
-	emit("PUSH_8")
-
-	emit("lea receiverTypes(%%rip), %%rax")
-	emit("PUSH_8")
-	emit("SUM_FROM_STACK")
 
 	emit("# find method %s", call.methodName)
-	emit("mov (%%rax), %%rax") // address of receiverType
 	emit("PUSH_8 # map head")
+	groot.useMethodName(string(call.methodName))
 
 	emit("push $128 # len")
-	emit("lea .M%s, %%rax", call.methodName) // index value
-	emit("PUSH_8 # map index value")                 // index value
+	emit("lea .M%s(%%rip), %%rax", call.methodName) // index value
+	emit("LOAD_16_BY_DEREF")
+	emit("PUSH_STRING # map index value") // index value
 	emitMapGet(mapType, false)
 
 	emit("PUSH_8")
@@ -45,6 +41,7 @@ func (call *IrInterfaceMethodCall) emit(args []Expr) {
 
 	emit("PUSH_8 # receiver")
 
+	numRegs := 1
 	otherArgs := args[1:]
 	for i, arg := range otherArgs {
 		if _, ok := arg.(*ExprVaArg); ok {
@@ -53,12 +50,17 @@ func (call *IrInterfaceMethodCall) emit(args []Expr) {
 		} else {
 			arg.emit()
 		}
-		emit("PUSH_8 # argument no %d", i+2)
+		if arg.getGtype().isString() {
+			emit("PUSH_STRING # argument no %d", i+2)
+			numRegs += 2
+		} else {
+			emit("PUSH_8 # argument no %d", i+2)
+			numRegs++
+		}
 	}
 
-	for i, _ := range args {
-		j := len(args) - 1 - i
-		emit("POP_TO_ARG_%d", j)
+	for i := numRegs - 1; i >= 0; i-- {
+		emit("POP_TO_ARG_%d", i)
 	}
 
 	emit("pop %%rax")
@@ -78,12 +80,17 @@ func loadMapIndexExpr(_map Expr, index Expr) {
 	emitOffsetLoad(_map, IntSize, IntSize)
 	emit("PUSH_8 # len")
 	index.emit()
-	emit("PUSH_8 # index value")
+	if _map.getGtype().Underlying().mapKey.isString() {
+		emit("PUSH_STRING # index value")
+	} else {
+		emit("PUSH_8 # index value")
+	}
 	emitMapGet(_map.getGtype(), true)
 }
 
-func mapOkRegister(is24Width bool) string {
-	if is24Width {
+// the register to hold ok of "v, ok = x" next to the value v
+func mapOkRegister(valueType *Gtype) string {
+	if valueType.is24Width() || valueType.isString() {
 		return "rdx"
 	} else {
 		return "rbx"
@@ -94,11 +101,8 @@ func mapOkRegister(is24Width bool) string {
 // r11: map len")
 // r12: specified index value")
 // r13: loop counter")
+// r14: len of specified index value if it is a string")
 func emitMapGet(mapType *Gtype, deref bool) {
-
-	emit("pop %%r12 # index value")
-	emit("pop %%r11 # map len")
-	emit("pop %%r10 # map head")
 	if mapType.kind == G_NAMED {
 		// @TODO handle infinite chain of relations
 		mapType = mapType.relation.gtype
@@ -106,6 +110,13 @@ func emitMapGet(mapType *Gtype, deref bool) {
 	mapKeyType := mapType.mapKey
 	mapValueType := mapType.mapValue
 	is24Width := mapValueType.is24Width()
+
+	if mapKeyType.isString() {
+		emit("pop %%r14 # index len")
+	}
+	emit("pop %%r12 # index value")
+	emit("pop %%r11 # map len")
+	emit("pop %%r10 # map head")
 	emit("# emitMapGet")
 	emit("mov $0, %%r13 # init loop counter") // i = 0
 
@@ -122,12 +133,12 @@ func emitMapGet(mapType *Gtype, deref bool) {
 	if is24Width {
 		emit("LOAD_EMPTY_SLICE # NOT FOUND")
 	} else if mapValueType.isString() {
-		emitEmptyString()
+		emit("LOAD_EMPTY_STRING # NOT FOUND")
 	} else {
 		emit("mov $0, %%rax # key not found")
 	}
 
-	okRegister := mapOkRegister(is24Width)
+	okRegister := mapOkRegister(mapValueType)
 	emit("mov $0, %%%s # ok = false", okRegister)
 
 	emit("je %s  # Exit. NOT FOUND IN ALL KEYS.", labelEnd)
@@ -146,22 +157,26 @@ func emitMapGet(mapType *Gtype, deref bool) {
 	emit("LOAD_8_BY_DEREF") // emit index address
 
 	assert(mapKeyType != nil, nil, "key kind should not be nil:"+mapType.String())
-	if !mapKeyType.isString() {
-		emit("LOAD_8_BY_DEREF") // dereference
-	}
 	if mapKeyType.isString() {
+		emit("LOAD_16_BY_DEREF") // dereference
+		emit("push %%r14")
 		emit("push %%r13")
+		emit("push %%r12")
 		emit("push %%r11")
 		emit("push %%r10")
 
-		emit("PUSH_8")
+		emit("PUSH_STRING")
 		emit("push %%r12")
+		emit("push %%r14")
 		emitStringsEqualFromStack(true)
 
 		emit("pop %%r10")
 		emit("pop %%r11")
+		emit("pop %%r12")
 		emit("pop %%r13")
+		emit("pop %%r14")
 	} else {
+		emit("LOAD_8_BY_DEREF") // dereference
 		// primitive comparison
 		emit("cmp %%r12, %%rax # compare specifiedvalue vs indexvalue")
 		emit("sete %%al")
@@ -179,6 +194,8 @@ func emitMapGet(mapType *Gtype, deref bool) {
 	if deref {
 		if mapValueType.is24Width() {
 			emit("LOAD_24_BY_DEREF")
+		} else if mapValueType.isString() {
+			emit("LOAD_16_BY_DEREF")
 		} else {
 			emit("LOAD_8_BY_DEREF")
 		}
@@ -197,15 +214,19 @@ func emitMapGet(mapType *Gtype, deref bool) {
 
 // m[k] = v
 // append key and value to the tail of map data, and increment its length
-func (e *ExprIndex) emitMapSet(isWidth24 bool) {
+// width is the number of words of the value in the stack
+func (e *ExprIndex) emitMapSet(width int) {
 
 	labelAppend := makeLabel()
 	labelSave := makeLabel()
 
+	mapType := e.collection.getGtype().Underlying()
+	mapKeyType := mapType.mapKey
+
 	// map get to check if exists
 	e.emit()
 	// jusdge update or append
-	emit("cmp $1, %%%s # ok == true", mapOkRegister(isWidth24))
+	emit("cmp $1, %%%s # ok == true", mapOkRegister(mapType.mapValue))
 	emit("sete %%al")
 	emit("movzb %%al, %%eax")
 	emit("TEST_IT")
@@ -216,39 +237,40 @@ func (e *ExprIndex) emitMapSet(isWidth24 bool) {
 	emit("jmp %s", labelSave)
 
 	// append
+	// The map data is a list of 16 byte entries {key address, value address}.
+	// Extend it by an empty entry like a slice, which grows when it is full.
 	emit("%s: # append to a map ", labelAppend)
-	e.collection.emit() // emit pointer address to %rax
-	emit("PUSH_8")
-
-	// emit len of the map
-	elen := &ExprLen{
-		arg: e.collection,
+	e.collection.emit()
+	emit("PUSH_MAP")
+	emit("LOAD_EMPTY_STRING # empty entry")
+	emit("PUSH_STRING")
+	for i := 4; i >= 0; i-- {
+		emit("POP_TO_ARG_%d", i)
 	}
-	elen.emit()
-	emit("IMUL_NUMBER %d", 2*8) // distance from head to tail
+	emit("FUNCALL iruntime.append16")
+	emit("PUSH_MAP")
+	emitSave24(e.collection, 0)
+
+	// the address of the new entry
+	e.collection.emit()
+	emit("imul $%d, %%rbx", 2*8)
+	emit("lea -%d(%%rax,%%rbx), %%rax", 2*8) // ptr + (len-1) * 16
 	emit("PUSH_8")
-	emit("SUM_FROM_STACK")
-	emit("PUSH_8")
-
-	// map len++
-	elen.emit()
-	emit("ADD_NUMBER 1")
-	emitOffsetSave(e.collection, IntSize, ptrSize) // update map len
 
 	// Save key and value
 	emit("%s: # end loop", labelSave)
 	e.index.emit()
-	emit("PUSH_8") // index value
-
-	mapType := e.collection.getGtype().Underlying()
-	mapKeyType := mapType.mapKey
 
 	if mapKeyType.isString() {
-		emit("pop %%rcx")          // index value
-		emit("pop %%rax")          // map tail address
-		emit("mov %%rcx, (%%rax)") // save indexvalue to malloced area
-		emit("PUSH_8")         // push map tail
+		emit("PUSH_STRING") // index value
+		emitCallMalloc(16)
+		emit("PUSH_8")
+		emit("STORE_16_INDIRECT_FROM_STACK") // save indexvalue to malloced area
+		emit("pop %%rcx")                    // map tail address
+		emit("mov %%rax, (%%rcx) #")         // save index address to the tail
+		emit("push %%rcx")                   // push map tail
 	} else {
+		emit("PUSH_8") // index value
 		// malloc(8)
 		emitCallMalloc(8)
 		// %%rax : malloced address
@@ -263,20 +285,12 @@ func (e *ExprIndex) emitMapSet(isWidth24 bool) {
 	// save value
 
 	// malloc(8)
-	var size int = 8
-	if isWidth24 {
-		size = 24
-	}
-	emitCallMalloc(size)
+	emitCallMalloc(width * 8)
 
 	emit("pop %%rcx")           // map tail address
 	emit("mov %%rax, 8(%%rcx)") // set malloced address to tail+8
 	emit("PUSH_8")
-	if isWidth24 {
-		emit("STORE_24_INDIRECT_FROM_STACK")
-	} else {
-		emit("STORE_8_INDIRECT_FROM_STACK")
-	}
+	emit("STORE_%d_INDIRECT_FROM_STACK", width*8)
 }
 
 func (f *StmtFor) emitRangeForMap() {
@@ -333,10 +347,14 @@ func (f *StmtFor) emitRangeForMap() {
 	emit("SUM_FROM_STACK # x + y")
 	emit("LOAD_8_BY_DEREF")
 
-	if !mapKeyType.isString() {
+	if mapKeyType.isString() {
+		emit("LOAD_16_BY_DEREF")
+		emit("PUSH_STRING")
+		emitSave16(f.rng.indexvar, 0)
+	} else {
 		emit("LOAD_8_BY_DEREF")
+		f.rng.indexvar.emitSave()
 	}
-	f.rng.indexvar.emitSave()
 
 	if f.rng.valuevar != nil {
 		emit("# Setting valuevar")
@@ -360,6 +378,10 @@ func (f *StmtFor) emitRangeForMap() {
 			emit("LOAD_24_BY_DEREF")
 			emit("PUSH_24")
 			emitSave24(f.rng.valuevar, 0)
+		case G_STRING:
+			emit("LOAD_16_BY_DEREF")
+			emit("PUSH_STRING")
+			emitSave16(f.rng.valuevar, 0)
 		default:
 			emit("LOAD_8_BY_DEREF")
 			f.rng.valuevar.emitSave()
@@ -369,6 +391,7 @@ func (f *StmtFor) emitRangeForMap() {
 
 	f.block.emit()
 	emit("%s: # end block", f.labelEndBlock)
+	emitLoc(f.tok)
 
 	// counter++
 	indexIncr := &StmtInc{
@@ -402,6 +425,10 @@ func (lit *ExprMapLiteral) emit() {
 		// alloc key
 		if mapKeyType.isString() {
 			element.key.emit()
+			emit("PUSH_STRING") // value of key
+			emitCallMalloc(16)
+			emit("PUSH_8")
+			emit("STORE_16_INDIRECT_FROM_STACK") // save key to heap
 		} else {
 			element.key.emit()
 			emit("PUSH_8") // value of key
@@ -416,7 +443,13 @@ func (lit *ExprMapLiteral) emit() {
 		emit("mov %%rax, %d(%%rbx) #", i*2*8) // save key address
 		emit("push %%rbx")                    // map head
 
-		if element.value.getGtype().getSize() <= 8 {
+		if element.value.getGtype().isString() {
+			element.value.emit()
+			emit("PUSH_STRING") // value of value
+			emitCallMalloc(16)
+			emit("PUSH_8")
+			emit("STORE_16_INDIRECT_FROM_STACK") // save value to heap
+		} else if element.value.getGtype().getSize() <= 8 {
 			element.value.emit()
 			emit("PUSH_8") // value of value
 			emitCallMalloc(8)
@@ -442,6 +475,6 @@ func (lit *ExprMapLiteral) emit() {
 	}
 
 	emit("pop %%rax") // address (head of the heap)
-	emit("mov $%d, %%rbx", length) // len
-	emit("mov $%d, %%rcx", length) // cap
+	emit("mov $%d, %%rbx", length)      // len
+	emit("mov $%d, %%rcx", size/(2*8)) // cap: the number of entries
 }
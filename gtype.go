@@ -43,7 +43,7 @@ type Gtype struct {
 	fieldname      identifier                  // for struct field
 	offset         int                         // for struct field
 	padding        int                         // for struct field
-	length         int                         // for array, string(len without the terminating \0)
+	length         int                         // for array, string literal
 	elementType    *Gtype                      // for array, slice
 	imethods       map[identifier]*signature   // for interface
 	methods        map[identifier]*ExprFuncRef // for G_NAMED
@@ -111,10 +111,13 @@ func (gtype *Gtype) getSize() int {
 				gtype.calcStructOffset()
 			}
 			return gtype.size
-		} else if gtype.kind == G_POINTER || gtype.kind == G_STRING {
+		} else if gtype.kind == G_POINTER {
 			return ptrSize
+		} else if gtype.kind == G_STRING {
+			//     ptr    ,  len
+			return ptrSize + IntSize
 		} else if gtype.kind == G_INTERFACE {
-			//     data    ,  receiverTypeId, dtype
+			//     data    ,  methods, dtype
 			return ptrSize + ptrSize + ptrSize
 		} else if gtype.kind == G_SLICE {
 			return ptrSize + IntSize + IntSize
@@ -126,6 +129,36 @@ func (gtype *Gtype) getSize() int {
 	}
 }
 
+// pointerOffsets returns the offsets of the words in a value of gtype
+// which may point into the heap. The collector scans only them.
+func (gtype *Gtype) pointerOffsets() []int {
+	var offsets []int
+	switch gtype.getKind() {
+	case G_POINTER, G_STRING, G_SLICE, G_MAP, G_INTERFACE:
+		offsets = append(offsets, 0)
+	case G_STRUCT:
+		strct := gtype.Underlying()
+		strct.getSize() // calculate the offsets of fields
+		for _, field := range strct.fields {
+			var fieldOffsets []int = field.pointerOffsets()
+			for _, offset := range fieldOffsets {
+				offsets = append(offsets, field.offset+offset)
+			}
+		}
+	case G_ARRAY:
+		elementType := gtype.Underlying().elementType
+		var elementOffsets []int = elementType.pointerOffsets()
+		if len(elementOffsets) > 0 {
+			for i := 0; i < gtype.Underlying().length; i++ {
+				for _, offset := range elementOffsets {
+					offsets = append(offsets, i*elementType.getSize()+offset)
+				}
+			}
+		}
+	}
+	return offsets
+}
+
 func (gtype *Gtype) String() string {
 	if gtype == nil {
 		return "NO_TYPE"
@@ -257,6 +290,10 @@ func (e *ExprMethodcall) getGtype() *Gtype {
 		errorft(e.token(), "ExprMethodcall.getGtype(): socope \"%s\" does not exist in allScopes ", gtype.relation.pkg)
 	}
 	pgtype := allScopes[gtype.relation.pkg].getGtype(gtype.relation.name)
+	if pgtype == nil {
+		// a predeclared type like error
+		pgtype = gtype.relation.gtype
+	}
 	if pgtype == nil {
 		errorft(e.token(), "%s is not found in the scope", gtype)
 	}
@@ -302,6 +339,10 @@ func (f *ExprFuncRef) getGtype() *Gtype {
 }
 
 func (e *ExprSlice) getGtype() *Gtype {
+	if e.collection.getGtype().isString() {
+		// a substring has the same type as its operand
+		return e.collection.getGtype()
+	}
 	return &Gtype{
 		kind:        G_SLICE,
 		elementType: e.collection.getGtype().elementType,
@@ -339,6 +380,13 @@ func (e *ExprIndex) getSecondGtype() *Gtype {
 	return nil
 }
 
+func (e *ExprNew) getGtype() *Gtype {
+	return &Gtype{
+		kind:     G_POINTER,
+		origType: e.gtype,
+	}
+}
+
 func (e *ExprStructField) getGtype() *Gtype {
 	gstruct := e.strct.getGtype()
 
@@ -397,7 +445,7 @@ func (e *ExprBinop) getGtype() *Gtype {
 	switch e.op {
 	case "<", ">", "<=", ">=", "!=", "==", "&&", "||":
 		return gBool
-	case "+":
+	case "+", "&", "|", "^", "&^", "<<", ">>":
 		return e.left.getGtype()
 	case "-", "*", "%", "/":
 		return gInt
@@ -434,3 +482,7 @@ func (e *ExprMapLiteral) getGtype() *Gtype {
 func (e *ExprConversionToInterface) getGtype() *Gtype {
 	return gInterface
 }
+
+func (e *ExprBad) getGtype() *Gtype {
+	return nil
+}
@@ -0,0 +1,306 @@
+// The order of initialization of package variables.
+// A variable is initialized after the variables which its initializer refers to,
+// directly or through the functions and the methods it refers to.
+// Otherwise the variables are initialized in the order of declaration.
+// https://golang.org/ref/spec#Package_initialization
+package main
+
+// a package variable and the variables its initializer depends on
+type varInit struct {
+	decl *DeclVar
+	deps []*ExprVariable
+	done bool
+}
+
+func orderVarInits(pkg *AstPackage) {
+	var inits []*varInit
+	var pkgVars []*ExprVariable
+	for _, decl := range pkg.vars {
+		pkgVars = append(pkgVars, decl.variable)
+	}
+	for _, decl := range pkg.vars {
+		refs := &initRefs{
+			pkg:     pkg.name,
+			pkgVars: pkgVars,
+		}
+		refs.expr(decl.initval)
+		inits = append(inits, &varInit{
+			decl: decl,
+			deps: refs.vars,
+		})
+	}
+
+	var ordered []*DeclVar
+	for len(ordered) < len(inits) {
+		var next *varInit
+		for _, vi := range inits {
+			if !vi.done && isReadyToInit(vi, inits) {
+				next = vi
+				break
+			}
+		}
+		if next == nil {
+			// every variable left depends on itself
+			for _, vi := range inits {
+				if !vi.done {
+					var errors []string = []string{errorAt(vi.decl.variable.token(), "initialization cycle for "+string(vi.decl.variable.varname))}
+					reportErrorList(pkg, errors)
+				}
+			}
+		}
+		next.done = true
+		ordered = append(ordered, next.decl)
+	}
+	pkg.vars = ordered
+}
+
+// isReadyToInit tells if the variables a variable depends on have been initialized
+func isReadyToInit(vi *varInit, inits []*varInit) bool {
+	for _, dep := range vi.deps {
+		for _, other := range inits {
+			if other.decl.variable == dep && !other.done {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// initRefs finds the package variables which an initializer refers to
+type initRefs struct {
+	pkg     identifier
+	pkgVars []*ExprVariable
+	vars    []*ExprVariable // found so far
+	funcs   []*DeclFunc     // visited
+}
+
+func containsVariable(list []*ExprVariable, v *ExprVariable) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *initRefs) variable(v *ExprVariable) {
+	if !v.isGlobal || containsVariable(r.vars, v) {
+		return
+	}
+	if containsVariable(r.pkgVars, v) {
+		r.vars = append(r.vars, v)
+	}
+}
+
+// only the functions of the package can refer to its variables
+func (r *initRefs) function(fn *DeclFunc) {
+	if fn.body == nil || fn.pkg != r.pkg {
+		return
+	}
+	for _, visited := range r.funcs {
+		if visited == fn {
+			return
+		}
+	}
+	r.funcs = append(r.funcs, fn)
+	r.stmt(fn.body)
+}
+
+func (r *initRefs) stmt(s Stmt) {
+	if s == nil {
+		return
+	}
+	switch s.(type) {
+	case *StmtSatementList:
+		list := s.(*StmtSatementList)
+		if list == nil {
+			return
+		}
+		for _, stmt := range list.stmts {
+			r.stmt(stmt)
+		}
+	case *DeclVar:
+		r.expr(s.(*DeclVar).initval)
+	case *StmtShortVarDecl:
+		r.exprs(s.(*StmtShortVarDecl).rights)
+	case *StmtAssignment:
+		assignment := s.(*StmtAssignment)
+		r.exprs(assignment.lefts)
+		r.exprs(assignment.rights)
+	case *StmtExpr:
+		r.expr(s.(*StmtExpr).expr)
+	case *StmtInc:
+		r.expr(s.(*StmtInc).operand)
+	case *StmtDec:
+		r.expr(s.(*StmtDec).operand)
+	case *StmtReturn:
+		r.exprs(s.(*StmtReturn).exprs)
+	case *StmtDefer:
+		r.expr(s.(*StmtDefer).expr)
+	case *StmtIf:
+		stmtIf := s.(*StmtIf)
+		r.stmt(stmtIf.simplestmt)
+		r.expr(stmtIf.cond)
+		r.stmt(stmtIf.then)
+		r.stmt(stmtIf.els)
+	case *StmtFor:
+		stmtFor := s.(*StmtFor)
+		if stmtFor.rng != nil {
+			r.expr(stmtFor.rng.rangeexpr)
+		}
+		if stmtFor.cls != nil {
+			r.stmt(stmtFor.cls.init)
+			r.stmt(stmtFor.cls.cond)
+			r.stmt(stmtFor.cls.post)
+		}
+		r.stmt(stmtFor.block)
+	case *StmtSwitch:
+		stmtSwitch := s.(*StmtSwitch)
+		r.expr(stmtSwitch.cond)
+		for _, cse := range stmtSwitch.cases {
+			r.exprs(cse.exprs)
+			r.stmt(cse.compound)
+		}
+		r.stmt(stmtSwitch.dflt)
+	case *ExprBinop:
+		// the condition of a for statement
+		r.expr(s.(*ExprBinop))
+	case *ExprUop:
+		r.expr(s.(*ExprUop))
+	case *ExprFuncallOrConversion:
+		r.expr(s.(*ExprFuncallOrConversion))
+	case *ExprMethodcall:
+		r.expr(s.(*ExprMethodcall))
+	}
+}
+
+func (r *initRefs) exprs(list []Expr) {
+	for _, e := range list {
+		r.expr(e)
+	}
+}
+
+func (r *initRefs) expr(x Expr) {
+	if x == nil {
+		return
+	}
+	switch x.(type) {
+	case *Relation:
+		r.expr(x.(*Relation).expr)
+	case *ExprVariable:
+		r.variable(x.(*ExprVariable))
+	case *ExprFuncRef:
+		r.function(x.(*ExprFuncRef).funcdef)
+	case *ExprUop:
+		r.expr(x.(*ExprUop).operand)
+	case *ExprBinop:
+		binop := x.(*ExprBinop)
+		r.expr(binop.left)
+		r.expr(binop.right)
+	case *ExprStructLiteral:
+		for _, field := range x.(*ExprStructLiteral).fields {
+			r.expr(field.value)
+		}
+	case *ExprSliceLiteral:
+		r.exprs(x.(*ExprSliceLiteral).values)
+	case *ExprArrayLiteral:
+		r.exprs(x.(*ExprArrayLiteral).values)
+	case *ExprMapLiteral:
+		for _, element := range x.(*ExprMapLiteral).elements {
+			r.expr(element.key)
+			r.expr(element.value)
+		}
+	case *ExprStructField:
+		r.expr(x.(*ExprStructField).strct)
+	case *ExprIndex:
+		index := x.(*ExprIndex)
+		r.expr(index.collection)
+		r.expr(index.index)
+	case *ExprSlice:
+		slice := x.(*ExprSlice)
+		r.expr(slice.collection)
+		r.expr(slice.low)
+		r.expr(slice.high)
+		r.expr(slice.max)
+	case *ExprLen:
+		r.expr(x.(*ExprLen).arg)
+	case *ExprCap:
+		r.expr(x.(*ExprCap).arg)
+	case *ExprConversion:
+		r.expr(x.(*ExprConversion).expr)
+	case *ExprConversionToInterface:
+		r.expr(x.(*ExprConversionToInterface).expr)
+	case *ExprTypeAssertion:
+		r.expr(x.(*ExprTypeAssertion).expr)
+	case *ExprTypeSwitchGuard:
+		r.expr(x.(*ExprTypeSwitchGuard).expr)
+	case *ExprVaArg:
+		r.expr(x.(*ExprVaArg).expr)
+	case *ExprFuncallOrConversion:
+		funcall := x.(*ExprFuncallOrConversion)
+		r.exprs(funcall.args)
+		r.expr(funcall.rel)
+	case *ExprMethodcall:
+		// a method called through an interface is not a reference
+		call := x.(*ExprMethodcall)
+		r.expr(call.receiver)
+		r.exprs(call.args)
+		origType := call.getOrigType()
+		if origType.kind == G_INTERFACE {
+			return
+		}
+		funcref, ok := origType.methods[call.fname]
+		if ok {
+			r.function(funcref.funcdef)
+		}
+	}
+}
+
+// addVarInitFunc makes the init function which assigns the package variables
+// whose initial values are not known at compile time, in the order of initialization.
+// It is called before the init functions of the package.
+func addVarInitFunc(pkg *AstPackage) {
+	var stmts []Stmt
+	var localvars []*ExprVariable
+	for _, decl := range pkg.vars {
+		if decl.isStatic() {
+			continue
+		}
+		assignment := &StmtAssignment{
+			tok:    decl.token(),
+			lefts:  []Expr{decl.varname},
+			rights: []Expr{decl.initval},
+		}
+		stmts = append(stmts, assignment)
+		for _, variable := range decl.invisibles {
+			localvars = append(localvars, variable)
+		}
+	}
+	if len(stmts) == 0 {
+		return
+	}
+
+	tok := stmts[0].token()
+	fn := &DeclFunc{
+		tok:   tok,
+		pkg:   pkg.name,
+		fname: "init",
+		body: &StmtSatementList{
+			tok:   tok,
+			stmts: stmts,
+		},
+		localvars:         localvars,
+		labelDeferHandler: makeLabel() + "_defer_handler",
+	}
+	var funcs []*DeclFunc = []*DeclFunc{fn}
+	for _, f := range pkg.funcs {
+		funcs = append(funcs, f)
+	}
+	pkg.funcs = funcs
+	var inits []*DeclFunc = []*DeclFunc{fn}
+	for _, f := range pkg.inits {
+		f.initIndex = len(inits)
+		inits = append(inits, f)
+	}
+	pkg.inits = inits
+}
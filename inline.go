@@ -0,0 +1,510 @@
+// Inlining of small leaf functions.
+// A function whose body is a single return of an expression without calls
+// can be inlined: its call evaluates the args into copies of the params
+// in the frame of the caller, and then the expression.
+package main
+
+var inlineEnabled = true // -l disables it
+var inlineBudget = 20    // -inline-budget=N: the largest body to inline
+var inlineGrowth = 400   // -inline-growth=N: how much a function may grow by inlining
+
+// InlinedCall is emitted instead of the call it is attached to
+type InlinedCall struct {
+	tok    *Token // of the call
+	callee *DeclFunc
+	params []*ExprVariable // copies of the params which are not substituted
+	args   []Expr
+	body   Expr // the return value of the callee with the params substituted
+}
+
+type inliner struct {
+	fn       *DeclFunc // the caller
+	growth   int       // the total cost of the calls inlined so far
+	verbose  bool
+	separate bool // only the functions of the same package are inlined
+}
+
+func inlineCalls(root *IrRoot, mainPkg *AstPackage) {
+	if !inlineEnabled {
+		return
+	}
+	for _, pkg := range root.packages {
+		for _, fn := range pkg.funcs {
+			if fn.body == nil {
+				continue
+			}
+			inl := &inliner{
+				fn:       fn,
+				verbose:  printEscapes && fn.pkg == mainPkg.name,
+				separate: root.separate,
+			}
+			inl.stmt(fn.body)
+		}
+	}
+}
+
+// types which a param or a result of an inlined function can have
+func isInlineType(gtype *Gtype) bool {
+	switch gtype.getKind() {
+	case G_INT, G_BOOL, G_BYTE, G_POINTER, G_STRING, G_SLICE:
+		return true
+	}
+	return false
+}
+
+// the cost of inlining the function, or -1 if it can not be inlined
+func (fn *DeclFunc) getInlineCost() int {
+	if fn.inlineCost == 0 {
+		fn.inlineCost = fn.computeInlineCost()
+	}
+	return fn.inlineCost
+}
+
+func (fn *DeclFunc) computeInlineCost() int {
+	if fn.noinline || fn.body == nil || fn.stmtDefer != nil || fn.pkg == "libc" {
+		return -1
+	}
+	if len(fn.rettypes) != 1 || !isInlineType(fn.rettypes[0]) || len(fn.body.stmts) != 1 {
+		return -1
+	}
+	ret, ok := fn.body.stmts[0].(*StmtReturn)
+	if !ok || len(ret.exprs) != 1 {
+		return -1
+	}
+	var params []*ExprVariable = escapeParams(fn)
+	for _, param := range params {
+		if param.isVariadic || param.heapAddr != nil || !isInlineType(param.getGtype()) {
+			return -1
+		}
+	}
+	return inlineCost(ret.exprs[0])
+}
+
+func addInlineCost(a int, b int) int {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a + b
+}
+
+// the number of nodes of an expression, or -1 if it has something other than
+// variables, constants, operators and field or element accesses
+func inlineCost(e Expr) int {
+	switch e.(type) {
+	case *Relation:
+		rel := e.(*Relation)
+		switch rel.expr.(type) {
+		case *ExprVariable, *ExprConstVariable, *ExprNilLiteral:
+			return 1
+		}
+		return -1
+	case *ExprVariable, *ExprConstVariable, *ExprNumberLiteral, *ExprStringLiteral, *ExprNilLiteral:
+		return 1
+	case *ExprBinop:
+		binop := e.(*ExprBinop)
+		return addInlineCost(1, addInlineCost(inlineCost(binop.left), inlineCost(binop.right)))
+	case *ExprUop:
+		uop := e.(*ExprUop)
+		if uop.op == "&" {
+			// taking an address is left to escape analysis
+			return -1
+		}
+		return addInlineCost(1, inlineCost(uop.operand))
+	case *ExprStructField:
+		return addInlineCost(1, inlineCost(e.(*ExprStructField).strct))
+	case *ExprIndex:
+		index := e.(*ExprIndex)
+		switch index.collection.getGtype().getKind() {
+		case G_SLICE, G_STRING:
+			return addInlineCost(1, addInlineCost(inlineCost(index.collection), inlineCost(index.index)))
+		}
+		return -1
+	case *ExprLen:
+		return addInlineCost(1, inlineCost(e.(*ExprLen).arg))
+	case *ExprConversion:
+		conversion := e.(*ExprConversion)
+		if !isScalarConversion(conversion.gtype, conversion.expr) {
+			return -1
+		}
+		return addInlineCost(1, inlineCost(conversion.expr))
+	case *ExprFuncallOrConversion:
+		funcall := e.(*ExprFuncallOrConversion)
+		if len(funcall.args) != 1 {
+			return -1
+		}
+		if funcall.rel.expr == nil && funcall.rel.gtype != nil {
+			if !isScalarConversion(funcall.rel.gtype, funcall.args[0]) {
+				return -1
+			}
+			return addInlineCost(1, inlineCost(funcall.args[0]))
+		}
+		if funcref, ok := funcall.rel.expr.(*ExprFuncRef); ok && funcref.funcdef == builtinLen {
+			return addInlineCost(1, inlineCost(funcall.args[0]))
+		}
+	}
+	return -1
+}
+
+// a conversion which copies nothing
+func isScalarConversion(to *Gtype, from Expr) bool {
+	fromKind := from.getGtype().getKind()
+	toKind := to.getKind()
+	if fromKind == G_STRING || toKind == G_STRING {
+		return fromKind == toKind
+	}
+	return isInlineType(to) && toKind != G_SLICE && fromKind != G_SLICE
+}
+
+func (inl *inliner) stmt(s Stmt) {
+	if s == nil {
+		return
+	}
+	switch s.(type) {
+	case *StmtSatementList:
+		list := s.(*StmtSatementList)
+		if list == nil {
+			return
+		}
+		for _, stmt := range list.stmts {
+			inl.stmt(stmt)
+		}
+	case *DeclVar:
+		inl.expr(s.(*DeclVar).initval)
+	case *StmtShortVarDecl:
+		decl := s.(*StmtShortVarDecl)
+		inl.exprs(decl.lefts)
+		inl.exprs(decl.rights)
+	case *StmtAssignment:
+		assignment := s.(*StmtAssignment)
+		inl.exprs(assignment.lefts)
+		inl.exprs(assignment.rights)
+	case *StmtExpr:
+		inl.expr(s.(*StmtExpr).expr)
+	case *StmtInc:
+		inl.expr(s.(*StmtInc).operand)
+	case *StmtDec:
+		inl.expr(s.(*StmtDec).operand)
+	case *StmtReturn:
+		inl.exprs(s.(*StmtReturn).exprs)
+	case *StmtIf:
+		stmtIf := s.(*StmtIf)
+		inl.stmt(stmtIf.simplestmt)
+		inl.expr(stmtIf.cond)
+		inl.stmt(stmtIf.then)
+		inl.stmt(stmtIf.els)
+	case *StmtFor:
+		stmtFor := s.(*StmtFor)
+		if stmtFor.rng != nil {
+			inl.expr(stmtFor.rng.rangeexpr)
+		}
+		if stmtFor.cls != nil {
+			inl.stmt(stmtFor.cls.init)
+			inl.stmt(stmtFor.cls.cond)
+			inl.stmt(stmtFor.cls.post)
+		}
+		inl.stmt(stmtFor.block)
+	case *StmtSwitch:
+		stmtSwitch := s.(*StmtSwitch)
+		inl.expr(stmtSwitch.cond)
+		for _, cse := range stmtSwitch.cases {
+			inl.exprs(cse.exprs)
+			inl.stmt(cse.compound)
+		}
+		inl.stmt(stmtSwitch.dflt)
+	case *ExprBinop:
+		// the condition of a for statement
+		inl.expr(s.(*ExprBinop))
+	case *ExprUop:
+		inl.expr(s.(*ExprUop))
+	case *ExprFuncallOrConversion:
+		inl.expr(s.(*ExprFuncallOrConversion))
+	case *ExprMethodcall:
+		inl.expr(s.(*ExprMethodcall))
+	}
+	// a deferred call is left as it is
+}
+
+func (inl *inliner) exprs(list []Expr) {
+	for _, e := range list {
+		inl.expr(e)
+	}
+}
+
+func (inl *inliner) expr(x Expr) {
+	if x == nil {
+		return
+	}
+	switch x.(type) {
+	case *ExprUop:
+		inl.expr(x.(*ExprUop).operand)
+	case *ExprBinop:
+		binop := x.(*ExprBinop)
+		inl.expr(binop.left)
+		inl.expr(binop.right)
+	case *ExprStructLiteral:
+		for _, field := range x.(*ExprStructLiteral).fields {
+			inl.expr(field.value)
+		}
+	case *ExprSliceLiteral:
+		inl.exprs(x.(*ExprSliceLiteral).values)
+	case *ExprArrayLiteral:
+		inl.exprs(x.(*ExprArrayLiteral).values)
+	case *ExprMapLiteral:
+		for _, element := range x.(*ExprMapLiteral).elements {
+			inl.expr(element.key)
+			inl.expr(element.value)
+		}
+	case *ExprStructField:
+		inl.expr(x.(*ExprStructField).strct)
+	case *ExprIndex:
+		index := x.(*ExprIndex)
+		inl.expr(index.collection)
+		inl.expr(index.index)
+	case *ExprSlice:
+		slice := x.(*ExprSlice)
+		inl.expr(slice.collection)
+		inl.expr(slice.low)
+		inl.expr(slice.high)
+		inl.expr(slice.max)
+	case *ExprLen:
+		inl.expr(x.(*ExprLen).arg)
+	case *ExprCap:
+		inl.expr(x.(*ExprCap).arg)
+	case *ExprConversion:
+		inl.expr(x.(*ExprConversion).expr)
+	case *ExprConversionToInterface:
+		inl.expr(x.(*ExprConversionToInterface).expr)
+	case *ExprTypeAssertion:
+		inl.expr(x.(*ExprTypeAssertion).expr)
+	case *ExprTypeSwitchGuard:
+		inl.expr(x.(*ExprTypeSwitchGuard).expr)
+	case *ExprVaArg:
+		inl.expr(x.(*ExprVaArg).expr)
+	case *ExprFuncallOrConversion:
+		funcall := x.(*ExprFuncallOrConversion)
+		inl.exprs(funcall.args)
+		if funcall.rel.expr == nil {
+			// conversion
+			return
+		}
+		funcref, ok := funcall.rel.expr.(*ExprFuncRef)
+		if ok {
+			funcall.inlined = inl.inline(funcall.tok, funcref.funcdef, funcall.args)
+		}
+	case *ExprMethodcall:
+		call := x.(*ExprMethodcall)
+		inl.expr(call.receiver)
+		inl.exprs(call.args)
+		gtype := call.receiver.getGtype()
+		if gtype.kind == G_POINTER {
+			gtype = gtype.origType
+		}
+		if gtype == nil || gtype.kind != G_NAMED || gtype.relation.gtype.kind == G_INTERFACE {
+			return
+		}
+		funcref, ok := gtype.relation.gtype.methods[call.fname]
+		if !ok {
+			return
+		}
+		callee := funcref.funcdef
+		if callee.receiver == nil || callee.receiver.getGtype().getKind() != call.receiver.getGtype().getKind() {
+			// the receiver needs to be addressed or dereferenced
+			return
+		}
+		args := []Expr{call.receiver}
+		for _, arg := range call.args {
+			args = append(args, arg)
+		}
+		call.inlined = inl.inline(call.tok, callee, args)
+	}
+}
+
+// an arg which can be evaluated where the param is used, instead of being copied
+func isInlineOperand(arg Expr, param *ExprVariable) bool {
+	gtype := arg.getGtype()
+	if gtype == nil || gtype.getKind() != param.getGtype().getKind() {
+		return false
+	}
+	switch arg.(type) {
+	case *ExprNumberLiteral, *ExprStringLiteral:
+		return true
+	case *Relation:
+		switch arg.(*Relation).expr.(type) {
+		case *ExprVariable, *ExprConstVariable:
+			return true
+		}
+	}
+	return false
+}
+
+func isConstantOperand(arg Expr) bool {
+	switch arg.(type) {
+	case *ExprNumberLiteral, *ExprStringLiteral:
+		return true
+	case *Relation:
+		_, ok := arg.(*Relation).expr.(*ExprConstVariable)
+		return ok
+	}
+	return false
+}
+
+// returns nil if the call is not inlined
+func (inl *inliner) inline(tok *Token, callee *DeclFunc, args []Expr) *InlinedCall {
+	if inl.separate && callee.pkg != inl.fn.pkg {
+		// the function is emitted in another object
+		return nil
+	}
+	cost := callee.getInlineCost()
+	if cost < 0 || cost > inlineBudget || inl.growth+cost > inlineGrowth {
+		return nil
+	}
+	var params []*ExprVariable = escapeParams(callee)
+	if len(params) != len(args) {
+		return nil
+	}
+	inl.growth += cost
+
+	// variables are read where the params are used only if no arg changes them
+	allOperands := true
+	for i, arg := range args {
+		if !isInlineOperand(arg, params[i]) {
+			allOperands = false
+		}
+	}
+	call := &InlinedCall{
+		tok:    tok,
+		callee: callee,
+	}
+	c := &inlineCopier{
+		params: params,
+	}
+	for i, arg := range args {
+		param := params[i]
+		if isInlineOperand(arg, param) && (allOperands || isConstantOperand(arg)) {
+			c.values = append(c.values, arg)
+			continue
+		}
+		copied := &ExprVariable{
+			tok:          param.tok,
+			varname:      param.varname,
+			gtype:        param.getGtype(),
+			isInlineCopy: true,
+		}
+		caller := inl.fn
+		caller.localvars = append(caller.localvars, copied)
+		call.params = append(call.params, copied)
+		call.args = append(call.args, arg)
+		c.values = append(c.values, &Relation{
+			tok:  param.tok,
+			name: param.varname,
+			expr: copied,
+		})
+	}
+	ret := callee.body.stmts[0].(*StmtReturn)
+	call.body = c.expr(ret.exprs[0])
+	if inl.verbose {
+		printEscapeDecision(tok, "inlining call to "+callee.getSymbol())
+	}
+	return call
+}
+
+// inlineCopier copies the body of a function with the params replaced by values
+type inlineCopier struct {
+	params []*ExprVariable
+	values []Expr
+}
+
+func (c *inlineCopier) variable(variable *ExprVariable, e Expr) Expr {
+	for i, param := range c.params {
+		if param == variable {
+			return c.values[i]
+		}
+	}
+	return e
+}
+
+// the nodes are the ones accepted by inlineCost
+func (c *inlineCopier) expr(e Expr) Expr {
+	switch e.(type) {
+	case *Relation:
+		rel := e.(*Relation)
+		if variable, ok := rel.expr.(*ExprVariable); ok {
+			return c.variable(variable, e)
+		}
+		return e
+	case *ExprVariable:
+		return c.variable(e.(*ExprVariable), e)
+	case *ExprBinop:
+		binop := e.(*ExprBinop)
+		return &ExprBinop{
+			tok:   binop.tok,
+			op:    binop.op,
+			left:  c.expr(binop.left),
+			right: c.expr(binop.right),
+		}
+	case *ExprUop:
+		uop := e.(*ExprUop)
+		return &ExprUop{
+			tok:     uop.tok,
+			op:      uop.op,
+			operand: c.expr(uop.operand),
+		}
+	case *ExprStructField:
+		field := e.(*ExprStructField)
+		return &ExprStructField{
+			tok:       field.tok,
+			strct:     c.expr(field.strct),
+			fieldname: field.fieldname,
+		}
+	case *ExprIndex:
+		index := e.(*ExprIndex)
+		return &ExprIndex{
+			tok:        index.tok,
+			collection: c.expr(index.collection),
+			index:      c.expr(index.index),
+		}
+	case *ExprLen:
+		exprLen := e.(*ExprLen)
+		return &ExprLen{
+			tok: exprLen.tok,
+			arg: c.expr(exprLen.arg),
+		}
+	case *ExprConversion:
+		conversion := e.(*ExprConversion)
+		return &ExprConversion{
+			tok:   conversion.tok,
+			gtype: conversion.gtype,
+			expr:  c.expr(conversion.expr),
+		}
+	case *ExprFuncallOrConversion:
+		funcall := e.(*ExprFuncallOrConversion)
+		return &ExprFuncallOrConversion{
+			tok:   funcall.tok,
+			rel:   funcall.rel,
+			fname: funcall.fname,
+			args:  []Expr{c.expr(funcall.args[0])},
+		}
+	}
+	// literals and constants
+	return e
+}
+
+func (call *InlinedCall) emit() {
+	callee := call.callee
+	emit("# inlined %s (%s:%d)", callee.getSymbol(), callee.tok.filename, callee.tok.line)
+	for i, param := range call.params {
+		decl := &DeclVar{
+			tok: call.tok,
+			varname: &Relation{
+				tok:  param.tok,
+				name: param.varname,
+				expr: param,
+			},
+			variable: param,
+			initval:  call.args[i],
+		}
+		decl.emitLocal()
+	}
+	call.body.emit()
+	emit("# end of inlined %s", callee.getSymbol())
+}
@@ -2,26 +2,548 @@ package runtime
 
 var runtimeArgc int
 var runtimeArgv *int
-var Args []string //  Do not remove this. Actually this is real os.Args.
 
-var heap [640485760]byte
-var heapTail *int
+var heapTail int
+
+// the bottom of the stack, which is set by main()
+var runtimeStackBottom int
 
 const intSize = 8
 
 func init() {
-	// set head address of heap
-	heapTail = heap + 0
+	gcInit()
 }
 
 func malloc(size int) *int {
-	if heapTail+ size > len(heap) + heap  {
-		panic("malloc exceeds heap capacity")
+	return mallocChunk(size, chunkAlloc)
+}
+
+// mallocNoscan allocates memory which never contains pointers.
+// The collector does not scan it.
+func mallocNoscan(size int) *int {
+	return mallocChunk(size, chunkAllocNoscan)
+}
+
+// mallocTyped allocates memory for values described by a pointer map,
+// which is emitted by the compiler. The collector scans only the pointers in it.
+func mallocTyped(size int, pointerMap int) *int {
+	var p int = mallocChunk(size, chunkAllocTyped)
+	storeWord(p - chunkHeaderSize + intSize, pointerMap + chunkAllocTyped)
+	return p
+}
+
+func mallocChunk(size int, state int) *int {
+	csize := roundChunkSize(size + chunkHeaderSize)
+	if gcPercent >= 0 && heapAlloc + csize > nextGC {
+		gc()
+	}
+	var c int = allocChunk(csize, state)
+	if c == 0 && gcPercent >= 0 {
+		gc()
+		c = allocChunk(csize, state)
+	}
+	if c == 0 {
+		// panic() cannot be used here because it allocates a C string
+		printf("panic:malloc exceeds heap capacity\n")
+		exit(1)
 		return 0
 	}
-	r := heapTail
-	heapTail += size
-	return r
+	heapAlloc = heapAlloc + csize
+	return c + chunkHeaderSize
+}
+
+// Heap
+//
+// The heap is a sequence of chunks from arenaStart to heapTail.
+// Its address space is reserved at startup, and arenas in it are mapped
+// by mmap when the tail reaches heapEnd. Fresh memory from mmap is zero.
+//
+// A small chunk has the size of a size class and is recycled through
+// the free list of the class. A large chunk is a span of whole blocks.
+// Free spans are kept in the large list and split for any size.
+//
+// Garbage collector
+//
+// Each chunk has a 2 word header {size, state} followed by its payload.
+// The collector is a non-moving mark-sweep.
+// It scans the stack, the saved registers and the data sections conservatively:
+// every word in them which points into an allocated chunk keeps the chunk alive.
+// Chunks allocated by mallocTyped are scanned precisely.
+// The compiler emits a pointer map for their type {element size, n, n offsets},
+// and its address is kept in the state word, whose low 4 bits are the state.
+//
+// To find the chunk from an interior pointer, we keep two side tables
+// in front of the arenas, which are mapped together with them:
+//   chunkStarts: a byte per granule which is 1 if a chunk starts there
+//   blockTable:  for each block, the chunk which covers its first byte
+
+const granuleSize = 16
+const blockSize = 4096
+const chunkHeaderSize = 16
+const minChunkSize = 32
+const markStackSize = 65536
+const minNextGC = 4194304
+const arenaSize = 67108864
+const maxHeapSize = 274877906944 // address space to reserve
+
+// for mmap
+const protNone = 0
+const protReadWrite = 3
+const mapPrivate = 2
+const mapFixed = 16
+const mapAnonymous = 32
+const mapNoreserve = 16384
+
+// chunk states
+const chunkFree = 0
+const chunkAlloc = 1
+const chunkAllocNoscan = 2
+const chunkAllocTyped = 3
+const chunkMarked = 10 // added to the state of a marked chunk
+
+// free lists indexed by size class.
+// The index 0 is the large list for chunks larger than maxSmallChunkSize.
+const maxSmallChunkSize = 32768
+const numSizeClasses = 40
+var freeLists [40]int
+var classSizes [40]int
+
+// size class of a small chunk indexed by size / granuleSize
+var sizeToClass [2049]int
+
+var chunkStarts int
+var blockTable int
+var markStack int
+var markStackLen int
+var markStackOverflowed bool
+var arenaStart int
+var heapEnd int
+
+// memory above this address has never been handed out and is still zero
+var heapHighWater int
+
+// bytes in allocated chunks
+var heapAlloc int
+
+// the next collection starts when heapAlloc exceeds this
+var nextGC int
+
+// GOGC. -1 means the collector is off.
+var gcPercent int
+
+// the number of the collections done
+var numGC int
+
+func gcInit() {
+	initSizeClasses()
+
+	tablesSize := maxHeapSize / granuleSize + maxHeapSize / blockSize * intSize
+	var reserved int = mmap(0, tablesSize + maxHeapSize, protNone, mapPrivate + mapAnonymous + mapNoreserve, -1, 0)
+	markStack = mmap(0, markStackSize * intSize, protReadWrite, mapPrivate + mapAnonymous, -1, 0)
+	if reserved == -1 || markStack == -1 {
+		printf("panic:failed to reserve the heap\n")
+		exit(1)
+	}
+	chunkStarts = reserved
+	blockTable = chunkStarts + maxHeapSize / granuleSize
+	arenaStart = blockTable + maxHeapSize / blockSize * intSize
+	heapEnd = arenaStart
+	heapTail = arenaStart
+	heapHighWater = arenaStart
+	gcPercent = readGOGC()
+	nextGC = minNextGC
+}
+
+// Size classes grow by granuleSize up to 128 bytes,
+// and then by a quarter of the power of 2 below them.
+func initSizeClasses() {
+	var size int = minChunkSize
+	var step int = granuleSize
+	for class := 1; class < numSizeClasses; class++ {
+		classSizes[class] = size
+		if size >= step * 8 {
+			step = step * 2
+		}
+		size = size + step
+	}
+
+	var class int = 1
+	for g := 1; g < len(sizeToClass); g++ {
+		for classSizes[class] < g * granuleSize {
+			class++
+		}
+		sizeToClass[g] = class
+	}
+}
+
+// the size of a chunk which can hold size bytes
+func roundChunkSize(size int) int {
+	if size <= maxSmallChunkSize {
+		return classSizes[sizeToClass[(size + granuleSize - 1) / granuleSize]]
+	}
+	return (size + blockSize - 1) / blockSize * blockSize
+}
+
+// map arenas and their side tables until the heap covers the address end
+func growHeap(end int) bool {
+	for heapEnd < end {
+		if heapEnd + arenaSize > arenaStart + maxHeapSize {
+			return false
+		}
+		offset := heapEnd - arenaStart
+		if !commit(heapEnd, arenaSize) {
+			return false
+		}
+		if !commit(chunkStarts + offset / granuleSize, arenaSize / granuleSize) {
+			return false
+		}
+		if !commit(blockTable + offset / blockSize * intSize, arenaSize / blockSize * intSize) {
+			return false
+		}
+		heapEnd = heapEnd + arenaSize
+	}
+	return true
+}
+
+func commit(addr int, size int) bool {
+	var p int = mmap(addr, size, protReadWrite, mapPrivate + mapAnonymous + mapFixed, -1, 0)
+	return p == addr
+}
+
+// parse the GOGC environment variable.
+// Like Go, "off" or a negative number turns the collector off,
+// and a value which is not a number is 100.
+func readGOGC() int {
+	var p *byte = getenv("GOGC")
+	if p == 0 {
+		return 100
+	}
+	if cstringEquals(p, "off") {
+		return -1
+	}
+	var negative bool
+	// int(*p) would load 8 bytes
+	var c byte = *p
+	if c == '-' {
+		negative = true
+		p = p + 1
+		c = *p
+	}
+	if c == 0 {
+		return 100
+	}
+	var n int
+	for c != 0 {
+		if c < '0' || c > '9' {
+			return 100
+		}
+		n = n * 10 + int(c) - '0'
+		p = p + 1
+		c = *p
+	}
+	if negative {
+		return -1
+	}
+	return n
+}
+
+// whether the C string at p is s
+func cstringEquals(p *byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		var c byte = *p
+		if c != s[i] {
+			return false
+		}
+		p = p + 1
+	}
+	var end byte = *p
+	return end == 0
+}
+
+func loadWord(addr int) int {
+	var p *int = addr
+	return *p
+}
+
+func storeWord(addr int, v int) {
+	var p *int = addr
+	*p = v
+}
+
+func chunkSize(c int) int {
+	return loadWord(c)
+}
+
+func chunkState(c int) int {
+	return loadWord(c + intSize) % 16
+}
+
+func chunkPointerMap(c int) int {
+	return loadWord(c + intSize) - chunkState(c)
+}
+
+// set the state keeping the pointer map
+func setChunkState(c int, state int) {
+	storeWord(c + intSize, chunkPointerMap(c) + state)
+}
+
+func setChunkStart(c int, v byte) {
+	var p *byte = chunkStarts + (c - arenaStart) / granuleSize
+	*p = v
+}
+
+// write the header of a chunk and register it to the side tables
+func setChunk(c int, size int, state int) {
+	storeWord(c, size)
+	storeWord(c + intSize, state)
+	setChunkStart(c, 1)
+	first := (c - arenaStart + blockSize - 1) / blockSize
+	last := (c + size - 1 - arenaStart) / blockSize
+	for b := first; b <= last; b++ {
+		storeWord(blockTable + b * intSize, c)
+	}
+}
+
+// find the chunk which contains addr. returns 0 if there is none.
+func findChunk(addr int) int {
+	if addr < arenaStart || addr >= heapTail {
+		return 0
+	}
+	offset := addr - arenaStart
+	granule := offset / granuleSize
+	firstGranule := offset / blockSize * (blockSize / granuleSize)
+	var p *byte = chunkStarts + granule
+	for g := granule; g >= firstGranule; g-- {
+		if *p == 1 {
+			return arenaStart + g * granuleSize
+		}
+		p = p - 1
+	}
+	return loadWord(blockTable + offset / blockSize * intSize)
+}
+
+func allocChunk(csize int, state int) int {
+	var c int
+	if csize <= maxSmallChunkSize {
+		class := sizeToClass[csize / granuleSize]
+		c = freeLists[class]
+		if c != 0 {
+			freeLists[class] = loadWord(c + chunkHeaderSize)
+			storeWord(c + intSize, state)
+			memset(c + chunkHeaderSize, 0, csize - chunkHeaderSize)
+			return c
+		}
+	}
+
+	c = allocFromLargeList(csize, state)
+	if c != 0 {
+		return c
+	}
+	return allocFromTail(csize, state)
+}
+
+func allocFromTail(csize int, state int) int {
+	var c int = heapTail
+	if c + csize > heapEnd && !growHeap(c + csize) {
+		return 0
+	}
+	heapTail = c + csize
+	setChunk(c, csize, state)
+	if c < heapHighWater {
+		memset(c + chunkHeaderSize, 0, csize - chunkHeaderSize)
+	}
+	if heapTail > heapHighWater {
+		heapHighWater = heapTail
+	}
+	return c
+}
+
+// first fit
+func allocFromLargeList(csize int, state int) int {
+	var prev int
+	var c int = freeLists[0]
+	for c != 0 {
+		size := chunkSize(c)
+		if size - csize >= minChunkSize {
+			// cut it from the end, so that the rest keeps its place
+			// in the list and its entries in the side tables
+			storeWord(c, size - csize)
+			c = c + size - csize
+			setChunk(c, csize, state)
+			memset(c + chunkHeaderSize, 0, csize - chunkHeaderSize)
+			return c
+		}
+		if size >= csize {
+			next := loadWord(c + chunkHeaderSize)
+			if prev == 0 {
+				freeLists[0] = next
+			} else {
+				storeWord(prev + chunkHeaderSize, next)
+			}
+			storeWord(c + intSize, state)
+			memset(c + chunkHeaderSize, 0, size - chunkHeaderSize)
+			return c
+		}
+		prev = c
+		c = loadWord(c + chunkHeaderSize)
+	}
+	return 0
+}
+
+// make free chunks of the memory and put them to free lists.
+// Small memory is cut into chunks of size classes.
+func freeChunk(c int, size int) {
+	if size > maxSmallChunkSize {
+		pushFreeChunk(c, size, 0)
+		return
+	}
+	for size > 0 {
+		// the largest class which fits
+		class := sizeToClass[size / granuleSize]
+		if classSizes[class] > size {
+			class--
+		}
+		if size - classSizes[class] == granuleSize {
+			// leave a chunk of minChunkSize at least
+			class--
+		}
+		pushFreeChunk(c, classSizes[class], class)
+		c = c + classSizes[class]
+		size = size - classSizes[class]
+	}
+}
+
+func pushFreeChunk(c int, size int, index int) {
+	setChunk(c, size, chunkFree)
+	storeWord(c + chunkHeaderSize, freeLists[index])
+	freeLists[index] = c
+}
+
+// gcCollect is called by gc() with the stack pointer after saving registers
+// and the range of the data sections.
+func gcCollect(sp int, dataStart int, dataEnd int) {
+	numGC = numGC + 1
+	markStackLen = 0
+	markStackOverflowed = false
+
+	scanRange(sp, runtimeStackBottom)
+	scanRange(dataStart, dataEnd)
+	drainMarkStack()
+	for markStackOverflowed {
+		markStackOverflowed = false
+		rescanMarkedChunks()
+		drainMarkStack()
+	}
+
+	sweep()
+	if gcPercent >= 0 {
+		nextGC = heapAlloc + heapAlloc / 100 * gcPercent
+		if nextGC < minNextGC {
+			nextGC = minNextGC
+		}
+	}
+}
+
+func scanRange(from int, to int) {
+	var p *int = (from + intSize - 1) / intSize * intSize
+	for p + intSize <= to {
+		markPointer(*p)
+		p = p + intSize
+	}
+}
+
+func markPointer(v int) {
+	c := findChunk(v)
+	if c == 0 {
+		return
+	}
+	state := chunkState(c)
+	if state == chunkFree || state >= chunkMarked {
+		return
+	}
+	setChunkState(c, state + chunkMarked)
+	if state == chunkAllocNoscan {
+		return
+	}
+	if markStackLen == markStackSize {
+		// it will be scanned by rescanMarkedChunks()
+		markStackOverflowed = true
+		return
+	}
+	storeWord(markStack + markStackLen * intSize, c)
+	markStackLen++
+}
+
+func drainMarkStack() {
+	for markStackLen > 0 {
+		markStackLen--
+		c := loadWord(markStack + markStackLen * intSize)
+		scanChunk(c)
+	}
+}
+
+func scanChunk(c int) {
+	if chunkState(c) != chunkAllocTyped + chunkMarked {
+		scanRange(c + chunkHeaderSize, c + chunkSize(c))
+		return
+	}
+
+	m := chunkPointerMap(c)
+	elementSize := loadWord(m)
+	n := loadWord(m + intSize)
+	end := c + chunkSize(c)
+	var e int = c + chunkHeaderSize
+	for e < end {
+		for i := 0; i < n; i++ {
+			p := e + loadWord(m + (i + 2) * intSize)
+			if p + intSize <= end {
+				markPointer(loadWord(p))
+			}
+		}
+		e = e + elementSize
+	}
+}
+
+func rescanMarkedChunks() {
+	for c := arenaStart; c < heapTail; c = c + chunkSize(c) {
+		state := chunkState(c)
+		if state == chunkAlloc + chunkMarked || state == chunkAllocTyped + chunkMarked {
+			scanChunk(c)
+			drainMarkStack()
+		}
+	}
+}
+
+// free unmarked chunks, merging adjacent free ones, and rebuild the free lists
+func sweep() {
+	for i := 0; i < len(freeLists); i++ {
+		freeLists[i] = 0
+	}
+	heapAlloc = 0
+
+	var runStart int
+	var c int = arenaStart
+	for c < heapTail {
+		size := chunkSize(c)
+		state := chunkState(c)
+		if state >= chunkMarked {
+			setChunkState(c, state - chunkMarked)
+			heapAlloc = heapAlloc + size
+			if runStart != 0 {
+				freeChunk(runStart, c - runStart)
+				runStart = 0
+			}
+		} else if runStart == 0 {
+			runStart = c
+		} else {
+			setChunkStart(c, 0)
+		}
+		c = c + size
+	}
+	if runStart != 0 {
+		setChunkStart(runStart, 0)
+		heapTail = runStart
+	}
 }
 
 func append1(x []byte, elm byte) []byte {
@@ -72,6 +594,29 @@ func append8(x []int, elm int) []int {
 	return z
 }
 
+func append16(x []string, elm string) []string {
+	var z []string
+	xlen := len(x)
+	zlen := xlen + 1
+
+	if cap(x) >= zlen {
+		z = x[:zlen]
+	} else {
+		var newcap int
+		if xlen == 0 {
+			newcap = 8
+		} else {
+			newcap = xlen * 2
+		}
+		z = makeSlice(zlen, newcap, 16)
+		for i:=0;i<xlen;i++ {
+			z[i] = x[i]
+		}
+	}
+
+	z[xlen] = elm
+	return z
+}
 
 func append24(x []interface{}, elm interface{}) []interface{} {
 	//dumpInterface(elm)
@@ -98,12 +643,125 @@ func append24(x []interface{}, elm interface{}) []interface{} {
 	return z
 }
 
-func strcopy(src string, dest string, slen int) string {
-	for i:=0; i < slen ; i++ {
-		dest[i] = src[i]
+func eqstrings(a string, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i:=0; i < len(a) ; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// compare strings byte by byte. returns -1, 0 or 1
+func cmpstrings(a string, b string) int {
+	var n int = len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i:=0; i < n ; i++ {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	if len(a) < len(b) {
+		return -1
+	}
+	if len(a) > len(b) {
+		return 1
+	}
+	return 0
+}
+
+// libcInt makes the int of 32 bits which a libc function returns signed,
+// e.g. -1 on errors
+func libcInt(n int) int {
+	if n >= 2147483648 {
+		return n - 4294967296
+	}
+	return n
+}
+
+// Dynamic values
+//
+// An interface value is {pointer to the value, methods, dynamic type}.
+// The compiler puts the kind of a dynamic type just before its label,
+// which is a GTYPE_KIND of gtype.go.
+const kindInt = 3
+const kindBool = 4
+const kindByte = 5
+const kindArray = 8
+const kindSlice = 9
+const kindString = 10
+const kindPointer = 12
+const kindFunc = 13
+
+// dynamicKind returns the kind of the dynamic type of x, or 0 if x is nil
+func dynamicKind(x interface{}) int {
+	var typ int = loadWord(&x + intSize * 2)
+	if typ == 0 {
+		return 0
+	}
+	return loadWord(typ - intSize)
+}
+
+// dynamicString returns the dynamic value of x whose kind is kindString
+func dynamicString(x interface{}) string {
+	var p *string = loadWord(&x)
+	return *p
+}
+
+// dynamicBytes returns the dynamic value of x whose type is []byte
+func dynamicBytes(x interface{}) []byte {
+	var p *[]byte = loadWord(&x)
+	return *p
+}
+
+// dynamicByteArray returns the elements of x whose type is [n]byte.
+// The box of an array holds its address.
+func dynamicByteArray(x interface{}, n int) []byte {
+	var p *byte = loadWord(loadWord(&x))
+	var b []byte
+	for i := 0; i < n; i++ {
+		var c byte = *p
+		b = append(b, c)
+		p = p + 1
+	}
+	return b
+}
+
+// dynamicTypeName returns the string at the label of the dynamic type of x,
+// like "*G_NAMED(main.T)"
+func dynamicTypeName(x interface{}) string {
+	var p *byte = loadWord(&x + intSize * 2)
+	var b []byte
+	for {
+		var c byte = *p
+		if c == 0 {
+			break
+		}
+		b = append(b, c)
+		p = p + 1
+	}
+	return string(b)
+}
+
+// dynamicWord returns the dynamic value of x which fits in a word
+func dynamicWord(x interface{}) int {
+	if dynamicKind(x) == kindByte {
+		var p *byte = loadWord(&x)
+		var c byte = *p
+		return int(c)
 	}
-	dest[slen] = 0
-	return dest
+	return loadWord(loadWord(&x))
 }
 
+// MiniGo is 1 when the program is compiled by minigo.
+// It is in the internal scope, which the standard packages see but user packages do not.
+// User packages tell minigo by the minigo build tag.
 const MiniGo int = 1
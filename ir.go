@@ -0,0 +1,303 @@
+// The IR is a control flow graph of basic blocks whose values are in SSA form.
+// A function which handles only scalar values (int, bool and pointers) is lowered
+// into it from the AST, optimized and emitted from it.
+// Other functions are emitted from the AST as before: the IR has no values
+// of more than one word like strings, slices, structs and interfaces,
+// and no defer.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var dumpIR = false // --dump-ir: print the IR after each pass
+
+type IrOp int
+
+const (
+	IR_CONST        IrOp = iota // aux
+	IR_PARAM                    // aux: index of the param with the receiver first
+	IR_COPY                     // args[0]
+	IR_PHI                      // args[i] comes from preds[i]
+	IR_ADD                      // args[0] + args[1]
+	IR_SUB                      // args[0] - args[1]
+	IR_MUL                      // args[0] * args[1]
+	IR_DIV                      // args[0] / args[1]
+	IR_MOD                      // args[0] % args[1]
+	IR_EQ                       // args[0] == args[1]
+	IR_NE                       // args[0] != args[1]
+	IR_LT                       // args[0] < args[1]
+	IR_LE                       // args[0] <= args[1]
+	IR_GT                       // args[0] > args[1]
+	IR_GE                       // args[0] >= args[1]
+	IR_NOT                      // !args[0]
+	IR_NEG                      // -args[0]
+	IR_LOAD                     // *(args[0] + aux)
+	IR_STORE                    // *(args[0] + aux) = args[1]
+	IR_LOAD_GLOBAL              // sym
+	IR_STORE_GLOBAL             // sym = args[0]
+	IR_CALL                     // sym(args...), aux: number of results
+	IR_RESULT                   // the aux-th result of args[0], a call with several results
+)
+
+var irOpNames []string = []string{
+	"const", "param", "copy", "phi",
+	"add", "sub", "mul", "div", "mod",
+	"eq", "ne", "lt", "le", "gt", "ge",
+	"not", "neg",
+	"load", "store", "loadglobal", "storeglobal", "call", "result",
+}
+
+type IrBlockKind int
+
+const (
+	IR_BLOCK_PLAIN  IrBlockKind = iota // jumps to succs[0]
+	IR_BLOCK_IF                        // jumps to succs[0] if control is true, otherwise to succs[1]
+	IR_BLOCK_RETURN                    // returns results
+)
+
+type IrFunc struct {
+	decl     *DeclFunc
+	symbol   string
+	blocks   []*IrBlock // the entry block first
+	params   []*IrValue // receiver first
+	valueSeq int
+	blockSeq int
+	tok      *Token // the statement being lowered
+
+	// for register allocation
+	valuesById []*IrValue
+	intervals  []*IrValue // values with a location in the order of their start
+}
+
+type IrBlock struct {
+	id      int
+	kind    IrBlockKind
+	values  []*IrValue // phis first
+	control *IrValue
+	results []*IrValue // of a return block
+	preds   []*IrBlock
+	succs   []*IrBlock
+
+	// for SSA construction
+	sealed     bool // all preds are known
+	defVars    []*ExprVariable
+	defs       []*IrValue // the current value of defVars[i]
+	incomplete []*IrValue // phis whose operands are not added yet
+
+	// for passes
+	visited   bool
+	postorder int
+	idom      *IrBlock   // immediate dominator
+	dominated []*IrBlock // children in the dominator tree
+
+	// for register allocation
+	start   int    // position of the start
+	end     int    // position of the terminator
+	liveIn  []bool // indexed by value id
+	liveOut []bool
+
+	label string
+}
+
+type IrValue struct {
+	id       int
+	op       IrOp
+	aux      int
+	sym      string
+	args     []*IrValue
+	block    *IrBlock
+	variable *ExprVariable // the variable which a param or a phi stands for
+	alias    *IrValue      // the value which replaces this one
+	live     bool
+	tok      *Token // the statement which the value is made for
+
+	// for register allocation
+	pos    int
+	start  int    // the first position where the value is live
+	end    int    // the last position where the value is live
+	reg    string // empty if the value is spilled
+	offset int    // stack slot
+}
+
+func (f *IrFunc) newBlock() *IrBlock {
+	blk := &IrBlock{
+		id: f.blockSeq,
+	}
+	f.blockSeq++
+	f.blocks = append(f.blocks, blk)
+	return blk
+}
+
+func (f *IrFunc) newValue(blk *IrBlock, op IrOp) *IrValue {
+	v := &IrValue{
+		id:    f.valueSeq,
+		op:    op,
+		block: blk,
+		tok:   f.tok,
+	}
+	f.valueSeq++
+	blk.values = append(blk.values, v)
+	return v
+}
+
+// phis are put before any other values
+func (f *IrFunc) newPhi(blk *IrBlock, variable *ExprVariable) *IrValue {
+	v := &IrValue{
+		id:       f.valueSeq,
+		op:       IR_PHI,
+		block:    blk,
+		variable: variable,
+		tok:      f.tok,
+	}
+	f.valueSeq++
+	var values []*IrValue = []*IrValue{v}
+	for _, value := range blk.values {
+		values = append(values, value)
+	}
+	blk.values = values
+	return v
+}
+
+func addEdge(from *IrBlock, to *IrBlock) {
+	from.succs = append(from.succs, to)
+	to.preds = append(to.preds, from)
+}
+
+// whether the value is kept in the stack frame
+func (v *IrValue) hasResult() bool {
+	switch v.op {
+	case IR_STORE, IR_STORE_GLOBAL:
+		return false
+	case IR_CALL:
+		// the results of a call with several results are IR_RESULT values
+		return v.aux == 1
+	}
+	return true
+}
+
+func (v *IrValue) resolve() *IrValue {
+	for v.alias != nil {
+		v = v.alias
+	}
+	return v
+}
+
+func irIsScalar(gtype *Gtype) bool {
+	switch gtype.getKind() {
+	case G_INT, G_BOOL, G_POINTER:
+		return true
+	}
+	return false
+}
+
+func irAreScalars(gtypes []*Gtype) bool {
+	for _, gtype := range gtypes {
+		if !irIsScalar(gtype) {
+			return false
+		}
+	}
+	return true
+}
+
+// lowerFuncs lowers every function it can into the IR and optimizes it
+func lowerFuncs(root *IrRoot, mainPkg *AstPackage) {
+	for _, pkg := range root.packages {
+		for _, fn := range pkg.funcs {
+			if fn.dead {
+				continue
+			}
+			irfunc := lowerFunc(fn)
+			if irfunc == nil {
+				continue
+			}
+			irfunc.optimize(dumpIR && fn.pkg == mainPkg.name)
+			fn.ir = irfunc
+		}
+	}
+}
+
+func (f *IrFunc) optimize(dump bool) {
+	if dump {
+		f.dump("lower")
+	}
+	f.propagateConstants()
+	if dump {
+		f.dump("constprop")
+	}
+	f.propagateCopies()
+	if dump {
+		f.dump("copyprop")
+	}
+	f.eliminateCommonSubexpressions()
+	if dump {
+		f.dump("cse")
+	}
+	f.eliminateDeadCode()
+	if dump {
+		f.dump("dce")
+	}
+}
+
+func (f *IrFunc) dump(pass string) {
+	s := fmt.Sprintf("# %s after %s\n", f.symbol, pass)
+	for _, blk := range f.blocks {
+		s = s + fmt.Sprintf("b%d:", blk.id)
+		if len(blk.preds) > 0 {
+			s = s + " <-"
+			for _, pred := range blk.preds {
+				s = s + fmt.Sprintf(" b%d", pred.id)
+			}
+		}
+		s = s + "\n"
+		for _, v := range blk.values {
+			s = s + "    " + v.String() + "\n"
+		}
+		s = s + "    " + blk.terminatorString() + "\n"
+	}
+	var b []byte = []byte(s)
+	os.Stderr.Write(b)
+}
+
+func (v *IrValue) name() string {
+	return fmt.Sprintf("v%d", v.id)
+}
+
+func (v *IrValue) String() string {
+	var s string
+	if v.hasResult() || (v.op == IR_CALL && v.aux > 1) {
+		s = v.name() + " = "
+	}
+	s = s + irOpNames[int(v.op)]
+	switch v.op {
+	case IR_CONST, IR_PARAM, IR_RESULT:
+		s = s + fmt.Sprintf(" %d", v.aux)
+	case IR_LOAD_GLOBAL, IR_STORE_GLOBAL, IR_CALL:
+		s = s + " " + v.sym
+	}
+	for i, arg := range v.args {
+		s = s + " " + arg.name()
+		if i == 0 && (v.op == IR_LOAD || v.op == IR_STORE) {
+			s = s + fmt.Sprintf("+%d", v.aux)
+		}
+	}
+	if v.variable != nil {
+		s = s + " (" + string(v.variable.varname) + ")"
+	}
+	return s
+}
+
+func (blk *IrBlock) terminatorString() string {
+	switch blk.kind {
+	case IR_BLOCK_PLAIN:
+		return fmt.Sprintf("jmp b%d", blk.succs[0].id)
+	case IR_BLOCK_IF:
+		return fmt.Sprintf("if %s b%d b%d", blk.control.name(), blk.succs[0].id, blk.succs[1].id)
+	}
+	s := "ret"
+	for _, v := range blk.results {
+		s = s + " " + v.name()
+	}
+	return s
+}
@@ -3,12 +3,20 @@ package main
 var groot *IrRoot
 
 type IrRoot struct {
-	packages      []*AstPackage
-	methodTable   map[int][]string
+	packages      []*AstPackage // the packages to emit
+	imported      []*AstPackage // the packages compiled in other objects
 	uniquedDTypes []string
-	importOS      bool
+	uniquedDKinds []GTYPE_KIND // kinds of uniquedDTypes
+	usedDTypes    []bool       // whether each of uniquedDTypes is referred by the emitted code
+	pointerMaps   []string     // the contents of pointer maps for the collector
+	inits         []*DeclFunc  // the init functions in the order of calls
+	methodNames   []string     // the names of methods referred by the emitted code
+	separate      bool         // the packages make an object of their own, which other objects refer to
+	withRuntime   bool         // emit the runtime functions written in assembly
+	withMain      bool         // emit the entry point which calls the inits and main.main
 }
 
+// makeIR makes the whole program to emit it at once
 func makeIR(universe *AstPackage, iruntime *AstPackage, csl *compiledStdlib, mainPkg *AstPackage) *IrRoot {
 	var packages []*AstPackage
 
@@ -21,66 +29,113 @@ func makeIR(universe *AstPackage, iruntime *AstPackage, csl *compiledStdlib, mai
 	packages = append(packages, iruntime)
 	packages = append(packages, mainPkg)
 
+	// the runtime first, and then every package after the packages it imports
+	var initOrder []*AstPackage = []*AstPackage{iruntime}
+	for _, pkg := range importedPackages {
+		initOrder = append(initOrder, pkg)
+	}
+	initOrder = append(initOrder, mainPkg)
+
+	root := newIrRoot(packages, initOrder)
+	root.withRuntime = true
+	root.withMain = true
+	return root
+}
+
+// newIrRoot makes the IR of packages.
+// The entry point, if emitted, calls the init functions of initOrder in the order.
+func newIrRoot(packages []*AstPackage, initOrder []*AstPackage) *IrRoot {
 	var dynamicTypes []*Gtype
-	var funcs []*DeclFunc
 
 	for _, pkg := range packages {
-		collectDecls(pkg)
-		if pkg == universe {
-			setStringLables(pkg, "universe")
-		} else {
-			setStringLables(pkg, string(pkg.name))
-		}
+		prepareDecls(pkg)
+		setPackageStringLabels(pkg)
 		for _, dt := range pkg.dynamicTypes {
 			dynamicTypes = append(dynamicTypes, dt)
 		}
-		for _, fn := range pkg.funcs {
-			funcs = append(funcs, fn)
-		}
 		setTypeIds(pkg.namedTypes)
 	}
 
 	root := &IrRoot{}
 	root.packages = packages
 	root.setDynamicTypes(dynamicTypes)
-	root.importOS = in_array("os", csl.uniqImportedPackageNames)
-	root.methodTable = composeMethodTable(funcs)
+	for _, pkg := range initOrder {
+		if !containsPackage(packages, pkg) {
+			// compiled in another object, which does not have
+			// the string literals of its constants used here
+			prepareDecls(pkg)
+			setPackageStringLabels(pkg)
+			root.imported = append(root.imported, pkg)
+		}
+		for _, fn := range pkg.inits {
+			root.inits = append(root.inits, fn)
+		}
+	}
 	return root
 }
 
-func (root *IrRoot) setDynamicTypes(dynamicTypes []*Gtype) {
-	var uniquedDTypes []string = builtinTypesAsString
-	for _, gtype := range dynamicTypes {
-		gs := gtype.String()
-		if !in_array(gs, uniquedDTypes) {
-			uniquedDTypes = append(uniquedDTypes, gs)
-		}
+// prepareDecls collects the declarations of a package,
+// and the variables to initialize at run time into an init function
+func prepareDecls(pkg *AstPackage) {
+	collectDecls(pkg)
+	orderVarInits(pkg)
+	addVarInitFunc(pkg)
+}
+
+func setPackageStringLabels(pkg *AstPackage) {
+	if pkg.name == "" {
+		setStringLables(pkg, "universe")
+	} else {
+		setStringLables(pkg, string(pkg.name))
 	}
+}
 
-	root.uniquedDTypes = uniquedDTypes
+func containsPackage(list []*AstPackage, pkg *AstPackage) bool {
+	for _, p := range list {
+		if p == pkg {
+			return true
+		}
+	}
+	return false
 }
 
-func composeMethodTable(funcs []*DeclFunc) map[int][]string {
-	var methodTable map[int][]string = map[int][]string{} // receiverTypeId : []methodTable
+func (root *IrRoot) setDynamicTypes(dynamicTypes []*Gtype) {
+	for _, gs := range builtinTypesAsString {
+		root.uniquedDTypes = append(root.uniquedDTypes, gs)
+		root.usedDTypes = append(root.usedDTypes, false)
+	}
+	for _, kind := range builtinTypeKinds {
+		root.uniquedDKinds = append(root.uniquedDKinds, kind)
+	}
+	for _, gtype := range dynamicTypes {
+		root.addDynamicType(gtype)
+	}
+}
 
-	for _, funcdecl := range funcs {
-		if funcdecl.receiver == nil {
-			continue
-		}
+// addDynamicType returns the id of a dynamic type, and adds it if it is new
+func (root *IrRoot) addDynamicType(gtype *Gtype) int {
+	gs := dynamicTypeString(gtype)
+	id := get_index(gs, root.uniquedDTypes)
+	if id >= 0 {
+		return id
+	}
+	var kind GTYPE_KIND
+	if !gtype.isNil() {
+		kind = gtype.getKind()
+	}
+	root.uniquedDTypes = append(root.uniquedDTypes, gs)
+	root.uniquedDKinds = append(root.uniquedDKinds, kind)
+	root.usedDTypes = append(root.usedDTypes, false)
+	return len(root.uniquedDTypes) - 1
+}
 
-		gtype := funcdecl.receiver.getGtype()
-		if gtype.kind == G_POINTER {
-			gtype = gtype.origType
-		}
-		if gtype.relation == nil {
-			errorf("no relation for %#v", funcdecl.receiver.getGtype())
+// predeclared types are named by themselves, e.g. "string" not "G_NAMED(main.string)"
+func dynamicTypeString(gtype *Gtype) string {
+	if gtype.kind == G_NAMED {
+		switch gtype.relation.gtype {
+		case gBool, gByte, gInt, gString:
+			return gtype.relation.gtype.String()
 		}
-		typeId := gtype.relation.gtype.receiverTypeId
-		symbol := funcdecl.getSymbol()
-		methods := methodTable[typeId]
-		methods = append(methods, symbol)
-		methodTable[typeId] = methods
 	}
-	debugf("set methodTable")
-	return methodTable
+	return gtype.String()
 }
@@ -0,0 +1,867 @@
+// Lowering of the AST into the IR.
+// Local variables become SSA values as they are assigned, and phis are placed
+// while the blocks are built, following "Simple and Efficient Construction of
+// Static Single Assignment Form" by Braun et al.
+package main
+
+type irLoop struct {
+	stmtFor    *StmtFor
+	breakTo    *IrBlock
+	continueTo *IrBlock
+}
+
+type irBuilder struct {
+	fn     *IrFunc
+	cur    *IrBlock
+	loops  []*irLoop
+	failed bool // met something the IR does not have
+}
+
+// lowerFunc returns nil if the function can not be lowered
+func lowerFunc(decl *DeclFunc) *IrFunc {
+	if decl.body == nil || decl.stmtDefer != nil || !irAreScalars(decl.rettypes) {
+		return nil
+	}
+	var params []*ExprVariable = escapeParams(decl)
+	if len(params) > len(RegsForArguments) {
+		return nil
+	}
+	for _, param := range params {
+		if !irIsScalar(param.getGtype()) || param.isVariadic || param.heapAddr != nil {
+			return nil
+		}
+	}
+
+	f := &IrFunc{
+		decl:   decl,
+		symbol: decl.getSymbol(),
+	}
+	b := &irBuilder{
+		fn: f,
+	}
+	entry := f.newBlock()
+	entry.sealed = true
+	for i, param := range params {
+		v := f.newValue(entry, IR_PARAM)
+		v.aux = i
+		v.variable = param
+		f.params = append(f.params, v)
+		writeVariable(entry, param, v)
+	}
+	b.cur = entry
+	b.stmt(decl.body)
+	if b.failed {
+		return nil
+	}
+	var none []*IrValue
+	b.ret(none)
+	return f
+}
+
+func (b *irBuilder) fail() {
+	b.failed = true
+}
+
+func (b *irBuilder) value(op IrOp, args []*IrValue) *IrValue {
+	v := b.fn.newValue(b.cur, op)
+	v.args = args
+	return v
+}
+
+func (b *irBuilder) constant(n int) *IrValue {
+	v := b.fn.newValue(b.cur, IR_CONST)
+	v.aux = n
+	return v
+}
+
+func (b *irBuilder) jump(to *IrBlock) {
+	b.cur.kind = IR_BLOCK_PLAIN
+	addEdge(b.cur, to)
+}
+
+func (b *irBuilder) branch(cond *IrValue, then *IrBlock, els *IrBlock) {
+	b.cur.kind = IR_BLOCK_IF
+	b.cur.control = cond
+	addEdge(b.cur, then)
+	addEdge(b.cur, els)
+}
+
+func (b *irBuilder) ret(results []*IrValue) {
+	blk := b.cur
+	blk.kind = IR_BLOCK_RETURN
+	blk.results = results
+}
+
+// code after a jump goes to a block nobody jumps to
+func (b *irBuilder) startUnreachable() {
+	blk := b.fn.newBlock()
+	blk.sealed = true
+	b.cur = blk
+}
+
+func writeVariable(blk *IrBlock, variable *ExprVariable, v *IrValue) {
+	for i, defVar := range blk.defVars {
+		if defVar == variable {
+			blk.defs[i] = v
+			return
+		}
+	}
+	blk.defVars = append(blk.defVars, variable)
+	blk.defs = append(blk.defs, v)
+}
+
+func (b *irBuilder) readVariable(blk *IrBlock, variable *ExprVariable) *IrValue {
+	for i, defVar := range blk.defVars {
+		if defVar == variable {
+			return blk.defs[i]
+		}
+	}
+	var v *IrValue
+	if !blk.sealed {
+		v = b.fn.newPhi(blk, variable)
+		blk.incomplete = append(blk.incomplete, v)
+	} else if len(blk.preds) == 1 {
+		v = b.readVariable(blk.preds[0], variable)
+	} else if len(blk.preds) == 0 {
+		// unreachable
+		v = b.fn.newValue(blk, IR_CONST)
+	} else {
+		v = b.fn.newPhi(blk, variable)
+		writeVariable(blk, variable, v)
+		b.addPhiOperands(v)
+	}
+	writeVariable(blk, variable, v)
+	return v
+}
+
+func (b *irBuilder) addPhiOperands(phi *IrValue) {
+	for _, pred := range phi.block.preds {
+		phi.args = append(phi.args, b.readVariable(pred, phi.variable))
+	}
+}
+
+// seal a block when all of its preds are known
+func (b *irBuilder) seal(blk *IrBlock) {
+	for _, phi := range blk.incomplete {
+		b.addPhiOperands(phi)
+	}
+	blk.incomplete = nil
+	blk.sealed = true
+}
+
+// a local variable which is kept as SSA values
+func isIrLocal(variable *ExprVariable) bool {
+	return !variable.isGlobal && variable.heapAddr == nil && !variable.isVariadic && irIsScalar(variable.getGtype())
+}
+
+func (b *irBuilder) stmt(s Stmt) {
+	if s == nil || b.failed {
+		return
+	}
+	switch s.(type) {
+	case *StmtSatementList:
+		list := s.(*StmtSatementList)
+		if list == nil {
+			return
+		}
+		for _, stmt := range list.stmts {
+			b.fn.tok = stmt.token()
+			b.stmt(stmt)
+		}
+	case *DeclVar:
+		decl := s.(*DeclVar)
+		if !isIrLocal(decl.variable) {
+			b.fail()
+			return
+		}
+		var v *IrValue
+		if decl.initval == nil {
+			v = b.constant(0)
+		} else {
+			v = b.expr(decl.initval)
+		}
+		if v != nil {
+			writeVariable(b.cur, decl.variable, v)
+		}
+	case *DeclConst, *DeclType:
+		// nothing to do
+	case *StmtShortVarDecl:
+		decl := s.(*StmtShortVarDecl)
+		b.assign(decl.lefts, decl.rights)
+	case *StmtAssignment:
+		assignment := s.(*StmtAssignment)
+		b.assign(assignment.lefts, assignment.rights)
+	case *StmtExpr:
+		b.exprStmt(s.(*StmtExpr).expr)
+	case *StmtInc:
+		b.incr(s.(*StmtInc).operand, IR_ADD)
+	case *StmtDec:
+		b.incr(s.(*StmtDec).operand, IR_SUB)
+	case *StmtReturn:
+		b.stmtReturn(s.(*StmtReturn))
+	case *StmtIf:
+		b.stmtIf(s.(*StmtIf))
+	case *StmtFor:
+		b.stmtFor(s.(*StmtFor))
+	case *StmtSwitch:
+		b.stmtSwitch(s.(*StmtSwitch))
+	case *StmtBreak:
+		loop := b.findLoop(s.(*StmtBreak).stmtFor)
+		if loop == nil {
+			return
+		}
+		b.jump(loop.breakTo)
+		b.startUnreachable()
+	case *StmtContinue:
+		loop := b.findLoop(s.(*StmtContinue).stmtFor)
+		if loop == nil {
+			return
+		}
+		b.jump(loop.continueTo)
+		b.startUnreachable()
+	default:
+		b.fail()
+	}
+}
+
+// a call whose results are discarded
+func (b *irBuilder) exprStmt(e Expr) {
+	switch e.(type) {
+	case *ExprFuncallOrConversion:
+		funcall := e.(*ExprFuncallOrConversion)
+		if funcall.rel.expr == nil {
+			b.fail()
+			return
+		}
+		b.funcall(funcall, false)
+	case *ExprMethodcall:
+		b.methodcall(e.(*ExprMethodcall), false)
+	default:
+		b.fail()
+	}
+}
+
+func (b *irBuilder) findLoop(stmtFor *StmtFor) *irLoop {
+	for i := len(b.loops) - 1; i >= 0; i-- {
+		if b.loops[i].stmtFor == stmtFor {
+			return b.loops[i]
+		}
+	}
+	b.fail()
+	return nil
+}
+
+// all the rights are evaluated before any assignment
+func (b *irBuilder) assign(lefts []Expr, rights []Expr) {
+	var values []*IrValue = b.exprs(rights, len(lefts))
+	if values == nil {
+		return
+	}
+	for i, left := range lefts {
+		b.assignTo(left, values[i])
+	}
+}
+
+func (b *irBuilder) assignTo(left Expr, v *IrValue) {
+	if rel, ok := left.(*Relation); ok {
+		if rel.expr == nil {
+			// _
+			return
+		}
+		variable, ok := rel.expr.(*ExprVariable)
+		if !ok {
+			b.fail()
+			return
+		}
+		b.assignToVariable(variable, v)
+		return
+	}
+	base, offset := b.memoryOperand(left)
+	if base == nil {
+		return
+	}
+	b.store(base, offset, v)
+}
+
+func (b *irBuilder) store(base *IrValue, offset int, v *IrValue) {
+	store := b.value(IR_STORE, []*IrValue{base, v})
+	store.aux = offset
+}
+
+func (b *irBuilder) assignToVariable(variable *ExprVariable, v *IrValue) {
+	if variable.isGlobal {
+		if !irIsScalar(variable.getGtype()) {
+			b.fail()
+			return
+		}
+		store := b.value(IR_STORE_GLOBAL, []*IrValue{v})
+		store.sym = string(variable.varname)
+		return
+	}
+	if !isIrLocal(variable) {
+		b.fail()
+		return
+	}
+	writeVariable(b.cur, variable, v)
+}
+
+// x++ and x--
+func (b *irBuilder) incr(operand Expr, op IrOp) {
+	one := b.constant(1)
+	if rel, ok := operand.(*Relation); ok {
+		v := b.expr(rel)
+		if v == nil {
+			return
+		}
+		b.assignTo(rel, b.value(op, []*IrValue{v, one}))
+		return
+	}
+	// the address is evaluated once
+	base, offset := b.memoryOperand(operand)
+	if base == nil {
+		return
+	}
+	v := b.value(IR_LOAD, []*IrValue{base})
+	v.aux = offset
+	b.store(base, offset, b.value(op, []*IrValue{v, one}))
+}
+
+// p.field and *p are addressed by a pointer and an offset
+func (b *irBuilder) memoryOperand(e Expr) (*IrValue, int) {
+	switch e.(type) {
+	case *ExprStructField:
+		field := e.(*ExprStructField)
+		strctType := field.strct.getGtype()
+		if strctType.kind != G_POINTER {
+			// a struct value
+			b.fail()
+			return nil, 0
+		}
+		field.calcOffset()
+		fieldType := strctType.origType.relation.gtype.getField(field.fieldname)
+		if !irIsScalar(fieldType) {
+			b.fail()
+			return nil, 0
+		}
+		base := b.expr(field.strct)
+		return base, fieldType.offset
+	case *ExprUop:
+		uop := e.(*ExprUop)
+		if uop.op != "*" || !irIsScalar(uop.getGtype()) {
+			b.fail()
+			return nil, 0
+		}
+		base := b.expr(uop.operand)
+		return base, 0
+	}
+	b.fail()
+	return nil, 0
+}
+
+func (b *irBuilder) stmtReturn(s *StmtReturn) {
+	var results []*IrValue
+	if len(b.fn.decl.rettypes) > 0 {
+		results = b.exprs(s.exprs, len(b.fn.decl.rettypes))
+		if results == nil {
+			return
+		}
+	}
+	b.ret(results)
+	b.startUnreachable()
+}
+
+// n values of exprs, which may be one call with n results.
+// returns nil if it fails
+func (b *irBuilder) exprs(exprs []Expr, n int) []*IrValue {
+	if len(exprs) == 1 && n > 1 {
+		return b.callResults(exprs[0], n)
+	}
+	if len(exprs) != n {
+		b.fail()
+		return nil
+	}
+	var values []*IrValue
+	for _, e := range exprs {
+		v := b.expr(e)
+		if v == nil {
+			return nil
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// the results of a call with several results
+func (b *irBuilder) callResults(e Expr, n int) []*IrValue {
+	var call *IrValue
+	switch e.(type) {
+	case *ExprFuncallOrConversion:
+		funcall := e.(*ExprFuncallOrConversion)
+		if funcall.rel.expr == nil || funcall.inlined != nil {
+			b.fail()
+			return nil
+		}
+		call = b.funcall(funcall, true)
+	case *ExprMethodcall:
+		methodCall := e.(*ExprMethodcall)
+		if methodCall.inlined != nil {
+			b.fail()
+			return nil
+		}
+		call = b.methodcall(methodCall, true)
+	default:
+		b.fail()
+		return nil
+	}
+	if call == nil {
+		return nil
+	}
+	if call.aux != n {
+		b.fail()
+		return nil
+	}
+	var values []*IrValue
+	for i := 0; i < n; i++ {
+		v := b.value(IR_RESULT, []*IrValue{call})
+		v.aux = i
+		values = append(values, v)
+	}
+	return values
+}
+
+func (b *irBuilder) stmtIf(s *StmtIf) {
+	b.stmt(s.simplestmt)
+	then := b.fn.newBlock()
+	join := b.fn.newBlock()
+	els := join
+	if s.els != nil {
+		els = b.fn.newBlock()
+	}
+	b.cond(s.cond, then, els)
+	b.seal(then)
+	b.cur = then
+	b.stmt(s.then)
+	b.jump(join)
+	if s.els != nil {
+		b.seal(els)
+		b.cur = els
+		b.stmt(s.els)
+		b.jump(join)
+	}
+	b.seal(join)
+	b.cur = join
+}
+
+func (b *irBuilder) stmtFor(s *StmtFor) {
+	if s.rng != nil {
+		b.fail()
+		return
+	}
+	var cond Stmt
+	var post Stmt
+	if s.cls != nil {
+		b.stmt(s.cls.init)
+		cond = s.cls.cond
+		post = s.cls.post
+	}
+	header := b.fn.newBlock()
+	body := b.fn.newBlock()
+	next := b.fn.newBlock()
+	exit := b.fn.newBlock()
+	b.jump(header)
+	b.cur = header
+	if cond == nil {
+		b.jump(body)
+	} else {
+		b.cond(stmtToExpr(cond), body, exit)
+	}
+	b.seal(body)
+
+	loop := &irLoop{
+		stmtFor:    s,
+		breakTo:    exit,
+		continueTo: next,
+	}
+	b.loops = append(b.loops, loop)
+	b.cur = body
+	b.stmt(s.block)
+	b.jump(next)
+	b.loops = b.loops[0 : len(b.loops)-1]
+
+	b.seal(next)
+	b.cur = next
+	b.stmt(post)
+	b.jump(header)
+	b.seal(header)
+	b.seal(exit)
+	b.cur = exit
+}
+
+// the condition of a for statement is an expression
+func stmtToExpr(s Stmt) Expr {
+	switch s.(type) {
+	case *StmtExpr:
+		return s.(*StmtExpr).expr
+	case *ExprBinop:
+		return s.(*ExprBinop)
+	case *ExprUop:
+		return s.(*ExprUop)
+	case *Relation:
+		return s.(*Relation)
+	case *ExprFuncallOrConversion:
+		return s.(*ExprFuncallOrConversion)
+	case *ExprMethodcall:
+		return s.(*ExprMethodcall)
+	case *ExprStructField:
+		return s.(*ExprStructField)
+	}
+	return &ExprBad{
+		tok: s.token(),
+	}
+}
+
+// cases are tested in order like an if-else chain
+func (b *irBuilder) stmtSwitch(s *StmtSwitch) {
+	if s.isTypeSwitch {
+		b.fail()
+		return
+	}
+	var subject *IrValue
+	if s.cond != nil {
+		if !irIsScalar(s.cond.getGtype()) {
+			b.fail()
+			return
+		}
+		subject = b.expr(s.cond)
+		if subject == nil {
+			return
+		}
+	}
+	end := b.fn.newBlock()
+	var bodies []*IrBlock
+	for i := 0; i < len(s.cases); i++ {
+		bodies = append(bodies, b.fn.newBlock())
+	}
+	for i, cse := range s.cases {
+		for _, e := range cse.exprs {
+			next := b.fn.newBlock()
+			if subject == nil {
+				b.cond(e, bodies[i], next)
+			} else {
+				v := b.expr(e)
+				if v == nil {
+					return
+				}
+				b.branch(b.value(IR_EQ, []*IrValue{subject, v}), bodies[i], next)
+			}
+			b.seal(next)
+			b.cur = next
+		}
+	}
+	var dflt *IrBlock
+	if s.dflt == nil {
+		b.jump(end)
+	} else {
+		dflt = b.fn.newBlock()
+		b.jump(dflt)
+		b.seal(dflt)
+	}
+	for i, cse := range s.cases {
+		b.seal(bodies[i])
+		b.cur = bodies[i]
+		b.stmt(cse.compound)
+		b.jump(end)
+	}
+	if dflt != nil {
+		b.cur = dflt
+		b.stmt(s.dflt)
+		b.jump(end)
+	}
+	b.seal(end)
+	b.cur = end
+}
+
+// branch to then or els by a condition, short-circuiting && and ||
+func (b *irBuilder) cond(e Expr, then *IrBlock, els *IrBlock) {
+	if b.failed {
+		return
+	}
+	switch e.(type) {
+	case *ExprBinop:
+		binop := e.(*ExprBinop)
+		if binop.op == "&&" || binop.op == "||" {
+			mid := b.fn.newBlock()
+			if binop.op == "&&" {
+				b.cond(binop.left, mid, els)
+			} else {
+				b.cond(binop.left, then, mid)
+			}
+			b.seal(mid)
+			b.cur = mid
+			b.cond(binop.right, then, els)
+			return
+		}
+	case *ExprUop:
+		uop := e.(*ExprUop)
+		if uop.op == "!" {
+			b.cond(uop.operand, els, then)
+			return
+		}
+	}
+	v := b.expr(e)
+	if v == nil {
+		return
+	}
+	b.branch(v, then, els)
+}
+
+// returns nil if it fails
+func (b *irBuilder) expr(e Expr) *IrValue {
+	if b.failed {
+		return nil
+	}
+	switch e.(type) {
+	case *Relation:
+		rel := e.(*Relation)
+		if rel.expr == nil {
+			b.fail()
+			return nil
+		}
+		return b.expr(rel.expr)
+	case *ExprVariable:
+		variable := e.(*ExprVariable)
+		if variable.isGlobal {
+			if !irIsScalar(variable.getGtype()) {
+				b.fail()
+				return nil
+			}
+			v := b.fn.newValue(b.cur, IR_LOAD_GLOBAL)
+			v.sym = string(variable.varname)
+			return v
+		}
+		if !isIrLocal(variable) {
+			b.fail()
+			return nil
+		}
+		return b.readVariable(b.cur, variable)
+	case *ExprNumberLiteral:
+		return b.constant(e.(*ExprNumberLiteral).val)
+	case *ExprNilLiteral:
+		return b.constant(0)
+	case *ExprConstVariable:
+		cnst := e.(*ExprConstVariable)
+		if rel, ok := cnst.val.(*Relation); ok {
+			val, ok := rel.expr.(*ExprConstVariable)
+			if ok && val == eIota {
+				return b.constant(cnst.iotaIndex)
+			}
+		}
+		return b.expr(cnst.val)
+	case *ExprBinop:
+		return b.binop(e.(*ExprBinop))
+	case *ExprUop:
+		uop := e.(*ExprUop)
+		switch uop.op {
+		case "!", "-":
+			operand := b.expr(uop.operand)
+			if operand == nil {
+				return nil
+			}
+			if uop.op == "!" {
+				return b.value(IR_NOT, []*IrValue{operand})
+			}
+			return b.value(IR_NEG, []*IrValue{operand})
+		case "*":
+			return b.load(uop)
+		}
+	case *ExprStructField:
+		return b.load(e)
+	case *ExprFuncallOrConversion:
+		funcall := e.(*ExprFuncallOrConversion)
+		if funcall.rel.expr == nil && funcall.rel.gtype != nil {
+			if len(funcall.args) != 1 {
+				b.fail()
+				return nil
+			}
+			return b.conversion(funcall.rel.gtype, funcall.args[0])
+		}
+		return b.funcall(funcall, true)
+	case *ExprConversion:
+		conversion := e.(*ExprConversion)
+		return b.conversion(conversion.gtype, conversion.expr)
+	case *ExprMethodcall:
+		return b.methodcall(e.(*ExprMethodcall), true)
+	}
+	b.fail()
+	return nil
+}
+
+func (b *irBuilder) load(e Expr) *IrValue {
+	base, offset := b.memoryOperand(e)
+	if base == nil {
+		return nil
+	}
+	v := b.value(IR_LOAD, []*IrValue{base})
+	v.aux = offset
+	return v
+}
+
+func (b *irBuilder) conversion(to *Gtype, from Expr) *IrValue {
+	if !irIsScalar(to) {
+		b.fail()
+		return nil
+	}
+	v := b.expr(from)
+	if v == nil {
+		return nil
+	}
+	return b.value(IR_COPY, []*IrValue{v})
+}
+
+func (b *irBuilder) binop(binop *ExprBinop) *IrValue {
+	var op IrOp
+	switch binop.op {
+	case "&&", "||":
+		// 1 or 0 merged by a phi
+		then := b.fn.newBlock()
+		els := b.fn.newBlock()
+		join := b.fn.newBlock()
+		b.cond(binop, then, els)
+		if b.failed {
+			return nil
+		}
+		b.seal(then)
+		b.seal(els)
+		b.cur = then
+		one := b.constant(1)
+		b.jump(join)
+		b.cur = els
+		zero := b.constant(0)
+		b.jump(join)
+		b.seal(join)
+		b.cur = join
+		phi := b.fn.newPhi(join, nil)
+		phi.args = []*IrValue{one, zero}
+		return phi
+	case "+":
+		op = IR_ADD
+	case "-":
+		op = IR_SUB
+	case "*":
+		op = IR_MUL
+	case "/":
+		op = IR_DIV
+	case "%":
+		op = IR_MOD
+	case "==":
+		op = IR_EQ
+	case "!=":
+		op = IR_NE
+	case "<":
+		op = IR_LT
+	case "<=":
+		op = IR_LE
+	case ">":
+		op = IR_GT
+	case ">=":
+		op = IR_GE
+	default:
+		b.fail()
+		return nil
+	}
+	left := b.expr(binop.left)
+	if left == nil {
+		return nil
+	}
+	right := b.expr(binop.right)
+	if right == nil {
+		return nil
+	}
+	return b.value(op, []*IrValue{left, right})
+}
+
+func (b *irBuilder) funcall(funcall *ExprFuncallOrConversion, hasResult bool) *IrValue {
+	if funcall.inlined != nil {
+		return b.inlined(funcall.inlined)
+	}
+	decl := funcall.getFuncDef()
+	return b.call(getFuncSymbol(decl.pkg, funcall.fname), decl, funcall.args, hasResult)
+}
+
+func (b *irBuilder) methodcall(methodCall *ExprMethodcall, hasResult bool) *IrValue {
+	if methodCall.inlined != nil {
+		return b.inlined(methodCall.inlined)
+	}
+	origType := methodCall.getOrigType()
+	if origType.kind == G_INTERFACE {
+		b.fail()
+		return nil
+	}
+	funcref, ok := origType.methods[methodCall.fname]
+	if !ok {
+		b.fail()
+		return nil
+	}
+	decl := funcref.funcdef
+	if decl.receiver == nil || decl.receiver.getGtype().getKind() != methodCall.receiver.getGtype().getKind() {
+		// the receiver needs to be addressed or dereferenced
+		b.fail()
+		return nil
+	}
+	args := []Expr{methodCall.receiver}
+	for _, arg := range methodCall.args {
+		args = append(args, arg)
+	}
+	return b.call(getFuncSymbol(decl.pkg, methodCall.getUniqueName()), decl, args, hasResult)
+}
+
+// the copies of the params are variables like the other locals
+func (b *irBuilder) inlined(call *InlinedCall) *IrValue {
+	for i, param := range call.params {
+		if !isIrLocal(param) {
+			b.fail()
+			return nil
+		}
+		v := b.expr(call.args[i])
+		if v == nil {
+			return nil
+		}
+		writeVariable(b.cur, param, v)
+	}
+	return b.expr(call.body)
+}
+
+// only calls of functions written in Go which take and return scalar values
+func (b *irBuilder) call(symbol string, decl *DeclFunc, args []Expr, hasResult bool) *IrValue {
+	if decl.body == nil || decl.pkg == "libc" || !irAreScalars(decl.rettypes) {
+		b.fail()
+		return nil
+	}
+	if hasResult && len(decl.rettypes) == 0 {
+		b.fail()
+		return nil
+	}
+	var params []*ExprVariable = escapeParams(decl)
+	if len(params) != len(args) || len(args) > len(RegsForArguments) {
+		b.fail()
+		return nil
+	}
+	for _, param := range params {
+		if !irIsScalar(param.getGtype()) || param.isVariadic {
+			b.fail()
+			return nil
+		}
+	}
+	var values []*IrValue
+	for _, arg := range args {
+		v := b.expr(arg)
+		if v == nil {
+			return nil
+		}
+		values = append(values, v)
+	}
+	v := b.value(IR_CALL, values)
+	v.sym = symbol
+	v.aux = len(decl.rettypes)
+	return v
+}
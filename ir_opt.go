@@ -0,0 +1,460 @@
+// Optimization passes on the IR
+package main
+
+// values which can be removed when nobody uses them
+func isPure(op IrOp) bool {
+	switch op {
+	case IR_STORE, IR_STORE_GLOBAL, IR_CALL:
+		return false
+	case IR_DIV, IR_MOD, IR_LOAD:
+		// may fault
+		return false
+	}
+	return true
+}
+
+// values which are the same when their operands are the same
+func isCommonable(op IrOp) bool {
+	switch op {
+	case IR_CONST, IR_ADD, IR_SUB, IR_MUL, IR_DIV, IR_MOD,
+		IR_EQ, IR_NE, IR_LT, IR_LE, IR_GT, IR_GE, IR_NOT, IR_NEG:
+		return true
+	}
+	return false
+}
+
+func isCommutative(op IrOp) bool {
+	switch op {
+	case IR_ADD, IR_MUL, IR_EQ, IR_NE:
+		return true
+	}
+	return false
+}
+
+func bool2int(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// propagateConstants folds values whose operands are constants,
+// and branches on constants into jumps
+func (f *IrFunc) propagateConstants() {
+	for {
+		changed := false
+		for _, blk := range f.blocks {
+			for _, v := range blk.values {
+				if v.op == IR_CONST {
+					continue
+				}
+				n, ok := v.fold()
+				if ok {
+					v.op = IR_CONST
+					v.aux = n
+					v.args = nil
+					v.variable = nil
+					changed = true
+				}
+			}
+			if blk.kind == IR_BLOCK_IF && blk.control.op == IR_CONST {
+				taken := blk.succs[0]
+				untaken := blk.succs[1]
+				if blk.control.aux == 0 {
+					taken = blk.succs[1]
+					untaken = blk.succs[0]
+				}
+				removeEdge(blk, untaken)
+				blk.kind = IR_BLOCK_PLAIN
+				blk.control = nil
+				blk.succs = []*IrBlock{taken}
+				changed = true
+			}
+		}
+		if f.removeUnreachable() {
+			changed = true
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+// the constant value of v if its operands are constants
+func (v *IrValue) fold() (int, bool) {
+	if v.op == IR_PHI {
+		var c *IrValue
+		for _, arg := range v.args {
+			if arg == v {
+				continue
+			}
+			if arg.op != IR_CONST || (c != nil && c.aux != arg.aux) {
+				return 0, false
+			}
+			c = arg
+		}
+		if c == nil {
+			return 0, false
+		}
+		return c.aux, true
+	}
+	if v.op == IR_COPY || v.op == IR_NOT || v.op == IR_NEG {
+		x := v.args[0]
+		if x.op != IR_CONST {
+			return 0, false
+		}
+		switch v.op {
+		case IR_COPY:
+			return x.aux, true
+		case IR_NOT:
+			return bool2int(x.aux == 0), true
+		case IR_NEG:
+			return -x.aux, true
+		}
+	}
+	if len(v.args) != 2 || v.op == IR_STORE {
+		return 0, false
+	}
+	x := v.args[0]
+	y := v.args[1]
+	if x.op != IR_CONST || y.op != IR_CONST {
+		return 0, false
+	}
+	a := x.aux
+	b := y.aux
+	switch v.op {
+	case IR_ADD:
+		return a + b, true
+	case IR_SUB:
+		return a - b, true
+	case IR_MUL:
+		return a * b, true
+	case IR_DIV, IR_MOD:
+		// the division is unsigned at runtime
+		if a < 0 || b <= 0 {
+			return 0, false
+		}
+		if v.op == IR_DIV {
+			return a / b, true
+		}
+		return a % b, true
+	case IR_EQ:
+		return bool2int(a == b), true
+	case IR_NE:
+		return bool2int(a != b), true
+	case IR_LT:
+		return bool2int(a < b), true
+	case IR_LE:
+		return bool2int(a <= b), true
+	case IR_GT:
+		return bool2int(a > b), true
+	case IR_GE:
+		return bool2int(a >= b), true
+	}
+	return 0, false
+}
+
+// remove the edge and the operands of phis which come through it
+func removeEdge(from *IrBlock, to *IrBlock) {
+	var index int = -1
+	for i, pred := range to.preds {
+		if pred == from {
+			index = i
+			break
+		}
+	}
+	assert(index >= 0, nil, "the edge should exist")
+
+	var preds []*IrBlock
+	for i, pred := range to.preds {
+		if i != index {
+			preds = append(preds, pred)
+		}
+	}
+	to.preds = preds
+	for _, v := range to.values {
+		if v.op != IR_PHI {
+			continue
+		}
+		var args []*IrValue
+		for i, arg := range v.args {
+			if i != index {
+				args = append(args, arg)
+			}
+		}
+		v.args = args
+	}
+}
+
+func (f *IrFunc) markReachable(blk *IrBlock) {
+	if blk.visited {
+		return
+	}
+	blk.visited = true
+	for _, succ := range blk.succs {
+		f.markReachable(succ)
+	}
+}
+
+// removeUnreachable reports whether any block is removed
+func (f *IrFunc) removeUnreachable() bool {
+	for _, blk := range f.blocks {
+		blk.visited = false
+	}
+	f.markReachable(f.blocks[0])
+	var blocks []*IrBlock
+	for _, blk := range f.blocks {
+		if blk.visited {
+			blocks = append(blocks, blk)
+			continue
+		}
+		for _, succ := range blk.succs {
+			if succ.visited {
+				removeEdge(blk, succ)
+			}
+		}
+	}
+	if len(blocks) == len(f.blocks) {
+		return false
+	}
+	f.blocks = blocks
+	return true
+}
+
+// rewrite operands to the values which replace them, and remove the replaced values
+func (f *IrFunc) replaceAliases() {
+	for _, blk := range f.blocks {
+		for _, v := range blk.values {
+			for i, arg := range v.args {
+				v.args[i] = arg.resolve()
+			}
+		}
+		if blk.control != nil {
+			blk.control = blk.control.resolve()
+		}
+		for i, v := range blk.results {
+			blk.results[i] = v.resolve()
+		}
+	}
+	for _, blk := range f.blocks {
+		var values []*IrValue
+		for _, v := range blk.values {
+			if v.alias == nil {
+				values = append(values, v)
+			}
+		}
+		blk.values = values
+	}
+}
+
+// propagateCopies replaces copies and phis which merge only one value by the value
+func (f *IrFunc) propagateCopies() {
+	for {
+		changed := false
+		for _, blk := range f.blocks {
+			for _, v := range blk.values {
+				if v.alias != nil {
+					continue
+				}
+				var same *IrValue
+				if v.op == IR_COPY {
+					same = v.args[0].resolve()
+				} else if v.op == IR_PHI {
+					same = v.trivialPhi()
+				}
+				if same != nil {
+					v.alias = same
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	f.replaceAliases()
+}
+
+// the only value a phi merges apart from itself, or nil
+func (v *IrValue) trivialPhi() *IrValue {
+	var same *IrValue
+	for _, arg := range v.args {
+		arg = arg.resolve()
+		if arg == v || arg == same {
+			continue
+		}
+		if same != nil {
+			return nil
+		}
+		same = arg
+	}
+	return same
+}
+
+func (f *IrFunc) postorderFrom(blk *IrBlock, order []*IrBlock) []*IrBlock {
+	blk.visited = true
+	for _, succ := range blk.succs {
+		if !succ.visited {
+			order = f.postorderFrom(succ, order)
+		}
+	}
+	blk.postorder = len(order)
+	order = append(order, blk)
+	return order
+}
+
+// computeDominators builds the dominator tree by
+// "A Simple, Fast Dominance Algorithm" by Cooper, Harvey and Kennedy
+func (f *IrFunc) computeDominators() {
+	for _, blk := range f.blocks {
+		blk.visited = false
+		blk.idom = nil
+		blk.dominated = nil
+	}
+	entry := f.blocks[0]
+	var order []*IrBlock
+	order = f.postorderFrom(entry, order)
+	entry.idom = entry
+	for {
+		changed := false
+		for i := len(order) - 1; i >= 0; i-- {
+			blk := order[i]
+			if blk == entry {
+				continue
+			}
+			var idom *IrBlock
+			for _, pred := range blk.preds {
+				if pred.idom == nil {
+					continue
+				}
+				if idom == nil {
+					idom = pred
+				} else {
+					idom = intersectDominators(pred, idom)
+				}
+			}
+			if blk.idom != idom {
+				blk.idom = idom
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		blk := order[i]
+		if blk != entry {
+			idom := blk.idom
+			idom.dominated = append(idom.dominated, blk)
+		}
+	}
+}
+
+func intersectDominators(a *IrBlock, b *IrBlock) *IrBlock {
+	for a != b {
+		for a.postorder < b.postorder {
+			a = a.idom
+		}
+		for b.postorder < a.postorder {
+			b = b.idom
+		}
+	}
+	return a
+}
+
+func (v *IrValue) isSameAs(w *IrValue) bool {
+	if v.op != w.op || v.aux != w.aux || v.sym != w.sym || len(v.args) != len(w.args) {
+		return false
+	}
+	same := true
+	for i, arg := range v.args {
+		if arg != w.args[i] {
+			same = false
+		}
+	}
+	if same {
+		return true
+	}
+	return isCommutative(v.op) && v.args[0] == w.args[1] && v.args[1] == w.args[0]
+}
+
+// eliminateCommonSubexpressions replaces a value by the same one which dominates it
+func (f *IrFunc) eliminateCommonSubexpressions() {
+	f.computeDominators()
+	var available []*IrValue
+	f.eliminateCommonSubexpressionsIn(f.blocks[0], available)
+	f.replaceAliases()
+}
+
+// available holds the values of the dominators
+func (f *IrFunc) eliminateCommonSubexpressionsIn(blk *IrBlock, available []*IrValue) {
+	for _, v := range blk.values {
+		for i, arg := range v.args {
+			v.args[i] = arg.resolve()
+		}
+		if !isCommonable(v.op) {
+			continue
+		}
+		var same *IrValue
+		for _, w := range available {
+			if v.isSameAs(w) {
+				same = w
+				break
+			}
+		}
+		if same != nil {
+			v.alias = same
+		} else {
+			available = append(available, v)
+		}
+	}
+	for _, child := range blk.dominated {
+		f.eliminateCommonSubexpressionsIn(child, available)
+	}
+}
+
+// eliminateDeadCode removes unreachable blocks and values nobody uses
+func (f *IrFunc) eliminateDeadCode() {
+	f.removeUnreachable()
+	var work []*IrValue
+	for _, blk := range f.blocks {
+		for _, v := range blk.values {
+			v.live = !isPure(v.op)
+			if v.live {
+				work = append(work, v)
+			}
+		}
+	}
+	for _, blk := range f.blocks {
+		if blk.control != nil && !blk.control.live {
+			blk.control.live = true
+			work = append(work, blk.control)
+		}
+		for _, v := range blk.results {
+			if !v.live {
+				v.live = true
+				work = append(work, v)
+			}
+		}
+	}
+	for len(work) > 0 {
+		v := work[len(work)-1]
+		work = work[0 : len(work)-1]
+		for _, arg := range v.args {
+			if !arg.live {
+				arg.live = true
+				work = append(work, arg)
+			}
+		}
+	}
+	for _, blk := range f.blocks {
+		var values []*IrValue
+		for _, v := range blk.values {
+			if v.live {
+				values = append(values, v)
+			}
+		}
+		blk.values = values
+	}
+}
@@ -0,0 +1,575 @@
+// loader finds the packages to build on disk
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// --root or $MINIGOROOT: the directory which has stdlib and internal like this repository.
+// The embedded copies of them are used if it is empty.
+var minigoRoot string
+
+// rootFiles returns the .go files of a directory under the root, or nil if no root is set
+func rootFiles(dir string) []string {
+	if minigoRoot == "" {
+		return nil
+	}
+	path := joinPath(minigoRoot, dir)
+	files := goFilesIn(path)
+	if len(files) == 0 {
+		errorf("%s", noGoFiles(path))
+	}
+	return files
+}
+
+// the import path of a package given as .go files, like the go command
+const commandLineArguments string = "command-line-arguments"
+
+// a module is the tree of packages under a go.mod file
+type module struct {
+	path string // the module path declared in go.mod
+	dir  string // the absolute path of the directory which has go.mod
+}
+
+// a package of source files on disk
+type sourcePackage struct {
+	name    identifier // the name in the package clauses
+	path    string     // the import path
+	files   []string
+	std     bool             // a standard package, which can use the internal scope
+	code    string           // the embedded source of a standard package, which has no files
+	imports []*sourcePackage // the packages imported directly
+	tok     *Token           // the package clause of the first file
+}
+
+type packageLoader struct {
+	cwd      string
+	mod      *module                   // nil if the packages are not in a module
+	roots    []*sourcePackage          // the packages given in the arguments
+	order    []*sourcePackage          // the imported packages of the module, dependencies first
+	stdlibs  []string                  // the names of the imported standard packages, dependencies first
+	stdPkgs  map[identifier]string     // the embedded source code of the standard packages
+	loaded   map[string]*sourcePackage // by import path
+	visiting map[string]bool           // the packages whose imports are being loaded
+	stack    []string                  // the import paths being loaded, for error messages
+}
+
+// loadPackages loads the packages of the arguments and the packages they import.
+// An argument is a .go file, a directory, or a pattern like ./... which matches
+// the directory and its subdirectories.
+// All .go files in the arguments which build constraints do not exclude make one package.
+func loadPackages(args []string) *packageLoader {
+	cwd, err := os.Getwd()
+	if err != nil {
+		errorf("%s", err.Error())
+	}
+	ld := &packageLoader{
+		cwd:      cwd,
+		loaded:   map[string]*sourcePackage{},
+		visiting: map[string]bool{},
+		stdPkgs:  makeStdLib(),
+	}
+
+	if isGoFile(args[0]) {
+		for _, arg := range args {
+			if !isGoFile(arg) {
+				errorf("cannot mix .go files and packages: %s", arg)
+			}
+		}
+		ld.mod = findModule(ld.absPath(parentDir(args[0])))
+		var files []string
+		for _, arg := range args {
+			if shouldBuild(arg) {
+				files = append(files, arg)
+			}
+		}
+		if len(files) == 0 {
+			errorf("build constraints exclude all Go files in %s", parentDir(args[0]))
+		}
+		pkg := &sourcePackage{
+			path:  commandLineArguments,
+			files: files,
+		}
+		ld.loadRoot(pkg)
+		return ld
+	}
+
+	var dirs []string
+	for _, arg := range args {
+		if arg == "..." || strings.HasSuffix(arg, "/...") {
+			top := cleanPath(arg[0 : len(arg)-len("...")])
+			dirs = ld.walkPackageDirs(top, dirs)
+		} else {
+			dirs = append(dirs, cleanPath(arg))
+		}
+	}
+	if len(dirs) == 0 {
+		errorf("no Go files match %s", args[0])
+	}
+	ld.mod = findModule(ld.absPath(dirs[0]))
+	for _, dir := range dirs {
+		path := ld.importPathOf(dir)
+		if pkg, ok := ld.loaded[path]; ok {
+			// imported by another argument, or given twice
+			if !ld.isRoot(pkg) {
+				ld.roots = append(ld.roots, pkg)
+			}
+			continue
+		}
+		files := goFilesIn(dir)
+		if len(files) == 0 {
+			errorf("%s", noGoFiles(dir))
+		}
+		pkg := &sourcePackage{
+			path:  path,
+			files: files,
+		}
+		ld.loadRoot(pkg)
+	}
+	return ld
+}
+
+// minigo - reads the source from stdin
+func isGoFile(arg string) bool {
+	return strings.HasSuffix(arg, ".go") || arg == "/dev/stdin"
+}
+
+func (ld *packageLoader) loadRoot(pkg *sourcePackage) {
+	ld.roots = append(ld.roots, pkg)
+	ld.load(pkg)
+	ld.loaded[pkg.path] = pkg
+	if pkg.name != "main" {
+		ld.order = append(ld.order, pkg)
+	}
+}
+
+func (ld *packageLoader) isRoot(pkg *sourcePackage) bool {
+	for _, root := range ld.roots {
+		if root == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the package clauses and the imports of a package,
+// and loads the packages it imports before it.
+func (ld *packageLoader) load(pkg *sourcePackage) {
+	ld.visiting[pkg.path] = true
+	ld.stack = append(ld.stack, pkg.path)
+	for _, file := range pkg.files {
+		p := &parser{}
+		astFile := p.parseFile(file, nil, true)
+		reportLoadErrors(astFile.errors)
+		clause := astFile.packageClause
+		if pkg.tok == nil {
+			pkg.name = clause.name
+			pkg.tok = clause.tok
+		} else if clause.name != pkg.name {
+			loadError(clause.tok, "found packages %s (%s) and %s (%s)",
+				string(pkg.name), pkg.tok.filename, string(clause.name), file)
+		}
+		pkg.addImports(ld, astFile)
+	}
+	ld.stack = ld.stack[0 : len(ld.stack)-1]
+	ld.visiting[pkg.path] = false
+}
+
+// addImports loads the packages which a file imports
+func (pkg *sourcePackage) addImports(ld *packageLoader, astFile *AstFile) {
+	for _, importDecl := range astFile.importDecls {
+		for _, spec := range importDecl.specs {
+			imported := ld.importPackage(spec)
+			if !pkg.hasImport(imported) {
+				pkg.imports = append(pkg.imports, imported)
+			}
+		}
+	}
+}
+
+func (pkg *sourcePackage) hasImport(imported *sourcePackage) bool {
+	for _, p := range pkg.imports {
+		if p == imported {
+			return true
+		}
+	}
+	return false
+}
+
+func (ld *packageLoader) importPackage(spec *ImportSpec) *sourcePackage {
+	path := spec.path
+	if ld.visiting[path] {
+		var chain string
+		for i := get_index(path, ld.stack); i < len(ld.stack); i++ {
+			chain = chain + ld.stack[i] + " -> "
+		}
+		loadError(spec.tok, "import cycle not allowed: %s", chain+path)
+	}
+	if !ld.inModule(path) {
+		return ld.importStdlib(spec)
+	}
+
+	pkg, ok := ld.loaded[path]
+	if !ok {
+		dir := ld.relPath(ld.mod.dir + path[len(ld.mod.path):len(path)])
+		files := goFilesIn(dir)
+		if len(files) == 0 {
+			loadError(spec.tok, "%s for \"%s\"", noGoFiles(dir), path)
+		}
+		pkg = &sourcePackage{
+			path:  path,
+			files: files,
+		}
+		ld.load(pkg)
+		ld.loaded[path] = pkg
+		ld.order = append(ld.order, pkg)
+	}
+	if pkg.name == "main" {
+		loadError(spec.tok, "import \"%s\" is a program, not an importable package", path)
+	}
+	// the importer refers to the package by the last element of the path
+	if string(pkg.name) != getBaseNameFromImport(path) {
+		loadError(spec.tok, "package %s in %s must be named %s",
+			string(pkg.name), path, getBaseNameFromImport(path))
+	}
+	return pkg
+}
+
+// importStdlib loads the standard packages which a standard package imports before it.
+// A standard package is loaded by its name.
+func (ld *packageLoader) importStdlib(spec *ImportSpec) *sourcePackage {
+	path := spec.path
+	baseName := getBaseNameFromImport(path)
+	if in_array(baseName, ld.stdlibs) {
+		return ld.loaded[baseName]
+	}
+	pkg := &sourcePackage{
+		name: identifier(baseName),
+		path: baseName,
+		std:  true,
+	}
+	if minigoRoot == "" {
+		code, ok := ld.stdPkgs[identifier(baseName)]
+		if !ok {
+			loadError(spec.tok, "package %s is not in the standard library", path)
+		}
+		pkg.code = code
+	} else {
+		dir := joinPath(minigoRoot, "stdlib/"+baseName)
+		pkg.files = goFilesIn(dir)
+		if len(pkg.files) == 0 {
+			loadError(spec.tok, "package %s is not in the standard library (no Go files in %s)", path, dir)
+		}
+	}
+	ld.visiting[path] = true
+	ld.stack = append(ld.stack, path)
+	if pkg.code != "" {
+		p := &parser{}
+		astFile := p.parseString(baseName+".memory", pkg.code, nil, true)
+		reportLoadErrors(astFile.errors)
+		pkg.addImports(ld, astFile)
+	}
+	for _, file := range pkg.files {
+		p := &parser{}
+		astFile := p.parseFile(file, nil, true)
+		reportLoadErrors(astFile.errors)
+		pkg.addImports(ld, astFile)
+	}
+	ld.stack = ld.stack[0 : len(ld.stack)-1]
+	ld.visiting[path] = false
+	ld.stdlibs = append(ld.stdlibs, baseName)
+	ld.loaded[baseName] = pkg
+	return pkg
+}
+
+// stdPackages lists the imported standard packages, dependencies first
+func (ld *packageLoader) stdPackages() []*sourcePackage {
+	var pkgs []*sourcePackage
+	for _, name := range ld.stdlibs {
+		pkgs = append(pkgs, ld.loaded[name])
+	}
+	return pkgs
+}
+
+// dependencyOrder lists roots and the packages they import directly or indirectly,
+// dependencies first
+func (ld *packageLoader) dependencyOrder(roots []*sourcePackage) []*sourcePackage {
+	var needed []string
+	for _, root := range roots {
+		needed = markImports(root, needed)
+	}
+	var all []*sourcePackage = ld.stdPackages()
+	for _, pkg := range ld.order {
+		all = append(all, pkg)
+	}
+	for _, root := range roots {
+		if root.name == "main" {
+			all = append(all, root)
+		}
+	}
+	var r []*sourcePackage
+	for _, pkg := range all {
+		if in_array(pkg.path, needed) {
+			r = append(r, pkg)
+		}
+	}
+	return r
+}
+
+// markImports adds the import paths of a package and the packages it imports
+func markImports(pkg *sourcePackage, marked []string) []string {
+	if in_array(pkg.path, marked) {
+		return marked
+	}
+	marked = append(marked, pkg.path)
+	for _, imported := range pkg.imports {
+		marked = markImports(imported, marked)
+	}
+	return marked
+}
+
+// packagePaths maps the names of the loaded packages to their import paths
+func (ld *packageLoader) packagePaths() map[identifier]string {
+	paths := map[identifier]string{}
+	for path, pkg := range ld.loaded {
+		paths[pkg.name] = path
+	}
+	return paths
+}
+
+// inModule tells if an import path is of a package in the module
+func (ld *packageLoader) inModule(path string) bool {
+	if ld.mod == nil {
+		return false
+	}
+	return path == ld.mod.path || strings.HasPrefix(path, ld.mod.path+"/")
+}
+
+// importPathOf returns the import path of the package in a directory
+func (ld *packageLoader) importPathOf(dir string) string {
+	abs := ld.absPath(dir)
+	if ld.mod == nil {
+		return abs
+	}
+	if abs == ld.mod.dir {
+		return ld.mod.path
+	}
+	if strings.HasPrefix(abs, ld.mod.dir+"/") {
+		return ld.mod.path + abs[len(ld.mod.dir):len(abs)]
+	}
+	errorf("directory %s is outside the module %s", dir, ld.mod.path)
+	return ""
+}
+
+// walkPackageDirs appends dir and its subdirectories which have .go files.
+// Like the go command, it skips testdata, names beginning with . or _,
+// and nested modules.
+func (ld *packageLoader) walkPackageDirs(dir string, dirs []string) []string {
+	names, ok := readDirNames(dir)
+	if !ok {
+		errorf("cannot read directory %s", dir)
+	}
+	var files []string = goFilesIn(dir)
+	if len(files) > 0 {
+		dirs = append(dirs, dir)
+	}
+	for _, name := range names {
+		if name == "testdata" || name[0] == '.' || name[0] == '_' || strings.HasSuffix(name, ".go") {
+			continue
+		}
+		sub := joinPath(dir, name)
+		_, isDir := readDirNames(sub)
+		if isDir && !fileExists(joinPath(sub, "go.mod")) {
+			dirs = ld.walkPackageDirs(sub, dirs)
+		}
+	}
+	return dirs
+}
+
+// findModule looks for go.mod in dir and its parents
+func findModule(dir string) *module {
+	for {
+		gomod := joinPath(dir, "go.mod")
+		if fileExists(gomod) {
+			return &module{
+				path: readModulePath(gomod),
+				dir:  dir,
+			}
+		}
+		if dir == "/" {
+			break
+		}
+		dir = parentDir(dir)
+	}
+	return nil
+}
+
+// readModulePath returns the path in the module directive of a go.mod file
+func readModulePath(gomod string) string {
+	bytes, _ := ioutil.ReadFile(gomod)
+	lines := strings.Split(string(bytes), "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module ") {
+			path := strings.TrimSpace(line[len("module "):len(line)])
+			if len(path) > 1 && path[0] == '"' {
+				path = path[1 : len(path)-1]
+			}
+			return path
+		}
+	}
+	errorf("%s: no module declaration", gomod)
+	return ""
+}
+
+// goFilesIn returns the .go files of a directory in the order of their names,
+// except the files which build constraints exclude
+func goFilesIn(dir string) []string {
+	var files []string
+	names, _ := readDirNames(dir)
+	for _, name := range names {
+		if strings.HasSuffix(name, ".go") && shouldBuild(joinPath(dir, name)) {
+			files = append(files, joinPath(dir, name))
+		}
+	}
+	return files
+}
+
+// noGoFiles tells why goFilesIn found nothing in a directory
+func noGoFiles(dir string) string {
+	names, _ := readDirNames(dir)
+	for _, name := range names {
+		if strings.HasSuffix(name, ".go") {
+			return fmt.Sprintf("build constraints exclude all Go files in %s", dir)
+		}
+	}
+	return fmt.Sprintf("no Go files in %s", dir)
+}
+
+// readDirNames returns the sorted names in a directory, and false if it is not a directory
+func readDirNames(dir string) ([]string, bool) {
+	var names []string
+	f, err := os.Open(dir)
+	if err != nil {
+		return names, false
+	}
+	names, err = f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return names, false
+	}
+	sortStrings(names)
+	return names, true
+}
+
+func fileExists(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+func (ld *packageLoader) absPath(path string) string {
+	if len(path) > 0 && path[0] == '/' {
+		return cleanPath(path)
+	}
+	return cleanPath(ld.cwd + "/" + path)
+}
+
+// relPath makes an absolute path relative to the current directory if it is under it
+func (ld *packageLoader) relPath(path string) string {
+	if strings.HasPrefix(path, ld.cwd+"/") {
+		return path[len(ld.cwd)+1 : len(path)]
+	}
+	return path
+}
+
+func joinPath(dir string, name string) string {
+	if dir == "." {
+		return name
+	}
+	if strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+	return dir + "/" + name
+}
+
+// parentDir returns the directory of a path. The parent of a file name is "."
+func parentDir(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' {
+			if i == 0 {
+				return "/"
+			}
+			return path[0:i]
+		}
+	}
+	return "."
+}
+
+// baseName returns the last element of a path
+func baseName(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' {
+			return path[i+1 : len(path)]
+		}
+	}
+	return path
+}
+
+// cleanPath removes empty and "." elements, and resolves ".." where possible.
+// e.g. "./a//b/../c/" => "a/c"
+func cleanPath(path string) string {
+	isAbs := len(path) > 0 && path[0] == '/'
+	var elems []string
+	parts := strings.Split(path, "/")
+	for _, elem := range parts {
+		if elem == "" || elem == "." {
+			continue
+		}
+		if elem == ".." && len(elems) > 0 && elems[len(elems)-1] != ".." {
+			elems = elems[0 : len(elems)-1]
+			continue
+		}
+		if elem == ".." && isAbs {
+			continue
+		}
+		elems = append(elems, elem)
+	}
+	var r string
+	for i, elem := range elems {
+		if i > 0 {
+			r = r + "/"
+		}
+		r = r + elem
+	}
+	if isAbs {
+		return "/" + r
+	}
+	if r == "" {
+		return "."
+	}
+	return r
+}
+
+// loadError reports an error in finding packages, which stops the compilation
+func loadError(tok *Token, format string, v ...interface{}) {
+	var errors []string = []string{errorAt(tok, fmt.Sprintf(format, v...))}
+	reportLoadErrors(errors)
+}
+
+func reportLoadErrors(errors []string) {
+	for _, s := range errors {
+		line := s + "\n"
+		var b []byte = []byte(line)
+		os.Stderr.Write(b)
+	}
+	if len(errors) > 0 {
+		errorf("%d errors in loading packages", len(errors))
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"strings"
 )
 
@@ -16,6 +18,22 @@ var tokenizeOnly = false
 var parseOnly = false
 var resolveOnly = false
 
+// the subcommand and its flags
+var command string       // "build" or "run", or empty to write the assembly to stdout
+var outputName string    // -o
+var asmOnly bool         // -S writes the assembly instead of an executable
+var programArgs []string // the arguments for the program of "run"
+
+func printUsage() {
+	println("usage: minigo build [-o output] [-S] [flags] [files.go | packages]")
+	println("       minigo run [flags] [files.go | package] [arguments]")
+	println("       minigo -S [flags] [files.go | package]")
+	println("A package is a directory, and dir/... matches the packages under dir.")
+	println("build and run keep the compiled packages in $MINIGOCACHE or ~/.cache/minigo,")
+	println("and -v prints the packages which are compiled.")
+	println("--root dir or $MINIGOROOT reads stdlib and internal in dir instead of the embedded ones.")
+}
+
 func printVersion() {
 	println("minigo 0.1.0")
 	println("Copyright (C) 2019 @DQNEO")
@@ -24,11 +42,42 @@ func printVersion() {
 func parseOpts(args []string) []string {
 	var r []string
 
-	for _, opt := range args {
+	if len(args) > 0 && (args[0] == "build" || args[0] == "run") {
+		command = args[0]
+		args = args[1:len(args)]
+	}
+
+	for i := 0; i < len(args); i++ {
+		opt := args[i]
+		if command == "run" && len(r) > 0 {
+			// the program is .go files or a package
+			morefiles := isGoFile(r[0]) && strings.HasSuffix(opt, ".go")
+			if !morefiles {
+				// the rest is passed to the program
+				programArgs = args[i:len(args)]
+				break
+			}
+		}
 		if opt == "--version" {
 			printVersion()
 			return nil
 		}
+		if opt == "-o" && i+1 < len(args) {
+			i++
+			outputName = args[i]
+			continue
+		}
+		if opt == "--root" && i+1 < len(args) {
+			i++
+			minigoRoot = args[i]
+			continue
+		}
+		if opt == "-S" {
+			asmOnly = true
+		}
+		if opt == "-v" {
+			verboseBuild = true
+		}
 		if opt == "-t" {
 			debugToken = true
 		}
@@ -38,6 +87,30 @@ func parseOpts(args []string) []string {
 		if opt == "-p" {
 			debugParser = true
 		}
+		if opt == "-m" {
+			printEscapes = true
+		}
+		if opt == "--dump-ir" {
+			dumpIR = true
+		}
+		if opt == "-O0" {
+			peepholeEnabled = false
+		}
+		if opt == "-O1" {
+			peepholeEnabled = true
+		}
+		if opt == "-l" {
+			inlineEnabled = false
+		}
+		if n, ok := intOption(opt, "-inline-budget="); ok {
+			inlineBudget = n
+		}
+		if n, ok := intOption(opt, "-inline-growth="); ok {
+			inlineGrowth = n
+		}
+		if opt == "-w" {
+			dwarfEnabled = false
+		}
 		if opt == "-d" {
 			debugMode = true
 		}
@@ -50,51 +123,207 @@ func parseOpts(args []string) []string {
 		if opt == "--resolve-only" {
 			resolveOnly = true
 		}
-		if strings.HasSuffix(opt, ".go") {
-			r = append(r, opt)
-		} else if opt == "-" {
+		if opt == "-" {
 			return []string{"/dev/stdin"}
+		} else if len(opt) > 0 && opt[0] != '-' {
+			// a .go file, a package directory or a pattern
+			r = append(r, opt)
 		}
 	}
 
 	return r
 }
 
+// the value of an option like -name=N
+func intOption(opt string, prefix string) (int, bool) {
+	if len(opt) <= len(prefix) || opt[0:len(prefix)] != prefix {
+		return 0, false
+	}
+	var n int
+	for i := len(prefix); i < len(opt); i++ {
+		c := opt[i]
+		if c < '0' || c > '9' {
+			errorf("invalid value for %s: %s", prefix[0:len(prefix)-1], opt[len(prefix):len(opt)])
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
 func main() {
 	// parsing arguments
-	var sourceFiles []string
+	var args []string
 
 	assert(len(os.Args) > 0, nil, "os.Args should not be empty")
 	if len(os.Args) > 1 {
-		sourceFiles = parseOpts(os.Args[1:len(os.Args)])
+		args = parseOpts(os.Args[1:len(os.Args)])
 	}
 
-	if len(sourceFiles) == 0 {
+	if len(args) == 0 {
 		println("No input files.")
 		return
 	}
+	if minigoRoot == "" {
+		minigoRoot = os.Getenv("MINIGOROOT")
+	}
 
 	if tokenizeOnly {
-		dumpTokenForFiles(sourceFiles)
+		dumpTokenForFiles(args)
 		return
 	}
 
+	if command == "" && !asmOnly && !parseOnly && !resolveOnly {
+		printUsage()
+		os.Exit(2)
+	}
+
+	ld := loadPackages(args)
+	if command == "build" && (len(ld.roots) > 1 || ld.roots[0].name != "main") {
+		// like go build, multiple packages or a non-main package are compiled but not linked
+		if outputName != "" {
+			errorf("-o cannot be used with multiple packages or a non-main package")
+		}
+		if asmOnly {
+			checkPackages(ld)
+		} else {
+			buildPackages(ld, ld.roots)
+		}
+		return
+	}
+	if len(ld.roots) > 1 {
+		errorf("%s matches %d packages, but only one main package can be compiled", args[0], len(ld.roots))
+	}
+	prog := ld.roots[0]
+
+	switch command {
+	case "build":
+		if outputName == "" {
+			outputName = defaultOutputName(prog)
+			if asmOnly {
+				outputName = outputName + ".s"
+			}
+		}
+		if asmOnly {
+			compileToFile(ld, prog, outputName)
+			return
+		}
+		buildExecutable(ld, prog, outputName)
+	case "run":
+		if prog.name != "main" {
+			errorf("package %s is not a main package", prog.path)
+		}
+		os.Exit(runProgram(ld, prog))
+	default:
+		asmOut = os.Stdout
+		compile(ld, prog)
+	}
+}
+
+// compile writes the assembly of the program to asmOut
+func compile(ld *packageLoader, prog *sourcePackage) {
 	// setup the universe scope
 	universe := newUniverse()
+	internal := newInternalScope(universe)
 
-	u := compileUniverse(universe)
-	r := compileRuntime(universe)
-
-	imported := parseImports(sourceFiles)
+	u := compileUniverse(universe, internal)
+	r := compileRuntime(internal)
 
 	allScopes = map[identifier]*Scope{}
-	libs := compileStdLibs(universe, imported)
+	libs := compileStdLibs(internal, ld.stdPackages())
+	compileModulePackages(universe, libs, ld.order)
 
-	m := compileMainPackage(universe, sourceFiles)
+	m := compileMainPackage(universe, prog.files)
 	if m == nil {
 		return
 	}
 
 	ir := makeIR(u, r, libs, m)
+	analyzeEscapes(ir, m)
+	inlineCalls(ir, m)
+	eliminateDeadCode(ir, m)
+	lowerFuncs(ir, m)
 	ir.emit()
 }
+
+// checkPackages compiles the packages of the arguments without writing anything
+func checkPackages(ld *packageLoader) {
+	universe := newUniverse()
+	internal := newInternalScope(universe)
+	compileUniverse(universe, internal)
+	compileRuntime(internal)
+
+	allScopes = map[identifier]*Scope{}
+	libs := compileStdLibs(internal, ld.stdPackages())
+	compileModulePackages(universe, libs, ld.order)
+	for _, pkg := range ld.roots {
+		if pkg.name == "main" {
+			compileMainPackage(universe, pkg.files)
+		}
+	}
+}
+
+// the name of the executable is the first source file without .go,
+// or the last element of the import path, like go build
+func defaultOutputName(prog *sourcePackage) string {
+	if prog.path == commandLineArguments {
+		name := getBaseNameFromImport(prog.files[0])
+		return name[0 : len(name)-len(".go")]
+	}
+	return getBaseNameFromImport(prog.path)
+}
+
+func compileToFile(ld *packageLoader, prog *sourcePackage, asmFile string) {
+	f, err := os.Create(asmFile)
+	if err != nil {
+		errorf("%s", err.Error())
+	}
+	asmOut = f
+	compile(ld, prog)
+	f.Close()
+}
+
+// runTool runs an external command with the standard files of minigo,
+// and returns its exit code
+func runTool(name string, args []string) int {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if cmd.ProcessState == nil {
+		errorf("%s", err.Error())
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+// buildExecutable compiles the packages of the program into the build cache,
+// and links their objects
+func buildExecutable(ld *packageLoader, prog *sourcePackage, output string) {
+	c := buildPackages(ld, []*sourcePackage{prog})
+	var args []string = []string{"-o", output}
+	for _, objFile := range c.objFiles {
+		args = append(args, objFile)
+	}
+	if runTool("gcc", args) != 0 {
+		os.Exit(1)
+	}
+}
+
+// runProgram builds the program in a temporary directory and executes it.
+// It returns the exit code of the program.
+func runProgram(ld *packageLoader, prog *sourcePackage) int {
+	dir, err := ioutil.TempDir("", "minigo")
+	if err != nil {
+		errorf("%s", err.Error())
+	}
+	binFile := dir + "/" + defaultOutputName(prog)
+	buildExecutable(ld, prog, binFile)
+	code := runTool(binFile, programArgs)
+	os.Remove(binFile)
+	os.Remove(dir)
+	if code < 0 {
+		// killed by a signal
+		return 1
+	}
+	return code
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 )
 
 const __func__ string = "__func__"
@@ -22,14 +23,23 @@ type parser struct {
 	tokenStream         *TokenStream
 	packageBlockScope   *Scope
 	currentScope        *Scope
-	importedNames       map[identifier]bool
+	importedNames       map[identifier]bool // imported package names and whether they are used
 	unresolvedRelations []*Relation
 	uninferredGlobals   []*ExprVariable
 	uninferredLocals    []Inferrer // VarDecl, StmtShortVarDecl or RangeClause
 	stringLiterals      []*ExprStringLiteral
+	formatCalls         []*ExprFuncallOrConversion // calls which may be of printf family
+	selectors           []Expr                     // field accesses, method calls and struct literals
 	namedTypes          []*DeclType
 	dynamicTypes        []*Gtype
 	methods             map[identifier]methods
+	exportData          bool // parsing the declarations of an imported package
+
+	// error recovery
+	errors      []string    // syntax errors
+	checkErrors []*posError // other errors, reported only if there are no syntax errors
+	panicking   bool        // true while skipping tokens after a syntax error
+	errorLine   int         // the line of the last syntax error
 }
 
 func (p *parser) clearLocalState() {
@@ -53,9 +63,7 @@ func (p *parser) assertNotNil(x interface{}) {
 
 func (p *parser) peekToken() *Token {
 	if p.tokenStream.isEnd() {
-		return &Token{
-			typ: "EOF",
-		}
+		return p.tokenStream.eof
 	}
 	r := p.tokenStream.tokens[p.tokenStream.index]
 	return r
@@ -68,6 +76,8 @@ func (p *parser) lastToken() *Token {
 // skip one token
 func (p *parser) skip() {
 	if p.tokenStream.isEnd() {
+		// remember it so that unreadToken does not go back
+		p.tokenStream.overrun++
 		return
 	}
 	p.tokenStream.index++
@@ -80,33 +90,140 @@ func (p *parser) readToken() *Token {
 }
 
 func (p *parser) unreadToken() {
+	if p.tokenStream.overrun > 0 {
+		// the token read was EOF
+		p.tokenStream.overrun--
+		return
+	}
 	p.tokenStream.index--
 }
 
+// syntaxError records an error and puts the parser into panic mode.
+// Further errors are suppressed until the parser resynchronizes,
+// so that a single mistake is not reported many times.
+// Like gc, a line has one syntax error at most.
+func (p *parser) syntaxError(tok *Token, format string, v ...interface{}) {
+	if p.panicking || (len(p.errors) > 0 && tok.line == p.errorLine) {
+		return
+	}
+	p.panicking = true
+	p.errorLine = tok.line
+	msg := fmt.Sprintf(format, v...)
+	p.errors = append(p.errors, errorAt(tok, "syntax error: "+msg))
+}
+
+// an error with its position
+type posError struct {
+	tok *Token
+	msg string
+}
+
+// checkError records an error which is not a syntax error, like an unused variable.
+// Errors are kept in source order because they are not found in that order.
+func (p *parser) checkError(tok *Token, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	e := &posError{
+		tok: tok,
+		msg: msg,
+	}
+	p.checkErrors = append(p.checkErrors, e)
+	i := len(p.checkErrors) - 1
+	for ; i > 0; i-- {
+		prev := p.checkErrors[i-1].tok
+		if prev.line < tok.line || (prev.line == tok.line && prev.column <= tok.column) {
+			break
+		}
+		p.checkErrors[i] = p.checkErrors[i-1]
+	}
+	p.checkErrors[i] = e
+}
+
+func errorAt(tok *Token, msg string) string {
+	return fmt.Sprintf("%s:%d:%d: %s", tok.filename, tok.line, tok.column, msg)
+}
+
+func (p *parser) errorExpected(tok *Token, expected string) {
+	p.syntaxError(tok, "unexpected %s, expected %s", tok.describe(), expected)
+}
+
+// The expect functions do not consume the token on mismatch,
+// because it may be a boundary to resynchronize at.
 func (p *parser) expectIdent() identifier {
-	tok := p.readToken()
+	tok := p.peekToken()
 	if !tok.isTypeIdent() {
-		errorft(tok, "Identifier expected, but got %s", tok)
+		p.errorExpected(tok, "name")
+		return "_"
 	}
+	p.skip()
 	return tok.getIdent()
 }
 
 func (p *parser) expectKeyword(name string) *Token {
-	tok := p.readToken()
+	tok := p.peekToken()
 	if !tok.isKeyword(name) {
-		errorft(tok, "Keyword %s expected but got %s", name, tok)
+		p.errorExpected(tok, name)
+		return tok
 	}
+	p.skip()
 	return tok
 }
 
 func (p *parser) expect(punct string) *Token {
-	tok := p.readToken()
+	tok := p.peekToken()
 	if !tok.isPunct(punct) {
-		errorft(tok, "punct '%s' expected but got '%s'", punct, tok)
+		p.errorExpected(tok, punct)
+		return tok
 	}
+	p.skip()
 	return tok
 }
 
+// skip tokens until a statement boundary
+func (p *parser) syncStmt() {
+	var depth int // nesting level of skipped blocks
+	for {
+		tok := p.peekToken()
+		if tok.isEOF() {
+			break
+		}
+		if tok.isPunct("}") {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		if tok.isPunct("{") {
+			depth++
+		}
+		p.skip()
+		if tok.isSemicolon() && depth == 0 {
+			break
+		}
+	}
+	p.panicking = false
+}
+
+func isDeclKeyword(tok *Token) bool {
+	return tok.isKeyword("func") || tok.isKeyword("var") || tok.isKeyword("const") || tok.isKeyword("type") || tok.isKeyword("import")
+}
+
+// skip tokens until the beginning of a top level declaration
+func (p *parser) syncDecl() {
+	for {
+		tok := p.peekToken()
+		if tok.isEOF() {
+			break
+		}
+		if isDeclKeyword(tok) && p.lastToken().isSemicolon() {
+			break
+		}
+		p.skip()
+	}
+	p.panicking = false
+	p.clearLocalState()
+	p.currentScope = p.packageBlockScope
+}
+
 func getCallerName(n int) string {
 	pc, _, _, ok := runtime.Caller(n)
 	if !ok {
@@ -149,6 +266,9 @@ func (p *parser) readFuncallArgs() []Expr {
 	defer p.traceOut(__func__)
 	var r []Expr
 	for {
+		if p.panicking {
+			return r
+		}
 		tok := p.peekToken()
 		if tok.isPunct(")") {
 			p.skip()
@@ -174,7 +294,8 @@ func (p *parser) readFuncallArgs() []Expr {
 			p.skip()
 			continue
 		} else {
-			errorft(tok, "invalid token in funcall arguments")
+			p.errorExpected(tok, "comma or )")
+			return r
 		}
 	}
 }
@@ -196,6 +317,7 @@ func (p *parser) parseIdentExpr(firstIdentToken *Token) Expr {
 	// read QualifiedIdent
 	var pkg identifier // ignored for now
 	if _, ok := p.importedNames[firstIdent]; ok {
+		p.importedNames[firstIdent] = true // used
 		pkg = firstIdent
 		p.expect(".")
 		// shift firstident
@@ -205,7 +327,10 @@ func (p *parser) parseIdentExpr(firstIdentToken *Token) Expr {
 	rel := &Relation{
 		tok:  firstIdentToken,
 		name: firstIdent,
-		pkg:  p.packageName, // @TODO is this right?
+		pkg:  p.packageName,
+	}
+	if pkg != "" {
+		rel.pkg = pkg
 	}
 	if rel.name == "__func__" {
 		sliteral := &ExprStringLiteral{
@@ -230,12 +355,16 @@ func (p *parser) parseIdentExpr(firstIdentToken *Token) Expr {
 		p.skip()
 		args := p.readFuncallArgs()
 		fname := string(rel.name)
-		e = &ExprFuncallOrConversion{
+		call := &ExprFuncallOrConversion{
 			tok:   next,
 			rel:   rel,
 			fname: fname,
 			args:  args,
 		}
+		if fname == "printf" || fname == "Printf" || fname == "Sprintf" {
+			p.formatCalls = append(p.formatCalls, call)
+		}
+		e = call
 	} else if next.isPunct("[") {
 		// index access
 		e = p.parseIndexOrSliceExpr(rel)
@@ -326,15 +455,15 @@ func (p *parser) parseIndexOrSliceExpr(e Expr) Expr {
 					}
 					p.expect("]")
 				} else {
-					errorft(tok, "invalid token in index access")
+					p.errorExpected(tok, ": or ]")
 				}
 			}
 		} else {
-			errorft(tok, "invalid token in index access")
+			p.errorExpected(tok, ": or ]")
 		}
 	}
 	if r == nil {
-		errorft(tok, "should not be nil")
+		return &ExprBad{tok: tok}
 	}
 	return r
 }
@@ -390,6 +519,7 @@ func (p *parser) succeedingExpr(e Expr) Expr {
 				fname:    tok.getIdent(),
 				args:     args,
 			}
+			p.selectors = append(p.selectors, r)
 			return p.succeedingExpr(r)
 		} else {
 			// (expr).field
@@ -403,6 +533,7 @@ func (p *parser) succeedingExpr(e Expr) Expr {
 				strct:     e,
 				fieldname: tok.getIdent(),
 			}
+			p.selectors = append(p.selectors, r)
 			return p.succeedingExpr(r)
 		}
 	} else if next.isPunct("[") {
@@ -434,6 +565,22 @@ func (p *parser) parseMakeExpr() Expr {
 	}
 }
 
+func (p *parser) parseNewExpr() Expr {
+	p.traceIn(__func__)
+	defer p.traceOut(__func__)
+	tok := p.readToken()
+	p.assert(tok.isIdent("new"), "read new")
+
+	p.expect("(")
+	gtype := p.parseType()
+	p.expect(")")
+	return &ExprNew{
+		tok:          tok,
+		gtype:        gtype,
+		invisiblevar: p.newInvisibleVariable(gtype),
+	}
+}
+
 func (p *parser) parseMapType() *Gtype {
 	p.traceIn(__func__)
 	defer p.traceOut(__func__)
@@ -492,11 +639,9 @@ func (p *parser) parsePrim() Expr {
 		}
 	case tok.isTypeChar(): // char literal
 		p.skip()
-		sval := tok.sval
-		c := sval[0]
 		return &ExprNumberLiteral{
 			tok: tok,
-			val: int(c),
+			val: tok.getIntval(),
 		}
 	case tok.isKeyword("map"): // map literal
 		ptok := tok
@@ -508,7 +653,14 @@ func (p *parser) parsePrim() Expr {
 				p.skip()
 				break
 			}
+			if p.panicking || p.peekToken().isEOF() {
+				break
+			}
 			key := p.parseExpr()
+			if key == nil {
+				p.errorExpected(p.lastToken(), "map key")
+				break
+			}
 			p.expect(":")
 			value := p.parseExpr()
 			p.expect(",")
@@ -556,24 +708,27 @@ func (p *parser) parsePrim() Expr {
 				tok:    tok,
 				gtype:  gtype,
 				values: values,
-				invisiblevar: p.newVariable("", &Gtype{
+				invisiblevar: p.newInvisibleVariable(&Gtype{
 					kind:        G_ARRAY,
 					elementType: gtype.elementType,
 					length:      len(values),
 				}),
 			}
 		default:
-			errorft(tok, "internal error")
+			p.errorExpected(tok, "array or slice type")
+			return &ExprBad{tok: tok}
 		}
 	case tok.isIdent("make"):
 		return p.parseMakeExpr()
+	case tok.isIdent("new"):
+		return p.parseNewExpr()
 	case tok.isTypeIdent():
 		p.skip()
 		return p.parseIdentExpr(tok)
 	}
 
-	errorft(tok, "unable to handle")
-	return nil
+	p.errorExpected(tok, "expression")
+	return &ExprBad{tok: tok}
 }
 
 // for now, this is suppose to be either of
@@ -592,15 +747,23 @@ func (p *parser) parseArrayLiteral() []Expr {
 		}
 
 		v := p.parseExpr()
-		p.assertNotNil(v)
+		if v == nil {
+			p.errorExpected(tok, "expression")
+		}
+		if p.panicking {
+			break
+		}
 		values = append(values, v)
-		tok = p.readToken()
+		tok = p.peekToken()
 		if tok.isPunct(",") {
+			p.skip()
 			continue
 		} else if tok.isPunct("}") {
+			p.skip()
 			break
 		} else {
-			errorft(tok, "unpexpected token")
+			p.errorExpected(tok, "comma or }")
+			break
 		}
 	}
 
@@ -616,14 +779,20 @@ func (p *parser) parseStructLiteral(rel *Relation) *ExprStructLiteral {
 		tok:       ptok,
 		strctname: rel,
 	}
+	p.selectors = append(p.selectors, r)
 
 	for {
-		tok := p.readToken()
+		tok := p.peekToken()
 		if tok.isPunct("}") {
+			p.skip()
+			break
+		}
+		if !tok.isTypeIdent() {
+			p.errorExpected(tok, "field name")
 			break
 		}
+		p.skip()
 		p.expect(":")
-		p.assert(tok.isTypeIdent(), "field name is ident")
 		value := p.parseExpr()
 		f := &KeyedElement{
 			tok:   tok,
@@ -636,6 +805,9 @@ func (p *parser) parseStructLiteral(rel *Relation) *ExprStructLiteral {
 			break
 		}
 		p.expect(",")
+		if p.panicking {
+			break
+		}
 	}
 
 	return r
@@ -660,7 +832,7 @@ func (p *parser) parseUnaryExpr() Expr {
 		// when &T{}, allocate stack memory
 		if strctliteral, ok := uop.operand.(*ExprStructLiteral); ok {
 			// newVariable
-			strctliteral.invisiblevar = p.newVariable("", &Gtype{
+			strctliteral.invisiblevar = p.newInvisibleVariable(&Gtype{
 				kind:     G_NAMED,
 				relation: strctliteral.strctname,
 			})
@@ -696,11 +868,9 @@ func priority(op string) int {
 		return 5
 	case "==", "!=", "<", ">", ">=", "<=":
 		return 10
-	case "-", "+":
+	case "-", "+", "|", "^":
 		return 11
-	case "/", "%":
-		return 15
-	case "*":
+	case "*", "/", "%", "<<", ">>", "&", "&^":
 		return 20
 	default:
 		errorf("unkown operator %s", op)
@@ -716,6 +886,7 @@ func (p *parser) parseExpr() Expr {
 
 var binops = []string{
 	"+", "*", "-", "==", "!=", "<", ">", "<=", ">=", "&&", "||", "/", "%",
+	"&", "|", "^", "&^", "<<", ">>",
 }
 
 func (p *parser) parseExprInt(prior int) Expr {
@@ -762,6 +933,10 @@ func (p *parser) parseExprInt(prior int) Expr {
 func (p *parser) newVariable(varname identifier, gtype *Gtype) *ExprVariable {
 	var variable *ExprVariable
 	if p.isGlobal() {
+		// the symbol of a package variable is qualified except in main and the runtime
+		if p.packageName != "" && p.packageName != "main" && p.packageName != "iruntime" {
+			varname = p.packageName + "." + varname
+		}
 		variable = &ExprVariable{
 			tok:      p.lastToken(),
 			varname:  varname,
@@ -780,6 +955,16 @@ func (p *parser) newVariable(varname identifier, gtype *Gtype) *ExprVariable {
 	return variable
 }
 
+// newInvisibleVariable makes the hidden local storage of an expression, e.g. &T{}
+func (p *parser) newInvisibleVariable(gtype *Gtype) *ExprVariable {
+	variable := &ExprVariable{
+		tok:   p.lastToken(),
+		gtype: gtype,
+	}
+	p.localvars = append(p.localvars, variable)
+	return variable
+}
+
 func (p *parser) registerDynamicType(gtype *Gtype) *Gtype {
 	p.dynamicTypes = append(p.dynamicTypes, gtype)
 	return gtype
@@ -795,13 +980,24 @@ func (p *parser) parseType() *Gtype {
 		tok := p.readToken()
 		if tok.isTypeIdent() {
 			ident := tok.getIdent()
+			// https://golang.org/ref/spec#QualifiedIdent
+			var pkg identifier
+			if _, ok := p.importedNames[ident]; ok {
+				p.importedNames[ident] = true // used
+				pkg = ident
+				p.expect(".")
+				ident = p.expectIdent()
+			}
 			// unresolved
 			rel := &Relation{
 				tok:  tok,
 				pkg:  p.packageName,
 				name: ident,
 			}
-			p.tryResolve("", rel)
+			if pkg != "" {
+				rel.pkg = pkg
+			}
+			p.tryResolve(pkg, rel)
 			gtype = &Gtype{
 				kind:     G_NAMED,
 				relation: rel,
@@ -844,9 +1040,13 @@ func (p *parser) parseType() *Gtype {
 				// array
 				p.expect("]")
 				typ := p.parseType()
+				var length int // 0 for "...", which is set later
+				if tok.isTypeInt() {
+					length = tok.getIntval()
+				}
 				gtype = &Gtype{
 					kind:        G_ARRAY,
-					length:      tok.getIntval(),
+					length:      length,
 					elementType: typ,
 				}
 				return p.registerDynamicType(gtype)
@@ -857,7 +1057,13 @@ func (p *parser) parseType() *Gtype {
 			// vaargs
 			TBI(tok, "VAARGS is not supported yet")
 		} else {
-			errorft(tok, "Unkonwn token")
+			if !tok.isEOF() {
+				p.unreadToken()
+			}
+			p.errorExpected(tok, "type")
+			return &Gtype{
+				kind: G_UNKOWNE,
+			}
 		}
 
 	}
@@ -869,6 +1075,7 @@ func (p *parser) parseVarDecl() *DeclVar {
 	ptok := p.expectKeyword("var")
 
 	// read newName
+	nameTok := p.peekToken()
 	newName := p.expectIdent()
 	var typ *Gtype
 	var initval Expr
@@ -908,7 +1115,14 @@ func (p *parser) parseVarDecl() *DeclVar {
 			p.uninferredLocals = append(p.uninferredLocals, r)
 		}
 	}
-	p.currentScope.setVar(newName, variable)
+	variable.tok = nameTok
+	if p.isGlobal() {
+		r.invisibles = p.localvars
+		p.localvars = nil
+		p.currentScope.setVar(newName, variable)
+	} else {
+		p.currentScope.setLocalVar(newName, variable)
+	}
 	return r
 }
 
@@ -962,6 +1176,9 @@ func (p *parser) parseConstDecl() *DeclConst {
 	if p.peekToken().isPunct("(") {
 		p.readToken()
 		for {
+			if p.panicking || p.peekToken().isEOF() {
+				break
+			}
 			// multi definitions
 			cnst := p.parseConstDeclSingle(lastExpr, lastGtype, iotaIndex)
 			if cnst.getGtype() != nil {
@@ -998,7 +1215,8 @@ func (p *parser) parseIdentList() []identifier {
 			r = append(r, tok.getIdent())
 		} else if len(r) == 0 {
 			// at least one ident is needed
-			errorft(tok, "Ident expected")
+			p.errorExpected(tok, "name")
+			return r
 		}
 
 		tok = p.peekToken()
@@ -1016,6 +1234,10 @@ func (p *parser) enterNewScope(name string) {
 }
 
 func (p *parser) exitScope() {
+	unused := p.currentScope.unusedVars()
+	for _, variable := range unused {
+		p.checkError(variable.tok, "declared and not used: %s", variable.varname)
+	}
 	p.currentScope = p.currentScope.outer
 }
 
@@ -1120,23 +1342,27 @@ func (p *parser) parseForRange(exprs []Expr, infer bool) *StmtFor {
 	}
 	indexvar, ok := exprs[0].(*Relation)
 	if !ok {
-		errorft(tokRange, " rng.lefts[0]. is not relation")
+		p.syntaxError(tokRange, "range index should be a name")
 	}
 	var valuevar *Relation
 	if len(exprs) == 2 {
-		valuevar = exprs[1].(*Relation)
+		valuevar, ok = exprs[1].(*Relation)
+		if !ok {
+			p.syntaxError(tokRange, "range value should be a name")
+		}
 	}
 
 	p.requireBlock = true
 	rangeExpr := p.parseExpr()
 	p.requireBlock = false
 	p.expect("{")
+	// this replaces the for statement which parseForStmt has begun
 	var r = &StmtFor{
 		tok:   tokRange,
-		outer: p.currentForStmt,
+		outer: p.currentForStmt.outer,
 		rng: &ForRangeClause{
 			tok:                 tokRange,
-			invisibleMapCounter: p.newVariable("", gInt),
+			invisibleMapCounter: p.newInvisibleVariable(gInt),
 			indexvar:            indexvar,
 			valuevar:            valuevar,
 			rangeexpr:           rangeExpr,
@@ -1169,10 +1395,11 @@ func (p *parser) parseIfStmt() *StmtIf {
 		r.cond = p.parseExpr()
 	} else {
 		es, ok := stmt.(*StmtExpr)
-		if !ok {
-			errorft(stmt.token(), "internal error")
+		if ok {
+			r.cond = es.expr
+		} else {
+			p.syntaxError(ptok, "missing condition in if statement")
 		}
-		r.cond = es.expr
 	}
 	p.expect("{")
 	p.requireBlock = false
@@ -1189,7 +1416,7 @@ func (p *parser) parseIfStmt() *StmtIf {
 			p.skip()
 			r.els = p.parseCompoundStmt()
 		} else {
-			errorft(tok2, "Unexpected token")
+			p.syntaxError(tok2, "else must be followed by if or statement block")
 		}
 	}
 	p.exitScope()
@@ -1246,7 +1473,23 @@ func (p *parser) parseAssignment(lefts []Expr) *StmtAssignment {
 	ptok := p.lastToken()
 
 	rights := p.parseExpressionList(nil)
-	p.assertNotNil(rights[0])
+	if rights[0] == nil {
+		p.errorExpected(ptok, "expression")
+	}
+	// assigning to a variable is not a use of it
+	for _, left := range lefts {
+		rel, ok := left.(*Relation)
+		if !ok {
+			continue
+		}
+		_, isVar := rel.expr.(*ExprVariable)
+		if isVar {
+			body := p.currentScope.get(rel.name)
+			if body != nil && body.expr == rel.expr {
+				body.uses--
+			}
+		}
+	}
 	return &StmtAssignment{
 		tok:    ptok,
 		lefts:  lefts,
@@ -1289,10 +1532,15 @@ func (p *parser) parseAssignmentOperation(left Expr, assignop string) *StmtAssig
 }
 
 func (p *parser) shortVarDecl(e Expr) {
-	rel := e.(*Relation) // a brand new rel
+	rel, ok := e.(*Relation) // a brand new rel
+	if !ok {
+		p.syntaxError(p.lastToken(), "non-name on left side of :=")
+		return
+	}
 	assert(p.isGlobal() == false, e.token(), "should not be in global scope")
 	variable := p.newVariable(rel.name, nil)
-	p.currentScope.setVar(rel.name, variable)
+	variable.tok = rel.tok
+	p.currentScope.setLocalVar(rel.name, variable)
 	rel.expr = variable
 }
 
@@ -1353,7 +1601,7 @@ func (p *parser) parseSwitchStmt() Stmt {
 						p.skip()
 						gtype := p.parseType()
 						gtypes = append(gtypes, gtype)
-					} else if tok.isPunct(":") {
+					} else {
 						break
 					}
 				}
@@ -1366,7 +1614,7 @@ func (p *parser) parseSwitchStmt() Stmt {
 						p.skip()
 						expr := p.parseExpr()
 						exprs = append(exprs, expr)
-					} else if tok.isPunct(":") {
+					} else {
 						break
 					}
 				}
@@ -1392,7 +1640,8 @@ func (p *parser) parseSwitchStmt() Stmt {
 			r.dflt = compound
 			break
 		} else {
-			errorft(tok, "internal error")
+			p.errorExpected(tok, "case or default or }")
+			break
 		}
 	}
 
@@ -1461,7 +1710,11 @@ func (p *parser) parseStmt() Stmt {
 		} else if tok3.isPunct(":=") {
 			return p.parseShortAssignment(lefts)
 		} else {
-			TBI(tok3, "")
+			p.errorExpected(tok3, ":= or = or comma")
+			return &StmtExpr{
+				tok:  tok3,
+				expr: expr1,
+			}
 		}
 	} else if tok2.isPunct("=") {
 		p.skip()
@@ -1490,7 +1743,6 @@ func (p *parser) parseStmt() Stmt {
 			expr: expr1,
 		}
 	}
-	return nil
 }
 
 func (p *parser) parseCompoundStmt() *StmtSatementList {
@@ -1509,11 +1761,19 @@ func (p *parser) parseCompoundStmt() *StmtSatementList {
 		if p.inCase > 0 && (tok.isKeyword("case") || tok.isKeyword("default")) {
 			return r
 		}
+		if tok.isEOF() || tok.isKeyword("func") {
+			// the closing brace is missing
+			p.errorExpected(tok, "}")
+			return r
+		}
 		if tok.isSemicolon() {
 			p.skip()
 			continue
 		}
 		stmt := p.parseStmt()
+		if p.panicking {
+			p.syncStmt()
+		}
 		r.stmts = append(r.stmts, stmt)
 	}
 }
@@ -1522,19 +1782,21 @@ func (p *parser) parseFuncSignature() (identifier, []*ExprVariable, []*Gtype) {
 	p.traceIn(__func__)
 	defer p.traceOut(__func__)
 
-	tok := p.readToken()
-	fname := tok.getIdent()
+	fname := p.expectIdent()
 	p.expect("(")
 
 	var params []*ExprVariable
 
-	tok = p.peekToken()
+	tok := p.peekToken()
 	if tok.isPunct(")") {
 		p.skip()
 	} else {
 		for {
-			tok := p.readToken()
-			pname := tok.getIdent()
+			if p.panicking {
+				break
+			}
+			tok := p.peekToken()
+			pname := p.expectIdent()
 			if p.peekToken().isPunct("...") {
 				p.expect("...")
 				gtype := p.parseType()
@@ -1562,13 +1824,16 @@ func (p *parser) parseFuncSignature() (identifier, []*ExprVariable, []*Gtype) {
 			}
 			params = append(params, variable)
 			p.currentScope.setVar(pname, variable)
-			tok = p.readToken()
+			tok = p.peekToken()
 			if tok.isPunct(")") {
+				p.skip()
 				break
 			}
 			if !tok.isPunct(",") {
-				errorft(tok, "Invalid token")
+				p.errorExpected(tok, "comma or )")
+				break
 			}
+			p.skip()
 		}
 	}
 
@@ -1590,7 +1855,8 @@ func (p *parser) parseFuncSignature() (identifier, []*ExprVariable, []*Gtype) {
 			} else if next.isPunct(",") {
 				p.skip()
 			} else {
-				errorft(next, "invalid token")
+				p.errorExpected(next, "comma or )")
+				break
 			}
 		}
 
@@ -1617,8 +1883,8 @@ func (p *parser) parseFuncDef() *DeclFunc {
 		isMethod = true
 		p.expect("(")
 		// method definition
-		tok := p.readToken()
-		pname := tok.getIdent()
+		tok := p.peekToken()
+		pname := p.expectIdent()
 		ptype := p.parseType()
 		receiver = &ExprVariable{
 			tok:     tok,
@@ -1631,7 +1897,12 @@ func (p *parser) parseFuncDef() *DeclFunc {
 
 	fname, params, rettypes := p.parseFuncSignature()
 
-	ptok2 := p.expect("{")
+	// a function in export data is compiled in the object of its package
+	external := p.exportData && !p.peekToken().isPunct("{")
+	ptok2 := ptok
+	if !external {
+		ptok2 = p.expect("{")
+	}
 
 	r := &DeclFunc{
 		tok:      ptok,
@@ -1640,6 +1911,7 @@ func (p *parser) parseFuncDef() *DeclFunc {
 		fname:    fname,
 		rettypes: rettypes,
 		params:   params,
+		noinline: in_array("go:noinline", ptok.pragmas),
 	}
 
 	ref := &ExprFuncRef{
@@ -1655,7 +1927,15 @@ func (p *parser) parseFuncDef() *DeclFunc {
 			typeToBelong = receiver.gtype
 		}
 
-		p.assert(typeToBelong.kind == G_NAMED, "methods must belong to a named type")
+		if typeToBelong.kind != G_NAMED {
+			p.syntaxError(ptok, "methods must belong to a named type")
+			typeToBelong = &Gtype{
+				kind: G_NAMED,
+				relation: &Relation{
+					name: "_",
+				},
+			}
+		}
 		var mthds methods
 		var ok bool
 		typeName := typeToBelong.relation.name
@@ -1670,15 +1950,27 @@ func (p *parser) parseFuncDef() *DeclFunc {
 		pm[typeName] = mthds
 		p.methods = pm
 
+	} else if fname == "init" {
+		// init functions can not be referred to, and a package can have many of them
+		if len(params) > 0 || len(rettypes) > 0 {
+			p.checkError(ptok, "func init must have no arguments and no return values")
+		}
 	} else {
 		p.packageBlockScope.setFunc(fname, ref)
 	}
+	if external {
+		p.exitScope()
+		return r
+	}
 
 	// every function has a defer_handler
 	r.labelDeferHandler = makeLabel() + "_defer_handler"
 	p.currentFunc = r
 	body := p.parseCompoundStmt()
 	r.body = body
+	if len(rettypes) > 0 && !isTerminatingList(body) {
+		p.checkError(p.lastToken(), "missing return")
+	}
 	r.localvars = p.localvars
 
 	p.localvars = nil
@@ -1691,31 +1983,39 @@ func (p *parser) parseImport() *ImportDecl {
 	defer p.traceOut(__func__)
 	tokImport := p.expectKeyword("import")
 
-	tok := p.readToken()
+	tok := p.peekToken()
 	var specs []*ImportSpec
 	if tok.isPunct("(") {
+		p.skip()
 		for {
-			tok := p.readToken()
+			if p.panicking {
+				break
+			}
+			tok := p.peekToken()
 			if tok.isTypeString() {
+				p.skip()
 				specs = append(specs, &ImportSpec{
 					tok:  tok,
 					path: tok.sval,
 				})
 				p.expect(";")
 			} else if tok.isPunct(")") {
+				p.skip()
 				break
 			} else {
-				errorft(tok, "invalid import path")
+				p.errorExpected(tok, "import path")
 			}
 		}
 	} else {
-		if !tok.isTypeString() {
-			errorft(tok, "import expects package name")
-		}
-		specs = []*ImportSpec{&ImportSpec{
-			tok:  tok,
-			path: tok.sval,
-		},
+		if tok.isTypeString() {
+			p.skip()
+			specs = []*ImportSpec{&ImportSpec{
+				tok:  tok,
+				path: tok.sval,
+			},
+			}
+		} else {
+			p.errorExpected(tok, "import path")
 		}
 	}
 	p.expect(";")
@@ -1744,6 +2044,9 @@ func (p *parser) parseImportDecls() []*ImportDecl {
 	var r []*ImportDecl
 	for p.peekToken().isKeyword("import") {
 		r = append(r, p.parseImport())
+		if p.panicking {
+			p.syncDecl()
+		}
 	}
 	return r
 }
@@ -1763,8 +2066,10 @@ func (p *parser) parseStructDef() *Gtype {
 			p.skip()
 			break
 		}
-		fieldname := tok.getIdent()
-		p.skip()
+		if p.panicking || tok.isEOF() {
+			break
+		}
+		fieldname := p.expectIdent()
 		gtype := p.parseType()
 		fieldtype := gtype
 		//fieldtype.origType = gtype
@@ -1794,6 +2099,9 @@ func (p *parser) parseInterfaceDef(newName identifier) *DeclType {
 		if p.peekToken().isPunct("}") {
 			break
 		}
+		if p.panicking || p.peekToken().isEOF() {
+			break
+		}
 
 		fname, params, rettypes := p.parseFuncSignature()
 		p.expect(";")
@@ -1836,10 +2144,19 @@ func (p *parser) tryResolve(pkg identifier, rel *Relation) {
 		}
 	} else {
 		// foreign package
-		relbody := allScopes[pkg].get(rel.name)
+		scope := allScopes[pkg]
+		relbody := scope.getDeclared(rel.name)
+		if relbody == nil && scope.isUnexported(rel.name) {
+			// the export data of the package does not declare it
+			p.checkError(rel.token(), "name %s not exported by package %s", rel.name, pkg)
+			return
+		}
 		if relbody == nil {
 			errorft(rel.token(), "name %s is not found in %s package", rel.name, pkg)
 		}
+		if !isExported(rel.name) {
+			p.checkError(rel.token(), "name %s not exported by package %s", rel.name, pkg)
+		}
 
 		if relbody.gtype != nil {
 			rel.gtype = relbody.gtype
@@ -1880,7 +2197,8 @@ func (p *parser) parseTopLevelDecl(nextToken *Token) *TopLevelDecl {
 	defer p.traceOut(__func__)
 
 	if !nextToken.isTypeKeyword() {
-		errorft(nextToken, "invalid token")
+		p.syntaxError(nextToken, "non-declaration statement outside function body")
+		return nil
 	}
 
 	switch nextToken.sval {
@@ -1896,9 +2214,13 @@ func (p *parser) parseTopLevelDecl(nextToken *Token) *TopLevelDecl {
 	case "type":
 		typedecl := p.parseTypeDecl()
 		return &TopLevelDecl{typedecl: typedecl}
+	case "import":
+		p.syntaxError(nextToken, "imports must appear before other declarations")
+		p.parseImportDecls()
+		return nil
 	}
 
-	TBI(nextToken, "")
+	p.syntaxError(nextToken, "non-declaration statement outside function body")
 	return nil
 }
 
@@ -1918,7 +2240,12 @@ func (p *parser) parseTopLevelDecls() []*TopLevelDecl {
 			continue
 		}
 		ast := p.parseTopLevelDecl(tok)
-		r = append(r, ast)
+		if p.panicking {
+			p.syncDecl()
+		}
+		if ast != nil {
+			r = append(r, ast)
+		}
 	}
 }
 
@@ -1941,6 +2268,9 @@ func (p *parser) initFile(bs *ByteStream, packageBlockScope *Scope) {
 	p.clearLocalState()
 
 	p.tokenStream = NewTokenStream(bs)
+	for _, e := range p.tokenStream.errors {
+		p.errors = append(p.errors, e)
+	}
 	p.packageBlockScope = packageBlockScope
 	p.currentScope = packageBlockScope
 	p.importedNames = map[identifier]bool{}
@@ -1957,13 +2287,19 @@ func (p *parser) parseByteStream(bs *ByteStream, packageBlockScope *Scope, impor
 	p.initFile(bs, packageBlockScope)
 
 	packageClause := p.parsePackageClause()
+	if p.panicking {
+		p.syncDecl()
+	}
+	if p.exportData {
+		p.readUnexportedNames(packageClause.tok)
+	}
 	importDecls := p.parseImportDecls()
 
 	// regsiter imported names
 	for _, importdecl := range importDecls {
 		for _, spec := range importdecl.specs {
 			pkgName := getBaseNameFromImport(spec.path)
-			p.importedNames[identifier(pkgName)] = true
+			p.importedNames[identifier(pkgName)] = false
 		}
 	}
 
@@ -1972,6 +2308,7 @@ func (p *parser) parseByteStream(bs *ByteStream, packageBlockScope *Scope, impor
 			tok:           packageClause.tok,
 			packageClause: packageClause,
 			importDecls:   importDecls,
+			errors:        p.errors,
 		}
 	}
 
@@ -1979,6 +2316,21 @@ func (p *parser) parseByteStream(bs *ByteStream, packageBlockScope *Scope, impor
 
 	topLevelDecls := p.parseTopLevelDecls()
 
+	for _, importdecl := range importDecls {
+		for _, spec := range importdecl.specs {
+			pkgName := getBaseNameFromImport(spec.path)
+			if !p.importedNames[identifier(pkgName)] {
+				p.checkError(spec.tok, "\"%s\" imported and not used", spec.path)
+			}
+		}
+	}
+	errors := p.errors
+	if len(errors) == 0 {
+		for _, e := range p.checkErrors {
+			errors = append(errors, errorAt(e.tok, e.msg))
+		}
+	}
+
 	var stillUnresolved []*Relation
 
 	for _, rel := range p.unresolvedRelations {
@@ -2001,13 +2353,40 @@ func (p *parser) parseByteStream(bs *ByteStream, packageBlockScope *Scope, impor
 		uninferredGlobals: p.uninferredGlobals,
 		uninferredLocals:  p.uninferredLocals,
 		stringLiterals:    p.stringLiterals,
+		formatCalls:       p.formatCalls,
+		selectors:         p.selectors,
 		dynamicTypes:      p.dynamicTypes,
 		namedTypes:        p.namedTypes,
 		methods:           p.methods,
+		errors:            errors,
 	}
 }
 
 func ParseSources(pkgname identifier, sources []string, onMemory bool) *AstPackage {
+	return parseSources(pkgname, sources, onMemory, false)
+}
+
+// readUnexportedNames records the names in //go:unexported directives before the package clause,
+// which are declared in the package but not in the export data.
+func (p *parser) readUnexportedNames(tokPkg *Token) {
+	for _, pragma := range tokPkg.pragmas {
+		if !strings.HasPrefix(pragma, "go:unexported ") {
+			continue
+		}
+		var names []string = strings.Split(pragma[len("go:unexported "):len(pragma)], " ")
+		for _, name := range names {
+			p.packageBlockScope.unexported = append(p.packageBlockScope.unexported, identifier(name))
+		}
+	}
+}
+
+// ParseExportData parses the export data of a package compiled before
+func ParseExportData(pkgname identifier, file string) *AstPackage {
+	var sources []string = []string{file}
+	return parseSources(pkgname, sources, false, true)
+}
+
+func parseSources(pkgname identifier, sources []string, onMemory bool, exportData bool) *AstPackage {
 	pkgScope := newScope(nil, string(pkgname))
 
 	var astFiles []*AstFile
@@ -2023,6 +2402,7 @@ func ParseSources(pkgname identifier, sources []string, onMemory bool) *AstPacka
 		var astFile *AstFile
 		p := &parser{
 			packageName: pkgname,
+			exportData:  exportData,
 		}
 		if onMemory {
 			var filename string = string(pkgname) + ".memory"
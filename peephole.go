@@ -0,0 +1,1000 @@
+// Peephole optimization of the emitted assembly.
+// With -O1 the lines of each function are buffered, the macros are expanded
+// and local patterns are rewritten before the lines are written out.
+package main
+
+var peepholeEnabled = true // -O0 disables it
+
+type AsmLineKind int
+
+const (
+	ASM_BLANK     AsmLineKind = iota // comments, blank lines and .loc
+	ASM_LABEL                        // label
+	ASM_DIRECTIVE                    // directives for the assembler
+	ASM_INST                         // instruction
+)
+
+// what an instruction does with its operands
+type AsmOpKind int
+
+const (
+	ASM_OP_UNKNOWN AsmOpKind = iota // calls, returns and the others
+	ASM_OP_MOV                      // mov, movq: the destination is written
+	ASM_OP_MOVE                     // lea and the moves which extend or truncate
+	ASM_OP_ARITH                    // the destination is read and written
+	ASM_OP_PUSH
+	ASM_OP_POP
+	ASM_OP_SET // setCC
+	ASM_OP_JMP // jmp
+	ASM_OP_JCC // jCC
+	ASM_OP_DIV // reads and writes %rax and %rdx besides the operand
+)
+
+type asmLine struct {
+	kind  AsmLineKind
+	text  string // as it is written out, with the newline
+	label string
+	dead  bool // removed by the optimizer
+
+	// for an instruction
+	indent  string
+	op      string
+	opKind  AsmOpKind
+	args    []string
+	barrier bool // what the optimizer does not know
+	stack   bool // moves or refers to the stack pointer
+	src0    int  // the families read through the operands other than the destination register
+	src1    int
+	src2    int
+	nsrc    int
+	dstReg  int  // the family of the destination register, or -1
+	dstFull bool // the write to dstReg clears the whole register
+}
+
+type asmMacro struct {
+	name     string
+	params   []string
+	defaults []string
+	body     []string
+	next     *asmMacro // in the same bucket
+}
+
+var asmMacroBuckets []*asmMacro
+var curMacro *asmMacro // the macro being defined
+
+var asmBuffer []*asmLine
+var asmPartial string // the last line not terminated yet
+
+// the registers of the families 0 to 7 without the prefix or the suffix for the width.
+// The families 8 to 15 are %r8 to %r15.
+var asmRegisterCores string = "axbxcxdxsidibpsp"
+
+const REG_RAX int = 0
+const REG_RDX int = 3
+const REG_RBP int = 6
+const REG_RSP int = 7
+
+const asmMacroBucketSize int = 61
+
+func asmMacroBucket(name string) int {
+	return (len(name)*7 + int(name[0]) + int(name[len(name)-1])*3) % asmMacroBucketSize
+}
+
+func newAsmMacro(name string, params string) *asmMacro {
+	m := &asmMacro{
+		name: name,
+	}
+	var names []string = splitOperands(params)
+	for _, param := range names {
+		var def string
+		for i := 0; i < len(param); i++ {
+			if param[i] == '=' {
+				def = param[i+1 : len(param)]
+				param = param[0:i]
+				break
+			}
+		}
+		m.params = append(m.params, param)
+		m.defaults = append(m.defaults, def)
+	}
+	return m
+}
+
+func addAsmMacro(m *asmMacro) {
+	if asmMacroBuckets == nil {
+		var none *asmMacro
+		for i := 0; i < asmMacroBucketSize; i++ {
+			asmMacroBuckets = append(asmMacroBuckets, none)
+		}
+	}
+	bucket := asmMacroBucket(m.name)
+	m.next = asmMacroBuckets[bucket]
+	asmMacroBuckets[bucket] = m
+}
+
+func findAsmMacro(name string) *asmMacro {
+	if asmMacroBuckets == nil || name[0] < 'A' || name[0] > 'Z' {
+		return nil
+	}
+	for m := asmMacroBuckets[asmMacroBucket(name)]; m != nil; m = m.next {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// bufferAsm takes what emit() writes
+func bufferAsm(s string) {
+	var start int
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			if asmPartial == "" {
+				addAsmLine(s[start:i+1], s[start:i])
+			} else {
+				line := asmPartial + s[start:i]
+				addAsmLine(line+"\n", line)
+				asmPartial = ""
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		asmPartial = asmPartial + s[start:len(s)]
+	}
+}
+
+// text is the line with the newline, and line is without it
+func addAsmLine(text string, line string) {
+	l := parseAsmLine(text, line)
+	if curMacro != nil {
+		// the definition is written out as it is
+		curMacro.body = append(curMacro.body, trimSpaces(line))
+		l.kind = ASM_DIRECTIVE
+	}
+	if l.kind == ASM_INST {
+		m := findAsmMacro(l.op)
+		if m != nil {
+			args := splitMacroArgs(line[len(l.indent)+len(l.op) : len(line)])
+			for _, body := range m.body {
+				expanded := l.indent + m.expand(body, args)
+				asmBuffer = append(asmBuffer, parseAsmLine(expanded+"\n", expanded))
+			}
+			return
+		}
+	}
+	if l.kind == ASM_LABEL && l.label[0] != '.' {
+		// a function starts
+		flushAsm()
+	}
+	asmBuffer = append(asmBuffer, l)
+}
+
+// substitute the arguments for \param in a line of the body
+func (m *asmMacro) expand(line string, args []string) string {
+	var s string
+	var start int
+	for i := 0; i < len(line); i++ {
+		if line[i] != '\\' {
+			continue
+		}
+		for j, param := range m.params {
+			end := i + 1 + len(param)
+			if end <= len(line) && line[i+1:end] == param {
+				arg := m.defaults[j]
+				if j < len(args) {
+					arg = args[j]
+				}
+				s = s + line[start:i] + arg
+				start = end
+				break
+			}
+		}
+	}
+	if start == 0 {
+		return line
+	}
+	return s + line[start:len(line)]
+}
+
+func trimSpaces(s string) string {
+	var start int
+	for start < len(s) && (s[start] == ' ' || s[start] == '\t') {
+		start++
+	}
+	end := len(s)
+	for end > start && (s[end-1] == ' ' || s[end-1] == '\t') {
+		end--
+	}
+	return s[start:end]
+}
+
+// split operands by commas outside of parentheses
+func splitOperands(s string) []string {
+	var r []string
+	var depth int
+	var start int
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+		} else if c == ',' && depth == 0 {
+			r = append(r, trimSpaces(s[start:i]))
+			start = i + 1
+		}
+	}
+	last := trimSpaces(s[start:len(s)])
+	if len(last) > 0 || len(r) > 0 {
+		r = append(r, last)
+	}
+	return r
+}
+
+// macro arguments are separated by commas or spaces
+func splitMacroArgs(s string) []string {
+	var r []string
+	var start int = -1
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ',' || s[i] == ' ' || s[i] == '\t' || s[i] == '#' {
+			if start >= 0 {
+				r = append(r, s[start:i])
+				start = -1
+			}
+			if i < len(s) && s[i] == '#' {
+				break
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return r
+}
+
+func parseAsmLine(text string, line string) *asmLine {
+	l := &asmLine{
+		text: text,
+	}
+	var i int
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	if i == len(line) || line[i] == '#' || line[i] == '/' {
+		l.kind = ASM_BLANK
+		return l
+	}
+	// a source position moves with the instructions around it
+	if i+5 <= len(line) && line[i:i+5] == ".loc " {
+		l.kind = ASM_BLANK
+		return l
+	}
+	j := i
+	for j < len(line) && line[j] != ' ' && line[j] != '\t' && line[j] != '#' {
+		j++
+	}
+	word := line[i:j]
+	if word[len(word)-1] == ':' {
+		l.kind = ASM_LABEL
+		l.label = word[0 : len(word)-1]
+		return l
+	}
+	if word[0] == '.' {
+		l.kind = ASM_DIRECTIVE
+		return l
+	}
+	l.kind = ASM_INST
+	l.indent = line[0:i]
+	l.op = word
+	end := j
+	for end < len(line) && line[end] != '#' {
+		end++
+	}
+	l.args = splitOperands(line[j:end])
+	l.analyze()
+	return l
+}
+
+func (l *asmLine) setInst(op string, args []string) {
+	l.op = op
+	l.args = args
+	s := l.indent + op
+	for i, arg := range args {
+		if i == 0 {
+			s = s + " " + arg
+		} else {
+			s = s + ", " + arg
+		}
+	}
+	l.text = s + "\n"
+	l.analyze()
+}
+
+func flushAsm() {
+	optimizeAsm(asmBuffer)
+	for _, l := range asmBuffer {
+		if l.dead {
+			continue
+		}
+		var b []byte = []byte(l.text)
+		asmOut.Write(b)
+	}
+	asmBuffer = nil
+}
+
+// finishAsm writes out what is left in the buffer
+func finishAsm() {
+	if asmPartial != "" {
+		addAsmLine(asmPartial+"\n", asmPartial)
+		asmPartial = ""
+	}
+	flushAsm()
+}
+
+// operands
+
+func coreRegisterFamily(a byte, b byte) int {
+	for i := 0; i < 8; i++ {
+		if asmRegisterCores[2*i] == a && asmRegisterCores[2*i+1] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// the family and the width in bits of a register operand like %eax, or -1
+func parseRegister(operand string) (int, int) {
+	n := len(operand)
+	if n < 3 || operand[0] != '%' {
+		return -1, 0
+	}
+	if operand[1] == 'r' && operand[2] >= '0' && operand[2] <= '9' {
+		num := int(operand[2] - '0')
+		i := 3
+		if i < n && operand[i] >= '0' && operand[i] <= '9' {
+			num = num*10 + int(operand[i]-'0')
+			i++
+		}
+		if num < 8 || num > 15 {
+			return -1, 0
+		}
+		if i == n {
+			return num, 64
+		}
+		if i+1 == n {
+			switch operand[i] {
+			case 'd':
+				return num, 32
+			case 'w':
+				return num, 16
+			case 'b':
+				return num, 8
+			}
+		}
+		return -1, 0
+	}
+	if n == 4 {
+		switch operand[1] {
+		case 'r':
+			return coreRegisterFamily(operand[2], operand[3]), 64
+		case 'e':
+			return coreRegisterFamily(operand[2], operand[3]), 32
+		}
+		if operand[3] == 'l' {
+			// %sil, %dil, %bpl and %spl
+			return coreRegisterFamily(operand[1], operand[2]), 8
+		}
+		return -1, 0
+	}
+	if n == 3 {
+		if operand[2] == 'l' || operand[2] == 'h' {
+			return coreRegisterFamily(operand[1], 'x'), 8
+		}
+		return coreRegisterFamily(operand[1], operand[2]), 16
+	}
+	return -1, 0
+}
+
+func registerFamily(operand string) int {
+	family, _ := parseRegister(operand)
+	return family
+}
+
+func isRegister(operand string) bool {
+	return registerFamily(operand) >= 0
+}
+
+func isRegister64(operand string) bool {
+	family, width := parseRegister(operand)
+	return family >= 0 && width == 64
+}
+
+// an immediate which fits in a sign extended 32 bit field
+func isImm32(operand string) bool {
+	if len(operand) < 2 || operand[0] != '$' {
+		return false
+	}
+	i := 1
+	neg := false
+	if operand[1] == '-' {
+		neg = true
+		i = 2
+	}
+	if i == len(operand) || len(operand)-i > 10 {
+		return false
+	}
+	var n int
+	for j := i; j < len(operand); j++ {
+		c := operand[j]
+		if c < '0' || c > '9' {
+			return false
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		return n <= 2147483648
+	}
+	return n <= 2147483647
+}
+
+// memory which can be read without a fault
+func isSafeMemory(operand string) bool {
+	return hasSuffix(operand, "(%rbp)") || hasSuffix(operand, "(%rip)")
+}
+
+func hasSuffix(s string, suffix string) bool {
+	return len(s) >= len(suffix) && s[len(s)-len(suffix):len(s)] == suffix
+}
+
+// instructions
+
+// the kind and the number of operands of an instruction
+func classifyOp(op string) (AsmOpKind, int) {
+	switch op {
+	case "mov", "movq":
+		return ASM_OP_MOV, 2
+	case "movl", "movb", "movw", "movabs", "movzb", "movzbq", "movzbl", "movzwq", "movsbq", "movslq", "lea":
+		return ASM_OP_MOVE, 2
+	case "add", "addq", "sub", "subq", "imul", "and", "or", "xor", "cmp", "cmpq", "test":
+		return ASM_OP_ARITH, 2
+	case "neg", "not", "inc", "dec":
+		return ASM_OP_ARITH, 1
+	case "push", "pushq":
+		return ASM_OP_PUSH, 1
+	case "pop", "popq":
+		return ASM_OP_POP, 1
+	case "sete", "setne", "setl", "setle", "setg", "setge", "setb", "setbe", "seta", "setae":
+		return ASM_OP_SET, 1
+	case "jmp":
+		return ASM_OP_JMP, 1
+	case "je", "jne", "jl", "jle", "jg", "jge", "jb", "jbe", "ja", "jae", "jz", "jnz":
+		return ASM_OP_JCC, 1
+	case "div", "divq", "idiv":
+		return ASM_OP_DIV, 1
+	case "cqo":
+		return ASM_OP_DIV, 0
+	}
+	return ASM_OP_UNKNOWN, -1
+}
+
+func negateCondition(cc string) string {
+	switch cc {
+	case "e":
+		return "ne"
+	case "ne":
+		return "e"
+	case "z":
+		return "nz"
+	case "nz":
+		return "z"
+	case "l":
+		return "ge"
+	case "ge":
+		return "l"
+	case "le":
+		return "g"
+	case "g":
+		return "le"
+	case "b":
+		return "ae"
+	case "ae":
+		return "b"
+	case "be":
+		return "a"
+	case "a":
+		return "be"
+	}
+	return ""
+}
+
+func (l *asmLine) analyze() {
+	kind, n := classifyOp(l.op)
+	l.opKind = kind
+	l.barrier = n < 0 || n != len(l.args)
+	if n == 1 && len(l.args) == 1 {
+		arg := l.args[0]
+		if arg[0] == '*' {
+			l.barrier = true
+		}
+	}
+	l.stack = kind == ASM_OP_PUSH || kind == ASM_OP_POP
+	l.nsrc = 0
+	l.dstReg = -1
+	for i, arg := range l.args {
+		if i == len(l.args)-1 {
+			family, width := parseRegister(arg)
+			if family >= 0 {
+				l.dstReg = family
+				l.dstFull = width >= 32
+				continue
+			}
+		}
+		l.addSources(arg)
+	}
+	if l.dstReg == REG_RSP {
+		l.stack = true
+	}
+}
+
+// record the registers which the operand refers to
+func (l *asmLine) addSources(operand string) {
+	for i := 0; i < len(operand); i++ {
+		if operand[i] != '%' {
+			continue
+		}
+		j := i + 1
+		for j < len(operand) && ((operand[j] >= 'a' && operand[j] <= 'z') || (operand[j] >= '0' && operand[j] <= '9')) {
+			j++
+		}
+		family := registerFamily(operand[i:j])
+		if family == REG_RSP {
+			l.stack = true
+		}
+		if family >= 0 {
+			switch l.nsrc {
+			case 0:
+				l.src0 = family
+			case 1:
+				l.src1 = family
+			case 2:
+				l.src2 = family
+			default:
+				l.barrier = true
+			}
+			l.nsrc++
+		}
+		i = j - 1
+	}
+}
+
+func (l *asmLine) isMove() bool {
+	return l.opKind == ASM_OP_MOV || l.opKind == ASM_OP_MOVE
+}
+
+func (l *asmLine) reads(family int) bool {
+	if l.barrier {
+		return true
+	}
+	if (l.nsrc > 0 && l.src0 == family) || (l.nsrc > 1 && l.src1 == family) || (l.nsrc > 2 && l.src2 == family) {
+		return true
+	}
+	if l.dstReg == family {
+		if l.isMove() || l.opKind == ASM_OP_POP {
+			// a partial write keeps the rest
+			return !l.dstFull
+		}
+		return true
+	}
+	if l.opKind == ASM_OP_DIV {
+		return family == REG_RAX || family == REG_RDX
+	}
+	return false
+}
+
+// whether the instruction writes the whole register without reading it
+func (l *asmLine) overwrites(family int) bool {
+	if l.barrier || l.dstReg != family || !l.dstFull {
+		return false
+	}
+	return l.isMove() || l.opKind == ASM_OP_POP
+}
+
+// the optimizer
+
+type peephole struct {
+	lines      []*asmLine
+	labelBase  int
+	labelIndex []int // the line of .L<labelBase+i>
+}
+
+func optimizeAsm(lines []*asmLine) {
+	if !peepholeEnabled || len(lines) == 0 {
+		return
+	}
+	p := &peephole{
+		lines: lines,
+	}
+	p.indexLabels()
+	for iter := 0; iter < 4; iter++ {
+		changed := false
+		for i, l := range lines {
+			if l.dead || l.kind != ASM_INST || l.barrier {
+				continue
+			}
+			if p.rewrite(i) {
+				changed = true
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+func (p *peephole) rewrite(i int) bool {
+	switch p.lines[i].opKind {
+	case ASM_OP_POP:
+		return p.foldPushPop(i)
+	case ASM_OP_MOV:
+		return p.removeSelfMove(i) || p.forwardStore(i) || p.forwardCopy(i) || p.removeDeadDef(i)
+	case ASM_OP_MOVE, ASM_OP_SET:
+		return p.removeDeadDef(i)
+	case ASM_OP_ARITH:
+		return p.fuseCompareBranch(i)
+	case ASM_OP_JMP, ASM_OP_JCC:
+		return p.removeJump(i)
+	}
+	return false
+}
+
+// the number of a label .L<n>, or -1
+func localLabelNumber(label string) int {
+	if len(label) < 3 || label[0] != '.' || label[1] != 'L' {
+		return -1
+	}
+	var n int
+	for i := 2; i < len(label); i++ {
+		c := label[i]
+		if c < '0' || c > '9' {
+			return -1
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
+func (p *peephole) indexLabels() {
+	p.labelBase = -1
+	var max int
+	for _, l := range p.lines {
+		if l.kind != ASM_LABEL {
+			continue
+		}
+		n := localLabelNumber(l.label)
+		if n < 0 {
+			continue
+		}
+		if p.labelBase < 0 || n < p.labelBase {
+			p.labelBase = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	if p.labelBase < 0 {
+		return
+	}
+	for i := p.labelBase; i <= max; i++ {
+		p.labelIndex = append(p.labelIndex, -1)
+	}
+	for i, l := range p.lines {
+		if l.kind == ASM_LABEL {
+			n := localLabelNumber(l.label)
+			if n >= 0 {
+				p.labelIndex[n-p.labelBase] = i
+			}
+		}
+	}
+}
+
+// the line of the label, or -1 if it is not in the buffer
+func (p *peephole) findLabel(label string) int {
+	n := localLabelNumber(label)
+	if n >= 0 {
+		if p.labelBase < 0 || n < p.labelBase || n-p.labelBase >= len(p.labelIndex) {
+			return -1
+		}
+		return p.labelIndex[n-p.labelBase]
+	}
+	for i, l := range p.lines {
+		if l.kind == ASM_LABEL && l.label == label {
+			return i
+		}
+	}
+	return -1
+}
+
+// the next instruction in the same basic block, or -1
+func (p *peephole) nextInst(i int) int {
+	for j := i + 1; j < len(p.lines); j++ {
+		l := p.lines[j]
+		if l.dead || l.kind == ASM_BLANK {
+			continue
+		}
+		if l.kind == ASM_INST {
+			return j
+		}
+		return -1
+	}
+	return -1
+}
+
+// the previous instruction in the same basic block, or -1
+func (p *peephole) prevInst(i int) int {
+	for j := i - 1; j >= 0; j-- {
+		l := p.lines[j]
+		if l.dead || l.kind == ASM_BLANK {
+			continue
+		}
+		if l.kind == ASM_INST {
+			return j
+		}
+		return -1
+	}
+	return -1
+}
+
+// push X; ...; pop %R => mov X, %R; ...
+// if nothing in between uses the stack or %R
+func (p *peephole) foldPushPop(i int) bool {
+	pop := p.lines[i]
+	dst := pop.args[0]
+	family := pop.dstReg
+	for j := p.prevInst(i); j >= 0; j = p.prevInst(j) {
+		push := p.lines[j]
+		if push.opKind == ASM_OP_PUSH && !push.barrier {
+			src := push.args[0]
+			if family >= 0 {
+				if src == dst {
+					push.dead = true
+				} else {
+					push.setInst("mov", []string{src, dst})
+				}
+				pop.dead = true
+				return true
+			}
+			// a pop to memory only from an adjacent push
+			if j == p.prevInst(i) && (isRegister(src) || isImm32(src)) {
+				pop.setInst("movq", []string{src, dst})
+				push.dead = true
+				return true
+			}
+			return false
+		}
+		if family < 0 || push.barrier || push.stack || push.reads(family) || push.dstReg == family {
+			return false
+		}
+	}
+	return false
+}
+
+// mov %R, %R
+func (p *peephole) removeSelfMove(i int) bool {
+	l := p.lines[i]
+	if l.args[0] == l.args[1] && isRegister64(l.args[0]) {
+		l.dead = true
+		return true
+	}
+	return false
+}
+
+// mov %R, M; mov M, %S => mov %R, M; mov %R, %S
+func (p *peephole) forwardStore(i int) bool {
+	store := p.lines[i]
+	if store.op != "mov" || !isRegister64(store.args[0]) || !isSafeMemory(store.args[1]) {
+		return false
+	}
+	j := p.nextInst(i)
+	if j < 0 {
+		return false
+	}
+	load := p.lines[j]
+	if load.op == "mov" && !load.barrier && load.args[0] == store.args[1] && isRegister64(load.args[1]) {
+		load.setInst("mov", []string{store.args[0], load.args[1]})
+		return true
+	}
+	return false
+}
+
+// mov S, %R; OP %R, X => mov S, %R; OP S, X
+// where S is a register or an immediate
+func (p *peephole) forwardCopy(i int) bool {
+	def := p.lines[i]
+	src := def.args[0]
+	reg := def.args[1]
+	if !isRegister64(reg) || (!isRegister64(src) && !isImm32(src)) {
+		return false
+	}
+	j := p.nextInst(i)
+	if j < 0 {
+		return false
+	}
+	use := p.lines[j]
+	if use.barrier || len(use.args) == 0 || use.args[0] != reg {
+		return false
+	}
+	if use.opKind == ASM_OP_PUSH {
+		use.setInst(use.op, []string{src})
+		return true
+	}
+	dst := use.args[len(use.args)-1]
+	if use.opKind == ASM_OP_MOV {
+		if isRegister(dst) || isRegister(src) {
+			use.setInst("mov", []string{src, dst})
+		} else {
+			use.setInst("movq", []string{src, dst})
+		}
+		return true
+	}
+	switch use.op {
+	case "add", "sub", "imul", "and", "or", "xor", "cmp":
+		if isRegister64(dst) && dst != reg {
+			use.setInst(use.op, []string{src, dst})
+			return true
+		}
+	}
+	return false
+}
+
+// setCC %al; movzb %al, %eax; [mov %rax, %R;] test %R, %R; je L => setCC %al; movzb %al, %eax; [mov %rax, %R;] jNCC L
+// since none of them changes the flags
+func (p *peephole) fuseCompareBranch(i int) bool {
+	test := p.lines[i]
+	if test.op != "test" || test.args[0] != test.args[1] || !isRegister64(test.args[0]) {
+		return false
+	}
+	j := p.nextInst(i)
+	if j < 0 {
+		return false
+	}
+	jump := p.lines[j]
+	if jump.op != "je" && jump.op != "jne" {
+		return false
+	}
+	k := p.prevInst(i)
+	if k >= 0 && test.args[0] != "%rax" {
+		mov := p.lines[k]
+		if mov.op != "mov" || mov.barrier || mov.args[0] != "%rax" || mov.args[1] != test.args[0] {
+			return false
+		}
+		k = p.prevInst(k)
+	}
+	if k < 0 {
+		return false
+	}
+	zext := p.lines[k]
+	if (zext.op != "movzb" && zext.op != "movzbl") || zext.barrier || zext.args[0] != "%al" || zext.args[1] != "%eax" {
+		return false
+	}
+	k = p.prevInst(k)
+	if k < 0 {
+		return false
+	}
+	set := p.lines[k]
+	if set.opKind != ASM_OP_SET || set.barrier || set.args[0] != "%al" {
+		return false
+	}
+	cc := set.op[3:len(set.op)]
+	if jump.op == "je" {
+		cc = negateCondition(cc)
+	}
+	jump.setInst("j"+cc, jump.args)
+	test.dead = true
+	return true
+}
+
+// whether only labels are between the line and the label
+func (p *peephole) fallsInto(i int, label string) bool {
+	for j := i + 1; j < len(p.lines); j++ {
+		l := p.lines[j]
+		if l.dead || l.kind == ASM_BLANK {
+			continue
+		}
+		if l.kind != ASM_LABEL {
+			return false
+		}
+		if l.label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// jmp L; L: => L:
+// jCC L1; jmp L2; L1: => jNCC L2; L1:
+func (p *peephole) removeJump(i int) bool {
+	l := p.lines[i]
+	if l.opKind == ASM_OP_JMP {
+		if p.fallsInto(i, l.args[0]) {
+			l.dead = true
+			return true
+		}
+		return false
+	}
+	j := p.nextInst(i)
+	if j < 0 {
+		return false
+	}
+	jmp := p.lines[j]
+	if jmp.opKind == ASM_OP_JMP && !jmp.barrier && p.fallsInto(j, l.args[0]) {
+		l.setInst("j"+negateCondition(l.op[1:len(l.op)]), jmp.args)
+		jmp.dead = true
+		return true
+	}
+	return false
+}
+
+// a definition of a register which is overwritten before it is read
+func (p *peephole) removeDeadDef(i int) bool {
+	def := p.lines[i]
+	if def.isMove() {
+		src := def.args[0]
+		if def.op != "lea" && !isRegister(src) && src[0] != '$' && !isSafeMemory(src) {
+			// a load may be there to fault
+			return false
+		}
+	}
+	family := def.dstReg
+	if family < 0 || family == REG_RSP || family == REG_RBP {
+		return false
+	}
+	if p.isDeadAfter(i, family) {
+		def.dead = true
+		return true
+	}
+	return false
+}
+
+// whether every path from the line overwrites the register before reading it.
+// Paths which leave the function or go too far count as reading it.
+func (p *peephole) isDeadAfter(i int, family int) bool {
+	var work []int = []int{i + 1}
+	var steps int
+	for len(work) > 0 {
+		j := work[len(work)-1]
+		work = work[0 : len(work)-1]
+		overwritten := false
+		for k := j; k < len(p.lines); k++ {
+			steps++
+			if steps > 64 {
+				return false
+			}
+			l := p.lines[k]
+			if l.dead || l.kind == ASM_BLANK || l.kind == ASM_LABEL {
+				continue
+			}
+			if l.kind == ASM_DIRECTIVE || l.reads(family) {
+				return false
+			}
+			if l.overwrites(family) {
+				overwritten = true
+				break
+			}
+			if l.opKind == ASM_OP_JMP || l.opKind == ASM_OP_JCC {
+				target := p.findLabel(l.args[0])
+				if target < 0 {
+					return false
+				}
+				if l.opKind == ASM_OP_JMP {
+					k = target
+				} else {
+					work = append(work, target)
+				}
+			}
+		}
+		if !overwritten {
+			return false
+		}
+	}
+	return true
+}
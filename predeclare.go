@@ -14,6 +14,7 @@ var gString = &Gtype{
 }
 
 var builtinTypesAsString []string = []string{"bool", "byte", "int", "string", "func"}
+var builtinTypeKinds []GTYPE_KIND = []GTYPE_KIND{G_BOOL, G_BYTE, G_INT, G_STRING, G_FUNC}
 
 var eIota = &ExprConstVariable{
 	name: "iota",
@@ -51,6 +52,12 @@ var builtinAsComment = &DeclFunc{
 	rettypes: []*Gtype{},
 }
 
+// gc() is implemented in assembly to save registers and to know the stack pointer
+var builtinGC = &DeclFunc{
+	pkg:      "iruntime",
+	rettypes: []*Gtype{},
+}
+
 var sBuiltinRunTimeArgsRettypes1 Gtype = Gtype{
 	kind: G_SLICE,
 	size: IntSize * 3,
@@ -71,45 +78,57 @@ func newUniverse() *Scope {
 	return universe
 }
 
-// https://golang.org/ref/spec#Predeclared_identifiers
-func setPredeclaredIdentifiers(universe *Scope) {
-	predeclareNil(universe)
-	predeclareTypes(universe)
-	predeclareConsts(universe)
-	predeclareLibcFuncs(universe)
+// The internal scope has helpers of the runtime and libc functions.
+// It is visible only to the runtime and the standard libraries, not to user code.
+func newInternalScope(universe *Scope) *Scope {
+	internal := newScope(universe, "internal")
+	predeclareLibcFuncs(internal)
 
-	universe.setFunc("len", &ExprFuncRef{
-		funcdef: builtinLen,
-	})
-	universe.setFunc("cap", &ExprFuncRef{
-		funcdef: builtinCap,
-	})
-	universe.setFunc("append", &ExprFuncRef{
-		funcdef: builtinAppend,
-	})
-	universe.setFunc("makeSlice", &ExprFuncRef{
+	internal.setFunc("makeSlice", &ExprFuncRef{
 		funcdef: builtinMakeSlice,
 	})
 
-	universe.setFunc("dumpSlice", &ExprFuncRef{
+	internal.setFunc("dumpSlice", &ExprFuncRef{
 		funcdef: builtinDumpSlice,
 	})
 
-	universe.setFunc("dumpInterface", &ExprFuncRef{
+	internal.setFunc("dumpInterface", &ExprFuncRef{
 		funcdef: builtinDumpInterface,
 	})
 
-	universe.setFunc("assertInterface", &ExprFuncRef{
+	internal.setFunc("assertInterface", &ExprFuncRef{
 		funcdef: builtinAssertInterface,
 	})
 
-	universe.setFunc("asComment", &ExprFuncRef{
+	internal.setFunc("asComment", &ExprFuncRef{
 		funcdef: builtinAsComment,
 	})
 
-	universe.setFunc("runtime_args", &ExprFuncRef{
+	internal.setFunc("gc", &ExprFuncRef{
+		funcdef: builtinGC,
+	})
+
+	internal.setFunc("runtime_args", &ExprFuncRef{
 		funcdef: builtinRunTimeArgs,
 	})
+	return internal
+}
+
+// https://golang.org/ref/spec#Predeclared_identifiers
+func setPredeclaredIdentifiers(universe *Scope) {
+	predeclareNil(universe)
+	predeclareTypes(universe)
+	predeclareConsts(universe)
+
+	universe.setFunc("len", &ExprFuncRef{
+		funcdef: builtinLen,
+	})
+	universe.setFunc("cap", &ExprFuncRef{
+		funcdef: builtinCap,
+	})
+	universe.setFunc("append", &ExprFuncRef{
+		funcdef: builtinAppend,
+	})
 }
 
 // Zero value:
@@ -149,45 +168,190 @@ func predeclareConsts(universe *Scope) {
 	universe.setConst("iota", eIota)
 }
 
-func predeclareLibcFuncs(universe *Scope) {
-	universe.setFunc("printf", &ExprFuncRef{
+func predeclareLibcFuncs(internal *Scope) {
+	internal.setFunc("printf", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg: "libc",
+		},
+	})
+	internal.setFunc("asprintf", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+	internal.setFunc("sprintf", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+	internal.setFunc("exit", &ExprFuncRef{
 		funcdef: &DeclFunc{
 			pkg: "libc",
 		},
 	})
-	universe.setFunc("sprintf", &ExprFuncRef{
+	internal.setFunc("open", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("read", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("write", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("atoi", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("getenv", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("mmap", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("memcpy", &ExprFuncRef{
 		funcdef: &DeclFunc{
 			pkg:      "libc",
 			rettypes: []*Gtype{gInt},
 		},
 	})
-	universe.setFunc("exit", &ExprFuncRef{
+
+	internal.setFunc("free", &ExprFuncRef{
 		funcdef: &DeclFunc{
 			pkg: "libc",
 		},
 	})
-	universe.setFunc("open", &ExprFuncRef{
+
+	internal.setFunc("memset", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("close", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("remove", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("mkdir", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("rename", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("mkdtemp", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("strdup", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("getpid", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("fork", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("execvp", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("waitpid", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("opendir", &ExprFuncRef{
+		funcdef: &DeclFunc{
+			pkg:      "libc",
+			rettypes: []*Gtype{gInt},
+		},
+	})
+
+	internal.setFunc("readdir", &ExprFuncRef{
 		funcdef: &DeclFunc{
 			pkg:      "libc",
 			rettypes: []*Gtype{gInt},
 		},
 	})
 
-	universe.setFunc("read", &ExprFuncRef{
+	internal.setFunc("closedir", &ExprFuncRef{
 		funcdef: &DeclFunc{
 			pkg:      "libc",
 			rettypes: []*Gtype{gInt},
 		},
 	})
 
-	universe.setFunc("write", &ExprFuncRef{
+	internal.setFunc("strlen", &ExprFuncRef{
 		funcdef: &DeclFunc{
 			pkg:      "libc",
 			rettypes: []*Gtype{gInt},
 		},
 	})
 
-	universe.setFunc("atoi", &ExprFuncRef{
+	internal.setFunc("getcwd", &ExprFuncRef{
 		funcdef: &DeclFunc{
 			pkg:      "libc",
 			rettypes: []*Gtype{gInt},
@@ -0,0 +1,262 @@
+// Register allocation for the IR by linear scan,
+// following "Linear Scan Register Allocation" by Poletto and Sarkar.
+//
+// No function preserves registers for its caller, so a value in a register
+// which is live across a call is saved and restored around it.
+// Code emitted from the AST keeps nothing in registers across calls.
+package main
+
+// %rax, %rcx and %rdx are left for the code generator
+var allocatableRegs []string = []string{"rbx", "rsi", "rdi", "r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15"}
+
+// constants are immediates, and the others are in registers or stack slots
+func (v *IrValue) needsLocation() bool {
+	return v.op != IR_CONST && v.hasResult()
+}
+
+func (f *IrFunc) allocateRegisters() {
+	f.numberPositions()
+	f.computeLiveness()
+	f.buildIntervals()
+	f.linearScan()
+}
+
+// every value gets a position in the order of emission,
+// and phis are at the start of their block
+func (f *IrFunc) numberPositions() {
+	var none *IrValue
+	f.valuesById = nil
+	for i := 0; i < f.valueSeq; i++ {
+		f.valuesById = append(f.valuesById, none)
+	}
+	var pos int
+	for _, blk := range f.blocks {
+		blk.start = pos
+		pos += 2
+		for _, v := range blk.values {
+			f.valuesById[v.id] = v
+			if v.op == IR_PHI {
+				v.pos = blk.start
+			} else {
+				v.pos = pos
+				pos += 2
+			}
+		}
+		blk.end = pos
+		pos += 2
+	}
+}
+
+func newBools(n int) []bool {
+	var r []bool
+	for i := 0; i < n; i++ {
+		r = append(r, false)
+	}
+	return r
+}
+
+func predIndex(blk *IrBlock, pred *IrBlock) int {
+	for i, p := range blk.preds {
+		if p == pred {
+			return i
+		}
+	}
+	return -1
+}
+
+// computeLiveness sets the values live at the start and the end of each block.
+// An operand of a phi is live at the end of the pred it comes from.
+func (f *IrFunc) computeLiveness() {
+	for _, blk := range f.blocks {
+		blk.liveIn = newBools(f.valueSeq)
+		blk.liveOut = newBools(f.valueSeq)
+	}
+	for {
+		changed := false
+		for i := len(f.blocks) - 1; i >= 0; i-- {
+			blk := f.blocks[i]
+			var liveOut []bool = blk.liveOut
+			for _, succ := range blk.succs {
+				index := predIndex(succ, blk)
+				for _, v := range succ.values {
+					if v.op == IR_PHI && v.args[index].needsLocation() {
+						liveOut[v.args[index].id] = true
+					}
+				}
+				for id, live := range succ.liveIn {
+					if live {
+						liveOut[id] = true
+					}
+				}
+			}
+
+			var live []bool
+			for _, b := range liveOut {
+				live = append(live, b)
+			}
+			if blk.control != nil && blk.control.needsLocation() {
+				live[blk.control.id] = true
+			}
+			for _, v := range blk.results {
+				if v.needsLocation() {
+					live[v.id] = true
+				}
+			}
+			for j := len(blk.values) - 1; j >= 0; j-- {
+				v := blk.values[j]
+				live[v.id] = false
+				if v.op == IR_PHI {
+					continue
+				}
+				for _, arg := range v.args {
+					if arg.needsLocation() {
+						live[arg.id] = true
+					}
+				}
+			}
+			for id, b := range live {
+				if b && !blk.liveIn[id] {
+					blk.liveIn[id] = true
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+func (v *IrValue) extendTo(pos int) {
+	if pos < v.start {
+		v.start = pos
+	}
+	if pos > v.end {
+		v.end = pos
+	}
+}
+
+// an interval is a single range from the first to the last position where the value is live
+func (f *IrFunc) buildIntervals() {
+	for _, blk := range f.blocks {
+		for _, v := range blk.values {
+			v.start = v.pos
+			v.end = v.pos
+		}
+	}
+	for _, blk := range f.blocks {
+		for id, live := range blk.liveIn {
+			if live {
+				f.valuesById[id].extendTo(blk.start)
+			}
+		}
+		for id, live := range blk.liveOut {
+			if live {
+				f.valuesById[id].extendTo(blk.end)
+			}
+		}
+		for _, v := range blk.values {
+			if v.op == IR_PHI {
+				// written at the end of the preds
+				for _, pred := range blk.preds {
+					v.extendTo(pred.end)
+				}
+				continue
+			}
+			for _, arg := range v.args {
+				arg.extendTo(v.pos)
+			}
+		}
+		if blk.control != nil {
+			blk.control.extendTo(blk.end)
+		}
+		for _, v := range blk.results {
+			v.extendTo(blk.end)
+		}
+	}
+}
+
+func insertByEnd(active []*IrValue, v *IrValue) []*IrValue {
+	var r []*IrValue
+	inserted := false
+	for _, a := range active {
+		if !inserted && v.end < a.end {
+			r = append(r, v)
+			inserted = true
+		}
+		r = append(r, a)
+	}
+	if !inserted {
+		r = append(r, v)
+	}
+	return r
+}
+
+func (f *IrFunc) linearScan() {
+	// intervals in the order of their start
+	var intervals []*IrValue
+	for _, blk := range f.blocks {
+		for _, v := range blk.values {
+			v.reg = ""
+			if !v.needsLocation() {
+				continue
+			}
+			var sorted []*IrValue
+			inserted := false
+			for _, w := range intervals {
+				if !inserted && v.start < w.start {
+					sorted = append(sorted, v)
+					inserted = true
+				}
+				sorted = append(sorted, w)
+			}
+			if !inserted {
+				sorted = append(sorted, v)
+			}
+			intervals = sorted
+		}
+	}
+	f.intervals = intervals
+
+	var free []string
+	for _, reg := range allocatableRegs {
+		free = append(free, reg)
+	}
+	var active []*IrValue // in the order of their end
+	for _, cur := range intervals {
+		var stillActive []*IrValue
+		for _, a := range active {
+			if a.end < cur.start {
+				free = append(free, a.reg)
+			} else {
+				stillActive = append(stillActive, a)
+			}
+		}
+		active = stillActive
+
+		if len(free) > 0 {
+			cur.reg = free[0]
+			free = free[1:len(free)]
+			active = insertByEnd(active, cur)
+			continue
+		}
+		// spill the one which lives longest
+		last := active[len(active)-1]
+		if last.end > cur.end {
+			cur.reg = last.reg
+			last.reg = ""
+			active = insertByEnd(active[0:len(active)-1], cur)
+		}
+	}
+}
+
+// values in registers which have to survive the call at pos
+func (f *IrFunc) liveAcross(pos int) []*IrValue {
+	var r []*IrValue
+	for _, v := range f.intervals {
+		if v.reg != "" && v.start < pos && pos < v.end {
+			r = append(r, v)
+		}
+	}
+	return r
+}
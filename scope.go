@@ -6,12 +6,16 @@ type Scope struct {
 	idents map[identifier]*IdentBody
 	name   string
 	outer  *Scope
+	locals []identifier // local variables in order of declaration
+	// the names of a package which are left out of its export data
+	unexported []identifier
 }
 
 type IdentBody struct {
 	typ   int // 1:*Gtype, 2:Expr
 	gtype *Gtype
 	expr  Expr
+	uses  int // number of references, not counting assignments
 }
 
 func (sc *Scope) get(name identifier) *IdentBody {
@@ -24,6 +28,24 @@ func (sc *Scope) get(name identifier) *IdentBody {
 	return nil
 }
 
+// look up a name only in this scope, not in the outer ones
+func (sc *Scope) getDeclared(name identifier) *IdentBody {
+	v, ok := sc.idents[name]
+	if ok {
+		return v
+	}
+	return nil
+}
+
+func (sc *Scope) isUnexported(name identifier) bool {
+	for _, n := range sc.unexported {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (sc *Scope) setFunc(name identifier, funcref *ExprFuncRef) {
 	sc.set(name, &IdentBody{
 		expr: funcref,
@@ -42,6 +64,36 @@ func (sc *Scope) setVar(name identifier, variable *ExprVariable) {
 	})
 }
 
+// declare a local variable, which must be used
+func (sc *Scope) setLocalVar(name identifier, variable *ExprVariable) {
+	body, ok := sc.idents[name]
+	if ok {
+		// redeclaration by := in the same scope
+		body.expr = variable
+		return
+	}
+	sc.setVar(name, variable)
+	if name != "_" {
+		sc.locals = append(sc.locals, name)
+	}
+}
+
+// local variables which are declared in this scope but never used
+func (sc *Scope) unusedVars() []*ExprVariable {
+	var r []*ExprVariable
+	for _, name := range sc.locals {
+		body := sc.idents[name]
+		if body.uses > 0 {
+			continue
+		}
+		variable, ok := body.expr.(*ExprVariable)
+		if ok {
+			r = append(r, variable)
+		}
+	}
+	return r
+}
+
 func (sc *Scope) setGtype(name identifier, gtype *Gtype) {
 	sc.set(name, &IdentBody{
 		gtype: gtype,
@@ -70,6 +122,17 @@ func (sc *Scope) getGtype(name identifier) *Gtype {
 	return elm.gtype
 }
 
+// https://golang.org/ref/spec#Exported_identifiers
+func isExported(name identifier) bool {
+	s := string(name)
+	return len(s) > 0 && 'A' <= s[0] && s[0] <= 'Z'
+}
+
+// the universe and the runtime are compiled into every program
+func isRuntimePackage(pkg identifier) bool {
+	return pkg == "" || pkg == "iruntime"
+}
+
 func newScope(outer *Scope, name string) *Scope {
 	return &Scope{
 		outer:  outer,
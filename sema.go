@@ -15,6 +15,7 @@ func setTypeIds(namedTypes []*DeclType) {
 func resolve(sc *Scope, rel *Relation) *IdentBody {
 	relbody := sc.get(rel.name)
 	if relbody != nil {
+		relbody.uses++
 		if relbody.gtype != nil {
 			rel.gtype = relbody.gtype
 		} else if relbody.expr != nil {
@@ -51,13 +52,75 @@ func resolveMethods(pmethods map[identifier]methods, packageScope *Scope) {
 	}
 }
 
+// the named type of gtype or of what gtype points to, or nil
+func namedTypeOf(gtype *Gtype) *Gtype {
+	if gtype != nil && gtype.kind == G_POINTER {
+		gtype = gtype.origType
+	}
+	if gtype == nil || gtype.kind != G_NAMED {
+		return nil
+	}
+	return gtype
+}
+
+// check that fields and methods of types in other packages are exported
+func checkExports(pkg *AstPackage) []string {
+	var errors []string
+	for _, f := range pkg.files {
+		for _, sel := range f.selectors {
+			var gtype *Gtype
+			var names []identifier
+			var what string
+			switch sel.(type) {
+			case *ExprStructField:
+				field := sel.(*ExprStructField)
+				gtype = field.strct.getGtype()
+				names = []identifier{field.fieldname}
+				what = "field"
+			case *ExprMethodcall:
+				call := sel.(*ExprMethodcall)
+				gtype = call.receiver.getGtype()
+				names = []identifier{call.fname}
+				what = "method"
+			case *ExprStructLiteral:
+				lit := sel.(*ExprStructLiteral)
+				gtype = lit.getGtype()
+				for _, elm := range lit.fields {
+					names = append(names, elm.key)
+				}
+				what = "field"
+			}
+			named := namedTypeOf(gtype)
+			if named == nil {
+				continue
+			}
+			declPkg := named.relation.pkg
+			if declPkg == "" || declPkg == pkg.name {
+				continue
+			}
+			for _, name := range names {
+				if name != "" && !isExported(name) {
+					msg := fmt.Sprintf("cannot refer to unexported %s %s of type %s.%s", what, name, declPkg, named.relation.name)
+					errors = append(errors, errorAt(sel.token(), msg))
+				}
+			}
+		}
+	}
+	return errors
+}
+
 func collectDecls(pkg *AstPackage) {
 	for _, f := range pkg.files {
 		for _, decl := range f.topLevelDecls {
 			if decl.vardecl != nil {
 				pkg.vars = append(pkg.vars, decl.vardecl)
 			} else if decl.funcdecl != nil {
-				pkg.funcs = append(pkg.funcs, decl.funcdecl)
+				fn := decl.funcdecl
+				pkg.funcs = append(pkg.funcs, fn)
+				if fn.receiver == nil && fn.fname == "init" {
+					fn.initIndex = len(pkg.inits)
+					pkg.inits = append(pkg.inits, fn)
+				}
 			}
 		}
 	}
@@ -69,3 +132,76 @@ func setStringLables(pkg *AstPackage, prefix string) {
 	}
 }
 
+// https://golang.org/ref/spec#Terminating_statements
+func isTerminating(stmt Stmt) bool {
+	switch stmt.(type) {
+	case *StmtReturn:
+		return true
+	case *StmtExpr:
+		call, ok := stmt.(*StmtExpr).expr.(*ExprFuncallOrConversion)
+		return ok && call.fname == "panic"
+	case *StmtSatementList:
+		return isTerminatingList(stmt.(*StmtSatementList))
+	case *StmtIf:
+		stmtIf := stmt.(*StmtIf)
+		if stmtIf.els == nil {
+			return false
+		}
+		return isTerminatingList(stmtIf.then) && isTerminating(stmtIf.els)
+	case *StmtFor:
+		// an infinite loop without break
+		stmtFor := stmt.(*StmtFor)
+		if stmtFor.cls == nil || stmtFor.cls.cond != nil {
+			return false
+		}
+		return !hasBreak(stmtFor.block)
+	case *StmtSwitch:
+		stmtSwitch := stmt.(*StmtSwitch)
+		if stmtSwitch.dflt == nil {
+			return false
+		}
+		if !isTerminatingList(stmtSwitch.dflt) || hasBreak(stmtSwitch.dflt) {
+			return false
+		}
+		for _, cas := range stmtSwitch.cases {
+			if !isTerminatingList(cas.compound) || hasBreak(cas.compound) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// a statement list is terminating if its last statement is terminating
+func isTerminatingList(list *StmtSatementList) bool {
+	if list == nil || len(list.stmts) == 0 {
+		return false
+	}
+	return isTerminating(list.stmts[len(list.stmts)-1])
+}
+
+// whether stmt contains a break which refers to the enclosing statement
+func hasBreak(stmt Stmt) bool {
+	switch stmt.(type) {
+	case *StmtBreak:
+		return true
+	case *StmtSatementList:
+		list := stmt.(*StmtSatementList)
+		if list == nil {
+			return false
+		}
+		for _, st := range list.stmts {
+			if hasBreak(st) {
+				return true
+			}
+		}
+	case *StmtIf:
+		stmtIf := stmt.(*StmtIf)
+		if hasBreak(stmtIf.then) {
+			return true
+		}
+		return stmtIf.els != nil && hasBreak(stmtIf.els)
+	}
+	return false
+}
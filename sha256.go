@@ -0,0 +1,112 @@
+// SHA-256 of FIPS 180-4, which makes the keys of the build cache.
+// The words of 32 bits are kept in ints.
+package main
+
+import "fmt"
+
+const mask32 int = 1<<32 - 1
+
+var sha256K []int = []int{
+	0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+	0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+	0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+	0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+	0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+	0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+	0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+	0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+}
+
+type sha256Digest struct {
+	h     []int  // the hash of the blocks so far
+	w     []int  // the message schedule of a block
+	block []byte // the bytes not hashed yet
+	size  int    // the number of bytes written
+}
+
+func newSha256() *sha256Digest {
+	d := &sha256Digest{
+		h: []int{0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19},
+	}
+	for i := 0; i < 64; i++ {
+		d.w = append(d.w, 0)
+	}
+	return d
+}
+
+func (d *sha256Digest) writeByte(c byte) {
+	d.block = append(d.block, c)
+	d.size++
+	if len(d.block) == 64 {
+		d.hashBlock()
+		d.block = d.block[0:0]
+	}
+}
+
+func rotr32(x int, n int) int {
+	return (x>>n | x<<(32-n)) & mask32
+}
+
+func (d *sha256Digest) hashBlock() {
+	w := d.w
+	block := d.block
+	for i := 0; i < 16; i++ {
+		w[i] = int(block[4*i])<<24 | int(block[4*i+1])<<16 | int(block[4*i+2])<<8 | int(block[4*i+3])
+	}
+	for i := 16; i < 64; i++ {
+		s0 := rotr32(w[i-15], 7) ^ rotr32(w[i-15], 18) ^ w[i-15]>>3
+		s1 := rotr32(w[i-2], 17) ^ rotr32(w[i-2], 19) ^ w[i-2]>>10
+		w[i] = (w[i-16] + s0 + w[i-7] + s1) & mask32
+	}
+
+	h := d.h
+	a := h[0]
+	b := h[1]
+	c := h[2]
+	dd := h[3]
+	e := h[4]
+	f := h[5]
+	g := h[6]
+	hh := h[7]
+	for i := 0; i < 64; i++ {
+		s1 := rotr32(e, 6) ^ rotr32(e, 11) ^ rotr32(e, 25)
+		ch := e&f ^ g&^e
+		t1 := hh + s1 + ch + sha256K[i] + w[i]
+		s0 := rotr32(a, 2) ^ rotr32(a, 13) ^ rotr32(a, 22)
+		maj := a&b ^ a&c ^ b&c
+		t2 := s0 + maj
+		hh = g
+		g = f
+		f = e
+		e = (dd + t1) & mask32
+		dd = c
+		c = b
+		b = a
+		a = (t1 + t2) & mask32
+	}
+	h[0] = (h[0] + a) & mask32
+	h[1] = (h[1] + b) & mask32
+	h[2] = (h[2] + c) & mask32
+	h[3] = (h[3] + dd) & mask32
+	h[4] = (h[4] + e) & mask32
+	h[5] = (h[5] + f) & mask32
+	h[6] = (h[6] + g) & mask32
+	h[7] = (h[7] + hh) & mask32
+}
+
+// sum pads the message with its length in bits and returns the hash in hex
+func (d *sha256Digest) sum() string {
+	bits := d.size * 8
+	d.writeByte(0x80)
+	for len(d.block) != 56 {
+		d.writeByte(0)
+	}
+	for i := 7; i >= 0; i-- {
+		d.writeByte(byte(bits >> (8 * i) & 0xff))
+	}
+	var s string
+	for _, x := range d.h {
+		s = s + fmt.Sprintf("%08x", x)
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package exec
+
+import "os"
+
+// Cmd represents an external command.
+// The command inherits the standard files of the caller,
+// so Stdin, Stdout and Stderr can only be os.Stdin, os.Stdout and os.Stderr.
+type Cmd struct {
+	Path         string
+	Args         []string
+	Stdin        *os.File
+	Stdout       *os.File
+	Stderr       *os.File
+	ProcessState *ProcessState
+}
+
+// ProcessState has the wait status of an exited process.
+type ProcessState struct {
+	status int
+}
+
+// ExitCode returns the exit code of the process, or -1 if it was killed by a signal.
+func (p *ProcessState) ExitCode() int {
+	if p.status%128 != 0 {
+		return -1
+	}
+	return (p.status / 256) % 256
+}
+
+// ExitError is returned by Run when the command exits unsuccessfully.
+type ExitError struct {
+	ProcessState *ProcessState
+}
+
+func (e *ExitError) Error() string {
+	code := e.ProcessState.ExitCode()
+	if code < 0 {
+		return "signal: killed"
+	}
+	var digits []byte
+	for {
+		digits = append(digits, byte('0'+code%10))
+		code = code / 10
+		if code == 0 {
+			break
+		}
+	}
+	var s string = "exit status "
+	for i := len(digits) - 1; i >= 0; i-- {
+		s = s + string(digits[i:i+1])
+	}
+	return s
+}
+
+// Command returns the Cmd to execute the named program with the given arguments.
+func Command(name string, arg ...string) *Cmd {
+	var args []string = []string{name}
+	for _, a := range arg {
+		args = append(args, a)
+	}
+	return &Cmd{
+		Path: name,
+		Args: args,
+	}
+}
+
+// Run starts the command found in PATH and waits for it to exit.
+func (c *Cmd) Run() error {
+	// a NULL terminated array of C strings
+	var argv []int
+	for _, a := range c.Args {
+		argv = append(argv, strdup(a))
+	}
+	argv = append(argv, 0)
+
+	var pid int = libcInt(fork())
+	if pid < 0 {
+		return &os.PathError{Op: "fork", Path: c.Path}
+	}
+	if pid == 0 {
+		execvp(c.Path, argv)
+		var msg []byte = []byte("exec: " + c.Path + ": not found\n")
+		os.Stderr.Write(msg)
+		exit(127)
+	}
+	var status []int = []int{0}
+	if libcInt(waitpid(pid, status, 0)) < 0 {
+		return &os.PathError{Op: "wait", Path: c.Path}
+	}
+	c.ProcessState = &ProcessState{
+		status: status[0],
+	}
+	if c.ProcessState.ExitCode() != 0 {
+		return &ExitError{
+			ProcessState: c.ProcessState,
+		}
+	}
+	return nil
+}
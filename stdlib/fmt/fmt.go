@@ -17,50 +17,471 @@ func Sprintf(format string, param ...interface{}) string {
 func Println(s string) {
 }
 
-var pbuf [1024]byte
-
+// doPrintf formats the arguments one directive at a time.
+// Strings are copied in Go, so that they can contain NUL,
+// and the other values are formatted by libc.
 func doPrintf(format string, a ...interface{}) string {
-	var a0 interface{}
-	var a1 interface{}
-	var a2 interface{}
-	var a3 interface{}
-	var numred int
-	if len(a) > 100 {
-		panic("runtime error: a in doPrintf is an invalid slice:" + format)
-	}
-
-	switch len(a) {
-	case 0:
-		numred = sprintf(pbuf, format)
-	case 1:
-		a0 = a[0]
-		numred = sprintf(pbuf, format, *a0)
-
-	case 2:
-		a0 = a[0]
-		a1 = a[1]
-		numred = sprintf(pbuf, format, *a0, *a1)
-	case 3:
-		a0 = a[0]
-		a1 = a[1]
-		a2 = a[2]
-		numred = sprintf(pbuf, format, *a0, *a1, *a2)
-	case 4:
-		a0 = a[0]
-		a1 = a[1]
-		a2 = a[2]
-		a3 = a[3]
-		numred = sprintf(pbuf, format, *a0, *a1, *a2, *a3)
-	default:
-		printf("len(a)=%d\n", len(a))
-		panic("ERROR: doPrintf cannot handle more than 4 params")
+	var b []byte
+	var argNum int
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b = append(b, c)
+			continue
+		}
+		// the flags, width and precision, e.g. "%-5"
+		var spec []byte
+		spec = append(spec, '%')
+		i++
+		for i < len(format) && (isFlagOrWidth(format[i]) || format[i] == '*') {
+			if format[i] == '*' && argNum < len(a) {
+				// the width is given by an argument
+				spec = appendString(spec, formatC("%ld", a[argNum]))
+				argNum++
+			} else {
+				spec = append(spec, format[i])
+			}
+			i++
+		}
+		if i == len(format) {
+			b = appendString(b, "%!(NOVERB)")
+			break
+		}
+		verb := format[i]
+		if verb == '%' {
+			b = append(b, '%')
+			continue
+		}
+		if argNum == len(a) {
+			b = appendString(b, "%!")
+			b = append(b, verb)
+			b = appendString(b, "(MISSING)")
+			continue
+		}
+		b = appendArg(b, string(spec), verb, a[argNum])
+		argNum++
 	}
+	return string(b)
+}
 
-	// copy string to heap area
-	var b []interface{}
-	b = makeSlice(numred+1, numred+1, 24)
-	strcopy(pbuf, b, numred)
+// appendArg formats an argument by a directive whose verb is separated from spec.
+// The verbs which libc does not know are rendered in Go like the fmt package of Go.
+func appendArg(b []byte, spec string, verb byte, arg interface{}) []byte {
+	kind := dynamicKind(arg)
+	sharp := hasFlag(spec, '#')
+	if verb == 'T' {
+		return appendPadded(b, spec, typeString(arg))
+	}
+	if kind == 0 {
+		if verb == 'v' {
+			return appendPadded(b, spec, "<nil>")
+		}
+		return appendBadVerb(b, verb, arg)
+	}
+	switch kind {
+	case kindString:
+		s := dynamicString(arg)
+		if verb == 's' || (verb == 'v' && !sharp) {
+			return appendPadded(b, spec, s)
+		}
+		if verb == 'q' || verb == 'v' {
+			return appendPadded(b, spec, quoteString(s))
+		}
+		if verb == 'x' || verb == 'X' {
+			return appendPadded(b, spec, hexString(s, verb == 'X'))
+		}
+	case kindSlice, kindArray:
+		// only []byte and [n]byte are printed
+		bs, ok := bytesOf(arg)
+		if ok {
+			if verb == 's' {
+				return appendPadded(b, spec, string(bs))
+			}
+			if verb == 'q' {
+				return appendPadded(b, spec, quoteString(string(bs)))
+			}
+			if verb == 'x' || verb == 'X' {
+				return appendPadded(b, spec, hexString(string(bs), verb == 'X'))
+			}
+			if verb == 'v' && !sharp {
+				return appendPadded(b, spec, byteList(bs))
+			}
+		}
+	case kindBool:
+		if verb == 'd' {
+			// minigo prints a bool as an integer
+			return appendLibc(b, spec, verb, arg)
+		}
+		if verb == 't' || verb == 'v' {
+			if dynamicWord(arg) == 0 {
+				return appendPadded(b, spec, "false")
+			}
+			return appendPadded(b, spec, "true")
+		}
+	case kindInt, kindByte:
+		switch verb {
+		case 'd', 'o', 'x', 'X':
+			return appendLibc(b, spec, verb, arg)
+		case 'b':
+			return appendPadded(b, spec, binaryString(dynamicWord(arg)))
+		case 'v':
+			return appendLibc(b, spec, 'd', arg)
+		case 'c':
+			var r []byte
+			r = appendRune(r, dynamicWord(arg))
+			return appendPadded(b, spec, string(r))
+		case 'q':
+			return appendPadded(b, spec, quoteRune(dynamicWord(arg)))
+		case 'U':
+			return appendPadded(b, spec, "U+"+formatC("%04lX", arg))
+		}
+	case kindFunc:
+		if verb == 'p' {
+			return appendLibc(b, spec, 'p', arg)
+		}
+	case kindPointer:
+		if verb == 'p' {
+			return appendLibc(b, spec, 'p', arg)
+		}
+		name := dynamicTypeName(arg)
+		if verb == 'v' && name[1] != 'G' {
+			// Go prints pointers to named types like &{...}, which is not supported
+			if sharp {
+				return appendPadded(b, spec, "("+typeString(arg)+")("+formatC("%p", arg)+")")
+			}
+			return appendLibc(b, "%", 'p', arg)
+		}
+	}
+	return appendBadVerb(b, verb, arg)
+}
+
+// appendLibc formats a value which is not a string by libc
+func appendLibc(b []byte, spec string, verb byte, arg interface{}) []byte {
+	var directive []byte = []byte(spec)
+	directive = append(directive, verb)
+	return appendString(b, formatC(cFormat(string(directive)), arg))
+}
+
+// appendBadVerb reports a verb which can not print the argument, e.g. "%!d(string=hi)"
+func appendBadVerb(b []byte, verb byte, arg interface{}) []byte {
+	b = appendString(b, "%!")
+	b = append(b, verb)
+	b = append(b, '(')
+	if dynamicKind(arg) == 0 {
+		b = appendString(b, "<nil>")
+	} else if verb == 'v' {
+		// a value which can not be printed
+		b = appendString(b, typeString(arg))
+	} else {
+		b = appendString(b, typeString(arg))
+		b = append(b, '=')
+		b = appendArg(b, "%", 'v', arg)
+	}
+	return append(b, ')')
+}
+
+func hasFlag(spec string, flag byte) bool {
+	for i := 0; i < len(spec); i++ {
+		if spec[i] == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// typeString prints the dynamic type of x like Go, e.g. "*main.T" for "*G_NAMED(main.T)"
+func typeString(x interface{}) string {
+	if dynamicKind(x) == 0 {
+		return "<nil>"
+	}
+	name := dynamicTypeName(x)
+	var b []byte
+	var i int
+	for i < len(name) {
+		if hasPrefix(name[i:len(name)], "G_NAMED(") {
+			i = i + len("G_NAMED(")
+			var qualified []byte
+			for name[i] != ')' {
+				qualified = append(qualified, name[i])
+				i++
+			}
+			i++
+			b = appendString(b, unqualifyPredeclared(string(qualified)))
+		} else if hasPrefix(name[i:len(name)], "byte") {
+			b = appendString(b, "uint8")
+			i = i + len("byte")
+		} else {
+			b = append(b, name[i])
+			i++
+		}
+	}
+	return string(b)
+}
+
+// the predeclared types are qualified by the package which refers to them, e.g. main.int
+func unqualifyPredeclared(qualified string) string {
+	var dot int
+	for qualified[dot] != '.' {
+		dot++
+	}
+	name := qualified[dot+1 : len(qualified)]
+	switch name {
+	case "byte":
+		return "uint8"
+	case "bool", "int", "string":
+		return name
+	}
+	return qualified
+}
+
+func hasPrefix(s string, prefix string) bool {
+	return len(s) >= len(prefix) && s[0:len(prefix)] == prefix
+}
+
+// quoteString quotes s with Go escapes. Bytes from 0x80 are kept as they are.
+func quoteString(s string) string {
+	var b []byte
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		b = appendEscaped(b, s[i], '"')
+	}
+	b = append(b, '"')
+	return string(b)
+}
+
+// quoteRune quotes a character like 'a'
+func quoteRune(r int) string {
+	var b []byte
+	b = append(b, '\'')
+	if r < 128 {
+		b = appendEscaped(b, byte(r), '\'')
+	} else {
+		b = appendRune(b, r)
+	}
+	b = append(b, '\'')
+	return string(b)
+}
+
+func appendEscaped(b []byte, c byte, quote byte) []byte {
+	var escape byte
+	switch c {
+	case '\a':
+		escape = 'a'
+	case '\b':
+		escape = 'b'
+	case '\f':
+		escape = 'f'
+	case '\n':
+		escape = 'n'
+	case '\r':
+		escape = 'r'
+	case '\t':
+		escape = 't'
+	case '\v':
+		escape = 'v'
+	case '\\', quote:
+		escape = c
+	}
+	if escape != 0 {
+		b = append(b, '\\')
+		return append(b, escape)
+	}
+	if c < ' ' || c == 127 {
+		b = appendString(b, "\\x")
+		b = append(b, hexDigit(int(c)/16, false))
+		return append(b, hexDigit(int(c)%16, false))
+	}
+	return append(b, c)
+}
+
+func hexString(s string, upper bool) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		var c byte = s[i]
+		b = append(b, hexDigit(int(c)/16, upper))
+		b = append(b, hexDigit(int(c)%16, upper))
+	}
+	return string(b)
+}
+
+func binaryString(n int) string {
+	if n < 0 {
+		return "-" + binaryString(-n)
+	}
+	var digits []byte
+	for n >= 2 {
+		digits = append(digits, byte('0'+n%2))
+		n = n / 2
+	}
+	var b []byte
+	b = append(b, byte('0'+n))
+	for i := len(digits) - 1; i >= 0; i-- {
+		b = append(b, digits[i])
+	}
+	return string(b)
+}
+
+// bytesOf returns the elements of a []byte or [n]byte
+func bytesOf(arg interface{}) ([]byte, bool) {
+	name := typeString(arg)
+	if name == "[]uint8" {
+		return dynamicBytes(arg), true
+	}
+	if name[0] != '[' {
+		return nil, false
+	}
+	var n int
+	var i int = 1
+	for i < len(name) && isDigit(name[i]) {
+		n = n*10 + int(name[i]) - '0'
+		i++
+	}
+	if name[i:len(name)] != "]uint8" {
+		return nil, false
+	}
+	return dynamicByteArray(arg, n), true
+}
+
+// byteList formats a []byte like [104 105]
+func byteList(bs []byte) string {
+	var b []byte
+	b = append(b, '[')
+	for i, c := range bs {
+		if i > 0 {
+			b = append(b, ' ')
+		}
+		b = appendString(b, formatC("%ld", int(c)))
+	}
+	b = append(b, ']')
+	return string(b)
+}
+
+func hexDigit(n int, upper bool) byte {
+	if n < 10 {
+		return byte('0' + n)
+	}
+	if upper {
+		return byte('A' + n - 10)
+	}
+	return byte('a' + n - 10)
+}
 
-	// return heap
+// appendRune appends the UTF-8 encoding of r
+func appendRune(b []byte, r int) []byte {
+	if r < 128 {
+		return append(b, byte(r))
+	}
+	if r < 2048 {
+		b = append(b, byte(192+r/64))
+		return append(b, byte(128+r%64))
+	}
+	if r < 65536 {
+		b = append(b, byte(224+r/4096))
+		b = append(b, byte(128+r/64%64))
+		return append(b, byte(128+r%64))
+	}
+	b = append(b, byte(240+r/262144))
+	b = append(b, byte(128+r/4096%64))
+	b = append(b, byte(128+r/64%64))
+	return append(b, byte(128+r%64))
+}
+
+// appendPadded appends s cut to the precision and padded to the width of spec
+func appendPadded(b []byte, spec string, s string) []byte {
+	var minus bool
+	var zero bool
+	var width int
+	var prec int = -1
+	var i int = 1
+	for i < len(spec) && !isDigit(spec[i]) && spec[i] != '.' {
+		if spec[i] == '-' {
+			minus = true
+		} else if spec[i] == '0' {
+			zero = true
+		}
+		i++
+	}
+	if i < len(spec) && spec[i] == '0' {
+		zero = true
+	}
+	for i < len(spec) && isDigit(spec[i]) {
+		width = width*10 + int(spec[i]) - '0'
+		i++
+	}
+	if i < len(spec) && spec[i] == '.' {
+		prec = 0
+		i++
+		for i < len(spec) && isDigit(spec[i]) {
+			prec = prec*10 + int(spec[i]) - '0'
+			i++
+		}
+	}
+	if prec >= 0 && prec < len(s) {
+		s = s[0:prec]
+	}
+	if minus {
+		b = appendString(b, s)
+	}
+	for n := len(s); n < width; n++ {
+		if zero && !minus {
+			b = append(b, '0')
+		} else {
+			b = append(b, ' ')
+		}
+	}
+	if !minus {
+		b = appendString(b, s)
+	}
 	return b
 }
+
+func appendString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		b = append(b, s[i])
+	}
+	return b
+}
+
+// formatC formats a value by libc
+func formatC(format string, arg interface{}) string {
+	var cstr int // formatted by libc into its own heap
+	n := asprintf(&cstr, format, *arg)
+	if n < 0 {
+		panic("ERROR: doPrintf failed to format:" + format)
+	}
+
+	// copy string to heap area
+	var buf []byte = makeSlice(n, n, 1)
+	memcpy(buf, cstr, n)
+	free(cstr)
+	return string(buf)
+}
+
+// cFormat makes integer verbs take 64 bit values like Go, e.g. "%5d" -> "%5ld".
+func cFormat(format string) string {
+	var b []byte
+	var inVerb bool
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if inVerb {
+			if c == 'd' || c == 'x' || c == 'X' || c == 'o' {
+				b = append(b, 'l')
+				inVerb = false
+			} else if !isFlagOrWidth(c) {
+				inVerb = false
+			}
+		} else if c == '%' {
+			inVerb = true
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func isFlagOrWidth(c byte) bool {
+	return isDigit(c) || c == '-' || c == '+' || c == ' ' || c == '#' || c == '.'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
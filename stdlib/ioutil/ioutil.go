@@ -1,17 +1,47 @@
 package ioutil
 
+import "os"
+
 const MYBUFSIZ = 65536 * 2
 const O_RDONLY = 0
 
+// ReadFile reads the whole file, growing the buffer as needed.
 func ReadFile(filename string) ([]byte, error) {
 	var fd int
 	var buf []byte
-	buf = makeSlice(MYBUFSIZ, MYBUFSIZ, 24)
+	buf = makeSlice(MYBUFSIZ, MYBUFSIZ, 1)
 	fd = open(filename, O_RDONLY)
-	var nbtyes int
-	nbtyes = read(fd, buf, MYBUFSIZ)
+	var n int
+	for {
+		if n == len(buf) {
+			var bigger []byte = makeSlice(len(buf)*2, len(buf)*2, 1)
+			memcpy(bigger, buf, n)
+			buf = bigger
+		}
+		var nbytes int
+		nbytes = libcInt(read(fd, buf[n:len(buf)], len(buf)-n))
+		if nbytes <= 0 {
+			break
+		}
+		n = n + nbytes
+	}
+	close(fd)
 	var buf2 []byte
-	buf2 = buf[0:nbtyes:nbtyes]
-	// @TODO set len of buf
+	buf2 = buf[0:n:n]
 	return buf2,nil
 }
+
+// TempDir creates a new directory whose name begins with pattern in dir,
+// or in /tmp if dir is empty.
+func TempDir(dir string, pattern string) (string, error) {
+	if dir == "" {
+		dir = "/tmp"
+	}
+	// mkdtemp replaces the last six X in place
+	template := []byte(dir + "/" + pattern + "XXXXXX")
+	template = append(template, 0)
+	if mkdtemp(template) == 0 {
+		return "", &os.PathError{Op: "mkdtemp", Path: dir}
+	}
+	return string(template[0 : len(template)-1]), nil
+}
@@ -1,5 +1,11 @@
 package os
 
+var Args []string
+
+var Stdin *File = &File{
+	id: 0,
+}
+
 var Stdout *File = &File{
 	id: 1,
 }
@@ -10,17 +16,157 @@ var Stderr *File = &File{
 
 // File represents an open file descriptor.
 type File struct {
-	id int
+	id   int
+	name string
 }
 
 func (f *File) Write(b []byte) (int, error) {
 	var fid int = f.id
 	var n int
-	n = write(fid, string(b), len(b))
+	n = write(fid, b, len(b))
 	return n,nil
 }
 
+// Read reads up to len(b) bytes from the file.
+func (f *File) Read(b []byte) (int, error) {
+	var n int = libcInt(read(f.id, b, len(b)))
+	if n < 0 {
+		return 0, &PathError{Op: "read", Path: f.name}
+	}
+	return n, nil
+}
+
+// Close closes the file descriptor.
+func (f *File) Close() error {
+	if libcInt(close(f.id)) < 0 {
+		return &PathError{Op: "close"}
+	}
+	return nil
+}
+
+// O_WRONLY|O_CREATE|O_TRUNC
+const flagsCreate = 577
+
+// the offset of d_name in struct dirent
+const direntNameOffset = 19
+
+// Open opens the named file for reading.
+func Open(name string) (*File, error) {
+	var fd int = libcInt(open(name, 0))
+	if fd < 0 {
+		return nil, &PathError{Op: "open", Path: name}
+	}
+	return &File{id: fd, name: name}, nil
+}
+
+// Readdirnames reads the names of all the entries of the directory
+// except "." and "..". n is ignored.
+func (f *File) Readdirnames(n int) ([]string, error) {
+	var names []string
+	var dir int = opendir(f.name)
+	if dir == 0 {
+		return nil, &PathError{Op: "readdirent", Path: f.name}
+	}
+	for {
+		var ent int = readdir(dir)
+		if ent == 0 {
+			break
+		}
+		var namelen int = strlen(ent + direntNameOffset)
+		var buf []byte = makeSlice(namelen, namelen, 1)
+		memcpy(buf, ent+direntNameOffset, namelen)
+		name := string(buf)
+		if name != "." && name != ".." {
+			names = append(names, name)
+		}
+	}
+	closedir(dir)
+	return names, nil
+}
+
+// Getwd returns the absolute path of the current directory.
+func Getwd() (string, error) {
+	var buf []byte = makeSlice(4096, 4096, 1)
+	if getcwd(buf, len(buf)) == 0 {
+		return "", &PathError{Op: "getwd", Path: "."}
+	}
+	return string(buf[0:strlen(buf)]), nil
+}
+
+// Create creates or truncates the named file with mode 0666.
+func Create(name string) (*File, error) {
+	var fd int = libcInt(open(name, flagsCreate, 438))
+	if fd < 0 {
+		return nil, &PathError{Op: "open", Path: name}
+	}
+	return &File{id: fd, name: name}, nil
+}
+
+// Remove removes the named file or empty directory.
+func Remove(name string) error {
+	if libcInt(remove(name)) < 0 {
+		return &PathError{Op: "remove", Path: name}
+	}
+	return nil
+}
+
+// Rename renames (moves) oldpath to newpath, replacing newpath if it exists.
+func Rename(oldpath string, newpath string) error {
+	if libcInt(rename(oldpath, newpath)) < 0 {
+		return &PathError{Op: "rename", Path: oldpath}
+	}
+	return nil
+}
+
+// A FileMode represents the permission bits of a file.
+type FileMode int
+
+// MkdirAll creates a directory named path along with any necessary parents.
+// It does nothing if path is already a directory.
+func MkdirAll(path string, perm FileMode) error {
+	for i := 1; i <= len(path); i++ {
+		if i == len(path) || path[i] == '/' {
+			// a parent which exists makes mkdir fail, which is fine
+			mkdir(path[0:i], int(perm))
+		}
+	}
+	var dir int = opendir(path)
+	if dir == 0 {
+		return &PathError{Op: "mkdir", Path: path}
+	}
+	closedir(dir)
+	return nil
+}
+
+// Getenv returns the value of the environment variable key, or "" if it is not set.
+func Getenv(key string) string {
+	var p int = getenv(key)
+	if p == 0 {
+		return ""
+	}
+	var n int = strlen(p)
+	var buf []byte = makeSlice(n, n, 1)
+	memcpy(buf, p, n)
+	return string(buf)
+}
+
+// PathError records an error and the operation and file path that caused it.
+type PathError struct {
+	Op   string
+	Path string
+}
+
+func (e *PathError) Error() string {
+	return e.Op + " " + e.Path + ": failed"
+}
+
+// Getpid returns the process id of the caller.
+func Getpid() int {
+	return libcInt(getpid())
+}
+
 func Exit(i int) {
+	exit(i)
 }
 
 func init() {
@@ -16,3 +16,20 @@ type Func struct {
 func (f *Func) Name() string {
 	return ""
 }
+
+// GC runs a garbage collection.
+func GC() {
+	gc()
+}
+
+// MemStats records statistics about the memory allocator.
+type MemStats struct {
+	HeapAlloc int // bytes of allocated heap objects
+	NumGC     int // the number of completed collections
+}
+
+// ReadMemStats populates m with memory allocator statistics.
+func ReadMemStats(m *MemStats) {
+	m.HeapAlloc = heapAlloc
+	m.NumGC = numGC
+}
@@ -9,6 +9,28 @@ func HasSuffix(s string, suffix string) bool {
 	return false
 }
 
+// HasPrefix tests whether the string s begins with prefix.
+func HasPrefix(s string, prefix string) bool {
+	return len(s) >= len(prefix) && s[0:len(prefix)] == prefix
+}
+
+// TrimSpace returns s without leading and trailing spaces, tabs and newlines.
+func TrimSpace(s string) string {
+	var start int = 0
+	var end int = len(s)
+	for start < end && isSpace(s[start]) {
+		start++
+	}
+	for end > start && isSpace(s[end-1]) {
+		end--
+	}
+	return s[start:end]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
 // Contains reports whether substr is within s.
 func Contains(s string, substr string) bool {
 	return Index(s, substr) >= 0
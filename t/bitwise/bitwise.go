@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+const mask int = 1<<32 - 1
+
+const flags int = 1<<3 | 1<<1
+
+var table []int = []int{0x0f & 0x3c, 0x0f | 0x30, 0x0f ^ 0x3c, 0x0f &^ 0x05}
+
+// rotr rotates a 32 bit word to the right
+func rotr(x int, n int) int {
+	return (x>>n | x<<(32-n)) & mask
+}
+
+func operators() {
+	a := 0x5a
+	b := 0x0f
+	fmt.Printf("%d %d %d %d\n", a&b, a|b, a^b, a&^b)
+	fmt.Printf("%d %d\n", a<<4, a>>3)
+	fmt.Printf("%d %d\n", table[0]+table[1], table[2]-table[3])
+	fmt.Printf("%d %d\n", mask, flags)
+}
+
+// shifts bind tighter than + and &, and | with +
+func precedence() {
+	x := 3
+	fmt.Printf("%d\n", 1+x<<2)
+	fmt.Printf("%d\n", x&1+2)
+	fmt.Printf("%d\n", x|4+1)
+	if x^1 == 2 {
+		fmt.Printf("x^1 == 2\n")
+	}
+}
+
+func shifts() {
+	n := -16
+	fmt.Printf("%d %d\n", n>>2, n<<1)
+	var big int = 64
+	one := 1
+	fmt.Printf("%d %d %d\n", one<<big, n>>big, one<<63>>63)
+	fmt.Printf("%d %d\n", rotr(1, 1), rotr(0x80000001, 4))
+}
+
+func bytes() {
+	var c byte = 'a'
+	var upper byte = c &^ 0x20
+	fmt.Printf("%c %d\n", upper, c>>4)
+}
+
+func main() {
+	operators()
+	precedence()
+	shifts()
+	bytes()
+}
@@ -0,0 +1,6 @@
+package main
+
+// ignored for its name
+func platform() string {
+	return "ignored"
+}
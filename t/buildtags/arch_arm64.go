@@ -0,0 +1,5 @@
+package main
+
+func arch() string {
+	return "arm64"
+}
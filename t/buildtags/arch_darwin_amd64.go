@@ -0,0 +1,5 @@
+package main
+
+func arch() string {
+	return "darwin/amd64"
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("platform=%s\n", platform())
+	fmt.Printf("arch=%s\n", arch())
+	fmt.Printf("tagged=%s\n", tagged())
+	fmt.Printf("double=%d\n", double(21))
+	fmt.Printf("release=%s\n", release())
+}
@@ -0,0 +1,5 @@
+package main
+
+// a second main if test files were built
+func main() {
+}
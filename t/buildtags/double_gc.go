@@ -0,0 +1,11 @@
+//go:build !minigo
+
+package main
+
+// minigo does not compile closures
+func double(x int) int {
+	f := func(y int) int {
+		return y * 2
+	}
+	return f(x)
+}
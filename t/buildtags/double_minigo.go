@@ -0,0 +1,7 @@
+//go:build minigo
+
+package main
+
+func double(x int) int {
+	return x * 2
+}
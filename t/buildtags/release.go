@@ -0,0 +1,7 @@
+//go:build go1.10
+
+package main
+
+func release() string {
+	return "go1.10"
+}
@@ -0,0 +1,8 @@
+//go:build go1.99
+
+package main
+
+// a release which minigo does not know yet
+func release() string {
+	return "go1.99"
+}
@@ -0,0 +1,9 @@
+// Copyright notice
+
+//go:build linux && (amd64 || arm64) && !windows
+
+package main
+
+func tagged() string {
+	return "linux"
+}
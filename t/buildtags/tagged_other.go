@@ -0,0 +1,7 @@
+//go:build !linux || ignore
+
+package main
+
+func tagged() string {
+	return "other"
+}
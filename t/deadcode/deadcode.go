@@ -0,0 +1,86 @@
+package main
+
+import "fmt"
+
+type shape interface {
+	area() int
+	name() string
+}
+
+type square struct {
+	side int
+}
+
+type rect struct {
+	w int
+	h int
+}
+
+// never converted to shape
+type circle struct {
+	r int
+}
+
+func (s *square) area() int {
+	return s.side * s.side
+}
+
+func (s *square) name() string {
+	return "square"
+}
+
+// not called through the interface
+func (s *square) perimeter() int {
+	return 4 * s.side
+}
+
+func (r *rect) area() int {
+	return r.w * r.h
+}
+
+func (r *rect) name() string {
+	return "rect"
+}
+
+func (c *circle) area() int {
+	return 3 * c.r * c.r
+}
+
+func (c *circle) name() string {
+	return "circle"
+}
+
+func unused() string {
+	return unusedToo("this string is never emitted")
+}
+
+func unusedToo(s string) string {
+	fmt.Printf("%s\n", s)
+	return s
+}
+
+func report(s string) {
+	fmt.Printf("report %s\n", s)
+}
+
+func deferred() {
+	fmt.Printf("deferred\n")
+}
+
+func total(shapes []shape) int {
+	var sum int
+	for _, s := range shapes {
+		fmt.Printf("%s %d\n", s.name(), s.area())
+		sum = sum + s.area()
+	}
+	return sum
+}
+
+func main() {
+	defer deferred()
+	shapes := []shape{&square{side: 2}, &rect{w: 2, h: 3}}
+	fmt.Printf("total %d\n", total(shapes))
+	c := &circle{r: 1}
+	fmt.Printf("circle %d\n", c.area())
+	report("done")
+}
@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x int
+	y int
+}
+
+var origin point
+
+func (p *point) String() string {
+	return fmt.Sprintf("(%d,%d)", p.x, p.y)
+}
+
+func greet(name string, times int) {
+	words := []string{"hello", name}
+	for i := 0; i < times; i++ {
+		fmt.Printf("%s %s\n", words[0], words[1])
+	}
+}
+
+func counter() *int {
+	count := 10
+	return &count
+}
+
+func main() {
+	p := &point{x: 1, y: 2}
+	greet(p.String(), 2)
+	c := counter()
+	if *c > 5 {
+		fmt.Printf("%d\n", *c)
+	} else {
+		fmt.Printf("small\n")
+	}
+	fmt.Printf("%d\n", origin.x)
+}
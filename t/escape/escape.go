@@ -0,0 +1,94 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x int
+	y int
+}
+
+type node struct {
+	val  int
+	next *node
+}
+
+var global *point
+
+// the literal is returned to the caller
+func newPoint(x int, y int) *point {
+	return &point{x: x, y: y}
+}
+
+// the pointer is only read
+func sum(p *point) int {
+	return p.x + p.y
+}
+
+// the local is kept by the caller after the function returns
+func counter() *int {
+	var n int = 10
+	return &n
+}
+
+// the param is stored in a global variable
+func keep(p *point) {
+	global = p
+}
+
+func stackLiterals() {
+	p := &point{x: 1, y: 2}
+	fmt.Printf("%d\n", sum(p))
+	q := new(point)
+	q.x = 3
+	fmt.Printf("%d\n", sum(q))
+	s := []int{4, 5, 6}
+	fmt.Printf("%d\n", s[0]+s[1]+s[2])
+}
+
+func heapLiterals() {
+	p := newPoint(7, 8)
+	keep(&point{x: 9, y: 10})
+	fmt.Printf("%d %d\n", sum(p), sum(global))
+}
+
+// each iteration needs its own copy of v
+func loopAddresses() {
+	var list *node
+	for i := 0; i < 3; i++ {
+		var v node = node{val: i}
+		v.next = list
+		list = &v
+	}
+	for n := list; n != nil; n = n.next {
+		fmt.Printf("%d\n", n.val)
+	}
+}
+
+// a local literal kept across the iterations of a loop
+func loopLiterals() {
+	var last *point
+	for i := 0; i < 3; i++ {
+		p := &point{x: i}
+		if last != nil {
+			fmt.Printf("%d->%d\n", last.x, p.x)
+		}
+		last = p
+	}
+}
+
+func addressOfParam(n int) *int {
+	return &n
+}
+
+func main() {
+	stackLiterals()
+	heapLiterals()
+	p := counter()
+	*p = *p + 1
+	fmt.Printf("%d\n", *p)
+	loopAddresses()
+	loopLiterals()
+	a := addressOfParam(11)
+	b := addressOfParam(12)
+	fmt.Printf("%d %d\n", *a, *b)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	for i, arg := range os.Args {
+		if i > 0 {
+			fmt.Printf("%s\n", arg)
+		}
+	}
+	os.Exit(3)
+	fmt.Printf("not reached\n")
+}
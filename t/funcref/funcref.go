@@ -3,12 +3,12 @@ package main
 import "fmt"
 
 func sum(a int, b int) int {
-	fmt.Printf("%d\n", sum)
+	fmt.Printf("%p\n", sum)
 	return a + b
 }
 
 func main() {
-	fmt.Printf("%d\n", sum)
+	fmt.Printf("%p\n", sum)
 	s := sum(1, 2)
 	fmt.Printf("%d\n", s)
 }
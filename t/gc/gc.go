@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type node struct {
+	id   int
+	name string
+	next *node
+}
+
+// keep builds a list that must survive every collection
+func keep(n int) *node {
+	var head *node
+	for i := 0; i < n; i++ {
+		head = &node{
+			id:   i,
+			name: fmt.Sprintf("node%d", i),
+			next: head,
+		}
+	}
+	return head
+}
+
+func sum(head *node) int {
+	var total int
+	for p := head; p != nil; p = p.next {
+		total = total + p.id
+	}
+	return total
+}
+
+// garbage allocates far more than it keeps
+func garbage() {
+	var s []int
+	for i := 0; i < 1000; i++ {
+		s = nil
+		for j := 0; j < 50000; j++ {
+			s = append(s, j)
+		}
+	}
+	fmt.Printf("%d\n", len(s))
+}
+
+func f1() {
+	head := keep(1000)
+	garbage()
+	runtime.GC()
+	fmt.Printf("%d\n", sum(head))
+	fmt.Printf("%s %s\n", head.name, head.next.next.name)
+}
+
+func f2() {
+	m := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		m[fmt.Sprintf("k%d", i)] = fmt.Sprintf("v%d", i)
+	}
+	runtime.GC()
+	garbage()
+	fmt.Printf("%s %s\n", m["k0"], m["k999"])
+}
+
+func f3() {
+	var b []byte
+	for i := 0; i < 3000; i++ {
+		b = append(b, 'a')
+	}
+	s := fmt.Sprintf("[%s]", string(b))
+	fmt.Printf("%d %c %c\n", len(s), s[0], s[3001])
+}
+
+func main() {
+	f1()
+	f2()
+	f3()
+}
@@ -0,0 +1,89 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x int
+	y int
+}
+
+type named interface {
+	name() string
+}
+
+func (p *point) name() string {
+	return fmt.Sprintf("(%d,%d)", p.x, p.y)
+}
+
+// initialized after the variables they refer to
+var total = sum(scores)
+var scores = map[string]int{
+	"alice": base + 1,
+	"bob":   base * 2,
+}
+var base = twice(5)
+
+var greeting = "hello, " + who
+var who string = "world"
+
+var origin = point{x: twice(1), y: -3}
+var ptr = &point{x: base, y: total}
+var pts = []*point{ptr, &origin}
+var shape named = ptr
+var counter = next()
+var lines []string = split("a,b,c")
+
+// static data
+var static = [3]int{1, 2, 3}
+var originRef = &origin
+var nothing *point = nil
+
+var calls int
+
+func twice(n int) int {
+	calls++
+	return n * 2
+}
+
+func sum(m map[string]int) int {
+	return m["alice"] + m["bob"]
+}
+
+func next() int {
+	calls++
+	return calls
+}
+
+func split(s string) []string {
+	var r []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == ',' {
+			r = append(r, s[start:i])
+			start = i + 1
+		}
+	}
+	r = append(r, s[start:len(s)])
+	return r
+}
+
+func init() {
+	// the variables have been initialized
+	fmt.Printf("init %d %d\n", base, counter)
+}
+
+func main() {
+	fmt.Printf("%d %d %d\n", base, scores["alice"], scores["bob"])
+	fmt.Printf("%d\n", total)
+	fmt.Printf("%s\n", greeting)
+	fmt.Printf("%d %d\n", origin.x, origin.y)
+	fmt.Printf("%d %d\n", ptr.x, ptr.y)
+	fmt.Printf("%d %d\n", len(pts), pts[1].y)
+	fmt.Printf("%s\n", shape.name())
+	fmt.Printf("%d %d\n", counter, calls)
+	fmt.Printf("%d %s %s\n", len(lines), lines[0], lines[2])
+	fmt.Printf("%d %d\n", static[2], originRef.y)
+	if nothing == nil {
+		fmt.Printf("nil\n")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type block struct {
+	buf [16384]byte
+}
+
+// only the last block is live
+var live *block
+
+func main() {
+	for i := 0; i < 20000; i++ {
+		live = new(block)
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	if m.NumGC > 0 {
+		fmt.Printf("collected\n")
+	} else {
+		fmt.Printf("not collected\n")
+	}
+	// 20000 blocks are 320MB
+	if m.HeapAlloc < 64*1024*1024 {
+		fmt.Printf("bounded\n")
+	} else {
+		fmt.Printf("unbounded\n")
+	}
+	fmt.Printf("%d\n", len(live.buf))
+}
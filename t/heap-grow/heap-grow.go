@@ -0,0 +1,50 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x int
+	y int
+}
+
+// live data spans several arenas
+func f1() {
+	var s []int
+	for i := 0; i < 10000000; i++ {
+		s = append(s, i)
+	}
+	var total int
+	for _, v := range s {
+		total = total + v
+	}
+	fmt.Printf("%d %d\n", len(s), total)
+}
+
+// memory is zero when it is reused
+func f2() {
+	for i := 0; i < 100000; i++ {
+		p := &point{}
+		if p.x != 0 || p.y != 0 {
+			fmt.Printf("not zero\n")
+			return
+		}
+		p.x = i
+		p.y = i
+	}
+	var ps []*point
+	for i := 0; i < 1000; i++ {
+		ps = append(ps, &point{x: i, y: i * 2})
+	}
+	fmt.Printf("%d %d\n", ps[999].x, ps[999].y)
+}
+
+func f3() {
+	var big int = 1099511627776
+	fmt.Printf("%d %x %5d|%-5d|\n", big, big, 42, 42)
+}
+
+func main() {
+	f1()
+	f2()
+	f3()
+}
@@ -3,23 +3,21 @@ package main
 import "fmt"
 
 func main() {
-	var heapHead *int
-	var heapTail *int
-
 	var address *int
 
-	address = malloc(8)
+	address = new(int)
 	*address = 1
 	fmt.Printf("%d\n", *address)
-	address = malloc(8)
+	address = new(int)
 	*address = 2
 	fmt.Printf("%d\n", *address)
-	address = malloc(8)
+	address = new(int)
 	*address = 3
 	fmt.Printf("%d\n", *address)
 
-	heapA := malloc(8)
-	heapB := malloc(0)
-
-	fmt.Printf("%d\n", (heapB-heapA)-4) // 4
+	heapA := new(int)
+	heapB := new(int)
+	*heapA = 4
+	*heapB = 5
+	fmt.Printf("%d\n", *heapA) // 4
 }
@@ -0,0 +1,111 @@
+package main
+
+import "fmt"
+
+type kind string
+
+const kindPunct kind = "punct"
+
+type token struct {
+	typ  kind
+	sval string
+	line int
+}
+
+type celsius int
+
+type point struct {
+	x int
+	y int
+}
+
+var calls int
+var origin point
+
+func (tok *token) isPunct(s string) bool {
+	return tok != nil && tok.typ == kindPunct && tok.sval == s
+}
+
+func (tok *token) getLine() int {
+	return tok.line
+}
+
+func (p *point) dist() int {
+	return abs(p.x) + abs(p.y)
+}
+
+func (c celsius) fahrenheit() int {
+	return int(c)*9/5 + 32
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func add(a int, b int) int {
+	return a + b
+}
+
+func first(s string) byte {
+	return s[0]
+}
+
+func size(s []int) int {
+	return len(s)
+}
+
+func isOrigin(p *point) bool {
+	return p == &origin
+}
+
+func bool2int(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//go:noinline
+func twice(n int) int {
+	return n * 2
+}
+
+// the args are evaluated once and in order
+func next() int {
+	calls++
+	return calls
+}
+
+// scalar functions are lowered into the IR with the calls inlined
+func scaled(n int) int {
+	return add(twice(n), add(n, 1))
+}
+
+func main() {
+	tok := &token{typ: kindPunct, sval: "(", line: 3}
+	fmt.Printf("%d %d\n", bool2int(tok.isPunct("(")), bool2int(tok.isPunct(")")))
+	var none *token
+	fmt.Printf("%d\n", bool2int(none.isPunct("(")))
+	fmt.Printf("%d\n", tok.getLine()+add(1, 2))
+
+	fmt.Printf("%d\n", add(next(), next()*10))
+	fmt.Printf("%d\n", calls)
+
+	p := &point{x: -3, y: 4}
+	fmt.Printf("%d\n", p.dist())
+	var c celsius = 100
+	fmt.Printf("%d\n", c.fahrenheit())
+	fmt.Printf("%c\n", first("inline"))
+	fmt.Printf("%d\n", size([]int{1, 2, 3}))
+	fmt.Printf("%d %d\n", bool2int(isOrigin(&origin)), bool2int(isOrigin(p)))
+	fmt.Printf("%d\n", scaled(5))
+
+	x := 7
+	y := add(x, add(x, 1))
+	fmt.Printf("%d\n", y)
+	s := "ab"
+	fmt.Printf("%d\n", add(len(s), int(first(s))))
+}
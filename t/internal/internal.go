@@ -4,5 +4,4 @@ import "fmt"
 
 func main() {
 	fmt.Printf("hello world\n")
-	fmt.Printf("MiniGo=%d\n", MiniGo)
 }
@@ -0,0 +1,180 @@
+package main
+
+import "fmt"
+
+type counter struct {
+	n     int
+	limit int
+	next  *counter
+}
+
+var total int
+
+// the loop counter and the sum are merged by phis
+func sum(n int) int {
+	s := 0
+	for i := 1; i <= n; i++ {
+		s = s + i
+	}
+	return s
+}
+
+// constants are folded and the dead branch is removed
+func folded() int {
+	const width = 8
+	x := width * 4
+	if x > 100 {
+		return 0
+	}
+	return x + 2
+}
+
+// a + b is computed once
+func common(a int, b int) int {
+	c := (a + b) * 2
+	d := (b + a) * 3
+	return c + d
+}
+
+func classify(n int) int {
+	switch n {
+	case 0:
+		return 10
+	case 1, 2:
+		return 20
+	}
+	if n < 0 && n > -10 || n == 100 {
+		return 30
+	}
+	return 40
+}
+
+func find(c *counter, n int) *counter {
+	for c != nil {
+		if c.n == n {
+			break
+		}
+		c = c.next
+	}
+	return c
+}
+
+func (c *counter) incr() bool {
+	if c.n >= c.limit {
+		return false
+	}
+	c.n++
+	total += c.n
+	return true
+}
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+func swap(a int, b int) int {
+	for i := 0; i < 3; i++ {
+		a, b = b, a
+	}
+	return a*10 + b
+}
+
+func skipOdd(n int) int {
+	var count int
+	i := 0
+	for {
+		i++
+		if i > n {
+			break
+		}
+		if i%2 == 1 {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+func twice(x int) int {
+	return x * 2
+}
+
+// more values are live across the calls than there are registers
+func spill(n int) int {
+	a := n + 1
+	b := n + 2
+	c := n + 3
+	d := n + 4
+	e := n + 5
+	f := n + 6
+	g := n + 7
+	h := n + 8
+	i := n + 9
+	j := n + 10
+	k := n + 11
+	l := n + 12
+	m := twice(a + l)
+	o := twice(m)
+	return a + b + c + d + e + f + g + h + i + j + k + l + m + o
+}
+
+// several results are returned in registers
+func divmod(a int, b int) (int, int) {
+	return a / b, a % b
+}
+
+func order(a int, b int) (int, int) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+func reorder(a int, b int) (int, int) {
+	return order(b, a)
+}
+
+// emitted from the AST because of the defer
+func deferred(n int) (int, bool) {
+	defer twice(n)
+	return n + 1, n > 0
+}
+
+// the results of calls are live across other calls
+func results(n int) int {
+	q, r := divmod(n, 7)
+	lo, hi := reorder(q, r)
+	_, half := divmod(hi, 2)
+	m, ok := deferred(lo)
+	if !ok {
+		return -1
+	}
+	return twice(q) + r*10 + lo*100 + hi*1000 + half*10000 + m*100000
+}
+
+func main() {
+	fmt.Printf("%d\n", sum(10))
+	fmt.Printf("%d\n", folded())
+	fmt.Printf("%d\n", common(3, 4))
+	fmt.Printf("%d %d %d\n", classify(0), classify(2), classify(-5))
+	fmt.Printf("%d %d\n", classify(100), classify(7))
+
+	c := &counter{n: 1, limit: 3}
+	c.next = &counter{n: 2, limit: 5}
+	fmt.Printf("%d\n", find(c, 2).limit)
+	if find(c, 3) == nil {
+		fmt.Printf("not found\n")
+	}
+	for c.incr() {
+	}
+	fmt.Printf("%d %d\n", c.n, total)
+
+	fmt.Printf("%d\n", fib(15))
+	fmt.Printf("%d\n", swap(1, 2))
+	fmt.Printf("%d\n", skipOdd(9))
+	fmt.Printf("%d\n", spill(1))
+	fmt.Printf("%d\n", results(65))
+}
@@ -0,0 +1,53 @@
+package main
+
+import "fmt"
+
+const mask int = 0xff
+
+func integers() {
+	fmt.Printf("%d\n", 0x1F)
+	fmt.Printf("%d\n", 0x1f)
+	fmt.Printf("%d\n", 0o17)
+	fmt.Printf("%d\n", 0o17)
+	fmt.Printf("%d\n", 017)
+	fmt.Printf("%d\n", 0b101)
+	fmt.Printf("%d\n", 0b101)
+	fmt.Printf("%d\n", 1_000_000)
+	fmt.Printf("%d\n", 0x_7fff_ffff)
+	fmt.Printf("%d\n", 0_600)
+	fmt.Printf("%d\n", 0)
+	fmt.Printf("%d\n", mask)
+	var array [0x3]int
+	fmt.Printf("%d\n", len(array))
+}
+
+func escapes() {
+	s := "\a\b\f\n\r\t\v\\\"'"
+	for i := 0; i < len(s); i++ {
+		var c byte = s[i]
+		fmt.Printf("%d ", c)
+	}
+	fmt.Printf("\n")
+	fmt.Printf("%s\n", "\101\x42C")
+	fmt.Printf("%d\n", len("é\U0001F600"))
+	fmt.Printf("%s\n", "\xe3\x81\x82")
+	fmt.Printf("%s\n", `a\nb`)
+}
+
+func runes() {
+	fmt.Printf("%d\n", '\a')
+	fmt.Printf("%d\n", '\v')
+	fmt.Printf("%d\n", '\'')
+	fmt.Printf("%d\n", '"')
+	fmt.Printf("%d\n", '\377')
+	fmt.Printf("%d\n", '\xff')
+	fmt.Printf("%d\n", 'é')
+	fmt.Printf("%d\n", '\U0001F600')
+	fmt.Printf("%d\n", 'é')
+}
+
+func main() {
+	integers()
+	escapes()
+	runes()
+}
@@ -0,0 +1,29 @@
+package greet
+
+import (
+	"fmt"
+
+	"example.com/modules/text"
+)
+
+// the number of greetings
+var count int
+
+// Greeter greets with a word
+type Greeter struct {
+	Word string
+}
+
+func (g *Greeter) Greet(name string) string {
+	count++
+	return text.Line(g.Word + ", " + name)
+}
+
+// Count returns the number of greetings so far
+func Count() int {
+	return count
+}
+
+func init() {
+	fmt.Printf("init greet %s\n", text.Line("after text"))
+}
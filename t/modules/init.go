@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+// the init functions of a package run in the order of the files and declarations
+func init() {
+	fmt.Printf("init main 1\n")
+}
+
+func init() {
+	fmt.Printf("init main 1 again\n")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"example.com/modules/greet"
+	"example.com/modules/text"
+)
+
+var count int = 100
+
+func init() {
+	// the packages which main imports are initialized before
+	fmt.Printf("init main 2 %d\n", len(os.Args))
+}
+
+func main() {
+	g := &greet.Greeter{Word: "hello"}
+	fmt.Printf("%s\n", g.Greet("gopher"))
+	fmt.Printf("%s\n", g.Greet("world"))
+	fmt.Printf("%s\n", text.Line("bye"))
+	count++
+	fmt.Printf("%d %d %d\n", greet.Count(), text.Count(), count)
+	fmt.Printf("%s\n", text.Prefix)
+}
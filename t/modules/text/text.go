@@ -0,0 +1,24 @@
+package text
+
+import "fmt"
+
+// Prefix is put before every line
+const Prefix string = "> "
+
+// the number of lines made by this package
+var count int
+
+// Line decorates a line and counts it
+func Line(s string) string {
+	count++
+	return Prefix + s
+}
+
+// Count returns the number of lines made so far
+func Count() int {
+	return count
+}
+
+func init() {
+	fmt.Printf("init text\n")
+}
@@ -6,15 +6,13 @@ import (
 )
 
 const MYBUFSIZ = 1024
-const O_RDONLY = 0
 
 var buf [1024]byte
 
 func main() {
-	var fd int
-
 	fname := os.Args[1]
-	fd = open(fname, O_RDONLY)
-	read(fd, buf, MYBUFSIZ)
-	fmt.Printf("%s", buf)
+	f, _ := os.Open(fname)
+	n, _ := f.Read(buf[0:MYBUFSIZ])
+	fmt.Printf("%s", buf[0:n])
+	f.Close()
 }
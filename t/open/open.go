@@ -1,26 +1,35 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
 
-const O_RDONLY = 0
+func f1() error {
+	f, err := os.Open("t/min/min.go")
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
 
-func f1() int {
-	var fd int
-	fd = open("t/min/min.go", O_RDONLY)
-	return fd
+func f2() error {
+	_, err := os.Open("/var/noexists.txt")
+	return err
 }
 
-func f2() int {
-	var fd int
-	fd = open("/var/noexists.txt", O_RDONLY)
-	return fd
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
 }
 
 func main() {
-	var fd int
-	fd = f1()
-	fmt.Printf("%d\n", fd) // 3
+	var err error
+	err = f1()
+	fmt.Printf("%s\n", result(err)) // ok
 
-	fd = f2()
-	fmt.Printf("%d\n", fd) // -1
+	err = f2()
+	fmt.Printf("%s\n", result(err)) // error
 }
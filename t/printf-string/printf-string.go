@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+type name string
+
+func main() {
+	s := "ab\x00cd"
+	fmt.Printf("%s|\n", s)
+	t := fmt.Sprintf("[%s]", s)
+	fmt.Printf("%d %s\n", len(t), t)
+	fmt.Printf("%d\n", len(fmt.Sprintf("%s%s", s, s)))
+
+	// width and precision count bytes
+	fmt.Printf("[%8s][%-8s][%.3s][%5.1s]\n", s, s, s, s)
+	fmt.Printf("[%3s][%-3s][%03s]\n", "x", "y", "z")
+
+	var n name = "minigo"
+	fmt.Printf("%s %d %s\n", n, 42, "end")
+	fmt.Printf("%s %s %s %s %s %s\n", "more", "than", "four", "arguments", "are", "formatted")
+	fmt.Printf("%5d|%-5d|%05d|%x|%c\n", 42, 42, 42, 255, 'A')
+	fmt.Printf("100%%\n")
+}
@@ -0,0 +1,60 @@
+package main
+
+import "fmt"
+
+type name string
+
+type point struct {
+	x int
+}
+
+func main() {
+	// %v prints the value in the default format
+	var n name = "gopher"
+	var i int = 42
+	var c byte = 'A'
+	var p *int = &i
+	fmt.Printf("%v %v %v %v %v\n", "str", n, i, c, true)
+	fmt.Printf("[%5v][%-6v]\n", i, false)
+	var e interface{}
+	fmt.Printf("%v\n", e)
+	fmt.Printf("%v\n", p != nil)
+
+	// %T prints the type
+	var pt *point = &point{x: 1}
+	var bs []byte = []byte("hi")
+	var ss []string
+	fmt.Printf("%T %T %T %T %T\n", "s", n, i, c, true)
+	fmt.Printf("%T %T %T %T\n", pt, bs, ss, e)
+
+	// %t prints booleans
+	fmt.Printf("%t %t|\n", true, 1 > 2)
+
+	// %q quotes strings and characters
+	fmt.Printf("%q %q\n", "a\"b\\c\n\t\x01", n)
+	fmt.Printf("%q %q %q\n", 'x', '\n', 0x263a)
+	fmt.Printf("%q %x %X\n", "hi", "hi", "hi!")
+	fmt.Printf("%#v %#v %#v\n", "q", i, true)
+
+	// a []byte is printed like a string, and %v lists its bytes
+	fmt.Printf("%s %q %x %v [%4s]\n", bs, bs, bs, bs, bs)
+	var arr [3]byte = [3]byte{'a', 'b', 'c'}
+	fmt.Printf("%s %v %X\n", arr, arr, arr)
+	var x interface{} = bs
+	got := x.([]byte)
+	fmt.Printf("%d %s\n", len(got), got)
+
+	// %b prints binary numbers
+	fmt.Printf("%b %b %b [%6b]\n", 0, 5, -6, c)
+
+	// %U prints Unicode code points, and %c encodes them
+	fmt.Printf("%U %U %c%c\n", 'A', 0x263a, 0x263a, 'z')
+
+	// mismatches are reported in the output like Go
+	var args []interface{}
+	args = append(args, "str")
+	args = append(args, true)
+	args = append(args, i)
+	format := "%d %x %t|%s %d\n"
+	fmt.Printf(format, args...)
+}
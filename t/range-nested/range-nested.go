@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+var grid [][]int
+
+// continue and break refer to the outer loop after an inner range loop ends
+func sumUntil(limit int) int {
+	var sum int
+	for i := 0; i < len(grid); i++ {
+		for _, v := range grid[i] {
+			sum = sum + v
+		}
+		if sum < limit {
+			continue
+		}
+		break
+	}
+	return sum
+}
+
+func countRows(min int) int {
+	var n int
+	for _, row := range grid {
+		for _, v := range row {
+			if v > 100 {
+				break
+			}
+		}
+		if len(row) < min {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func main() {
+	var row1 []int = []int{1, 2, 3}
+	var row2 []int = []int{4, 5}
+	var row3 []int = []int{6}
+	grid = append(grid, row1)
+	grid = append(grid, row2)
+	grid = append(grid, row3)
+
+	fmt.Printf("%d %d\n", sumUntil(10), sumUntil(100))
+	fmt.Printf("%d %d\n", countRows(2), countRows(3))
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+var gslice []int = []int{1, 2, 3, 4}
+
+// s[lo:] is s[lo:len(s)] for a slice, and a[lo:len(a)] for an array
+func sliceTail() {
+	var s []int = []int{10, 11, 12, 13}
+	t := s[1:]
+	fmt.Printf("%d %d %d %d\n", len(t), cap(t), t[0], t[2])
+
+	// a slice shorter than its capacity
+	var short []int = s[0:2]
+	u := short[1:]
+	fmt.Printf("%d %d %d\n", len(u), cap(u), u[0])
+
+	// the tail of a tail
+	v := t[1:]
+	v = v[1:]
+	fmt.Printf("%d %d\n", len(v), v[0])
+
+	// the end of a slice
+	w := s[4:]
+	fmt.Printf("%d %d\n", len(w), cap(w))
+
+	g := gslice[2:]
+	fmt.Printf("%d %d\n", len(g), g[1])
+}
+
+func arrayTail() {
+	var a [5]int = [5]int{1, 2, 3, 4, 5}
+	b := a[2:]
+	b[0] = 30
+	fmt.Printf("%d %d %d %d\n", len(b), cap(b), b[2], a[2])
+}
+
+func tail(s []int) []int {
+	return s[1:]
+}
+
+// the same s[lo:] applied to slices of different lengths
+func paramTail() {
+	var s []int = []int{1, 2, 3}
+	for len(s) > 0 {
+		s = tail(s)
+		fmt.Printf("%d ", len(s))
+	}
+	fmt.Printf("\n")
+}
+
+func main() {
+	sliceTail()
+	arrayTail()
+	paramTail()
+}
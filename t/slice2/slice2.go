@@ -8,7 +8,7 @@ func f1() {
 		1,
 	}
 
-	r = append(r, 2)
+	r = append(r, args[0]+1)
 
 	fmt.Printf("%d\n", len(r))
 	fmt.Printf("%d\n", r[0])
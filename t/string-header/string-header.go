@@ -0,0 +1,130 @@
+package main
+
+import "fmt"
+
+type user struct {
+	name string
+	tags [2]string
+}
+
+// a string can hold NUL bytes because its length is stored in its header
+func f1() {
+	s := "a\x00b"
+	fmt.Printf("%d\n", len(s))
+	var c byte = s[2]
+	fmt.Printf("%c\n", c)
+
+	bytes := []byte(s)
+	fmt.Printf("%d\n", len(bytes))
+	s2 := string(bytes)
+	if s2 == s {
+		fmt.Printf("equal\n")
+	}
+	if s2 != "a" {
+		fmt.Printf("not equal\n")
+	}
+}
+
+// a substring shares the bytes of its original string
+func f2() {
+	s := "hello world"
+	hello := s[0:5]
+	world := s[6:]
+	fmt.Printf("%d %d\n", len(hello), len(world))
+	fmt.Printf("%s,%s\n", hello, world)
+	fmt.Printf("%s\n", hello+"!")
+	if hello == "hello" {
+		fmt.Printf("hello == \"hello\"\n")
+	}
+	if hello != "hell" {
+		fmt.Printf("hello != \"hell\"\n")
+	}
+}
+
+// conversions copy the bytes
+func f3() {
+	bytes := []byte{'a', 'b', 'c'}
+	s := string(bytes)
+	bytes[0] = 'x'
+	fmt.Printf("%s\n", s)
+
+	b2 := []byte(s)
+	b2[1] = 'y'
+	fmt.Printf("%s\n", s)
+}
+
+func f4() {
+	m := map[string]int{
+		"one": 1,
+		"two": 2,
+	}
+	key := "three"
+	m[key[0:3]] = 3
+	m["three"] = 33
+	fmt.Printf("%d %d %d %d\n", m["one"], m["two"], m["thr"], m["three"])
+
+	names := map[string]string{}
+	names["go"] = "gopher"
+	name, ok := names["go"]
+	fmt.Printf("%s %d\n", name, len(name))
+	if ok {
+		fmt.Printf("ok\n")
+	}
+	name, ok = names["rust"]
+	fmt.Printf("%d\n", len(name))
+	if !ok {
+		fmt.Printf("not ok\n")
+	}
+}
+
+func f5() {
+	var list []string
+	list = append(list, "x")
+	list = append(list, "yy")
+	list = append(list, "zzz")
+	for _, s := range list {
+		fmt.Printf("%s:%d ", s, len(s))
+	}
+	fmt.Printf("\n")
+}
+
+func f6() {
+	u := user{name: "alice"}
+	u.tags[1] = "admin"
+	fmt.Printf("%s %d %s %d\n", u.name, len(u.tags[0]), u.tags[1], len(u.name))
+
+	p := &u
+	p.name = "bob"
+	fmt.Printf("%s\n", u.name)
+}
+
+func kind(s string) string {
+	switch s {
+	case "a", "b":
+		return "ab"
+	case "c":
+		return "c"
+	}
+	return "other"
+}
+
+func f7() {
+	s := "abc"
+	fmt.Printf("%s %s %s\n", kind(s[0:1]), kind(s[2:]), kind(s))
+
+	var ifc interface{} = s[1:2]
+	str, ok := ifc.(string)
+	if ok {
+		fmt.Printf("%s %d\n", str, len(str))
+	}
+}
+
+func main() {
+	f1()
+	f2()
+	f3()
+	f4()
+	f5()
+	f6()
+	f7()
+}
@@ -0,0 +1,107 @@
+package main
+
+import "fmt"
+
+const kwFunc = "func"
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compare(a string, b string) {
+	fmt.Printf("%s %s ", a, b)
+	fmt.Printf("%d %d %d %d\n", b2i(a < b), b2i(a > b), b2i(a <= b), b2i(a >= b))
+}
+
+func f1() {
+	compare("abc", "abd")
+	compare("abd", "abc")
+	compare("abc", "abc")
+	compare("ab", "abc")
+	compare("abc", "ab")
+	compare("", "a")
+	compare("", "")
+	compare("Z", "a")
+	compare("\xff", "a")
+}
+
+func sortStrings(ss []string) {
+	for i := 0; i < len(ss); i++ {
+		for j := i + 1; j < len(ss); j++ {
+			if ss[j] < ss[i] {
+				tmp := ss[i]
+				ss[i] = ss[j]
+				ss[j] = tmp
+			}
+		}
+	}
+}
+
+func f2() {
+	idents := []string{"var", "func", "if", "else", "for", "fo", "", "break", "funcs"}
+	sortStrings(idents)
+	for _, s := range idents {
+		fmt.Printf("[%s]", s)
+	}
+	fmt.Printf("\n")
+}
+
+func keyword(s string) int {
+	switch s {
+	case "if", "for":
+		return 1
+	case kwFunc:
+		return 2
+	case "fun", "funk":
+		return 3
+	case "":
+		return 4
+	case "else":
+		return 5
+	default:
+		return 0
+	}
+}
+
+func keywordNoDefault(s string) string {
+	var r string = "none"
+	switch s {
+	case "abc":
+		r = "abc"
+	case "abd":
+		r = "abd"
+	}
+	return r
+}
+
+func f3() {
+	words := []string{"if", "for", "func", "fun", "funk", "", "else", "elsf", "x", "iff", "fo"}
+	for _, w := range words {
+		fmt.Printf("%s:%d ", w, keyword(w))
+	}
+	fmt.Printf("\n")
+	fmt.Printf("%s %s %s\n", keywordNoDefault("abc"), keywordNoDefault("abd"), keywordNoDefault("abe"))
+
+	var prefix string = "fu"
+	switch prefix + "nc" {
+	case kwFunc:
+		fmt.Printf("concat matches\n")
+	default:
+		fmt.Printf("concat does not match\n")
+	}
+
+	var other string = "for"
+	switch "for" {
+	case other:
+		fmt.Printf("variable case matches\n")
+	}
+}
+
+func main() {
+	f1()
+	f2()
+	f3()
+}
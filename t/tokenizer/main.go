@@ -25,7 +25,7 @@ func f3() {
 func f4() {
 	path := "t/min/min.go"
 	bs := NewByteStreamFromFile(path)
-	tokens := Tokenize(bs)
+	tokens, _ := Tokenize(bs)
 	fmt.Printf("%d\n", len(tokens)) // 26
 	fmt.Printf("----------\n")
 	for _, tok := range tokens {
@@ -38,7 +38,7 @@ func f5() {
 	path := "t/data/string.txt"
 	bs := NewByteStreamFromFile(path)
 
-	tokens := Tokenize(bs)
+	tokens, _ := Tokenize(bs)
 	tok := tokens[0]
 	fmt.Printf("----------\n")
 	fmt.Printf("[%s]\n", tok.sval)
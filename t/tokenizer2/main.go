@@ -8,7 +8,7 @@ var debugToken = false
 func f1() {
 	filename := "t/data/gen.go.txt"
 	bs := NewByteStreamFromFile(filename)
-	tokens := Tokenize(bs)
+	tokens, _ := Tokenize(bs)
 	expectedLen := 17977
 	if len(tokens) == expectedLen {
 		println("1")
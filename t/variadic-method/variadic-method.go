@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+type logger struct {
+	prefix string
+	lines  int
+}
+
+// the receiver is passed before the args,
+// so the variadic parameter is the third one here
+func (l *logger) logf(format string, args ...interface{}) {
+	l.lines++
+	fmt.Printf(l.prefix+format+"\n", args...)
+}
+
+func (l *logger) count(args ...interface{}) int {
+	return len(args)
+}
+
+func main() {
+	l := &logger{prefix: "log: "}
+	l.logf("none")
+	l.logf("one %d", 1)
+	l.logf("three %d %s %d", 2, "x", 4)
+
+	var args []interface{}
+	args = append(args, "a")
+	args = append(args, 5)
+	l.logf("spread %s %d", args...)
+	fmt.Printf("%d\n", l.lines)
+
+	fmt.Printf("%d %d %d\n", l.count(), l.count(1), l.count(1, "2", 3))
+}
@@ -1,16 +1,21 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
 
 func stdout_write() {
 	s := "hello world\n"
-	n := write(1, s, len(s))
+	var b []byte = []byte(s)
+	n, _ := os.Stdout.Write(b)
 	fmt.Printf("%d\n", n)
 }
 
 func stderr_write() {
 	s := "hello stderr\n"
-	n := write(2, s, len(s))
+	var b []byte = []byte(s)
+	n, _ := os.Stderr.Write(b)
 	fmt.Printf("%d\n", n)
 }
 
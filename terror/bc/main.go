@@ -0,0 +1,7 @@
+package main
+
+import "example.com/bc/x"
+
+func main() {
+	x.Hello()
+}
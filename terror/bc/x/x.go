@@ -0,0 +1,6 @@
+//go:build ignore
+
+package x
+
+func Hello() {
+}
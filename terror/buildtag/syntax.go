@@ -0,0 +1,6 @@
+//go:build linux && (amd64 ||
+
+package main
+
+func main() {
+}
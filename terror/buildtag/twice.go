@@ -0,0 +1,8 @@
+// a build constraint in a copyright header
+//go:build linux
+//go:build amd64
+
+package main
+
+func main() {
+}
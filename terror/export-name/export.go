@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	var s string = fmt.doPrintf("%d", 1)
+	fmt.Printf("%s\n", s)
+}
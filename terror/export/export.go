@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	f := os.Stdout
+	fmt.Printf("%d\n", f.id)
+	g := &os.File{id: 2}
+	fmt.Printf("%d\n", g.id)
+}
@@ -0,0 +1,13 @@
+package a
+
+const limit = 10
+
+var counter int
+
+func helper() int {
+	return counter + limit
+}
+
+func Helper() int {
+	return helper()
+}
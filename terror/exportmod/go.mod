@@ -0,0 +1,3 @@
+module example.com/exportmod
+
+go 1.12
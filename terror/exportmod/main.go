@@ -0,0 +1,12 @@
+package main
+
+import (
+	"example.com/exportmod/a"
+	"fmt"
+)
+
+func main() {
+	fmt.Printf("%d\n", a.Helper())
+	fmt.Printf("%d\n", a.helper())
+	fmt.Printf("%d %d\n", a.counter, a.limit)
+}
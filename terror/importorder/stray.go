@@ -0,0 +1,7 @@
+package main
+return
+import "fmt"
+
+func main() {
+	fmt.Printf("x\n")
+}
@@ -0,0 +1,12 @@
+package main
+
+func init() {
+	println("first")
+}
+
+func init(n int) int {
+	return n
+}
+
+func main() {
+}
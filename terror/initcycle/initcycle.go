@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+var total int = sum()
+
+var numbers []int = []int{1, 2, 3}
+
+// total refers to itself through sum
+func sum() int {
+	n := 0
+	for _, v := range numbers {
+		n = n + v
+	}
+	return n + total
+}
+
+func main() {
+	fmt.Printf("%d\n", total)
+}
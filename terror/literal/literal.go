@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+func main() {
+	a := 0x
+	b := 0b102
+	c := 089
+	d := 1__000
+	e := 100_
+	f := 0o8
+	s := "\q \x4g \400 \uD800 \'"
+	r := '\"'
+	r2 := 'ab'
+	r3 := ''
+	fmt.Printf("%d %d %d %d %d %d %s %d %d %d\n", a, b, c, d, e, f, s, r, r2, r3)
+	t := "abc
+	fmt.Printf("%s\n", t)
+	g := 99999999999999999999
+	h := 0x1_0000_0000_0000_0000
+	i := 9223372036854775807
+	j := 0x7fff_ffff_ffff_ffff
+	fmt.Printf("%d %d %d %d\n", g, h, i, j)
+	// upper case prefixes are valid, which gofmt rewrites in t/literal
+	fmt.Printf("%d %d %d\n", 0X1f, 0O17, 0B101)
+}
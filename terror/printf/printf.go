@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+const format = "%d %s\n"
+
+func main() {
+	var n int = 1
+	var s string = "a"
+	var buf []byte
+	fmt.Printf("%s\n", n)
+	fmt.Printf("%d %d\n", n)
+	fmt.Printf("%d\n", n, s)
+	fmt.Printf("hello\n", n)
+	fmt.Printf(format, s, n)
+	fmt.Printf("%y\n", n)
+	fmt.Printf("%5s %-3d %%\n", buf, n)
+	t := fmt.Sprintf("%c", s)
+	fmt.Printf("%s %d\n", t, t)
+	fmt.Printf("%")
+	var p *point
+	var ok bool = true
+	var ns []int
+	fmt.Printf("%v %T %t %q %U %v\n", p, p, n, s, n, ok)
+	fmt.Printf("%i %c %x\n", n, ok, ns)
+}
+
+type point struct {
+	x int
+}
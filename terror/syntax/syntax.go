@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+func f1(a int, b int) int {
+	x := a +
+	return x * b
+}
+
+func f2() {
+	var y int = (1 + 2
+	fmt.Printf("%d\n", y)
+}
+
+type T struct {
+	a int
+	1
+}
+
+func main() {
+	if f1(1, 2) == 3 {
+		fmt.Printf("ok\n")
+	} else x {
+	}
+	f2(
+}
@@ -0,0 +1,4 @@
+package main
+
+func f() {
+	x := 1 ==
\ No newline at end of file
@@ -0,0 +1,3 @@
+package main
+
+var x = f(
\ No newline at end of file
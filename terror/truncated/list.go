@@ -0,0 +1,4 @@
+package main
+
+func f() {
+	a, 
\ No newline at end of file
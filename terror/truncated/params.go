@@ -0,0 +1,3 @@
+package main
+
+func f(a int,
\ No newline at end of file
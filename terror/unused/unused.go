@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func f1() int {
+	x := 1
+	var y int
+	y = 2
+	for i := 0; i < 3; i++ {
+		z := i
+	}
+	fmt.Printf("f1\n")
+}
+
+func f2(b bool) int {
+	if b {
+		return 1
+	} else {
+		return 2
+	}
+}
+
+func f3(b bool) int {
+	for {
+		if b {
+			break
+		}
+	}
+}
+
+func f4(n int) int {
+	switch n {
+	case 1:
+		return 1
+	default:
+		panic("bad")
+	}
+}
+
+func main() {
+	a, err := f2(true), 0
+	b, err := f2(false), 1
+	fmt.Printf("%d %d %d\n", a, b, err)
+	f1()
+	f3(true)
+	f4(1)
+}
@@ -1,12 +1,233 @@
 #!/bin/bash
 
-./minigo terror/panic/panic.go > /tmp/out/a.s
+# build and run keep the compiled packages here
+export MINIGOCACHE=/tmp/out/cache
+rm -rf $MINIGOCACHE
 
-gcc -g -no-pie /tmp/out/a.s && ./a.out >/dev/null
+./minigo -S terror/panic/panic.go > /tmp/out/a.s
+
+gcc -g /tmp/out/a.s && ./a.out >/dev/null
 
 if [[ $? -ne 1 ]]; then
     echo "FAILED"
     exit 1
 fi
 
+# all syntax errors in a file should be reported
+num_errors=$(./minigo -S terror/syntax/syntax.go 2>&1 >/dev/null | grep -c "syntax error:")
+if [[ $num_errors -ne 5 ]]; then
+    echo "FAILED: expected 5 syntax errors, got $num_errors"
+    exit 1
+fi
+
+# files which end in the middle of a declaration
+rm -f /tmp/out/truncated.txt
+for name in binop list params call
+do
+    timeout 10 ./minigo -S terror/truncated/$name.go 2>&1 >/dev/null | grep "^terror/" >> /tmp/out/truncated.txt
+done
+if ! diff terror/expected/truncated.txt /tmp/out/truncated.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# imports after other declarations
+rm -f /tmp/out/importorder.txt
+for name in stray late
+do
+    timeout 10 ./minigo -S terror/importorder/$name.go 2>&1 >/dev/null | grep "^terror/" >> /tmp/out/importorder.txt
+done
+if ! diff terror/expected/importorder.txt /tmp/out/importorder.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# malformed literals
+./minigo -S terror/literal/literal.go 2>&1 >/dev/null | grep "^terror/" > /tmp/out/literal.txt
+if ! diff terror/expected/literal.txt /tmp/out/literal.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# unused variables and imports, and missing returns
+./minigo -S terror/unused/unused.go 2>&1 >/dev/null | grep "^terror/" > /tmp/out/unused.txt
+if ! diff terror/expected/unused.txt /tmp/out/unused.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# printf format checking
+./minigo -S terror/printf/printf.go 2>&1 >/dev/null | grep "^terror/" > /tmp/out/printf.txt
+if ! diff terror/expected/printf.txt /tmp/out/printf.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# unexported names of other packages
+for name in export export-name
+do
+    ./minigo -S terror/$name/*.go 2>&1 >/dev/null | grep "^terror/" > /tmp/out/$name.txt
+    if ! diff terror/expected/$name.txt /tmp/out/$name.txt; then
+        echo "FAILED"
+        exit 1
+    fi
+done
+
+# build loads the other packages from their export data, which has no unexported names,
+# and the second build finds the package in the cache
+rm -f /tmp/out/exportmod.txt
+for i in 1 2
+do
+    ./minigo build -o /tmp/out/exportmod.bin ./terror/exportmod 2>&1 | grep "^terror/" >> /tmp/out/exportmod.txt
+done
+if ! diff terror/expected/exportmod.txt /tmp/out/exportmod.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# the driver runs a program with the arguments and forwards its exit status
+./minigo run t/exit/exit.go foo bar > /tmp/out/exit.txt 2>/dev/null
+echo "exit status $?" >> /tmp/out/exit.txt
+./minigo build -o /tmp/out/exit.bin t/exit/exit.go 2>/dev/null
+/tmp/out/exit.bin baz >> /tmp/out/exit.txt
+echo "exit status $?" >> /tmp/out/exit.txt
+./minigo build -S -o /tmp/out/exit.s t/exit/exit.go
+grep -c "^main.main:" /tmp/out/exit.s >> /tmp/out/exit.txt
+if ! diff terror/expected/exit.txt /tmp/out/exit.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# escape analysis decisions
+./minigo -S -m -l t/escape/escape.go 2>&1 >/dev/null | grep "^t/" > /tmp/out/escape.txt
+if ! diff terror/expected/escape.txt /tmp/out/escape.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# inlining decisions
+./minigo -S -m t/inline/inline.go 2>&1 >/dev/null | grep "^t/" > /tmp/out/inline.txt
+if ! diff terror/expected/inline.txt /tmp/out/inline.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# build -m prints the same decisions again when the package is in the cache
+for i in 1 2
+do
+    ./minigo build -m -o /tmp/out/inline.bin t/inline/inline.go 2>&1 >/dev/null | grep "^t/" > /tmp/out/inline-build.txt
+    if ! diff terror/expected/inline.txt /tmp/out/inline-build.txt; then
+        echo "FAILED"
+        exit 1
+    fi
+done
+
+# functions and string literals left after dead code elimination
+./minigo -S -l t/deadcode/deadcode.go | grep -e "^main\." -e "never emitted" | grep -v "\.\.methods:" > /tmp/out/deadcode.txt
+if ! diff terror/expected/deadcode.txt /tmp/out/deadcode.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# the line table and the variables in the debug information
+./minigo -S t/debuginfo/debuginfo.go > /tmp/out/debuginfo.s
+gcc -g -o /tmp/out/debuginfo.bin /tmp/out/debuginfo.s 2>/dev/null
+readelf --debug-dump=decodedline /tmp/out/debuginfo.bin | awk '$1 == "debuginfo.go" && $2 != "-" {print "line", $2}' > /tmp/out/debuginfo.txt
+# the functions and the global variables of the main package with their children
+readelf --debug-dump=info /tmp/out/debuginfo.bin | awk '/^ <1>/ {top = 1; p = 0} top && /DW_AT_name/ {top = 0; p = ($4 ~ /^main\./ || $4 == "origin")} p && /DW_AT_name|DW_AT_decl_line|DW_AT_location/' | sed -e 's/^ *<[0-9a-f]*> *//' -e 's/: .*(\(.*\))$/: \1/' -e 's/DW_OP_addr: .*/DW_OP_addr/' >> /tmp/out/debuginfo.txt
+if ! diff terror/expected/debuginfo.txt /tmp/out/debuginfo.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# the types, the bindings and the sizes of symbols
+readelf -s --wide /tmp/out/debuginfo.bin | awk '$8 ~ /^main\./ || $8 == "origin" || $8 == "main" {print $4, $5, ($3 > 0), $8}' | sort -k4 > /tmp/out/symbols.txt
+if ! diff terror/expected/symbols.txt /tmp/out/symbols.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# the IR after each pass
+./minigo -S --dump-ir t/ir/ir.go 2>&1 >/dev/null | sed -n '/^# main.sum after lower/,/^# main.classify after lower/p' | grep -v "^# main.classify" > /tmp/out/ir.txt
+if ! diff terror/expected/ir.txt /tmp/out/ir.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# packages of a module are loaded from directories, and import cycles are errors
+./minigo run t/modules > /tmp/out/modules.txt
+# building several packages only checks them
+(cd t/modules && ../../minigo build ./... && ls) >> /tmp/out/modules.txt
+./minigo -S terror/cycle/cycle.go 2>&1 >/dev/null | grep "^terror/" >> /tmp/out/modules.txt
+if ! diff terror/expected/modules.txt /tmp/out/modules.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# malformed init functions and initialization cycles of package variables
+for name in init initcycle
+do
+    ./minigo -S terror/$name/$name.go 2>&1 >/dev/null | grep "^terror/" > /tmp/out/$name.txt
+    if ! diff terror/expected/$name.txt /tmp/out/$name.txt; then
+        echo "FAILED"
+        exit 1
+    fi
+done
+
+# GOGC sets the pace of the collector, GOGC=off or a negative value turns it off,
+# and a value which is not a number is read as 100
+rm -f /tmp/out/gogc.txt
+for gogc in 50 100 0 off -1 junk 12x ""
+do
+    echo "GOGC=$gogc" >> /tmp/out/gogc.txt
+    GOGC=$gogc ./minigo run t/gogc >> /tmp/out/gogc.txt
+done
+if ! diff terror/expected/gogc.txt /tmp/out/gogc.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# malformed //go:build lines, and build constraints which exclude every file
+rm -f /tmp/out/buildtag.txt
+for name in syntax twice windows
+do
+    ./minigo -S terror/buildtag/$name.go 2>&1 >/dev/null | grep "terror/" >> /tmp/out/buildtag.txt
+done
+# a package whose files are all excluded, imported and given as a directory
+./minigo -S terror/bc/main.go 2>&1 >/dev/null | grep "^terror/" >> /tmp/out/buildtag.txt
+./minigo build terror/bc/x 2>&1 | grep "terror/" >> /tmp/out/buildtag.txt
+if ! diff terror/expected/buildtag.txt /tmp/out/buildtag.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# the standard library and the runtime are read from a root directory if one is given
+rm -rf /tmp/out/root
+mkdir -p /tmp/out/root
+cp -r stdlib internal /tmp/out/root
+./minigo run --root /tmp/out/root t/hello/hello.go > /tmp/out/root.txt
+MINIGOROOT=/tmp/out/root ./minigo run t/hello/hello.go >> /tmp/out/root.txt
+printf 'func Broken() int {\n}\n' >> /tmp/out/root/stdlib/strings/strings.go
+./minigo -S --root /tmp/out/root t/strings/strings.go 2>&1 >/dev/null | grep "^/tmp/" >> /tmp/out/root.txt
+./minigo -S --root /tmp/out/noroot t/hello/hello.go 2>&1 >/dev/null | grep "^t/" >> /tmp/out/root.txt
+if ! diff terror/expected/root.txt /tmp/out/root.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
+# build and run compile a package only when it or a package it imports has changed
+export MINIGOCACHE=/tmp/out/cache-test
+rm -rf $MINIGOCACHE
+./minigo run -v t/modules 2>&1 >/dev/null | sed 's/^/first: /' > /tmp/out/cache.txt
+./minigo run -v t/modules 2>&1 >/dev/null | sed 's/^/again: /' >> /tmp/out/cache.txt
+rm -rf /tmp/out/cachemod
+cp -r t/modules /tmp/out/cachemod
+./minigo run -v /tmp/out/cachemod 2>&1 >/dev/null | sed 's/^/copied: /' >> /tmp/out/cache.txt
+echo "// changed" >> /tmp/out/cachemod/greet/greet.go
+./minigo run -v /tmp/out/cachemod 2>&1 >/dev/null | sed 's/^/changed: /' >> /tmp/out/cache.txt
+if ! diff terror/expected/cache.txt /tmp/out/cache.txt; then
+    echo "FAILED"
+    exit 1
+fi
+
 echo "ok"
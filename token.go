@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"strconv"
 )
 
 // https://golang.org/ref/spec#Keywords
@@ -33,19 +32,30 @@ type Token struct {
 	filename string
 	line     int
 	column   int
+	pragmas  []string // directives like "go:noinline" in the lines before the token
 }
 
 type TokenStream struct {
-	tokens []*Token
-	index  int
+	tokens  []*Token
+	index   int
+	overrun int      // the number of tokens skipped at the end
+	eof     *Token   // the end of the source
+	errors  []string // lexical errors
 }
 
 func NewTokenStream(bs *ByteStream) *TokenStream {
-	tokens := Tokenize(bs)
+	tokens, errors := Tokenize(bs)
 	assert(len(tokens) > 0, nil, "tokens should have length")
 	return &TokenStream{
 		tokens: tokens,
 		index:  0,
+		eof: &Token{
+			typ:      T_EOF,
+			filename: bs.filename,
+			line:     bs.line,
+			column:   bs.column + 1,
+		},
+		errors: errors,
 	}
 
 }
@@ -82,8 +92,17 @@ func (tok *Token) getIdent() identifier {
 	return identifier(tok.sval)
 }
 
+// the value of an integer literal, or of a rune literal whose sval is in decimal
 func (tok *Token) getIntval() int {
-	val, _ := strconv.Atoi(tok.sval)
+	base, digits := intLiteralBase(tok.sval)
+	var val int
+	for i := 0; i < len(digits); i++ {
+		c := digits[i]
+		if c == '_' {
+			continue
+		}
+		val = val*base + digitVal(c)
+	}
 	return val
 }
 
@@ -115,6 +134,25 @@ func (tok *Token) isSemicolon() bool {
 	return tok.isPunct(";")
 }
 
+// describe the token for error messages
+func (tok *Token) describe() string {
+	switch {
+	case tok.isEOF():
+		return "EOF"
+	case tok.isSemicolon():
+		return "semicolon or newline"
+	case tok.isTypeString():
+		return "literal \"" + escapeString(tok.sval) + "\""
+	case tok.isTypeInt(), tok.isTypeChar():
+		return "literal " + tok.sval
+	case tok.isTypeIdent():
+		return "name " + tok.sval
+	case tok.isTypeKeyword():
+		return "keyword " + tok.sval
+	}
+	return tok.sval
+}
+
 /**
 
  Operators and punctuation
@@ -129,11 +167,6 @@ func (tok *Token) isSemicolon() bool {
 
 */
 
-var semicolonToken = Token{
-	typ:  "punct", // @FIXME: should be T_PUNCT
-	sval: ";",
-}
-
 func (tok *Token) dump() {
 	var s string = fmt.Sprintf("tok: line=%d, type=%s, sval=\"%s\"\n", tok.line, tok.typ, tok.sval)
 	var b []byte = []byte(s)
@@ -4,6 +4,104 @@ import "fmt"
 
 type Tokenizer struct {
 	bs *ByteStream
+	// position of the first byte of the current token
+	line   int
+	column int
+	errors []string
+	// directives waiting for the next token
+	pragmas []string
+}
+
+func (tn *Tokenizer) syntaxError(line int, column int, msg string) {
+	tn.error(line, column, "syntax error: "+msg)
+}
+
+func (tn *Tokenizer) error(line int, column int, msg string) {
+	tn.errors = append(tn.errors, fmt.Sprintf("%s:%d:%d: %s", tn.bs.filename, line, column, msg))
+}
+
+// the value of a hexadecimal digit, or 16 if c is not a digit
+func digitVal(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return 16
+}
+
+// the base and the digits of an integer literal
+func intLiteralBase(s string) (int, string) {
+	if len(s) >= 2 && s[0] == '0' {
+		prefix := s[1]
+		switch prefix {
+		case 'x', 'X':
+			return 16, s[2:]
+		case 'b', 'B':
+			return 2, s[2:]
+		case 'o', 'O':
+			return 8, s[2:]
+		}
+		// legacy octal like 0600
+		return 8, s[1:]
+	}
+	return 10, s
+}
+
+// https://golang.org/ref/spec#Integer_literals
+// returns an error message, or "" if the literal is valid
+func checkIntLiteral(s string) string {
+	base, digits := intLiteralBase(s)
+	var kind string
+	switch base {
+	case 16:
+		kind = "hexadecimal"
+	case 8:
+		kind = "octal"
+	case 2:
+		kind = "binary"
+	default:
+		kind = "decimal"
+	}
+	if len(digits) == 0 {
+		return kind + " literal has no digits"
+	}
+	for i := 0; i < len(digits); i++ {
+		c := digits[i]
+		if c == '_' {
+			// a separator may follow the prefix
+			if i == len(digits)-1 || digits[i+1] == '_' {
+				return "'_' must separate successive digits"
+			}
+			continue
+		}
+		if digitVal(c) >= base {
+			return fmt.Sprintf("invalid digit '%c' in %s literal", c, kind)
+		}
+	}
+	return ""
+}
+
+const maxInt int = 9223372036854775807
+
+// whether a valid integer literal is too large for int, which is the only integer type
+func intLiteralOverflows(s string) bool {
+	base, digits := intLiteralBase(s)
+	var val int
+	for i := 0; i < len(digits); i++ {
+		if digits[i] == '_' {
+			continue
+		}
+		d := digitVal(digits[i])
+		if val > (maxInt-d)/base {
+			return true
+		}
+		val = val*base + d
+	}
+	return false
 }
 
 func (tn *Tokenizer) read_number(c0 byte) string {
@@ -11,16 +109,24 @@ func (tn *Tokenizer) read_number(c0 byte) string {
 	for {
 		c, err := tn.bs.get()
 		if err != nil {
-			return string(chars)
+			break
 		}
-		if tn.isUnicodeDigit(c) {
+		// read letters as well to report invalid digits
+		if tn.isLetter(c) || tn.isUnicodeDigit(c) {
 			chars = append(chars, c)
-			continue
 		} else {
 			tn.bs.unget()
-			return string(chars)
+			break
 		}
 	}
+	sval := string(chars)
+	msg := checkIntLiteral(sval)
+	if msg != "" {
+		tn.syntaxError(tn.line, tn.column, msg)
+	} else if intLiteralOverflows(sval) {
+		tn.error(tn.line, tn.column, "constant "+sval+" overflows int")
+	}
+	return sval
 }
 
 // https://golang.org/ref/spec#unicode_letter
@@ -58,100 +164,216 @@ func (tn *Tokenizer) readIdentifier(c0 byte) string {
 	}
 }
 
-func (tn *Tokenizer) read_string() string {
-	var chars []byte
-	for {
+// append the UTF-8 encoding of a code point
+func appendRune(chars []byte, r int) []byte {
+	switch {
+	case r < 0x80:
+		chars = append(chars, byte(r))
+	case r < 0x800:
+		chars = append(chars, byte(0xc0+r/64))
+		chars = append(chars, byte(0x80+r%64))
+	case r < 0x10000:
+		chars = append(chars, byte(0xe0+r/4096))
+		chars = append(chars, byte(0x80+(r/64)%64))
+		chars = append(chars, byte(0x80+r%64))
+	default:
+		chars = append(chars, byte(0xf0+r/262144))
+		chars = append(chars, byte(0x80+(r/4096)%64))
+		chars = append(chars, byte(0x80+(r/64)%64))
+		chars = append(chars, byte(0x80+r%64))
+	}
+	return chars
+}
+
+// read n digits of an escape sequence in base
+func (tn *Tokenizer) readEscapeDigits(n int, base int, kind string) int {
+	var val int
+	for i := 0; i < n; i++ {
 		c, err := tn.bs.get()
 		if err != nil {
-			panic("invalid string literal")
+			tn.syntaxError(tn.bs.line, tn.bs.column, "escape sequence not terminated")
+			return val
 		}
-		if c == '\\' {
-			chars = append(chars, c)
-			c, err = tn.bs.get()
-			chars = append(chars, c)
-			continue
+		d := digitVal(c)
+		if d >= base {
+			tn.syntaxError(tn.bs.line, tn.bs.column, fmt.Sprintf("invalid character '%c' in %s escape", c, kind))
+			// the character may be the closing quote
+			tn.bs.unget()
+			return val
 		}
-		if c == '\n' {
-			chars = append(chars, '\\')
-			chars = append(chars, 'n')
-			continue
+		val = val*base + d
+	}
+	return val
+}
+
+// https://golang.org/ref/spec#Rune_literals
+// read an escape sequence after a backslash and return its value.
+// isByte is true for octal and hexadecimal escapes, which denote a byte rather than a code point.
+func (tn *Tokenizer) readEscape(quote byte) (int, bool) {
+	line := tn.bs.line
+	column := tn.bs.column
+	c, err := tn.bs.get()
+	if err != nil {
+		tn.syntaxError(line, column, "escape sequence not terminated")
+		return 0, false
+	}
+	switch c {
+	case 'a':
+		return 7, false
+	case 'b':
+		return 8, false
+	case 'f':
+		return 12, false
+	case 'n':
+		return 10, false
+	case 'r':
+		return 13, false
+	case 't':
+		return 9, false
+	case 'v':
+		return 11, false
+	case '\\':
+		return int(c), false
+	case '\'', '"':
+		if c != quote {
+			tn.syntaxError(line, column, "unknown escape")
 		}
-		if c != '"' {
-			chars = append(chars, c)
-			continue
-		} else {
-			return string(chars)
+		return int(c), false
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		tn.bs.unget()
+		val := tn.readEscapeDigits(3, 8, "octal")
+		if val > 255 {
+			tn.syntaxError(line, column, fmt.Sprintf("octal escape value %d > 255", val))
+		}
+		return val, true
+	case 'x':
+		return tn.readEscapeDigits(2, 16, "hexadecimal"), true
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		val := tn.readEscapeDigits(n, 16, "hexadecimal")
+		if val > 0x10ffff || (0xd800 <= val && val < 0xe000) {
+			tn.syntaxError(line, column, fmt.Sprintf("escape is invalid Unicode code point U+%04X", val))
 		}
+		return val, false
 	}
+	tn.syntaxError(line, column, "unknown escape")
+	return int(c), false
 }
 
-func (tn *Tokenizer) read_raw_string() string {
+// read the rest of a UTF-8 encoded character
+func (tn *Tokenizer) readUTF8(c0 byte) int {
+	var n int
+	var val int
+	switch {
+	case c0 >= 0xf0:
+		n = 3
+		val = int(c0 - 0xf0)
+	case c0 >= 0xe0:
+		n = 2
+		val = int(c0 - 0xe0)
+	case c0 >= 0xc0:
+		n = 1
+		val = int(c0 - 0xc0)
+	default:
+		return int(c0)
+	}
+	for i := 0; i < n; i++ {
+		c, err := tn.bs.get()
+		if err != nil {
+			break
+		}
+		// not a continuation byte
+		if c < 0x80 || c >= 0xc0 {
+			tn.bs.unget()
+			break
+		}
+		val = val*64 + int(c-0x80)
+	}
+	return val
+}
+
+// The value of a string literal is the bytes it denotes, with escapes decoded.
+func (tn *Tokenizer) read_string() string {
 	var chars []byte
 	for {
 		c, err := tn.bs.get()
 		if err != nil {
-			panic("invalid string literal")
+			tn.syntaxError(tn.line, tn.column, "string literal not terminated")
+			return string(chars)
 		}
-		if c == '\\' {
-			// @FIXME
-			chars = append(chars, c)
-			c, err = tn.bs.get()
-			chars = append(chars, c)
-			continue
+		if c == '\n' {
+			tn.syntaxError(tn.line, tn.column, "newline in string")
+			tn.bs.unget()
+			return string(chars)
 		}
 		if c == '"' {
-			chars = append(chars, '\\')
-			chars = append(chars, c)
-			continue
+			return string(chars)
 		}
-		if c != '`' {
-			if c == '\n' {
-				chars = append(chars, '\\')
-				chars = append(chars, 'n')
+		if c == '\\' {
+			val, isByte := tn.readEscape('"')
+			if isByte {
+				chars = append(chars, byte(val))
 			} else {
-				chars = append(chars, c)
+				chars = appendRune(chars, val)
 			}
 			continue
-		} else {
+		}
+		chars = append(chars, c)
+	}
+}
+
+func (tn *Tokenizer) read_raw_string() string {
+	var chars []byte
+	for {
+		c, err := tn.bs.get()
+		if err != nil {
+			tn.syntaxError(tn.line, tn.column, "raw string literal not terminated")
 			return string(chars)
 		}
+		if c == '`' {
+			return string(chars)
+		}
+		// carriage returns are discarded from raw strings
+		if c != '\r' {
+			chars = append(chars, c)
+		}
 	}
 }
 
+// The value of a rune literal is its code point in decimal.
 func (tn *Tokenizer) read_char() string {
-	c, err := tn.bs.get()
-	if err != nil {
-		panic("invalid char literal")
-	}
-	if c == '\\' {
-		var sval string
-		c, err = tn.bs.get()
-		switch c {
-		case 'n':
-			sval = "\n"
-		case 't':
-			sval = "\t"
-		case 'r':
-			sval = "\r"
-		case '\\':
-			sval = "\\"
-		case '\'':
-			sval = "'"
-		default:
-			errorf("unexpected char 1:%c", c)
+	var val int
+	var n int // number of characters
+	for {
+		c, err := tn.bs.get()
+		if err != nil {
+			tn.syntaxError(tn.line, tn.column, "rune literal not terminated")
+			break
 		}
-
-		end, _ := tn.bs.get()
-		if end != '\'' {
-			errorf("unexpected char 2:%c", end)
+		if c == '\n' {
+			tn.syntaxError(tn.line, tn.column, "newline in rune literal")
+			tn.bs.unget()
+			break
+		}
+		if c == '\'' {
+			if n == 0 {
+				tn.syntaxError(tn.line, tn.column, "empty rune literal or unescaped ' in rune literal")
+			} else if n > 1 {
+				tn.syntaxError(tn.line, tn.column, "more than one character in rune literal")
+			}
+			break
+		}
+		n++
+		if c == '\\' {
+			val, _ = tn.readEscape('\'')
+		} else {
+			val = tn.readUTF8(c)
 		}
-		return sval
-	}
-	end, _ := tn.bs.get()
-	if end != '\'' {
-		errorf("unexpected char:%c", end)
 	}
-	return string([]byte{c})
+	return fmt.Sprintf("%d", val)
 }
 
 func (tn *Tokenizer) isSpace(c byte) bool {
@@ -174,13 +396,16 @@ func (tn *Tokenizer) skipSpace() {
 }
 
 func (tn *Tokenizer) makeToken(typ TokenType, sval string) *Token {
-	return &Token{
+	tok := &Token{
 		typ:      typ,
 		sval:     sval,
 		filename: tn.bs.filename,
-		line:     tn.bs.line,
-		column:   tn.bs.column,
+		line:     tn.line,
+		column:   tn.column,
+		pragmas:  tn.pragmas,
 	}
+	tn.pragmas = nil
+	return tok
 }
 
 // https://golang.org/ref/spec#Semicolons
@@ -202,13 +427,20 @@ func (tn *Tokenizer) autoSemicolonInsert(last *Token) bool {
 	return false
 }
 
-func (tn *Tokenizer) skipLine() {
+// a line comment like //go:noinline at the start of a line is a directive
+func (tn *Tokenizer) readLineComment() {
+	isDirective := tn.column == 1
+	var buf []byte
 	for {
 		c, err := tn.bs.get()
 		if err != nil || c == '\n' {
 			tn.bs.unget()
-			return
+			break
 		}
+		buf = append(buf, c)
+	}
+	if isDirective && len(buf) > 3 && buf[0] == 'g' && buf[1] == 'o' && buf[2] == ':' {
+		tn.pragmas = append(tn.pragmas, string(buf))
 	}
 }
 
@@ -237,6 +469,8 @@ func (tn *Tokenizer) tokenize() []*Token {
 		if err != nil {
 			return r
 		}
+		tn.line = tn.bs.line
+		tn.column = tn.bs.column
 		var tok *Token
 		switch c {
 		case 0: // no need?
@@ -246,7 +480,15 @@ func (tn *Tokenizer) tokenize() []*Token {
 			if len(r) > 0 {
 				last := r[len(r)-1]
 				if tn.autoSemicolonInsert(last) {
-					r = append(r, &semicolonToken)
+					// give it the position of the last token for error messages
+					semicolon := &Token{
+						typ:      T_PUNCT,
+						sval:     ";",
+						filename: last.filename,
+						line:     last.line,
+						column:   last.column,
+					}
+					r = append(r, semicolon)
 				}
 			}
 			continue
@@ -276,7 +518,7 @@ func (tn *Tokenizer) tokenize() []*Token {
 		case '/':
 			c, _ = tn.bs.get()
 			if c == '/' {
-				tn.skipLine()
+				tn.readLineComment()
 				continue
 			} else if c == '*' {
 				tn.skipBlockComment()
@@ -442,9 +684,10 @@ func (tn *Tokenizer) tokenize() []*Token {
 	}
 }
 
-func Tokenize(bs *ByteStream) []*Token {
+func Tokenize(bs *ByteStream) ([]*Token, []string) {
 	var tn = &Tokenizer{
 		bs: bs,
 	}
-	return tn.tokenize()
+	tokens := tn.tokenize()
+	return tokens, tn.errors
 }
@@ -20,9 +20,11 @@ obj_file=$out_dir/${basename}.o
 actual=$out_dir/actual.txt
 # for os.Args
 ARGS=t/data/sample.txt
+# e.g. MINIGOFLAGS=-O0
+MINIGOFLAGS=${MINIGOFLAGS:-}
 
 function compile {
-    ./${progname} $src > $as_file
+    ./${progname} -S $MINIGOFLAGS $src > $as_file
 }
 
 function as_run {
@@ -30,7 +32,7 @@ function as_run {
     as -o $obj_file $as_file
     # gave up direct invocation of "ld"
     # https://stackoverflow.com/questions/33970159/bash-a-out-no-such-file-or-directory-on-running-executable-produced-by-ld
-    gcc -no-pie -o $bin_file $obj_file
+    gcc -o $bin_file $obj_file
     $bin_file $ARGS > $actual
     diff -uq $expected $actual
 }
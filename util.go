@@ -31,3 +31,48 @@ func in_array(item string, list []string) bool {
 	}
 	return false
 }
+
+// escape a string for string directives of the assembler and for messages
+func escapeString(s string) string {
+	var chars []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' {
+			chars = append(chars, '\\')
+			chars = append(chars, c)
+		} else if c < ' ' || c > '~' {
+			// a 3 digit octal escape
+			chars = append(chars, '\\')
+			chars = append(chars, '0'+c/64)
+			chars = append(chars, '0'+(c/8)%8)
+			chars = append(chars, '0'+c%8)
+		} else {
+			chars = append(chars, c)
+		}
+	}
+	return string(chars)
+}
+
+// sortStrings sorts a small slice in place by insertion
+func sortStrings(a []string) {
+	for i := 1; i < len(a); i++ {
+		s := a[i]
+		j := i
+		for ; j > 0 && a[j-1] > s; j-- {
+			a[j] = a[j-1]
+		}
+		a[j] = s
+	}
+}
+
+// joinStrings concatenates the elements with sep between them
+func joinStrings(elems []string, sep string) string {
+	var r string
+	for i, s := range elems {
+		if i > 0 {
+			r = r + sep
+		}
+		r = r + s
+	}
+	return r
+}
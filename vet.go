@@ -0,0 +1,242 @@
+package main
+
+import "fmt"
+
+// vet-like check of format strings of printf family calls.
+// libc sprintf trusts the format, so a mismatch crashes at runtime.
+
+// the name of the printf family function which is called, or "" if it is not
+func formatFuncName(call *ExprFuncallOrConversion) string {
+	if call.rel == nil || call.rel.expr == nil {
+		return ""
+	}
+	funcref, ok := call.rel.expr.(*ExprFuncRef)
+	if !ok || funcref.funcdef == nil {
+		return ""
+	}
+	pkg := funcref.funcdef.pkg
+	if pkg == "libc" && call.fname == "printf" {
+		return "printf"
+	}
+	if pkg == "fmt" && (call.fname == "Printf" || call.fname == "Sprintf") {
+		return "fmt." + call.fname
+	}
+	return ""
+}
+
+// the format string if it is a constant
+func constFormat(e Expr) (string, bool) {
+	switch e.(type) {
+	case *ExprStringLiteral:
+		return e.(*ExprStringLiteral).val, true
+	case *Relation:
+		rel := e.(*Relation)
+		if rel.expr != nil {
+			return constFormat(rel.expr)
+		}
+	case *ExprConstVariable:
+		cnst := e.(*ExprConstVariable)
+		if cnst.val != nil {
+			return constFormat(cnst.val)
+		}
+	}
+	return "", false
+}
+
+func pluralArgs(n int) string {
+	if n == 1 {
+		return "1 arg"
+	}
+	return fmt.Sprintf("%d args", n)
+}
+
+// type name for messages
+func typeName(gtype *Gtype) string {
+	if gtype == nil {
+		return "unknown type"
+	}
+	switch gtype.kind {
+	case G_NAMED:
+		return string(gtype.relation.name)
+	case G_POINTER:
+		return "*" + typeName(gtype.origType)
+	case G_SLICE:
+		return "[]" + typeName(gtype.elementType)
+	case G_ARRAY:
+		return fmt.Sprintf("[%d]%s", gtype.length, typeName(gtype.elementType))
+	case G_MAP:
+		return fmt.Sprintf("map[%s]%s", typeName(gtype.mapKey), typeName(gtype.mapValue))
+	}
+	return gtype.String()
+}
+
+func isFlag(c byte) bool {
+	return c == '#' || c == '0' || c == '-' || c == '+' || c == ' '
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// whether a value of gtype can be printed by the verb.
+// fmt formats strings, booleans and the verbs which libc does not know in Go,
+// and the rest by libc. libc printf takes a bool as an integer.
+func matchVerb(fname string, verb byte, gtype *Gtype) bool {
+	kind := gtype.getKind()
+	switch kind {
+	case G_UNKOWNE, G_DEPENDENT, G_INTERFACE:
+		// the type is not known statically
+		return true
+	}
+	isInteger := kind == G_INT || kind == G_BYTE
+	isString := kind == G_STRING
+	// fmt prints []byte and [n]byte, but not named types whose methods are not called
+	isBytes := (gtype.kind == G_SLICE || gtype.kind == G_ARRAY) && gtype.elementType.getKind() == G_BYTE
+	if fname == "printf" {
+		switch verb {
+		case 'd', 'i', 'o', 'u', 'x', 'X', 'c':
+			return isInteger || kind == G_BOOL
+		case 's':
+			return isString
+		case 'p':
+			return kind == G_POINTER
+		}
+		return false
+	}
+	switch verb {
+	case 'd':
+		// bool is an integer at runtime, and is printed by %d unlike Go
+		return isInteger || kind == G_BOOL
+	case 'v':
+		// Go prints a pointer to a named type like &{...}, which is not supported
+		isAddress := kind == G_POINTER && gtype.Underlying().origType.kind != G_NAMED
+		return isInteger || isString || isBytes || kind == G_BOOL || isAddress
+	case 'T':
+		return true
+	case 'o', 'b', 'c', 'U':
+		return isInteger
+	case 'x', 'X', 'q':
+		return isInteger || isString || isBytes
+	case 's':
+		return isString || isBytes
+	case 't':
+		return kind == G_BOOL
+	case 'p':
+		return kind == G_POINTER || kind == G_FUNC
+	}
+	return false
+}
+
+// the verbs which the runtime can print
+func isKnownVerb(fname string, verb byte) bool {
+	verbs := "vTdoxXcbUqstp"
+	if fname == "printf" {
+		verbs = "diouxXcsp"
+	}
+	for i := 0; i < len(verbs); i++ {
+		if verbs[i] == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// check a format string against the arguments
+func checkFormatCall(call *ExprFuncallOrConversion) []string {
+	var errors []string
+	fname := formatFuncName(call)
+	if fname == "" || len(call.args) == 0 {
+		return nil
+	}
+	format, ok := constFormat(call.args[0])
+	if !ok {
+		return nil
+	}
+	args := call.args[1:]
+	for _, arg := range args {
+		if _, isVaArg := arg.(*ExprVaArg); isVaArg {
+			// args are unknown
+			return nil
+		}
+	}
+	tok := call.rel.token()
+
+	var argIndex int // number of args consumed
+	var numDirectives int
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		var directive []byte
+		directive = append(directive, '%')
+		i++
+		for i < len(format) && isFlag(format[i]) {
+			directive = append(directive, format[i])
+			i++
+		}
+		// width and precision
+		for i < len(format) && (isDigit(format[i]) || format[i] == '.' || format[i] == '*') {
+			if format[i] == '*' {
+				argIndex++
+				if argIndex <= len(args) && !matchVerb(fname, 'd', args[argIndex-1].getGtype()) {
+					errors = append(errors, errorAt(tok, fmt.Sprintf("%s format %s uses non-int arg #%d as width", fname, string(directive)+"*", argIndex)))
+				}
+			}
+			directive = append(directive, format[i])
+			i++
+		}
+		if i >= len(format) {
+			errors = append(errors, errorAt(tok, fmt.Sprintf("%s format %s is missing verb at end of string", fname, string(directive))))
+			break
+		}
+		if format[i] == '[' {
+			// explicit argument indexes are not checked
+			return errors
+		}
+		verb := format[i]
+		directive = append(directive, verb)
+		if verb == '%' {
+			continue
+		}
+		numDirectives++
+		argIndex++
+		if !isKnownVerb(fname, verb) {
+			errors = append(errors, errorAt(tok, fmt.Sprintf("%s format %s has unknown verb %c", fname, string(directive), verb)))
+			continue
+		}
+		if argIndex > len(args) {
+			errors = append(errors, errorAt(tok, fmt.Sprintf("%s format %s reads arg #%d, but call has %s", fname, string(directive), argIndex, pluralArgs(len(args)))))
+			continue
+		}
+		arg := args[argIndex-1]
+		gtype := arg.getGtype()
+		if !matchVerb(fname, verb, gtype) {
+			argTok := arg.token()
+			if argTok == nil {
+				argTok = tok
+			}
+			errors = append(errors, errorAt(argTok, fmt.Sprintf("%s format %s has arg #%d of wrong type %s", fname, string(directive), argIndex, typeName(gtype))))
+		}
+	}
+
+	if numDirectives == 0 && len(args) > 0 {
+		errors = append(errors, errorAt(tok, fmt.Sprintf("%s call has arguments but no formatting directives", fname)))
+	} else if argIndex < len(args) {
+		errors = append(errors, errorAt(tok, fmt.Sprintf("%s call needs %s but has %s", fname, pluralArgs(argIndex), pluralArgs(len(args)))))
+	}
+	return errors
+}
+
+// check all the printf family calls in a package
+func checkFormatCalls(pkg *AstPackage) []string {
+	var errors []string
+	for _, f := range pkg.files {
+		for _, call := range f.formatCalls {
+			errs := checkFormatCall(call)
+			for _, e := range errs {
+				errors = append(errors, e)
+			}
+		}
+	}
+	return errors
+}